@@ -0,0 +1,173 @@
+// Command generate writes the CRDs, the ValidatingWebhookConfiguration and the ClusterRole
+// in configs from the kubebuilder markers of the operator's packages, with controller-gen's
+// generators. It is its own module so its dependencies stay out of the operator's; run it
+// with `go generate ./...` from the repository root.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strings"
+
+	"sigs.k8s.io/controller-tools/pkg/crd"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/rbac"
+	"sigs.k8s.io/controller-tools/pkg/webhook"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	roleName           = "my-app-controller"
+	operatorNS         = "default"
+	webhookService     = "my-app-controller-webhook"
+	webhookCertificate = operatorNS + "/my-app-controller-webhook"
+)
+
+// documentSeparator separates the objects of a YAML stream. Separators in indented block
+// scalars, like the ones in the descriptions of metav1.Condition, don't count.
+var documentSeparator = regexp.MustCompile(`(?m)^---\n`)
+
+// crdFiles maps the files the CRD generator writes to the ones in configs/crd.
+var crdFiles = map[string]string{
+	"example.com_myapps.yaml":             "app.yaml",
+	"example.com_myappaudits.yaml":        "audit.yaml",
+	"example.com_myappbackups.yaml":       "backup.yaml",
+	"example.com_myapprestores.yaml":      "restore.yaml",
+	"example.com_myapppreviews.yaml":      "preview.yaml",
+	"example.com_myapptemplates.yaml":     "template.yaml",
+	"example.com_maintenancewindows.yaml": "maintenance.yaml",
+}
+
+func main() {
+	root := flag.String("root", ".", "Repository root.")
+	flag.Parse()
+
+	if err := generate(*root); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func generate(root string) error {
+	configs := filepath.Join(root, "configs")
+	crdGen := genall.Generator(crd.Generator{})
+	rbacGen := genall.Generator(rbac.Generator{RoleName: roleName})
+	webhookGen := genall.Generator(webhook.Generator{})
+
+	// Packages are loaded relative to the working directory.
+	if err := os.Chdir(root); err != nil {
+		return err
+	}
+	rt, err := genall.Generators{&crdGen, &rbacGen, &webhookGen}.ForRoots("./pkg/...")
+	if err != nil {
+		return err
+	}
+	rt.OutputRules = genall.OutputRules{
+		Default: genall.OutputToNothing,
+		ByGenerator: map[*genall.Generator]genall.OutputRule{
+			&crdGen:     renamedOutput{dir: "configs/crd", names: crdFiles, transform: stampVersion},
+			&rbacGen:    renamedOutput{dir: "configs", names: map[string]string{"role.yaml": "role.yaml"}},
+			&webhookGen: renamedOutput{dir: "configs", names: map[string]string{"manifests.yaml": "webhook_configuration.yaml"}, transform: deployedWebhook},
+		},
+	}
+	if failed := rt.Run(); failed {
+		return fmt.Errorf("generating %s failed", configs)
+	}
+	return nil
+}
+
+// renamedOutput writes the artifacts of a generator to dir under the name they are mapped
+// to. Artifacts without a name are an error, so a new API type isn't silently dropped.
+type renamedOutput struct {
+	dir       string
+	names     map[string]string
+	transform func(obj map[string]interface{})
+}
+
+func (o renamedOutput) Open(_ *loader.Package, itemPath string) (io.WriteCloser, error) {
+	name, ok := o.names[itemPath]
+	if !ok {
+		return nil, fmt.Errorf("no file in %s for generated %s", o.dir, itemPath)
+	}
+	return &transformingFile{path: filepath.Join(o.dir, name), transform: o.transform}, nil
+}
+
+// transformingFile buffers a generated YAML stream and applies transform to each of its
+// objects on Close.
+type transformingFile struct {
+	bytes.Buffer
+	path      string
+	transform func(obj map[string]interface{})
+}
+
+func (f *transformingFile) Close() error {
+	data := f.Bytes()
+	if f.transform != nil {
+		var out bytes.Buffer
+		for _, doc := range documentSeparator.Split(string(data), -1) {
+			if strings.TrimSpace(doc) == "" {
+				continue
+			}
+			obj := map[string]interface{}{}
+			if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+				return fmt.Errorf("parsing %s: %w", f.path, err)
+			}
+			f.transform(obj)
+			b, err := yaml.Marshal(obj)
+			if err != nil {
+				return err
+			}
+			out.WriteString("---\n")
+			out.Write(b)
+		}
+		data = out.Bytes()
+	}
+	return os.WriteFile(f.path, data, 0o644)
+}
+
+// stampVersion records the controller-tools version that generated a CRD. controller-gen
+// can't tell when it isn't the main module and writes "(devel)".
+func stampVersion(obj map[string]interface{}) {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if annotations == nil {
+		return
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == "sigs.k8s.io/controller-tools" {
+			annotations["controller-gen.kubebuilder.io/version"] = dep.Version
+		}
+	}
+}
+
+// deployedWebhook points the generated webhook configuration at the operator's Service and
+// has cert-manager inject the CA of its serving certificate.
+func deployedWebhook(obj map[string]interface{}) {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+		obj["metadata"] = metadata
+	}
+	metadata["name"] = roleName
+	metadata["annotations"] = map[string]interface{}{"cert-manager.io/inject-ca-from": webhookCertificate}
+	webhooks, _ := obj["webhooks"].([]interface{})
+	for _, w := range webhooks {
+		w, _ := w.(map[string]interface{})
+		clientConfig, _ := w["clientConfig"].(map[string]interface{})
+		if service, ok := clientConfig["service"].(map[string]interface{}); ok {
+			service["name"] = webhookService
+			service["namespace"] = operatorNS
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	"github.com/steeling/controller-runtime-exercise/pkg/controller"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/yaml"
+)
+
+// export writes the children the controller renders for the MyApps of the cluster to a
+// directory, one file per child in <dir>/<namespace>/<MyApp>/, e.g. to commit them to Git.
+// Every exported MyApp's directory is replaced, so children it no longer renders disappear.
+func export(args []string) int {
+	var opts controller.Options
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s export [flags]\n\nWrites the children the controller renders for the cluster's MyApps to a directory.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	dir := fs.String("dir", "export", "Directory the children are written to.")
+	namespace := fs.String("n", "", "Namespace whose MyApps are exported. All namespaces when empty.")
+	selector := fs.String("l", "", "Label selector of the MyApps exported, e.g. team=platform. All MyApps when empty.")
+	detach := fs.Bool("detach", false, "Drop the owner references to the MyApps and the controller's annotations, so the children can be applied without the operator.")
+	renderFlags(fs, &opts)
+	_ = fs.Parse(args)
+
+	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	log := ctrl.Log.WithName("export")
+	ctx := ctrl.SetupSignalHandler()
+
+	listOpts := []client.ListOption{client.InNamespace(*namespace)}
+	if *selector != "" {
+		s, err := labels.Parse(*selector)
+		if err != nil {
+			log.Error(err, "invalid label selector")
+			return exitConfigError
+		}
+		listOpts = append(listOpts, client.MatchingLabelsSelector{Selector: s})
+	}
+
+	// Children are rendered against the cluster's objects, read directly.
+	c, code := newClusterClient(log)
+	if c == nil {
+		return code
+	}
+	renderer, err := controller.NewRenderer(opts, c)
+	if err != nil {
+		log.Error(err, "unable to set up rendering")
+		var configErr *controller.ConfigError
+		if errors.As(err, &configErr) {
+			return exitConfigError
+		}
+		return exitRuntimeError
+	}
+
+	apps := &api.MyAppList{}
+	if err := c.List(ctx, apps, listOpts...); err != nil {
+		log.Error(err, "unable to list MyApps")
+		return exitRuntimeError
+	}
+	for i := range apps.Items {
+		app := &apps.Items[i]
+		if err := exportApp(ctx, renderer, app, filepath.Join(*dir, app.Namespace, app.Name), *detach); err != nil {
+			// The other MyApps are exported anyway.
+			log.Error(err, "unable to export MyApp", "namespace", app.Namespace, "name", app.Name)
+			code = exitRuntimeError
+			continue
+		}
+		log.Info("exported MyApp", "namespace", app.Namespace, "name", app.Name)
+	}
+	return code
+}
+
+// exportApp replaces dir with the children of app.
+func exportApp(ctx context.Context, renderer *controller.Renderer, app *api.MyApp, dir string, detach bool) error {
+	objects, err := renderer.Render(ctx, app)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if detach {
+			controller.Detach(obj)
+		}
+		data, err := exportManifest(obj)
+		if err != nil {
+			return fmt.Errorf("encoding %s %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+		}
+		name := strings.ToLower(obj.GetObjectKind().GroupVersionKind().Kind) + "-" + obj.GetName() + ".yaml"
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportManifest encodes obj as YAML without its status and the empty fields of unsaved
+// objects, which would only add noise to diffs.
+func exportManifest(obj client.Object) ([]byte, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(u, "status")
+	unstructured.RemoveNestedField(u, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u, "spec", "template", "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u, "spec", "jobTemplate", "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u, "spec", "jobTemplate", "spec", "template", "metadata", "creationTimestamp")
+	return yaml.Marshal(u)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/controller"
+	appv1 "k8s.io/api/apps/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// importDeployment prints the MyApp an existing Deployment would be managed by, or creates it.
+// Adopting the Deployment makes the MyApp its controller, so the MyApp's controller takes it
+// over instead of creating a Deployment of its own.
+func importDeployment(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s import [flags] DEPLOYMENT\n\nPrints the MyApp of the same name capturing the Deployment's pods, or creates it.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	namespace := fs.String("n", "default", "Namespace of the Deployment.")
+	container := fs.String("container", "", "Container of the Deployment the MyApp runs. Defaults to the first one.")
+	create := fs.Bool("create", false, "Create the MyApp instead of printing it.")
+	adopt := fs.Bool("adopt", false, "Create the MyApp and make it the controller of the Deployment.")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitConfigError
+	}
+
+	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	log := ctrl.Log.WithName("import").WithValues("namespace", *namespace, "deployment", fs.Arg(0))
+	ctx := ctrl.SetupSignalHandler()
+
+	c, code := newClusterClient(log)
+	if c == nil {
+		return code
+	}
+
+	deployment := &appv1.Deployment{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: *namespace, Name: fs.Arg(0)}, deployment); err != nil {
+		log.Error(err, "unable to read the Deployment")
+		return exitRuntimeError
+	}
+	app, notes, err := controller.ImportDeployment(deployment, *container)
+	if err != nil {
+		log.Error(err, "unable to import the Deployment")
+		return exitConfigError
+	}
+	for _, note := range notes {
+		log.Info(note)
+	}
+
+	if !*create && !*adopt {
+		data, err := exportManifest(app)
+		if err != nil {
+			log.Error(err, "unable to encode the MyApp")
+			return exitRuntimeError
+		}
+		fmt.Print(string(data))
+		return 0
+	}
+	if err := c.Create(ctx, app); err != nil {
+		log.Error(err, "unable to create the MyApp")
+		return exitRuntimeError
+	}
+	log.Info("created MyApp")
+	if !*adopt {
+		return 0
+	}
+	// The controller applies the Deployment with the MyApp as its owner; setting it now ties the
+	// Deployment's lifetime to the MyApp's right away.
+	patch := client.MergeFrom(deployment.DeepCopy())
+	if err := ctrl.SetControllerReference(app, deployment, c.Scheme()); err != nil {
+		log.Error(err, "unable to adopt the Deployment")
+		return exitRuntimeError
+	}
+	if err := c.Patch(ctx, deployment, patch); err != nil {
+		log.Error(err, "unable to adopt the Deployment")
+		return exitRuntimeError
+	}
+	log.Info("adopted Deployment")
+	return 0
+}
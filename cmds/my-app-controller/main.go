@@ -1,24 +1,164 @@
 package main
 
 import (
-	"context"
+	"errors"
+	"flag"
+	"os"
+	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
 	"github.com/steeling/controller-runtime-exercise/pkg/controller"
+	"go.uber.org/zap/zapcore"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// Exit codes. Invalid flags exit with exitConfigError too, as the flag package does.
+const (
+	exitRuntimeError = 1
+	exitConfigError  = 2
 )
 
 func main() {
-	ctx := context.Background()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "render":
+			os.Exit(render(os.Args[2:]))
+		case "export":
+			os.Exit(export(os.Args[2:]))
+		case "import":
+			os.Exit(importDeployment(os.Args[2:]))
+		case "snapshot":
+			os.Exit(snapshot(os.Args[2:]))
+		case "restore":
+			os.Exit(restore(os.Args[2:]))
+		}
+	}
+	os.Exit(run())
+}
+
+func run() int {
+	var opts controller.Options
+	var verbosity int
+	flag.IntVar(&verbosity, "v", 1, "Log verbosity. 5 logs the body and response code of every mutation, with Secret values redacted.")
+	flag.StringVar(&opts.Namespace, "namespace", os.Getenv("POD_NAMESPACE"), "Namespace the operator runs in. Defaults to $POD_NAMESPACE.")
+	flag.BoolVar(&opts.AuditResources, "audit-resources", false, "Record every mutation in a MyAppAudit object per namespace, in addition to the audit log.")
+	flag.StringVar(&opts.CloudEventsSink, "cloudevents-sink", "", "HTTP endpoint that receives CloudEvents for MyApp lifecycle transitions. Disabled when empty.")
+	flag.StringVar(&opts.NotificationsSecret, "notifications-secret", "", "Secret (namespace/name) holding the notification routes used when a MyApp degrades. Disabled when empty.")
+	flag.BoolVar(&opts.GrafanaDashboard, "grafana-dashboard", false, "Publish a Grafana dashboard ConfigMap for the controller's metrics in the operator namespace.")
+	flag.BoolVar(&opts.PrometheusRules, "prometheus-rules", false, "Publish a PrometheusRule with operator alerts in the operator namespace, if the prometheus-operator CRDs are installed.")
+	flag.StringVar(&opts.OTLPMetricsEndpoint, "otlp-metrics-endpoint", "", "OTLP/HTTP endpoint, e.g. http://otel-collector:4318, the controller's metrics are additionally pushed to. Disabled when empty.")
+	flag.DurationVar(&opts.OTLPMetricsInterval, "otlp-metrics-interval", time.Minute, "How often metrics are pushed to --otlp-metrics-endpoint.")
+	flag.StringVar(&opts.PushgatewayURL, "pushgateway-url", "", "Prometheus Pushgateway, e.g. http://pushgateway:9091, the controller's metrics are pushed to periodically and on shutdown. Disabled when empty.")
+	flag.DurationVar(&opts.PushgatewayInterval, "pushgateway-interval", time.Minute, "How often metrics are pushed to --pushgateway-url. Only pushed on shutdown when 0.")
+	flag.BoolVar(&opts.InstallCRDs, "install-crds", false, "Install or update the operator's CRDs at startup with server-side apply. Refuses updates that drop a version objects are still stored in.")
+	flag.BoolVar(&opts.MigrateStoredVersions, "migrate-stored-versions", false, "After an upgrade changed the storage version of a CRD, rewrite its objects in the new version and update the CRD's status.storedVersions.")
+	flag.BoolVar(&opts.NamespaceSummaries, "namespace-summaries", false, "Publish the number of MyApps, ready MyApps and replicas of every namespace in its myapp-summary ConfigMap. Not supported with --shards.")
+	flag.IntVar(&opts.MaxConcurrentRollouts, "max-concurrent-rollouts", 0, "Number of MyApps whose Deployments roll out at once, per operator replica; the others are queued. Unlimited when 0.")
+	flag.BoolVar(&opts.RolloutWaves, "rollout-waves", false, "Roll changes from outside the MyApps' specs, e.g. to MyAppTemplates, out by the myapp.example.com/rollout-wave annotation of the MyApps, lowest wave first.")
+	flag.DurationVar(&opts.WaveSoakTime, "wave-soak-time", 10*time.Minute, "How long a rollout wave soaks before the next one starts, with --rollout-waves.")
+	flag.IntVar(&opts.WaveMaxDegraded, "wave-max-degraded", 0, "Number of degraded MyApps of lower waves that halt the next waves, with --rollout-waves.")
+	flag.IntVar(&opts.DrainMaxSurge, "drain-max-surge", 0, "Pre-scale MyApps by up to this many replicas while their pods are on cordoned Nodes, so drains complete faster. Disabled when 0.")
+	flag.Float64Var(&opts.ZoneFailureThreshold, "zone-failure-threshold", 0, "Fraction of unready Nodes of a single availability zone considered a zone outage, scaling up MyApps of the critical tier until it recovers. Disabled when 0.")
+	flag.IntVar(&opts.MaxConcurrentSecretRotations, "max-concurrent-secret-rotations", 1, "Number of MyApps restarting their pods for rotated Secrets at once, across the fleet. Unlimited when 0.")
+	flag.BoolVar(&opts.AdmissionDryRun, "admission-dry-run", false, "Dry-run the creation of a pod of every MyApp through the cluster's admission webhooks, e.g. Gatekeeper, and report denials in the MyApp's PolicyViolation condition.")
+	flag.Float64Var(&opts.CPUHourlyPrice, "cpu-hourly-price", 0, "Price of a CPU per hour, used to estimate the monthly cost of the MyApps' requests. Disabled when both prices are 0.")
+	flag.Float64Var(&opts.MemoryHourlyPrice, "memory-hourly-price", 0, "Price of a GiB of memory per hour, used to estimate the monthly cost of the MyApps' requests. Disabled when both prices are 0.")
+	flag.StringVar(&opts.RightSizingPrometheusURL, "rightsizing-prometheus-url", "", "Prometheus, e.g. http://prometheus:9090, the CPU and memory usage of MyApps is queried from to recommend their requests in their status. Disabled when empty.")
+	flag.DurationVar(&opts.RightSizingInterval, "rightsizing-interval", time.Hour, "How often the usage of every MyApp is analyzed for --rightsizing-prometheus-url.")
+	flag.BoolVar(&opts.VerifyImageArchitectures, "verify-image-architectures", true, "Look up the images of MyApps setting spec.architectures in their registries, anonymously, to verify they are built for them.")
+	flag.IntVar(&opts.Shards, "shards", 0, "Split MyApps across this many replicas by consistent hashing of namespace/name. Disables leader election. Disabled when 0 or 1.")
+	flag.IntVar(&opts.ShardIndex, "shard-index", -1, "Shard this replica reconciles. Defaults to the ordinal of the StatefulSet pod the operator runs in.")
+	flag.StringVar(&opts.AdminBindAddress, "admin-bind-address", ":8082", "Address the read-only admin API is served on, by every replica. Disabled when empty.")
+	flag.BoolVar(&opts.StandbyReady, "standby-ready", true, "Report Ready on replicas that aren't the leader. When false only the leader is Ready.")
+	flag.BoolVar(&opts.PriorityQueue, "priority-queue", false, "Reconcile MyApps whose spec changed before periodic resyncs and requeues.")
+	flag.DurationVar(&opts.DebounceWindow, "debounce-window", 0, "Wait until a MyApp saw no changes for this long before reconciling it, e.g. 2s. Disabled when 0.")
+	flag.DurationVar(&opts.HealthTimeout, "health-timeout", 10*time.Minute, "Fail the liveness check when MyApps stayed queued without a successful reconcile for this long. Disabled when 0.")
+	flag.DurationVar(&opts.WatchdogWindow, "watchdog-window", 0, "Report the workqueue stuck and log the goroutine stacks when it grew for this long without a reconcile finishing, e.g. 5m. Disabled when 0.")
+	flag.BoolVar(&opts.WatchdogFailHealthz, "watchdog-fail-healthz", false, "Fail the liveness check while the watchdog reports the workqueue stuck.")
+	flag.Float64Var(&opts.KubeAPIQPS, "kube-api-qps", 20, "Maximum QPS of the requests to the API server.")
+	flag.IntVar(&opts.KubeAPIBurst, "kube-api-burst", 30, "Maximum burst of the requests to the API server.")
+	flag.BoolVar(&opts.AdaptiveQPS, "adaptive-qps", false, "Lower the QPS while the API server throttles requests with 429s or Retry-After, and raise it back to --kube-api-qps gradually.")
+	flag.IntVar(&opts.LogReconcilesPerMinute, "log-reconciles-per-minute", 30, "Number of reconciles per MyApp and minute that are logged. The messages of the others are counted and summarized. Unlimited when 0.")
+	flag.IntVar(&opts.MaxConcurrentReconciles, "max-concurrent-reconciles", 1, "Number of MyApps reconciled in parallel.")
+	flag.IntVar(&opts.NamespaceConcurrency, "namespace-concurrency", 0, "Maximum concurrent reconciles per namespace. Unlimited when 0.")
+	flag.Float64Var(&opts.NamespaceQPS, "namespace-qps", 0, "Maximum writes per second issued for the MyApps of a namespace. Unlimited when 0.")
+	flag.Var(&opts.FeatureGates, "feature-gates", "Comma separated Feature=true|false pairs. Known features: VerifyCacheMiss.")
+	flag.StringVar(&opts.NamespaceSelector, "namespace-selector", "", "Label selector of the namespaces whose MyApps are reconciled, e.g. myapp.example.com/enabled=true. All namespaces when empty.")
+	flag.StringVar(&opts.ExcludeNamespaces, "exclude-namespaces", "", "Comma separated namespaces whose MyApps are never reconciled, e.g. kube-system.")
+	flag.StringVar(&opts.WatchLabelSelector, "watch-label-selector", "", "Label selector of the MyApps the controller manages, e.g. team=platform. All MyApps when empty.")
+	flag.BoolVar(&opts.ImpersonateTenants, "impersonate-tenants", false, "Apply the children of MyApps as the ServiceAccount named by the myapp.example.com/tenant-service-account annotation of their namespace.")
+	flag.StringVar(&opts.Controllers, "controllers", "*", "Comma separated controllers to run. * runs the ones enabled by default, -name disables one. Known controllers: myapp, backup (disabled by default, requires the MyAppBackup and MyAppRestore CRDs), preview (disabled by default, requires the MyAppPreview CRD).")
+	flag.IntVar(&opts.WebhookPort, "webhook-port", 0, "Port the MyApp validating webhook is served on. Disabled when 0.")
+	flag.StringVar(&opts.WebhookCertDir, "webhook-cert-dir", "", "Directory holding the webhook's tls.crt and tls.key. Defaults to the controller-runtime default.")
+	renderFlags(flag.CommandLine, &opts)
+	flag.Parse()
+
+	logger := zap.NewRaw(zap.UseDevMode(true), zap.Level(zapcore.Level(-verbosity)))
+	// Buffered entries are written before exiting.
+	defer logger.Sync() //nolint:errcheck
+	ctrl.SetLogger(zapr.NewLogger(logger))
+	log := ctrl.Log.WithName("setup")
+
+	// Cancelled on SIGTERM so the leader releases its lease before exiting.
+	ctx := ctrl.SetupSignalHandler()
 
 	// Create a new controller
-	c, err := controller.New(ctx)
-	check(err)
+	c, err := controller.New(ctx, opts)
+	if err != nil {
+		log.Error(err, "unable to create the controller")
+		var configErr *controller.ConfigError
+		if errors.As(err, &configErr) {
+			return exitConfigError
+		}
+		return exitRuntimeError
+	}
 
 	// Start the controller
-	c.Start(ctx)
+	if err := c.Start(ctx); err != nil {
+		log.Error(err, "controller stopped")
+		return exitRuntimeError
+	}
+	return 0
 }
 
-func check(err error) {
+// newClusterClient returns a client of the cluster of the kubeconfig, reading directly from the
+// API server. It returns nil and the exit code when there is none.
+func newClusterClient(log logr.Logger) (client.Client, int) {
+	scheme, err := controller.NewScheme()
+	if err != nil {
+		log.Error(err, "unable to set up the scheme")
+		return nil, exitRuntimeError
+	}
+	config, err := ctrl.GetConfig()
 	if err != nil {
-		panic(err)
+		log.Error(err, "unable to load the kubeconfig")
+		return nil, exitConfigError
 	}
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		log.Error(err, "unable to create a client")
+		return nil, exitRuntimeError
+	}
+	return c, 0
+}
+
+// renderFlags adds the flags configuring how children are rendered, shared by the controller
+// and the render subcommand.
+func renderFlags(fs *flag.FlagSet, opts *controller.Options) {
+	fs.StringVar(&opts.ServiceProfilesFile, "service-profiles", "", "YAML file mapping additional Service load balancer profile names to annotations.")
+	fs.StringVar(&opts.DebugImage, "debug-image", "busybox:1.36", "Image of the ephemeral debug containers the myapp.example.com/debug annotation adds to MyApp pods.")
+	fs.StringVar(&opts.FluentBitImage, "fluent-bit-image", "cr.fluentbit.io/fluent/fluent-bit:3.1", "Image of the fluent-bit sidecars tailing the log files of MyApps with spec.logging.output file.")
+	fs.StringVar(&opts.CABundleConfigMap, "ca-bundle-configmap", "", "ConfigMap (namespace/name) holding a trusted CA bundle under ca.crt, mounted in the pods of every MyApp not setting spec.disableCABundle.")
+	fs.StringVar(&opts.TierProfilesFile, "tier-profiles", "", "YAML file mapping the MyApp tiers dev, standard and critical to PodDisruptionBudget maxUnavailable, priorityClassName, antiAffinity and reconcilePriority, replacing the built-in tiers.")
+	fs.StringVar(&opts.EgressProxyProfilesFile, "egress-proxy-profiles", "", "YAML file mapping egress proxy profile names, selected by spec.egressProxy, to their httpProxy, httpsProxy, noProxy and caConfigMap.")
+	fs.StringVar(&opts.ProfilingConfigFile, "profiling-config", "", "YAML file configuring the continuous profiler, provider pyroscope or parca, serverAddress, annotations, env and sidecar, MyApps setting spec.profiling.enabled are set up for.")
+	fs.StringVar(&opts.SizeProfilesFile, "size-profiles", "", "YAML file mapping the MyApp sizes small, medium and large to resources, replicas and PodDisruptionBudget maxUnavailable, replacing the built-in sizes.")
+	fs.StringVar(&opts.DefaultGateway, "default-gateway", "", "Gateway (namespace/name[/section]) HTTPRoutes attach to when a MyApp in GatewayAPI mode doesn't name one.")
+	fs.IntVar(&opts.MinReplicas, "min-replicas", 0, "Minimum replicas of every MyApp, including the range it autoscales in. Enforced by the webhook and the controller.")
+	fs.IntVar(&opts.MaxReplicas, "max-replicas", 0, "Maximum replicas of every MyApp, including the range it autoscales in. Enforced by the webhook and the controller. Unbounded when 0.")
+	fs.BoolVar(&opts.AllowHostNamespaces, "allow-host-namespaces", false, "Permit MyApps in namespaces labeled myapp.example.com/allow-host-namespaces=true to set spec.hostNetwork and spec.hostPID.")
+	fs.StringVar(&opts.IgnoreDifferences, "ignore-differences", "", "Comma separated Kind:/json/pointer fields of children left to other managers for every MyApp, e.g. Deployment:/spec/template/metadata/annotations/sidecar.istio.io~1inject.")
 }
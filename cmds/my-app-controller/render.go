@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/controller"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/yaml"
+)
+
+// render prints the children the controller would apply for the MyApps of a manifest file,
+// without a cluster. The manifests' other objects, e.g. MyAppTemplates, Namespaces and
+// LimitRanges, stand in for the cluster's.
+func render(args []string) int {
+	var opts controller.Options
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s render [flags]\n\nPrints the children the controller would apply for the MyApps of the manifests, as YAML documents.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	file := fs.String("f", "-", "Manifest file holding the MyApps, and the objects they're rendered against. - reads stdin.")
+	renderFlags(fs, &opts)
+	_ = fs.Parse(args)
+
+	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	log := ctrl.Log.WithName("render")
+
+	var in io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Error(err, "unable to read the manifests")
+			return exitConfigError
+		}
+		defer f.Close()
+		in = f
+	}
+
+	objects, err := controller.RenderManifests(context.Background(), opts, in)
+	if err != nil {
+		log.Error(err, "unable to render the manifests")
+		var configErr *controller.ConfigError
+		if errors.As(err, &configErr) {
+			return exitConfigError
+		}
+		return exitRuntimeError
+	}
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			log.Error(err, "unable to encode a child", "name", obj.GetName())
+			return exitRuntimeError
+		}
+		fmt.Printf("---\n%s", data)
+	}
+	return 0
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/backup"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// snapshot stores the spec of a MyApp and the manifests of its children in a ConfigMap, so a
+// bad change can be undone with restore. It lists the MyApp's snapshots with -list.
+func snapshot(args []string) int {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s snapshot [flags] MYAPP\n\nSnapshots the MyApp's spec and children in a ConfigMap owned by the MyApp.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	namespace := fs.String("n", "default", "Namespace of the MyApp.")
+	keep := fs.Int("keep", 5, "Number of snapshots of the MyApp retained, the oldest are deleted.")
+	list := fs.Bool("list", false, "List the MyApp's snapshots, most recent first, instead of taking one.")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitConfigError
+	}
+	key := client.ObjectKey{Namespace: *namespace, Name: fs.Arg(0)}
+
+	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	log := ctrl.Log.WithName("snapshot").WithValues("namespace", key.Namespace, "name", key.Name)
+	ctx := ctrl.SetupSignalHandler()
+	c, code := newClusterClient(log)
+	if c == nil {
+		return code
+	}
+
+	if *list {
+		snapshots, err := backup.Snapshots(ctx, c, key)
+		if err != nil {
+			log.Error(err, "unable to list the snapshots")
+			return exitRuntimeError
+		}
+		for _, cm := range snapshots {
+			fmt.Printf("%s\t%s\n", cm.Name, cm.CreationTimestamp.UTC().Format(time.RFC3339))
+		}
+		return 0
+	}
+	name, err := backup.Snapshot(ctx, c, key, *keep, time.Now())
+	if err != nil {
+		log.Error(err, "unable to snapshot the MyApp", "snapshot", name)
+		return exitRuntimeError
+	}
+	log.Info("snapshotted MyApp", "snapshot", name)
+	return 0
+}
+
+// restore sets the spec of a MyApp back to the one of a snapshot, the most recent when none
+// is named. The MyApp's controller re-renders the children.
+func restore(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s restore [flags] MYAPP [SNAPSHOT]\n\nRestores the MyApp's spec from a snapshot taken with snapshot, the most recent by default.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	namespace := fs.String("n", "default", "Namespace of the MyApp.")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 && fs.NArg() != 2 {
+		fs.Usage()
+		return exitConfigError
+	}
+	key := client.ObjectKey{Namespace: *namespace, Name: fs.Arg(0)}
+
+	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	log := ctrl.Log.WithName("restore").WithValues("namespace", key.Namespace, "name", key.Name)
+	ctx := ctrl.SetupSignalHandler()
+	c, code := newClusterClient(log)
+	if c == nil {
+		return code
+	}
+
+	name, err := backup.Restore(ctx, c, key, fs.Arg(1))
+	if err != nil {
+		log.Error(err, "unable to restore the MyApp", "snapshot", name)
+		return exitRuntimeError
+	}
+	log.Info("restored MyApp", "snapshot", name)
+	return 0
+}
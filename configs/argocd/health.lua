@@ -0,0 +1,42 @@
+-- ArgoCD health check for example.com/MyApp.
+--
+-- Register it in the argocd-cm ConfigMap:
+--
+--   data:
+--     resource.customizations.health.example.com_MyApp: |
+--       <contents of this file>
+--
+-- The controller sets status.phase to Progressing, Healthy or Degraded and keeps
+-- the Available, Progressing and Degraded conditions up to date, so the phase
+-- maps directly onto ArgoCD health statuses.
+hs = {}
+if obj.status == nil or obj.status.phase == nil then
+  hs.status = "Progressing"
+  hs.message = "Waiting for the controller to report status"
+  return hs
+end
+
+if obj.status.observedGeneration ~= nil and obj.metadata.generation ~= nil and obj.status.observedGeneration < obj.metadata.generation then
+  hs.status = "Progressing"
+  hs.message = "Waiting for the controller to observe the latest spec"
+  return hs
+end
+
+local message = ""
+if obj.status.conditions ~= nil then
+  for _, condition in ipairs(obj.status.conditions) do
+    if condition.type == "Degraded" and condition.status == "True" then
+      message = condition.message
+    elseif condition.type == "Progressing" and condition.status == "True" and message == "" then
+      message = condition.message
+    end
+  end
+end
+
+if obj.status.phase == "Healthy" or obj.status.phase == "Degraded" or obj.status.phase == "Progressing" then
+  hs.status = obj.status.phase
+else
+  hs.status = "Unknown"
+end
+hs.message = message
+return hs
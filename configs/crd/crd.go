@@ -0,0 +1,10 @@
+// Package crd embeds the generated CustomResourceDefinitions, so the operator can install
+// them itself.
+package crd
+
+import "embed"
+
+// FS holds the CRD manifests, one per file.
+//
+//go:embed *.yaml
+var FS embed.FS
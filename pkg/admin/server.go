@@ -0,0 +1,93 @@
+// Package admin serves the operator's read-only admin API.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// maxBodySize is the largest body that may be posted.
+const maxBodySize = 1 << 20
+
+// Server is an HTTP server for admin endpoints. It implements manager.Runnable and runs on
+// every replica, not just the leader, so any replica can be inspected.
+type Server struct {
+	addr string
+	mux  *http.ServeMux
+	log  logr.Logger
+}
+
+func NewServer(addr string, log logr.Logger) *Server {
+	return &Server{
+		addr: addr,
+		mux:  http.NewServeMux(),
+		log:  log,
+	}
+}
+
+// Handle registers handler for pattern. Handlers must not mutate cluster state, as
+// non-leader replicas serve them too.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	srv := &http.Server{Addr: s.addr, Handler: s.mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			s.log.Error(err, "unable to shut down admin server")
+		}
+	}()
+	s.log.Info("serving admin API", "addr", s.addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// JSON returns a handler that serves the result of fn as JSON. Only GET is allowed.
+func JSON(fn func(r *http.Request) (interface{}, error)) http.Handler {
+	return serveJSON(http.MethodGet, fn)
+}
+
+// Post returns a handler that serves the result of fn for the posted body as JSON. Only
+// POST is allowed, and bodies are limited to maxBodySize.
+func Post(fn func(r *http.Request) (interface{}, error)) http.Handler {
+	return serveJSON(http.MethodPost, func(r *http.Request) (interface{}, error) {
+		r.Body = http.MaxBytesReader(nil, r.Body, maxBodySize)
+		return fn(r)
+	})
+}
+
+func serveJSON(method string, fn func(r *http.Request) (interface{}, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		v, err := fn(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -1,9 +1,11 @@
 package api
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/scheme"
 )
 
@@ -13,6 +15,12 @@ var (
 	AddToScheme   = SchemeBuilder.AddToScheme
 )
 
+// MyApp is the Schema for the myapps API
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Replicas",type=integer,description="The number of pods launched by the MyApp",JSONPath=".status.replicas"
+// +kubebuilder:printcolumn:name="Phase",type=string,description="Progressing, Healthy or Degraded",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Expires In",type=string,description="The time left until the MyApp expires",JSONPath=".status.expiresIn"
 type MyApp struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -21,20 +29,703 @@ type MyApp struct {
 	Status MyAppStatus `json:"status,omitempty"`
 }
 
+// MyAppSpec defines the desired state of MyApp
+// +kubebuilder:validation:XValidation:rule="!has(self.replicas) || !has(self.autoscaling) || self.replicas <= self.autoscaling.maxReplicas",message="replicas must not exceed autoscaling.maxReplicas"
+// +kubebuilder:validation:XValidation:rule="!has(self.workloadType) || self.workloadType != 'CronJob' || has(self.job) && has(self.job.schedule)",message="a CronJob workload requires job.schedule"
+// +kubebuilder:validation:XValidation:rule="!has(self.workloadType) || self.workloadType == 'Deployment' || !has(self.autoscaling)",message="autoscaling requires the Deployment workload type"
+// +kubebuilder:validation:XValidation:rule="!has(self.timezone) || !self.timezone.mountLocaltime || !has(self.os) || self.os != 'windows'",message="timezone.mountLocaltime is not supported on windows"
+// +kubebuilder:validation:XValidation:rule="!has(self.logging) || !has(self.logging.output) || self.logging.output != 'file' || !has(self.os) || self.os != 'windows'",message="logging to a file is not supported on windows"
 type MyAppSpec struct {
-	// Replicas Toggle specifies number of vmagent replicas
-	Replicas *int32   `json:"replicas,omitempty"`
-	Image    string   `json:"image,omitempty"`
-	Args     []string `json:"args,omitempty"`
+	// Replicas Toggle specifies number of MyApp replicas. Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Image specifies the container image to use for MyApp
+	// +kubebuilder:validation:XValidation:rule="self.contains('@') || self.substring(self.lastIndexOf('/') + 1).contains(':')",message="image must be pinned to a tag or digest"
+	Image string   `json:"image,omitempty"`
+	Args  []string `json:"args,omitempty"`
+	// Env are environment variables of the MyApp's container. The ones the operator sets, e.g.
+	// TZ or the egress proxy's, take precedence.
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// WorkloadType is how the MyApp's pods run: Deployment, a long running service, Job, run
+	// to completion once, or CronJob, run on Job.Schedule. Defaults to Deployment. Job and
+	// CronJob workloads get no PodDisruptionBudget. A Job runs again when it is deleted or
+	// the myapp.example.com/run annotation changes, with the spec at that time. It can't be
+	// changed once the MyApp is created.
+	// +kubebuilder:validation:Enum=Deployment;Job;CronJob
+	WorkloadType string `json:"workloadType,omitempty"`
+	// Job configures the runs of a Job or CronJob workload.
+	Job *JobSpec `json:"job,omitempty"`
+	// Tasks are named commands, e.g. database migrations, run on demand in a Job with the
+	// MyApp's image and environment. The myapp.example.com/run-task annotation runs one.
+	// +listType=map
+	// +listMapKey=name
+	Tasks []TaskSpec `json:"tasks,omitempty"`
+
+	// Size is a profile of resources, replicas and disruption budget defined by the operator,
+	// small, medium, large or custom. The fields set here or by the template take precedence.
+	// custom applies no profile.
+	// +kubebuilder:validation:Enum=small;medium;large;custom
+	Size string `json:"size,omitempty"`
+
+	// TemplateRef names a MyAppTemplate whose defaults apply to the fields left unset here.
+	TemplateRef *TemplateRef `json:"templateRef,omitempty"`
+	// Resources of the MyApp's container. Requests and limits are merged over the template's,
+	// per resource.
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// LivenessProbe of the MyApp's container. Defaults to the template's.
+	LivenessProbe *corev1.Probe `json:"livenessProbe,omitempty"`
+	// ReadinessProbe of the MyApp's container. Defaults to the template's.
+	ReadinessProbe *corev1.Probe `json:"readinessProbe,omitempty"`
+	// WarmupGate keeps the MyApp's pods from becoming ready, and receiving traffic, until the
+	// controller got a 200 from their warmup endpoint after their containers became ready.
+	// The controller must be able to reach the pods.
+	WarmupGate *WarmupGateSpec `json:"warmupGate,omitempty"`
+	// Warmup gives new pods time to start and ramps their traffic up.
+	Warmup *WarmupSpec `json:"warmup,omitempty"`
+	// Logging sets the standard logging environment variables of the MyApp's container, so
+	// the platform's log pipeline gets consistent output from it.
+	Logging *LoggingSpec `json:"logging,omitempty"`
+	// Profiling sets the MyApp's pods up for the operator's continuous profiler.
+	Profiling *ProfilingSpec `json:"profiling,omitempty"`
+	// Timezone of the MyApp's containers.
+	Timezone *TimezoneSpec `json:"timezone,omitempty"`
+	// SecurityContext of the MyApp's container. Defaults to the template's.
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+	// OS the MyApp's pods run on, linux or windows. The pods are scheduled on nodes of this
+	// OS. For windows, the Linux-only fields of the template's security context are dropped.
+	// +kubebuilder:validation:Enum=linux;windows
+	OS string `json:"os,omitempty"`
+	// RuntimeClassName is the RuntimeClass the MyApp's pods run with, e.g. a gVisor or Kata
+	// Containers sandbox. The RuntimeClass must exist; its pod overhead is included in the
+	// estimated cost.
+	RuntimeClassName string `json:"runtimeClassName,omitempty"`
+	// HostNetwork and HostPID run the MyApp's pods in the host's network and PID namespaces.
+	// They must be allowed by the operator, and the MyApp's namespace labeled with
+	// myapp.example.com/allow-host-namespaces=true.
+	HostNetwork bool `json:"hostNetwork,omitempty"`
+	HostPID     bool `json:"hostPID,omitempty"`
+	// EgressProxy is the operator's egress proxy profile the MyApp's pods reach the outside
+	// through. The proxy environment variables are set, and its CA bundle mounted at
+	// /etc/egress-proxy/ca.crt.
+	EgressProxy string `json:"egressProxy,omitempty"`
+	// Tier is a criticality tier, dev, standard or critical, defaulting the strictness of the
+	// PodDisruptionBudget, the priority class, the anti-affinity and the reconcile priority of
+	// the MyApp as configured on the operator. No tier applies no defaults. Critical MyApps are
+	// also scaled up while an availability zone fails, when the operator responds to zone outages.
+	// +kubebuilder:validation:Enum=dev;standard;critical
+	Tier string `json:"tier,omitempty"`
+	// CriticalityTier high is Tier critical when Tier is unset, and ignored otherwise.
+	//
+	// Deprecated: Use Tier, critical for high. It is removed in the next API version.
+	// +kubebuilder:validation:Enum=standard;high
+	CriticalityTier string `json:"criticalityTier,omitempty"`
+	// DisableCABundle opts the MyApp out of the operator's trusted CA bundle, which is
+	// otherwise mounted at /etc/ca-bundle/ca.crt in its pods and pointed to by SSL_CERT_FILE.
+	DisableCABundle bool `json:"disableCABundle,omitempty"`
+	// Architectures the MyApp's pods run on. The controller verifies the image is built for
+	// them and schedules the pods on nodes of the supported ones. Any node when empty.
+	// +listType=set
+	Architectures []Architecture `json:"architectures,omitempty"`
+
+	// ServiceMesh enrolls the MyApp's pods in a service mesh.
+	ServiceMesh *ServiceMeshSpec `json:"serviceMesh,omitempty"`
+
+	// ExternalSecrets are External Secrets Operator ExternalSecrets in the MyApp's namespace.
+	// Pods are not rolled out until each target Secret exists, and receive its keys as environment variables.
+	ExternalSecrets []ExternalSecretRef `json:"externalSecrets,omitempty"`
+	// SecretRotation restarts the pods when the target Secrets of the ExternalSecrets rotate,
+	// one MyApp after another across the fleet, within the PodDisruptionBudget.
+	SecretRotation *SecretRotationSpec `json:"secretRotation,omitempty"`
+
+	// Service exposes the MyApp through a Service.
+	Service *ServiceSpec `json:"service,omitempty"`
+
+	// Ingress routes external HTTP traffic to the MyApp's Service. A ClusterIP Service
+	// with default ports is generated when Service is not set.
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+
+	// Networking configures how Ingress is realized.
+	Networking *NetworkingSpec `json:"networking,omitempty"`
+
+	// Targets are remote clusters the MyApp's Deployment and PodDisruptionBudget are also
+	// created in, by the names they were registered with. ExternalSecrets, the Service and
+	// the Ingress are only managed in the local cluster.
+	Targets []ClusterTargetRef `json:"targets,omitempty"`
+
+	// Autoscaling scales the Deployment with a HorizontalPodAutoscaler. Replicas is ignored when set.
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// NetworkPolicy restricts ingress to the MyApp's pods to its Service port, from its own
+	// namespace and the namespaces listed.
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+
+	// IgnoreDifferences are fields of the MyApp's children the controller leaves to other
+	// managers, in addition to the ones the operator ignores for every MyApp.
+	IgnoreDifferences []IgnoreDifference `json:"ignoreDifferences,omitempty"`
+
+	// TTLSecondsAfterCreation expires the MyApp this many seconds after its creation.
+	// +kubebuilder:validation:Minimum=0
+	TTLSecondsAfterCreation *int32 `json:"ttlSecondsAfterCreation,omitempty"`
+	// ExpiresAt expires the MyApp at this time. The earlier of it and TTLSecondsAfterCreation applies.
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// ExpirationPolicy is what happens to an expired MyApp, Delete (default) deletes it,
+	// Hibernate scales it down to no pods and keeps it.
+	// +kubebuilder:validation:Enum=Delete;Hibernate
+	ExpirationPolicy string `json:"expirationPolicy,omitempty"`
+
+	// AutoRightSize applies the requests in Status.RightSizing to the MyApp's container. They
+	// are only recommended otherwise.
+	AutoRightSize bool `json:"autoRightSize,omitempty"`
+
+	// GracefulShutdown drains connections before the MyApp's pods stop, so rollouts behind
+	// load balancers don't drop requests.
+	GracefulShutdown *GracefulShutdownSpec `json:"gracefulShutdown,omitempty"`
+
+	// RecreateOnImmutableChange deletes and recreates children whose update is rejected
+	// because it changes an immutable field, e.g. the selector of a Deployment created
+	// before the MyApp. The pods of a recreated Deployment keep running until its
+	// replacement is rolled out.
+	RecreateOnImmutableChange bool `json:"recreateOnImmutableChange,omitempty"`
+}
+
+type IgnoreDifference struct {
+	// Kind of the children the fields are ignored on, e.g. Deployment.
+	Kind string `json:"kind"`
+	// JSONPointers are RFC 6901 JSON pointers to the ignored fields, e.g. /spec/replicas.
+	// +kubebuilder:validation:items:Pattern=`^/`
+	JSONPointers []string `json:"jsonPointers"`
+}
+
+type WarmupGateSpec struct {
+	// Path of the warmup endpoint, e.g. /warmup.
+	// +kubebuilder:validation:Pattern=`^/`
+	Path string `json:"path"`
+	// Port of the warmup endpoint.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+}
+
+type WarmupSpec struct {
+	// InitialDelaySeconds delays the first probe of a new pod. It is set on a startup probe
+	// derived from the readiness, or liveness, probe, which holds the other probes back
+	// until it succeeds.
+	// +kubebuilder:validation:Minimum=0
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+	// SlowStartSeconds is how long a new ready pod takes until it receives its full share of
+	// traffic, with Istio. It sets the Deployment's minReadySeconds too, so a rollout doesn't
+	// replace the next pods before the new ones have warmed up.
+	// +kubebuilder:validation:Minimum=0
+	SlowStartSeconds int32 `json:"slowStartSeconds,omitempty"`
+}
+
+// Log formats and outputs of Spec.Logging.
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+
+	LogOutputStdout = "stdout"
+	LogOutputFile   = "file"
+)
+
+type LoggingSpec struct {
+	// Format is json (default) or text. It is set in LOG_FORMAT, and tells the log pipeline
+	// how to parse the lines through the fluentbit.io/parser pod annotation.
+	// +kubebuilder:validation:Enum=json;text
+	Format string `json:"format,omitempty"`
+	// Level is the minimum level logged, e.g. info or debug. It is set in LevelEnv.
+	Level string `json:"level,omitempty"`
+	// LevelEnv is the environment variable the level is set in. Defaults to LOG_LEVEL.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z_][A-Za-z0-9_]*$`
+	LevelEnv string `json:"levelEnv,omitempty"`
+	// Output is stdout (default) or file. With file, the container writes to the file in
+	// LOG_FILE, on a volume shared with a fluent-bit sidecar that tails it to its own stdout.
+	// The sidecar's configuration is in the <name>-fluent-bit ConfigMap.
+	// +kubebuilder:validation:Enum=stdout;file
+	Output string `json:"output,omitempty"`
+}
+
+type ProfilingSpec struct {
+	// Enabled adds the annotations, environment variables and agent sidecar of the operator's
+	// profiler, Pyroscope or Parca, to the pods.
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+type TimezoneSpec struct {
+	// Name is an IANA time zone, e.g. Europe/Paris, set in the TZ environment variable of
+	// every container.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// MountLocaltime mounts the time zone's file at /etc/localtime too, for programs that
+	// ignore TZ. It is taken from the database embedded in the operator, through the
+	// <name>-timezone ConfigMap.
+	MountLocaltime bool `json:"mountLocaltime,omitempty"`
 }
 
+type GracefulShutdownSpec struct {
+	// DrainSeconds is how long load balancers are given to stop sending traffic to a
+	// terminating pod, and to start sending it to a new one, before the pod is stopped or
+	// the rollout continues. It is added to the termination grace period and sets the
+	// Deployment's minReadySeconds. Defaults to 15.
+	// +kubebuilder:validation:Minimum=1
+	DrainSeconds int32 `json:"drainSeconds,omitempty"`
+	// SleepPreStop adds a preStop hook sleeping for DrainSeconds, so the container only
+	// receives SIGTERM once it was removed from the load balancers. Apps that keep serving
+	// after SIGTERM don't need it. Requires Kubernetes 1.30.
+	SleepPreStop bool `json:"sleepPreStop,omitempty"`
+}
+
+type TemplateRef struct {
+	// Name of the MyAppTemplate.
+	Name string `json:"name"`
+}
+
+// +kubebuilder:validation:XValidation:rule="!has(self.minReplicas) || self.minReplicas <= self.maxReplicas",message="minReplicas must not exceed maxReplicas"
+type AutoscalingSpec struct {
+	// MinReplicas defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+	// TargetCPUUtilizationPercentage is the average CPU utilization, relative to the
+	// requests, the HorizontalPodAutoscaler aims for. Defaults to 80.
+	// +kubebuilder:validation:Minimum=1
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+	// Vertical creates a VerticalPodAutoscaler for the Deployment, if its CRD is installed.
+	// Its recommendations are reported in Status.Recommendations.
+	Vertical *VerticalAutoscalingSpec `json:"vertical,omitempty"`
+}
+
+// VerticalPodAutoscaler update modes.
+const (
+	VerticalModeOff  = "Off"
+	VerticalModeAuto = "Auto"
+)
+
+type VerticalAutoscalingSpec struct {
+	// Mode is Off (default), which only computes recommendations, or Auto, which applies
+	// them to the pods' memory requests. CPU is left to the HorizontalPodAutoscaler.
+	// +kubebuilder:validation:Enum=Off;Auto
+	Mode string `json:"mode,omitempty"`
+}
+
+type NetworkPolicySpec struct {
+	// AllowedNamespaces may reach the MyApp in addition to its own namespace.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+}
+
+// Workload types of Spec.WorkloadType.
+const (
+	WorkloadDeployment = "Deployment"
+	WorkloadJob        = "Job"
+	WorkloadCronJob    = "CronJob"
+)
+
+// RunAnnotation on a MyApp of the Job or CronJob workload type triggers a run whenever its
+// value changes, e.g. to the current time. A running Job is rerun once it finished.
+const RunAnnotation = "myapp.example.com/run"
+
+type JobSpec struct {
+	// Schedule is the cron schedule of a CronJob workload, e.g. "*/15 * * * *".
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule,omitempty"`
+	// ConcurrencyPolicy of a CronJob workload, Allow, Forbid or Replace. Defaults to Allow.
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	ConcurrencyPolicy string `json:"concurrencyPolicy,omitempty"`
+	// BackoffLimit is the number of retries before a run fails. Defaults to 6.
+	// +kubebuilder:validation:Minimum=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// SuccessfulJobsHistoryLimit and FailedJobsHistoryLimit are the finished runs of a
+	// CronJob workload that are kept. Default to 3 and 1.
+	// +kubebuilder:validation:Minimum=0
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+}
+
+// RunTaskAnnotation on a MyApp runs the task of Spec.Tasks it names whenever its value
+// changes, e.g. with kubectl annotate --overwrite. The name may be followed by @ and any
+// suffix, to run the same task again: migrate@2024-06-01T10:00.
+const RunTaskAnnotation = "myapp.example.com/run-task"
+
+// DebugAnnotation on a MyApp debugs one of its pods whenever its value changes, so users
+// who may edit the MyApp but not its pods can debug them. The value is the mode, ephemeral
+// to add an ephemeral debug container targeting the MyApp's container, or copy to create a
+// copy of the pod whose container sleeps instead of running the app. The mode may be followed
+// by / and the pod's name, a running pod is picked otherwise, and by @ and any suffix to
+// debug again: copy/my-app-7d9f8-x2x4z@2. Status.Debug reports the container or pod to attach to.
+const DebugAnnotation = "myapp.example.com/debug"
+
+// Modes of the debug annotation.
+const (
+	DebugEphemeral = "ephemeral"
+	DebugCopy      = "copy"
+)
+
+type DebugStatus struct {
+	// Mode is ephemeral or copy.
+	Mode string `json:"mode"`
+	// Pod to attach to: the debugged pod for ephemeral, its copy for copy.
+	Pod string `json:"pod,omitempty"`
+	// Container to attach to.
+	Container string `json:"container,omitempty"`
+	// Message explains why nothing could be debugged.
+	Message string      `json:"message,omitempty"`
+	Time    metav1.Time `json:"time"`
+}
+
+type TaskSpec struct {
+	// Name of the task.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=30
+	Name string `json:"name"`
+	// Command replaces the entrypoint of the MyApp's image.
+	Command []string `json:"command,omitempty"`
+	// Args replaces the MyApp's args.
+	Args []string `json:"args,omitempty"`
+	// BackoffLimit is the number of retries before the task fails. Defaults to 0.
+	// +kubebuilder:validation:Minimum=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+}
+
+type TaskStatus struct {
+	// Name of the task.
+	Name         string `json:"name"`
+	JobRunStatus `json:",inline"`
+}
+
+// Results of a JobRunStatus.
+const (
+	RunRunning   = "Running"
+	RunSucceeded = "Succeeded"
+	RunFailed    = "Failed"
+)
+
+type JobRunStatus struct {
+	// JobName is the Job of the run.
+	JobName string `json:"jobName"`
+	// Result is Running, Succeeded or Failed.
+	// +kubebuilder:validation:Enum=Running;Succeeded;Failed
+	Result         string       `json:"result"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message explains a failure.
+	Message string `json:"message,omitempty"`
+}
+
+// AllowHostNamespacesLabel, set to "true" on a namespace, permits its MyApps to set
+// Spec.HostNetwork and Spec.HostPID, when the operator allows them.
+const AllowHostNamespacesLabel = "myapp.example.com/allow-host-namespaces"
+
+// Tiers of Spec.Tier.
+const (
+	TierDev      = "dev"
+	TierStandard = "standard"
+	TierCritical = "critical"
+)
+
+// Criticality tiers of the deprecated Spec.CriticalityTier.
+const (
+	CriticalityTierStandard = "standard"
+	CriticalityTierHigh     = "high"
+)
+
+// Architecture is a CPU architecture, as in the kubernetes.io/arch node label.
+// +kubebuilder:validation:Enum=amd64;arm64
+type Architecture string
+
+const (
+	ArchitectureAMD64 Architecture = "amd64"
+	ArchitectureARM64 Architecture = "arm64"
+)
+
+type ClusterTargetRef struct {
+	// Name of the registered cluster.
+	Name string `json:"name"`
+}
+
+// Built-in Service load balancer profiles. Operators can define additional profiles.
+const (
+	ServiceProfileAWSNLB        = "aws-nlb"
+	ServiceProfileGKEInternal   = "gke-internal"
+	ServiceProfileAzureInternal = "azure-internal"
+)
+
+type ServiceSpec struct {
+	// Type is the Service type. Defaults to LoadBalancer when a Profile is set, ClusterIP otherwise.
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	Type corev1.ServiceType `json:"type,omitempty"`
+	// Port the Service exposes. Defaults to 80.
+	Port int32 `json:"port,omitempty"`
+	// TargetPort is the container port traffic is forwarded to. Defaults to Port.
+	TargetPort int32 `json:"targetPort,omitempty"`
+	// Profile expands into cloud provider load balancer annotations, one of aws-nlb,
+	// gke-internal, azure-internal or a profile defined by the operator.
+	Profile string `json:"profile,omitempty"`
+	// Annotations are added to the Service and take precedence over the profile's.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Hostname is published by external-dns for the Service's load balancer.
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// Sizes of Spec.Size.
+const (
+	SizeSmall  = "small"
+	SizeMedium = "medium"
+	SizeLarge  = "large"
+	SizeCustom = "custom"
+)
+
+// Expiration policies.
+const (
+	ExpirationPolicyDelete    = "Delete"
+	ExpirationPolicyHibernate = "Hibernate"
+)
+
+// Networking modes.
+const (
+	NetworkingModeIngress    = "Ingress"
+	NetworkingModeGatewayAPI = "GatewayAPI"
+)
+
+// +kubebuilder:validation:XValidation:rule="!has(self.gateway) || (has(self.mode) && self.mode == 'GatewayAPI')",message="gateway requires mode GatewayAPI"
+type NetworkingSpec struct {
+	// Mode selects how Spec.Ingress is realized, Ingress (default) or GatewayAPI. GatewayAPI
+	// creates an HTTPRoute instead of an Ingress.
+	// +kubebuilder:validation:Enum=Ingress;GatewayAPI
+	Mode string `json:"mode,omitempty"`
+	// Gateway the HTTPRoute attaches to in GatewayAPI mode. Defaults to the gateway configured
+	// on the operator.
+	Gateway *GatewayRef `json:"gateway,omitempty"`
+}
+
+type GatewayRef struct {
+	Name string `json:"name"`
+	// Namespace of the Gateway. Defaults to the MyApp's namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// SectionName is the Gateway listener to attach to.
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+type IngressSpec struct {
+	// Host routed to the MyApp. external-dns publishes a record for it.
+	Host string `json:"host"`
+	// ClassName is the IngressClass to use. The cluster default class is used when empty.
+	ClassName string `json:"className,omitempty"`
+	// Path prefix routed to the MyApp. Defaults to "/".
+	Path string `json:"path,omitempty"`
+	// TLSSecretName enables TLS for Host with the certificate in this Secret.
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+}
+
+type SecretRotationSpec struct {
+	// Secrets restricts the Secrets whose rotation restarts the pods. Defaults to every
+	// target Secret of the ExternalSecrets.
+	Secrets []string `json:"secrets,omitempty"`
+}
+
+type ExternalSecretRef struct {
+	// Name of the ExternalSecret.
+	Name string `json:"name"`
+}
+
+// Supported service mesh providers.
+const (
+	MeshIstio   = "istio"
+	MeshLinkerd = "linkerd"
+)
+
+type ServiceMeshSpec struct {
+	// Provider is istio or linkerd.
+	// +kubebuilder:validation:Enum=istio;linkerd
+	Provider string `json:"provider"`
+	// MTLSMode is the Istio PeerAuthentication mode, STRICT or PERMISSIVE. Defaults to STRICT.
+	// +kubebuilder:validation:Enum=STRICT;PERMISSIVE
+	MTLSMode string `json:"mtlsMode,omitempty"`
+}
+
+// Phases summarize the state of a MyApp using the health statuses ArgoCD understands.
+const (
+	// PhaseProgressing means the MyApp is being created or rolled out.
+	PhaseProgressing = "Progressing"
+	// PhaseHealthy means the rollout is complete and the MyApp is available.
+	PhaseHealthy = "Healthy"
+	// PhaseDegraded means the MyApp is unavailable or its rollout failed.
+	PhaseDegraded = "Degraded"
+)
+
+// Condition types maintained on MyAppStatus.Conditions.
+const (
+	// ConditionAvailable is True once the MyApp's Deployment has minimum availability.
+	ConditionAvailable = "Available"
+	// ConditionProgressing is True while the MyApp is being created or rolled out.
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded is True when the MyApp is unavailable or its rollout failed.
+	ConditionDegraded = "Degraded"
+
+	// The following follow the kstatus conventions so tools like kpt, Flux and cli-utils
+	// compute "Current" for a MyApp: Ready has normal polarity, Reconciling and Stalled
+	// are abnormal-true and are False once the MyApp settles.
+
+	// ConditionReady is True when the MyApp is Healthy.
+	ConditionReady = "Ready"
+	// ConditionReconciling is True while the latest spec is still being applied.
+	ConditionReconciling = "Reconciling"
+	// ConditionStalled is True when the controller can't make progress without intervention.
+	ConditionStalled = "Stalled"
+
+	// ConditionExternalSecretsReady is True once every referenced ExternalSecret has materialized its Secret.
+	ConditionExternalSecretsReady = "ExternalSecretsReady"
+	// ConditionServiceConfigured is False when Spec.Service can't be rendered, e.g. due to an unknown profile.
+	ConditionServiceConfigured = "ServiceConfigured"
+	// ConditionDNSReady is True once every hostname external-dns manages for the MyApp resolves
+	// to its load balancer.
+	ConditionDNSReady = "DNSReady"
+	// ConditionRouteConfigured is False when the MyApp's Spec.Ingress can't be realized, e.g.
+	// GatewayAPI mode without the Gateway API CRDs or a gateway to attach to.
+	ConditionRouteConfigured = "RouteConfigured"
+	// ConditionTargetsReady is True once the MyApp is available in every cluster in Spec.Targets.
+	ConditionTargetsReady = "TargetsReady"
+	// ConditionForbidden is True when the tenant ServiceAccount the operator impersonates
+	// isn't allowed to apply the MyApp's children. It is only set when impersonating tenants.
+	ConditionForbidden = "Forbidden"
+	// ConditionChangeFrozen is True while a MaintenanceWindow defers changes to the MyApp's
+	// children. The status is still maintained.
+	ConditionChangeFrozen = "ChangeFrozen"
+	// ConditionConflictingManager is True when another field manager keeps reverting the
+	// MyApp's children. The controller backs off from re-applying them.
+	ConditionConflictingManager = "ConflictingManager"
+	// ConditionSelectorMismatch is True when the selector of a live child differs from the
+	// rendered one. Selectors are immutable, the child is left as it is unless
+	// Spec.RecreateOnImmutableChange is set.
+	ConditionSelectorMismatch = "SelectorMismatch"
+	// ConditionExpired is True while an expired MyApp with the Hibernate expiration policy
+	// is scaled down.
+	ConditionExpired = "Expired"
+	// ConditionArchitecturesSupported is False when the MyApp's image isn't built for every
+	// architecture in Spec.Architectures, and Unknown when the image couldn't be looked up.
+	ConditionArchitecturesSupported = "ArchitecturesSupported"
+	// ConditionRolloutQueued is True while a change to the MyApp's pods waits for the
+	// operator's limit of concurrent rollouts, or for the MyApp's rollout wave.
+	ConditionRolloutQueued = "RolloutQueued"
+	// ConditionNodeDrain is True while the MyApp is scaled up because some of its pods are
+	// on cordoned Nodes.
+	ConditionNodeDrain = "NodeDrain"
+	// ConditionZoneFailure is True while a high criticality MyApp is scaled up because an
+	// availability zone fails.
+	ConditionZoneFailure = "ZoneFailure"
+	// ConditionQuotaExceeded is True while the MyApp's pods would exceed the ResourceQuotas
+	// of its namespace. Its message reports the shortfall.
+	ConditionQuotaExceeded = "QuotaExceeded"
+	// ConditionLimitRangeAdjusted is True while the requests or limits of the MyApp's
+	// containers are adjusted to the LimitRanges of its namespace, with reason Violation when
+	// they can't be and the pods would be rejected.
+	ConditionLimitRangeAdjusted = "LimitRangeAdjusted"
+	// ConditionPolicyViolation is True while the MyApp's pods would be rejected by the pod
+	// security level its namespace enforces, with reason PodSecurity and the offending fields
+	// in the message, or, when the operator dry-runs them, by the cluster's admission, with
+	// reason AdmissionDenied and the denial in the message. With reason HostNamespaces, the
+	// MyApp may not use the host's namespaces and its children are left as they are.
+	ConditionPolicyViolation = "PolicyViolation"
+	// ConditionChildAdmissionDenied is True while applying children is denied by admission
+	// webhooks or policies. The message holds the denials verbatim.
+	ConditionChildAdmissionDenied = "ChildAdmissionDenied"
+)
+
+// MyAppStatus defines the observed state of MyApp
 type MyAppStatus struct {
-	Healthy bool     `json:"healthy"`
-	Errors  []string `json:"errors,omitempty"`
-	Phase   string   `json:"phase,omitempty"`
+	// ObservedGeneration is the metadata.generation the status was computed for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Replicas is the effective number of replicas of the Deployment, after defaulting and
+	// the operator's bounds, or as scaled by the HorizontalPodAutoscaler.
+	Replicas int32 `json:"replicas,omitempty"`
+	// EstimatedCost is the estimated monthly cost of the resource requests of the MyApp's
+	// pods, in the currency of the operator's prices, e.g. "42.17". It is only set when the
+	// operator is configured with prices.
+	EstimatedCost string `json:"estimatedCost,omitempty"`
+	// ExpirationTime is when the MyApp expires, if it has a TTL or Spec.ExpiresAt.
+	ExpirationTime *metav1.Time `json:"expirationTime,omitempty"`
+	// ExpiresIn is the time left until ExpirationTime, rounded down to days, hours or
+	// minutes, e.g. "3d", or "expired". It is refreshed as it changes.
+	ExpiresIn string `json:"expiresIn,omitempty"`
+	// Recommendations are the resource requests the VerticalPodAutoscaler recommends for the
+	// MyApp's containers, when Spec.Autoscaling.Vertical is set.
+	Recommendations []ContainerRecommendation `json:"recommendations,omitempty"`
+	// RightSizing recommends requests from the actual usage of the MyApp's container when
+	// its requests are more than 50% off. It is only set when the operator is configured
+	// with a Prometheus endpoint.
+	RightSizing *RightSizingStatus `json:"rightSizing,omitempty"`
+	// Healthy is true when Phase is Healthy.
+	Healthy bool `json:"healthy"`
+	// Errors lists the messages explaining why the MyApp is Degraded.
+	Errors []string `json:"errors,omitempty"`
+	// Phase is one of Progressing, Healthy or Degraded.
+	// +kubebuilder:validation:Enum=Progressing;Healthy;Degraded
+	Phase string `json:"phase,omitempty"`
 	// Conditions follows the API specification "Conditions" properties.
 	// https://github.com/kubernetes/community/blob/master/contributors/devel/sig-architecture/api-conventions.md#typical-status-properties
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Targets reports the state of the MyApp in each cluster in Spec.Targets.
+	// +listType=map
+	// +listMapKey=name
+	Targets []TargetStatus `json:"targets,omitempty"`
+	// Resources lists the children the controller manages for the MyApp in the local cluster.
+	Resources []ResourceStatus `json:"resources,omitempty"`
+	// LastRun is the most recent run of a Job or CronJob workload.
+	LastRun *JobRunStatus `json:"lastRun,omitempty"`
+	// LastRunTrigger is the value of the myapp.example.com/run annotation last acted on.
+	LastRunTrigger string `json:"lastRunTrigger,omitempty"`
+	// Tasks reports the most recent run of the tasks in Spec.Tasks that ran.
+	// +listType=map
+	// +listMapKey=name
+	Tasks []TaskStatus `json:"tasks,omitempty"`
+	// LastTaskTrigger is the value of the myapp.example.com/run-task annotation last acted on.
+	LastTaskTrigger string `json:"lastTaskTrigger,omitempty"`
+	// Debug reports the last debugging session the myapp.example.com/debug annotation asked for.
+	Debug *DebugStatus `json:"debug,omitempty"`
+	// LastDebugTrigger is the value of the myapp.example.com/debug annotation last acted on.
+	LastDebugTrigger string `json:"lastDebugTrigger,omitempty"`
+}
+
+type RightSizingStatus struct {
+	// Requests are the recommended requests of the resources that are off.
+	Requests corev1.ResourceList `json:"requests"`
+	// Applied is true when Spec.AutoRightSize applies them.
+	Applied bool `json:"applied,omitempty"`
+	// Time the usage was analyzed.
+	Time metav1.Time `json:"time"`
+}
+
+type ContainerRecommendation struct {
+	ContainerName string `json:"containerName"`
+	// Target is the recommended requests.
+	Target corev1.ResourceList `json:"target,omitempty"`
+	// LowerBound and UpperBound are the requests below or above which the container is
+	// likely to be under or over provisioned.
+	LowerBound corev1.ResourceList `json:"lowerBound,omitempty"`
+	UpperBound corev1.ResourceList `json:"upperBound,omitempty"`
+}
+
+type ResourceStatus struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid,omitempty"`
+	// Ready is true when the child reached the state it was applied for, e.g. a Deployment
+	// that is available and fully rolled out.
+	Ready bool `json:"ready"`
+}
+
+type TargetStatus struct {
+	// Name of the cluster.
+	Name string `json:"name"`
+	// Ready is true when the Deployment in the cluster is available and fully rolled out.
+	Ready bool `json:"ready"`
+	// AvailableReplicas of the Deployment in the cluster.
+	AvailableReplicas int32 `json:"availableReplicas,omitempty"`
+	// Message explains why the cluster isn't ready.
+	Message string `json:"message,omitempty"`
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -96,6 +787,12 @@ func (in *MyAppList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretRotationSpec) DeepCopyInto(out *SecretRotationSpec) {
+	*out = *in
+	out.Secrets = append([]string(nil), in.Secrets...)
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MyAppSpec) DeepCopyInto(out *MyAppSpec) {
 	*out = *in
@@ -105,6 +802,234 @@ func (in *MyAppSpec) DeepCopyInto(out *MyAppSpec) {
 		**out = **in
 	}
 	out.Args = append([]string(nil), in.Args...)
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	out.Architectures = append([]Architecture(nil), in.Architectures...)
+	if in.Job != nil {
+		in, out := &in.Job, &out.Job
+		*out = new(JobSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tasks != nil {
+		in, out := &in.Tasks, &out.Tasks
+		*out = make([]TaskSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TemplateRef != nil {
+		in, out := &in.TemplateRef, &out.TemplateRef
+		*out = new(TemplateRef)
+		**out = **in
+	}
+	if in.Resources != nil {
+		out.Resources = in.Resources.DeepCopy()
+	}
+	if in.LivenessProbe != nil {
+		out.LivenessProbe = in.LivenessProbe.DeepCopy()
+	}
+	if in.ReadinessProbe != nil {
+		out.ReadinessProbe = in.ReadinessProbe.DeepCopy()
+	}
+	if in.WarmupGate != nil {
+		in, out := &in.WarmupGate, &out.WarmupGate
+		*out = new(WarmupGateSpec)
+		**out = **in
+	}
+	if in.Warmup != nil {
+		in, out := &in.Warmup, &out.Warmup
+		*out = new(WarmupSpec)
+		**out = **in
+	}
+	if in.Logging != nil {
+		in, out := &in.Logging, &out.Logging
+		*out = new(LoggingSpec)
+		**out = **in
+	}
+	if in.Profiling != nil {
+		in, out := &in.Profiling, &out.Profiling
+		*out = new(ProfilingSpec)
+		**out = **in
+	}
+	if in.Timezone != nil {
+		in, out := &in.Timezone, &out.Timezone
+		*out = new(TimezoneSpec)
+		**out = **in
+	}
+	if in.SecurityContext != nil {
+		out.SecurityContext = in.SecurityContext.DeepCopy()
+	}
+	if in.ServiceMesh != nil {
+		in, out := &in.ServiceMesh, &out.ServiceMesh
+		*out = new(ServiceMeshSpec)
+		**out = **in
+	}
+	if in.ExternalSecrets != nil {
+		in, out := &in.ExternalSecrets, &out.ExternalSecrets
+		*out = make([]ExternalSecretRef, len(*in))
+		copy(*out, *in)
+	}
+	if in.SecretRotation != nil {
+		in, out := &in.SecretRotation, &out.SecretRotation
+		*out = new(SecretRotationSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Service != nil {
+		in, out := &in.Service, &out.Service
+		*out = new(ServiceSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Ingress != nil {
+		in, out := &in.Ingress, &out.Ingress
+		*out = new(IngressSpec)
+		**out = **in
+	}
+	if in.Networking != nil {
+		in, out := &in.Networking, &out.Networking
+		*out = new(NetworkingSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]ClusterTargetRef, len(*in))
+		copy(*out, *in)
+	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(AutoscalingSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NetworkPolicy != nil {
+		in, out := &in.NetworkPolicy, &out.NetworkPolicy
+		*out = new(NetworkPolicySpec)
+		(*out).AllowedNamespaces = append([]string(nil), (*in).AllowedNamespaces...)
+	}
+	if in.IgnoreDifferences != nil {
+		in, out := &in.IgnoreDifferences, &out.IgnoreDifferences
+		*out = make([]IgnoreDifference, len(*in))
+		for i := range *in {
+			(*out)[i].Kind = (*in)[i].Kind
+			(*out)[i].JSONPointers = append([]string(nil), (*in)[i].JSONPointers...)
+		}
+	}
+	if in.TTLSecondsAfterCreation != nil {
+		in, out := &in.TTLSecondsAfterCreation, &out.TTLSecondsAfterCreation
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ExpiresAt != nil {
+		in, out := &in.ExpiresAt, &out.ExpiresAt
+		*out = (*in).DeepCopy()
+	}
+	if in.GracefulShutdown != nil {
+		in, out := &in.GracefulShutdown, &out.GracefulShutdown
+		*out = new(GracefulShutdownSpec)
+		**out = **in
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobSpec) DeepCopyInto(out *JobSpec) {
+	*out = *in
+	if in.BackoffLimit != nil {
+		in, out := &in.BackoffLimit, &out.BackoffLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SuccessfulJobsHistoryLimit != nil {
+		in, out := &in.SuccessfulJobsHistoryLimit, &out.SuccessfulJobsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedJobsHistoryLimit != nil {
+		in, out := &in.FailedJobsHistoryLimit, &out.FailedJobsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TaskSpec) DeepCopyInto(out *TaskSpec) {
+	*out = *in
+	out.Command = append([]string(nil), in.Command...)
+	out.Args = append([]string(nil), in.Args...)
+	if in.BackoffLimit != nil {
+		in, out := &in.BackoffLimit, &out.BackoffLimit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DebugStatus) DeepCopyInto(out *DebugStatus) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TaskStatus) DeepCopyInto(out *TaskStatus) {
+	*out = *in
+	in.JobRunStatus.DeepCopyInto(&out.JobRunStatus)
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobRunStatus) DeepCopyInto(out *JobRunStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoscalingSpec) DeepCopyInto(out *AutoscalingSpec) {
+	*out = *in
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetCPUUtilizationPercentage != nil {
+		in, out := &in.TargetCPUUtilizationPercentage, &out.TargetCPUUtilizationPercentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Vertical != nil {
+		in, out := &in.Vertical, &out.Vertical
+		*out = new(VerticalAutoscalingSpec)
+		**out = **in
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkingSpec) DeepCopyInto(out *NetworkingSpec) {
+	*out = *in
+	if in.Gateway != nil {
+		in, out := &in.Gateway, &out.Gateway
+		*out = new(GatewayRef)
+		**out = **in
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceSpec) DeepCopyInto(out *ServiceSpec) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MyAppSpec.
@@ -119,10 +1044,67 @@ func (in *MyAppSpec) DeepCopy() *MyAppSpec {
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MyAppStatus) DeepCopyInto(out *MyAppStatus) {
+	*out = *in
 	out.Conditions = append([]metav1.Condition(nil), in.Conditions...)
 	out.Errors = append([]string(nil), in.Errors...)
-	out.Phase = in.Phase
-	out.Healthy = in.Healthy
+	if in.ExpirationTime != nil {
+		in, out := &in.ExpirationTime, &out.ExpirationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]TargetStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]ResourceStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.RightSizing != nil {
+		in, out := &in.RightSizing, &out.RightSizing
+		*out = new(RightSizingStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastRun != nil {
+		in, out := &in.LastRun, &out.LastRun
+		*out = new(JobRunStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Debug != nil {
+		in, out := &in.Debug, &out.Debug
+		*out = new(DebugStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tasks != nil {
+		in, out := &in.Tasks, &out.Tasks
+		*out = make([]TaskStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Recommendations != nil {
+		in, out := &in.Recommendations, &out.Recommendations
+		*out = make([]ContainerRecommendation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RightSizingStatus) DeepCopyInto(out *RightSizingStatus) {
+	*out = *in
+	out.Requests = in.Requests.DeepCopy()
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerRecommendation) DeepCopyInto(out *ContainerRecommendation) {
+	*out = *in
+	out.Target = in.Target.DeepCopy()
+	out.LowerBound = in.LowerBound.DeepCopy()
+	out.UpperBound = in.UpperBound.DeepCopy()
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MyAppStatus.
@@ -136,6 +1118,7 @@ func (in *MyAppStatus) DeepCopy() *MyAppStatus {
 }
 
 // MyAppList contains a list of MyApp
+// +kubebuilder:object:root=true
 type MyAppList struct {
 	metav1.TypeMeta `json:",inline"`
 	metav1.ListMeta `json:"metadata,omitempty"`
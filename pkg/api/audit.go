@@ -0,0 +1,111 @@
+package api
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// MyAppAudit holds the most recent mutations the controller performed in a namespace.
+// +kubebuilder:object:root=true
+type MyAppAudit struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Entries []AuditEntry `json:"entries,omitempty"`
+}
+
+// AuditEntry describes a single Create/Update/Patch/Delete issued by the controller.
+type AuditEntry struct {
+	Time        metav1.Time `json:"time"`
+	ReconcileID string      `json:"reconcileID,omitempty"`
+	Verb        string      `json:"verb"`
+	APIVersion  string      `json:"apiVersion,omitempty"`
+	Kind        string      `json:"kind"`
+	Namespace   string      `json:"namespace,omitempty"`
+	Name        string      `json:"name"`
+	// Diff is a short summary of the fields the mutation touched.
+	Diff  string `json:"diff,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// MyAppAuditList contains a list of MyAppAudit
+// +kubebuilder:object:root=true
+type MyAppAuditList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MyAppAudit `json:"items"`
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppAudit) DeepCopyInto(out *MyAppAudit) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Entries != nil {
+		in, out := &in.Entries, &out.Entries
+		*out = make([]AuditEntry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MyAppAudit.
+func (in *MyAppAudit) DeepCopy() *MyAppAudit {
+	if in == nil {
+		return nil
+	}
+	out := new(MyAppAudit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MyAppAudit) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuditEntry) DeepCopyInto(out *AuditEntry) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppAuditList) DeepCopyInto(out *MyAppAuditList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MyAppAudit, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MyAppAuditList.
+func (in *MyAppAuditList) DeepCopy() *MyAppAuditList {
+	if in == nil {
+		return nil
+	}
+	out := new(MyAppAuditList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MyAppAuditList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+func init() { //nolint:gochecknoinits
+	SchemeBuilder.Register(&MyAppAudit{}, &MyAppAuditList{})
+}
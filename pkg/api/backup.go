@@ -0,0 +1,287 @@
+package api
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// MyAppBackup periodically snapshots a MyApp in its namespace.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="App",type=string,JSONPath=".spec.appName"
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=".spec.schedule"
+// +kubebuilder:printcolumn:name="Last Backup",type=date,JSONPath=".status.lastBackupTime"
+type MyAppBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MyAppBackupSpec   `json:"spec,omitempty"`
+	Status MyAppBackupStatus `json:"status,omitempty"`
+}
+
+type MyAppBackupSpec struct {
+	// AppName is the MyApp that is backed up.
+	AppName string `json:"appName"`
+	// Schedule is a cron expression, e.g. "0 3 * * *". A single snapshot is taken when empty.
+	Schedule string `json:"schedule,omitempty"`
+	// VolumeSnapshots additionally snapshots the contents of the PersistentVolumeClaims labeled
+	// with the MyApp's labels, with VolumeSnapshots of this class.
+	VolumeSnapshots *VolumeSnapshotSpec `json:"volumeSnapshots,omitempty"`
+	// KeepLast is the number of snapshots retained. Defaults to 5.
+	// +kubebuilder:validation:Minimum=1
+	KeepLast int32 `json:"keepLast,omitempty"`
+}
+
+type VolumeSnapshotSpec struct {
+	// ClassName is the VolumeSnapshotClass to use. The cluster default class is used when empty.
+	ClassName string `json:"className,omitempty"`
+}
+
+type MyAppBackupStatus struct {
+	// LastBackupTime is when the most recent snapshot was taken.
+	LastBackupTime *metav1.Time `json:"lastBackupTime,omitempty"`
+	// NextBackupTime is when the next snapshot is scheduled.
+	NextBackupTime *metav1.Time `json:"nextBackupTime,omitempty"`
+	// Snapshots are the retained snapshots, most recent first.
+	Snapshots []BackupSnapshot `json:"snapshots,omitempty"`
+	// Error explains why the last snapshot failed or the schedule is invalid.
+	Error string `json:"error,omitempty"`
+}
+
+type BackupSnapshot struct {
+	// Name of the snapshot. The MyApp's spec and the manifests of its children are stored in
+	// the ConfigMap of the same name.
+	Name string      `json:"name"`
+	Time metav1.Time `json:"time"`
+	// VolumeSnapshots maps the name of every snapshotted PersistentVolumeClaim to its VolumeSnapshot.
+	VolumeSnapshots map[string]string `json:"volumeSnapshots,omitempty"`
+}
+
+// MyAppBackupList contains a list of MyAppBackup
+// +kubebuilder:object:root=true
+type MyAppBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MyAppBackup `json:"items"`
+}
+
+// Restore phases.
+const (
+	RestorePhaseCompleted = "Completed"
+	RestorePhaseFailed    = "Failed"
+)
+
+// MyAppRestore restores a MyApp from a snapshot of a MyAppBackup in its namespace. It is
+// processed once.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Backup",type=string,JSONPath=".spec.backupName"
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=".status.phase"
+type MyAppRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MyAppRestoreSpec   `json:"spec,omitempty"`
+	Status MyAppRestoreStatus `json:"status,omitempty"`
+}
+
+type MyAppRestoreSpec struct {
+	// BackupName is the MyAppBackup to restore from.
+	BackupName string `json:"backupName"`
+	// SnapshotName is the snapshot to restore. Defaults to the most recent one.
+	SnapshotName string `json:"snapshotName,omitempty"`
+}
+
+type MyAppRestoreStatus struct {
+	// Phase is Completed or Failed once the restore was processed.
+	// +kubebuilder:validation:Enum=Completed;Failed
+	Phase string `json:"phase,omitempty"`
+	// SnapshotName is the snapshot that was restored.
+	SnapshotName string `json:"snapshotName,omitempty"`
+	// Message explains a failure, or lists the PersistentVolumeClaims that already existed
+	// and were not restored.
+	Message        string       `json:"message,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// MyAppRestoreList contains a list of MyAppRestore
+// +kubebuilder:object:root=true
+type MyAppRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MyAppRestore `json:"items"`
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppBackup) DeepCopyInto(out *MyAppBackup) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MyAppBackup.
+func (in *MyAppBackup) DeepCopy() *MyAppBackup {
+	if in == nil {
+		return nil
+	}
+	out := new(MyAppBackup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MyAppBackup) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppBackupSpec) DeepCopyInto(out *MyAppBackupSpec) {
+	*out = *in
+	if in.VolumeSnapshots != nil {
+		in, out := &in.VolumeSnapshots, &out.VolumeSnapshots
+		*out = new(VolumeSnapshotSpec)
+		**out = **in
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppBackupStatus) DeepCopyInto(out *MyAppBackupStatus) {
+	*out = *in
+	if in.LastBackupTime != nil {
+		in, out := &in.LastBackupTime, &out.LastBackupTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextBackupTime != nil {
+		in, out := &in.NextBackupTime, &out.NextBackupTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Snapshots != nil {
+		in, out := &in.Snapshots, &out.Snapshots
+		*out = make([]BackupSnapshot, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupSnapshot) DeepCopyInto(out *BackupSnapshot) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.VolumeSnapshots != nil {
+		in, out := &in.VolumeSnapshots, &out.VolumeSnapshots
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppBackupList) DeepCopyInto(out *MyAppBackupList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MyAppBackup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MyAppBackupList.
+func (in *MyAppBackupList) DeepCopy() *MyAppBackupList {
+	if in == nil {
+		return nil
+	}
+	out := new(MyAppBackupList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MyAppBackupList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppRestore) DeepCopyInto(out *MyAppRestore) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MyAppRestore.
+func (in *MyAppRestore) DeepCopy() *MyAppRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(MyAppRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MyAppRestore) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppRestoreStatus) DeepCopyInto(out *MyAppRestoreStatus) {
+	*out = *in
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppRestoreList) DeepCopyInto(out *MyAppRestoreList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MyAppRestore, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MyAppRestoreList.
+func (in *MyAppRestoreList) DeepCopy() *MyAppRestoreList {
+	if in == nil {
+		return nil
+	}
+	out := new(MyAppRestoreList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MyAppRestoreList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+func init() { //nolint:gochecknoinits
+	SchemeBuilder.Register(&MyAppBackup{}, &MyAppBackupList{}, &MyAppRestore{}, &MyAppRestoreList{})
+}
@@ -0,0 +1,7 @@
+// Package api contains the example.com/v1alpha1 API types. The CRDs in configs/crd are
+// generated from them and their kubebuilder markers with `go generate ./...`.
+// +groupName=example.com
+// +versionName=v1alpha1
+package api
+
+//go:generate go run -C ../../cmds/generate . -root ../..
@@ -0,0 +1,133 @@
+package api
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// MyAppPreview runs a short-lived copy of a MyApp in its namespace, e.g. the build of a pull
+// request, under its own host. The copy is a MyApp named after the preview, and is deleted
+// with it once its TTL expires.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="App",type=string,JSONPath=".spec.appName"
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=".status.url"
+// +kubebuilder:printcolumn:name="Expires",type=date,JSONPath=".status.expirationTime"
+type MyAppPreview struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MyAppPreviewSpec   `json:"spec,omitempty"`
+	Status MyAppPreviewStatus `json:"status,omitempty"`
+}
+
+type MyAppPreviewSpec struct {
+	// AppName is the MyApp that is copied.
+	AppName string `json:"appName"`
+	// Image overrides the image of the copy, e.g. with the build of a branch.
+	Image string `json:"image,omitempty"`
+	// Host the copy's Ingress routes. Defaults to the preview's name prefixed to the host of
+	// the MyApp, when it has an Ingress.
+	Host string `json:"host,omitempty"`
+	// TTL is how long after its creation the preview and its copy are deleted. Defaults to 24h.
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+}
+
+type MyAppPreviewStatus struct {
+	// URL the copy is reached at, when the MyApp has an Ingress.
+	URL string `json:"url,omitempty"`
+	// ExpirationTime is when the preview is deleted.
+	ExpirationTime *metav1.Time `json:"expirationTime,omitempty"`
+	// Error explains why the copy can't be created or updated.
+	Error string `json:"error,omitempty"`
+}
+
+// MyAppPreviewList contains a list of MyAppPreview
+// +kubebuilder:object:root=true
+type MyAppPreviewList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MyAppPreview `json:"items"`
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppPreview) DeepCopyInto(out *MyAppPreview) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MyAppPreview.
+func (in *MyAppPreview) DeepCopy() *MyAppPreview {
+	if in == nil {
+		return nil
+	}
+	out := new(MyAppPreview)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MyAppPreview) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppPreviewSpec) DeepCopyInto(out *MyAppPreviewSpec) {
+	*out = *in
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppPreviewStatus) DeepCopyInto(out *MyAppPreviewStatus) {
+	*out = *in
+	if in.ExpirationTime != nil {
+		in, out := &in.ExpirationTime, &out.ExpirationTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppPreviewList) DeepCopyInto(out *MyAppPreviewList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MyAppPreview, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MyAppPreviewList.
+func (in *MyAppPreviewList) DeepCopy() *MyAppPreviewList {
+	if in == nil {
+		return nil
+	}
+	out := new(MyAppPreviewList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MyAppPreviewList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+func init() { //nolint:gochecknoinits
+	SchemeBuilder.Register(&MyAppPreview{}, &MyAppPreviewList{})
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// MyAppTemplate holds base configuration shared by the MyApps referencing it. It is cluster scoped.
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+type MyAppTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec MyAppTemplateSpec `json:"spec,omitempty"`
+}
+
+// MyAppTemplateSpec holds the defaults of the fields of MyAppSpec of the same name.
+type MyAppTemplateSpec struct {
+	Resources       *corev1.ResourceRequirements `json:"resources,omitempty"`
+	LivenessProbe   *corev1.Probe                `json:"livenessProbe,omitempty"`
+	ReadinessProbe  *corev1.Probe                `json:"readinessProbe,omitempty"`
+	SecurityContext *corev1.SecurityContext      `json:"securityContext,omitempty"`
+}
+
+// MyAppTemplateList contains a list of MyAppTemplate
+// +kubebuilder:object:root=true
+type MyAppTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MyAppTemplate `json:"items"`
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppTemplate) DeepCopyInto(out *MyAppTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MyAppTemplate.
+func (in *MyAppTemplate) DeepCopy() *MyAppTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(MyAppTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MyAppTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppTemplateSpec) DeepCopyInto(out *MyAppTemplateSpec) {
+	*out = *in
+	if in.Resources != nil {
+		out.Resources = in.Resources.DeepCopy()
+	}
+	if in.LivenessProbe != nil {
+		out.LivenessProbe = in.LivenessProbe.DeepCopy()
+	}
+	if in.ReadinessProbe != nil {
+		out.ReadinessProbe = in.ReadinessProbe.DeepCopy()
+	}
+	if in.SecurityContext != nil {
+		out.SecurityContext = in.SecurityContext.DeepCopy()
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MyAppTemplateList) DeepCopyInto(out *MyAppTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MyAppTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MyAppTemplateList.
+func (in *MyAppTemplateList) DeepCopy() *MyAppTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(MyAppTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MyAppTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+func init() { //nolint:gochecknoinits
+	SchemeBuilder.Register(&MyAppTemplate{}, &MyAppTemplateList{})
+}
@@ -0,0 +1,237 @@
+// Package audit records every mutation the controller performs against the API server.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+)
+
+const (
+	VerbCreate = "create"
+	VerbUpdate = "update"
+	VerbPatch  = "patch"
+	VerbDelete = "delete"
+
+	// maxDiffFields caps how many changed field paths end up in a diff summary.
+	maxDiffFields = 10
+)
+
+// Entry is a single audited mutation.
+type Entry struct {
+	Time        time.Time
+	ReconcileID string
+	Verb        string
+	APIVersion  string
+	Kind        string
+	Namespace   string
+	Name        string
+	Diff        string
+	Err         error
+}
+
+// Sink receives audit entries. Record must not block the caller for long.
+type Sink interface {
+	Record(ctx context.Context, e Entry)
+}
+
+// LogSink writes every entry as a structured log line.
+type LogSink struct {
+	Log logr.Logger
+}
+
+func (s LogSink) Record(_ context.Context, e Entry) {
+	kv := []interface{}{
+		"verb", e.Verb,
+		"apiVersion", e.APIVersion,
+		"kind", e.Kind,
+		"namespace", e.Namespace,
+		"name", e.Name,
+		"reconcileID", e.ReconcileID,
+		"diff", e.Diff,
+		"timestamp", e.Time.UTC().Format(time.RFC3339Nano),
+	}
+	if e.Err != nil {
+		s.Log.Error(e.Err, "mutation failed", kv...)
+		return
+	}
+	s.Log.Info("mutation", kv...)
+}
+
+// NewClient wraps c so every Create, Update, Patch and Delete is reported to sinks.
+// Reads are passed through untouched.
+func NewClient(c client.Client, sinks ...Sink) client.Client {
+	return &auditClient{Client: c, sinks: sinks}
+}
+
+type auditClient struct {
+	client.Client
+	sinks []Sink
+}
+
+func (c *auditClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	err := c.Client.Create(ctx, obj, opts...)
+	c.record(ctx, VerbCreate, obj, "created", err)
+	return err
+}
+
+func (c *auditClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	diff := c.updateDiff(ctx, obj)
+	err := c.Client.Update(ctx, obj, opts...)
+	c.record(ctx, VerbUpdate, obj, diff, err)
+	return err
+}
+
+func (c *auditClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	diff := patchDiff(obj, patch)
+	err := c.Client.Patch(ctx, obj, patch, opts...)
+	c.record(ctx, VerbPatch, obj, diff, err)
+	return err
+}
+
+func (c *auditClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	err := c.Client.Delete(ctx, obj, opts...)
+	c.record(ctx, VerbDelete, obj, "deleted", err)
+	return err
+}
+
+func (c *auditClient) record(ctx context.Context, verb string, obj client.Object, diff string, err error) {
+	e := Entry{
+		Time:        time.Now(),
+		ReconcileID: string(controller.ReconcileIDFromContext(ctx)),
+		Verb:        verb,
+		Namespace:   obj.GetNamespace(),
+		Name:        obj.GetName(),
+		Diff:        diff,
+		Err:         err,
+	}
+	if gvk, gvkErr := c.GroupVersionKindFor(obj); gvkErr == nil {
+		e.APIVersion, e.Kind = gvk.GroupVersion().String(), gvk.Kind
+	}
+	for _, s := range c.sinks {
+		s.Record(ctx, e)
+	}
+}
+
+// updateDiff compares obj against the currently cached copy and summarizes the changed fields.
+func (c *auditClient) updateDiff(ctx context.Context, obj client.Object) string {
+	live, ok := obj.DeepCopyObject().(client.Object)
+	if !ok {
+		return ""
+	}
+	if err := c.Client.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+		return ""
+	}
+	before, err := toMap(live)
+	if err != nil {
+		return ""
+	}
+	after, err := toMap(obj)
+	if err != nil {
+		return ""
+	}
+	var paths []string
+	diffPaths("", before, after, &paths)
+	return summarize(paths)
+}
+
+// patchDiff summarizes the fields a patch sets.
+func patchDiff(obj client.Object, patch client.Patch) string {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return ""
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return string(patch.Type())
+	}
+	var paths []string
+	// JSON patches are a list of operations, everything else is a (partial) object.
+	if ops, ok := doc.([]interface{}); ok {
+		for _, op := range ops {
+			if m, ok := op.(map[string]interface{}); ok {
+				paths = append(paths, fmt.Sprintf("%v %v", m["op"], m["path"]))
+			}
+		}
+	} else {
+		diffPaths("", nil, doc, &paths)
+	}
+	return summarize(paths)
+}
+
+func toMap(obj client.Object) (map[string]interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	return m, json.Unmarshal(data, &m)
+}
+
+// ignoredPaths are bookkeeping fields the API server maintains that would
+// otherwise show up in every diff.
+var ignoredPaths = map[string]bool{
+	"apiVersion":                 true,
+	"kind":                       true,
+	"status":                     true,
+	"metadata.resourceVersion":   true,
+	"metadata.managedFields":     true,
+	"metadata.generation":        true,
+	"metadata.creationTimestamp": true,
+	"metadata.uid":               true,
+}
+
+// diffPaths appends the dotted paths of every leaf that differs between a and b.
+func diffPaths(prefix string, a, b interface{}, out *[]string) {
+	if ignoredPaths[prefix] {
+		return
+	}
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	// A missing side of an object is compared leaf by leaf against the other.
+	if a == nil && bok {
+		aok = true
+	}
+	if b == nil && aok {
+		bok = true
+	}
+	if !aok || !bok {
+		if !reflect.DeepEqual(a, b) {
+			*out = append(*out, prefix)
+		}
+		return
+	}
+	keys := map[string]bool{}
+	for k := range am {
+		keys[k] = true
+	}
+	for k := range bm {
+		keys[k] = true
+	}
+	for k := range keys {
+		p := k
+		if prefix != "" {
+			p = prefix + "." + k
+		}
+		diffPaths(p, am[k], bm[k], out)
+	}
+}
+
+func summarize(paths []string) string {
+	if len(paths) == 0 {
+		return "no changes"
+	}
+	sort.Strings(paths)
+	if len(paths) > maxDiffFields {
+		return fmt.Sprintf("%s (and %d more)", strings.Join(paths[:maxDiffFields], ", "), len(paths)-maxDiffFields)
+	}
+	return strings.Join(paths, ", ")
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ResourceName is the name of the MyAppAudit object kept in each namespace.
+	ResourceName = "myapp-audit"
+
+	// maxEntries bounds the number of entries retained per MyAppAudit.
+	maxEntries = 100
+)
+
+// +kubebuilder:rbac:groups=example.com,resources=myappaudits,verbs=get;list;watch;create;update
+
+// ResourceSink appends entries to a MyAppAudit object in the namespace of the mutated object.
+// Cluster scoped objects are not recorded.
+type ResourceSink struct {
+	// Client must not be an audited client, otherwise every record would audit itself.
+	Client client.Client
+	Log    logr.Logger
+
+	mu sync.Mutex
+}
+
+func (s *ResourceSink) Record(ctx context.Context, e Entry) {
+	if e.Namespace == "" {
+		return
+	}
+	entry := api.AuditEntry{
+		Time:        metav1.NewTime(e.Time),
+		ReconcileID: e.ReconcileID,
+		Verb:        e.Verb,
+		APIVersion:  e.APIVersion,
+		Kind:        e.Kind,
+		Namespace:   e.Namespace,
+		Name:        e.Name,
+		Diff:        e.Diff,
+	}
+	if e.Err != nil {
+		entry.Error = e.Err.Error()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append(ctx, entry); err != nil {
+		s.Log.Error(err, "unable to record audit entry", "namespace", e.Namespace)
+	}
+}
+
+func (s *ResourceSink) append(ctx context.Context, entry api.AuditEntry) error {
+	key := client.ObjectKey{Namespace: entry.Namespace, Name: ResourceName}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		audit := &api.MyAppAudit{}
+		err := s.Client.Get(ctx, key, audit)
+		if apierrors.IsNotFound(err) {
+			audit.Namespace, audit.Name = key.Namespace, key.Name
+			audit.Entries = []api.AuditEntry{entry}
+			return s.Client.Create(ctx, audit)
+		}
+		if err != nil {
+			return err
+		}
+		audit.Entries = append(audit.Entries, entry)
+		if n := len(audit.Entries); n > maxEntries {
+			audit.Entries = audit.Entries[n-maxEntries:]
+		}
+		return s.Client.Update(ctx, audit)
+	})
+}
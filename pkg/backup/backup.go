@@ -0,0 +1,334 @@
+// Package backup snapshots MyApps on a schedule and restores them.
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robfig/cron/v3"
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	defaultKeepLast = 5
+
+	// appKey is the ConfigMap key holding the MyApp of a snapshot. Its children are stored
+	// under their kind, PersistentVolumeClaims under their kind and name.
+	appKey = "MyApp.json"
+)
+
+// VolumeSnapshotGVK identifies the CSI VolumeSnapshot kind.
+var VolumeSnapshotGVK = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshot"}
+
+var backupsTaken = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "myapp_backups_total",
+	Help: "Number of MyApp snapshots taken, by result",
+}, []string{"result"})
+
+func init() {
+	metrics.Registry.MustRegister(backupsTaken)
+}
+
+// +kubebuilder:rbac:groups=example.com,resources=myappbackups;myapprestores,verbs=get;list;watch
+// +kubebuilder:rbac:groups=example.com,resources=myappbackups/status;myapprestores/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;create;delete
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;create
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;create;delete
+
+// BackupReconciler takes the snapshots of MyAppBackups. Each snapshot is a ConfigMap owned
+// by the MyAppBackup holding the MyApp and the manifests of its children, and optionally
+// VolumeSnapshots of the MyApp's PersistentVolumeClaims.
+type BackupReconciler struct {
+	Client client.Client
+	// Reader lists PersistentVolumeClaims, which aren't cached.
+	Reader client.Reader
+	Scheme *runtime.Scheme
+}
+
+// SetupWithManager registers the MyAppBackup and MyAppRestore controllers with manager.
+func SetupWithManager(manager ctrl.Manager, apiClient client.Client) error {
+	backups := &BackupReconciler{Client: apiClient, Reader: manager.GetAPIReader(), Scheme: manager.GetScheme()}
+	if err := ctrl.NewControllerManagedBy(manager).For(&api.MyAppBackup{}).Complete(backups); err != nil {
+		return err
+	}
+	restores := &RestoreReconciler{Client: apiClient, Reader: manager.GetAPIReader()}
+	return ctrl.NewControllerManagedBy(manager).For(&api.MyAppRestore{}).Complete(restores)
+}
+
+func (r *BackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	backup := &api.MyAppBackup{}
+	if err := r.Client.Get(ctx, req.NamespacedName, backup); err != nil {
+		// Snapshots are garbage collected through owner references.
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	var schedule cron.Schedule
+	if backup.Spec.Schedule != "" {
+		var err error
+		if schedule, err = cron.ParseStandard(backup.Spec.Schedule); err != nil {
+			// Nothing to do until the schedule is fixed.
+			backup.Status.Error = fmt.Sprintf("invalid schedule: %v", err)
+			backup.Status.NextBackupTime = nil
+			return ctrl.Result{}, r.Client.Status().Update(ctx, backup)
+		}
+	}
+
+	now := time.Now()
+	if next, ok := nextBackup(backup, schedule); !ok {
+		return ctrl.Result{}, nil
+	} else if next.After(now) {
+		if t := metav1.NewTime(next); backup.Status.NextBackupTime == nil || !backup.Status.NextBackupTime.Equal(&t) {
+			backup.Status.NextBackupTime = &t
+			if err := r.Client.Status().Update(ctx, backup); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{RequeueAfter: next.Sub(now)}, nil
+	}
+
+	snapshot, err := r.snapshot(ctx, backup, now)
+	if err != nil {
+		log.Error(err, "unable to snapshot MyApp", "app", backup.Spec.AppName)
+		backupsTaken.WithLabelValues("error").Inc()
+		// The snapshot is retried with backoff.
+		backup.Status.Error = err.Error()
+		if err := r.Client.Status().Update(ctx, backup); err != nil {
+			log.Error(err, "unable to update backup status")
+		}
+		return ctrl.Result{}, err
+	}
+	log.Info("snapshotted MyApp", "app", backup.Spec.AppName, "snapshot", snapshot.Name)
+	backupsTaken.WithLabelValues("success").Inc()
+	backup.Status.Error = ""
+	backup.Status.Snapshots = append([]api.BackupSnapshot{*snapshot}, backup.Status.Snapshots...)
+	if err := r.prune(ctx, backup); err != nil {
+		log.Error(err, "unable to delete expired snapshots")
+	}
+
+	t := metav1.NewTime(now)
+	backup.Status.LastBackupTime = &t
+	backup.Status.NextBackupTime = nil
+	var result ctrl.Result
+	if schedule != nil {
+		next := metav1.NewTime(schedule.Next(now))
+		backup.Status.NextBackupTime = &next
+		result.RequeueAfter = next.Sub(now)
+	}
+	return result, r.Client.Status().Update(ctx, backup)
+}
+
+// nextBackup returns when the next snapshot of backup is due. It returns false when a
+// backup without a schedule already took its snapshot.
+func nextBackup(backup *api.MyAppBackup, schedule cron.Schedule) (time.Time, bool) {
+	last := backup.Status.LastBackupTime
+	if schedule == nil {
+		return backup.CreationTimestamp.Time, last == nil
+	}
+	if last == nil {
+		return schedule.Next(backup.CreationTimestamp.Time), true
+	}
+	return schedule.Next(last.Time), true
+}
+
+// snapshot stores the MyApp of backup and its children in a ConfigMap, and snapshots its volumes.
+func (r *BackupReconciler) snapshot(ctx context.Context, backup *api.MyAppBackup, now time.Time) (*api.BackupSnapshot, error) {
+	key := client.ObjectKey{Namespace: backup.Namespace, Name: backup.Spec.AppName}
+	app := &api.MyApp{}
+	if err := r.Client.Get(ctx, key, app); err != nil {
+		return nil, fmt.Errorf("getting MyApp %s: %w", key.Name, err)
+	}
+
+	snapshot := &api.BackupSnapshot{
+		Name: fmt.Sprintf("%s-%s", backup.Name, now.UTC().Format("20060102-150405")),
+		Time: metav1.NewTime(now),
+	}
+	data, err := snapshotData(ctx, r.Client, r.Scheme, app)
+	if err != nil {
+		return nil, err
+	}
+
+	if backup.Spec.VolumeSnapshots != nil {
+		volumes, err := r.snapshotVolumes(ctx, backup, snapshot.Name, data)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.VolumeSnapshots = volumes
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: backup.Namespace,
+			Name:      snapshot.Name,
+			Labels:    map[string]string{"app": backup.Spec.AppName},
+		},
+		Data: data,
+	}
+	if err := ctrl.SetControllerReference(backup, cm, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := r.Client.Create(ctx, cm); err != nil {
+		return nil, fmt.Errorf("storing snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// snapshotData returns the manifests of app and its children, keyed as in snapshot ConfigMaps.
+func snapshotData(ctx context.Context, c client.Client, scheme *runtime.Scheme, app *api.MyApp) (map[string]string, error) {
+	data := map[string]string{}
+	if err := store(scheme, data, appKey, app); err != nil {
+		return nil, err
+	}
+
+	// The children are stored for reference, a restore re-renders them from the MyApp.
+	for _, child := range []client.Object{
+		&appv1.Deployment{},
+		&corev1.Service{},
+		&networkingv1.Ingress{},
+		&policyv1.PodDisruptionBudget{},
+		&autoscalingv2.HorizontalPodAutoscaler{},
+		&networkingv1.NetworkPolicy{},
+	} {
+		err := c.Get(ctx, client.ObjectKeyFromObject(app), child)
+		if apierrors.IsNotFound(err) || (err == nil && !metav1.IsControlledBy(child, app)) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		gvk, err := apiutil.GVKForObject(child, scheme)
+		if err != nil {
+			return nil, err
+		}
+		if err := store(scheme, data, gvk.Kind+".json", child); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// snapshotVolumes creates a VolumeSnapshot of every PersistentVolumeClaim labeled with the
+// MyApp's labels and stores the claims in data.
+func (r *BackupReconciler) snapshotVolumes(ctx context.Context, backup *api.MyAppBackup, name string, data map[string]string) (map[string]string, error) {
+	if _, err := r.Client.RESTMapper().RESTMapping(VolumeSnapshotGVK.GroupKind(), VolumeSnapshotGVK.Version); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, fmt.Errorf("volume snapshots requested but the VolumeSnapshot CRD is not installed")
+		}
+		return nil, err
+	}
+
+	claims := &corev1.PersistentVolumeClaimList{}
+	if err := r.Reader.List(ctx, claims, client.InNamespace(backup.Namespace), client.MatchingLabels{"app": backup.Spec.AppName}); err != nil {
+		return nil, err
+	}
+	volumes := map[string]string{}
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		vs := &unstructured.Unstructured{}
+		vs.SetGroupVersionKind(VolumeSnapshotGVK)
+		vs.SetNamespace(backup.Namespace)
+		vs.SetName(fmt.Sprintf("%s-%s", name, claim.Name))
+		spec := map[string]interface{}{
+			"source": map[string]interface{}{"persistentVolumeClaimName": claim.Name},
+		}
+		if class := backup.Spec.VolumeSnapshots.ClassName; class != "" {
+			spec["volumeSnapshotClassName"] = class
+		}
+		vs.Object["spec"] = spec
+		if err := ctrl.SetControllerReference(backup, vs, r.Scheme); err != nil {
+			return nil, err
+		}
+		if err := r.Client.Create(ctx, vs); err != nil {
+			return nil, fmt.Errorf("snapshotting volume %s: %w", claim.Name, err)
+		}
+		claim.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim"))
+		if err := store(r.Scheme, data, "PersistentVolumeClaim."+claim.Name+".json", claim); err != nil {
+			return nil, err
+		}
+		volumes[claim.Name] = vs.GetName()
+	}
+	return volumes, nil
+}
+
+// store adds the manifest of obj to data, without its status and server populated metadata.
+func store(scheme *runtime.Scheme, data map[string]string, key string, obj client.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvk)
+	delete(u.Object, "status")
+	manifest := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	manifest.SetGroupVersionKind(gvk)
+	manifest.SetNamespace(u.GetNamespace())
+	manifest.SetName(u.GetName())
+	manifest.SetLabels(u.GetLabels())
+	manifest.SetAnnotations(u.GetAnnotations())
+	for field, value := range u.Object {
+		if field != "apiVersion" && field != "kind" && field != "metadata" {
+			manifest.Object[field] = value
+		}
+	}
+	out, err := json.Marshal(manifest.Object)
+	if err != nil {
+		return err
+	}
+	data[key] = string(out)
+	return nil
+}
+
+// prune deletes the snapshots beyond KeepLast.
+func (r *BackupReconciler) prune(ctx context.Context, backup *api.MyAppBackup) error {
+	keep := int(backup.Spec.KeepLast)
+	if keep <= 0 {
+		keep = defaultKeepLast
+	}
+	snapshots := backup.Status.Snapshots
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].Time.After(snapshots[j].Time.Time) })
+	if len(snapshots) <= keep {
+		return nil
+	}
+	for _, expired := range snapshots[keep:] {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: backup.Namespace, Name: expired.Name}}
+		if err := r.Client.Delete(ctx, cm); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		for _, name := range expired.VolumeSnapshots {
+			vs := &unstructured.Unstructured{}
+			vs.SetGroupVersionKind(VolumeSnapshotGVK)
+			vs.SetNamespace(backup.Namespace)
+			vs.SetName(name)
+			if err := r.Client.Delete(ctx, vs); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+	backup.Status.Snapshots = snapshots[:keep]
+	return nil
+}
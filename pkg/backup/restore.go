@@ -0,0 +1,183 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// RestoreReconciler processes MyAppRestores. It restores the MyApp's spec, creating the MyApp
+// if it was deleted, and lets the MyApp controller re-render the children. PersistentVolumeClaims
+// that no longer exist are recreated from their VolumeSnapshots; existing ones are left alone.
+type RestoreReconciler struct {
+	Client client.Client
+	// Reader reads the snapshot ConfigMaps and PersistentVolumeClaims, which aren't cached.
+	Reader client.Reader
+}
+
+func (r *RestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	restore := &api.MyAppRestore{}
+	if err := r.Client.Get(ctx, req.NamespacedName, restore); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if restore.Status.Phase != "" {
+		return ctrl.Result{}, nil
+	}
+
+	snapshot, message, err := r.restore(ctx, restore)
+	if err != nil {
+		if !isPermanent(err) {
+			log.Error(err, "unable to restore MyApp")
+			return ctrl.Result{}, err
+		}
+		restore.Status.Phase = api.RestorePhaseFailed
+		restore.Status.Message = err.Error()
+	} else {
+		log.Info("restored MyApp", "snapshot", snapshot)
+		restore.Status.Phase = api.RestorePhaseCompleted
+		restore.Status.Message = message
+	}
+	restore.Status.SnapshotName = snapshot
+	now := metav1.Now()
+	restore.Status.CompletionTime = &now
+	return ctrl.Result{}, r.Client.Status().Update(ctx, restore)
+}
+
+// permanentError fails a restore instead of retrying it.
+type permanentError struct{ error }
+
+func isPermanent(err error) bool {
+	_, ok := err.(permanentError)
+	return ok
+}
+
+// restore restores the snapshot restore refers to. It returns the name of the snapshot and
+// a message listing the PersistentVolumeClaims that weren't restored.
+func (r *RestoreReconciler) restore(ctx context.Context, restore *api.MyAppRestore) (string, string, error) {
+	backup := &api.MyAppBackup{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: restore.Namespace, Name: restore.Spec.BackupName}, backup); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", "", permanentError{fmt.Errorf("MyAppBackup %s not found", restore.Spec.BackupName)}
+		}
+		return "", "", err
+	}
+	snapshot := findSnapshot(backup, restore.Spec.SnapshotName)
+	if snapshot == nil {
+		return "", "", permanentError{fmt.Errorf("snapshot %q not found in MyAppBackup %s", restore.Spec.SnapshotName, backup.Name)}
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := r.Reader.Get(ctx, client.ObjectKey{Namespace: restore.Namespace, Name: snapshot.Name}, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return snapshot.Name, "", permanentError{fmt.Errorf("snapshot ConfigMap %s not found", snapshot.Name)}
+		}
+		return snapshot.Name, "", err
+	}
+
+	saved := &api.MyApp{}
+	if err := json.Unmarshal([]byte(cm.Data[appKey]), saved); err != nil {
+		return snapshot.Name, "", permanentError{fmt.Errorf("decoding snapshot %s: %w", snapshot.Name, err)}
+	}
+	if err := restoreApp(ctx, r.Client, saved); err != nil {
+		return snapshot.Name, "", err
+	}
+
+	var skipped []string
+	for claimName, vsName := range snapshot.VolumeSnapshots {
+		restored, err := r.restoreVolume(ctx, cm, restore.Namespace, claimName, vsName)
+		if err != nil {
+			return snapshot.Name, "", err
+		}
+		if !restored {
+			skipped = append(skipped, claimName)
+		}
+	}
+	if len(skipped) == 0 {
+		return snapshot.Name, "", nil
+	}
+	sort.Strings(skipped)
+	return snapshot.Name, fmt.Sprintf("PersistentVolumeClaims already exist and were not restored: %s", strings.Join(skipped, ", ")), nil
+}
+
+func findSnapshot(backup *api.MyAppBackup, name string) *api.BackupSnapshot {
+	if name == "" && len(backup.Status.Snapshots) > 0 {
+		return &backup.Status.Snapshots[0]
+	}
+	for i := range backup.Status.Snapshots {
+		if backup.Status.Snapshots[i].Name == name {
+			return &backup.Status.Snapshots[i]
+		}
+	}
+	return nil
+}
+
+// restoreApp sets the spec of the MyApp to the saved one, creating the MyApp if it doesn't exist.
+func restoreApp(ctx context.Context, c client.Client, saved *api.MyApp) error {
+	app := &api.MyApp{}
+	err := c.Get(ctx, client.ObjectKeyFromObject(saved), app)
+	if apierrors.IsNotFound(err) {
+		app = &api.MyApp{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   saved.Namespace,
+				Name:        saved.Name,
+				Labels:      saved.Labels,
+				Annotations: saved.Annotations,
+			},
+			Spec: saved.Spec,
+		}
+		return c.Create(ctx, app)
+	}
+	if err != nil {
+		return err
+	}
+	app.Spec = saved.Spec
+	return c.Update(ctx, app)
+}
+
+// restoreVolume recreates the PersistentVolumeClaim claimName from its VolumeSnapshot. It
+// returns false when the claim exists.
+func (r *RestoreReconciler) restoreVolume(ctx context.Context, cm *corev1.ConfigMap, namespace, claimName, vsName string) (bool, error) {
+	err := r.Reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: claimName}, &corev1.PersistentVolumeClaim{})
+	if err == nil {
+		return false, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return false, err
+	}
+
+	claim := &corev1.PersistentVolumeClaim{}
+	if err := json.Unmarshal([]byte(cm.Data["PersistentVolumeClaim."+claimName+".json"]), claim); err != nil {
+		return false, permanentError{fmt.Errorf("decoding PersistentVolumeClaim %s: %w", claimName, err)}
+	}
+	// The claim is provisioned a new volume holding the snapshot's contents.
+	claim.Spec.VolumeName = ""
+	for key := range claim.Annotations {
+		if strings.HasPrefix(key, "pv.kubernetes.io/") || strings.HasPrefix(key, "volume.") {
+			// Binding and provisioning state of the old volume.
+			delete(claim.Annotations, key)
+		}
+	}
+	claim.Spec.DataSourceRef = nil
+	apiGroup := VolumeSnapshotGVK.Group
+	claim.Spec.DataSource = &corev1.TypedLocalObjectReference{
+		APIGroup: &apiGroup,
+		Kind:     VolumeSnapshotGVK.Kind,
+		Name:     vsName,
+	}
+	if err := r.Client.Create(ctx, claim); err != nil {
+		return false, fmt.Errorf("restoring PersistentVolumeClaim %s: %w", claimName, err)
+	}
+	return true, nil
+}
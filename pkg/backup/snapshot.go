@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SnapshotLabel labels the snapshots taken of a MyApp without a MyAppBackup with the MyApp's
+// name. They are ConfigMaps owned by the MyApp, in the format of the MyAppBackups', to undo a
+// bad change of its spec; a MyApp deleted is restored from a MyAppBackup.
+const SnapshotLabel = "myapp.example.com/snapshot-of"
+
+// snapshotTimeLayout formats the time of a snapshot in its name, so the names of the
+// snapshots of a MyApp sort by time.
+const snapshotTimeLayout = "20060102-150405.000"
+
+// Snapshot stores the MyApp named by key and the manifests of its children in a new snapshot
+// ConfigMap, and deletes its oldest snapshots beyond keep, defaultKeepLast when 0. It returns
+// the name of the snapshot.
+func Snapshot(ctx context.Context, c client.Client, key client.ObjectKey, keep int, now time.Time) (string, error) {
+	app := &api.MyApp{}
+	if err := c.Get(ctx, key, app); err != nil {
+		return "", fmt.Errorf("getting MyApp %s: %w", key.Name, err)
+	}
+	data, err := snapshotData(ctx, c, c.Scheme(), app)
+	if err != nil {
+		return "", err
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: app.Namespace,
+			// The API server appends a random suffix, snapshots taken at once don't collide.
+			GenerateName: fmt.Sprintf("%s-snapshot-%s-", app.Name, now.UTC().Format(snapshotTimeLayout)),
+			Labels:       map[string]string{SnapshotLabel: app.Name},
+		},
+		Data: data,
+	}
+	if err := ctrl.SetControllerReference(app, cm, c.Scheme()); err != nil {
+		return "", err
+	}
+	if err := c.Create(ctx, cm); err != nil {
+		return "", fmt.Errorf("storing snapshot: %w", err)
+	}
+
+	if keep <= 0 {
+		keep = defaultKeepLast
+	}
+	snapshots, err := Snapshots(ctx, c, key)
+	if err != nil {
+		return cm.Name, err
+	}
+	for i := keep; i < len(snapshots); i++ {
+		if err := c.Delete(ctx, &snapshots[i]); client.IgnoreNotFound(err) != nil {
+			return cm.Name, fmt.Errorf("deleting expired snapshot: %w", err)
+		}
+	}
+	return cm.Name, nil
+}
+
+// Snapshots returns the snapshot ConfigMaps of the MyApp named by key, most recent first.
+func Snapshots(ctx context.Context, c client.Reader, key client.ObjectKey) ([]corev1.ConfigMap, error) {
+	list := &corev1.ConfigMapList{}
+	if err := c.List(ctx, list, client.InNamespace(key.Namespace), client.MatchingLabels{SnapshotLabel: key.Name}); err != nil {
+		return nil, err
+	}
+	snapshots := list.Items
+	// Names hold the time of the snapshot after the MyApp's name.
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Name > snapshots[j].Name })
+	return snapshots, nil
+}
+
+// Restore sets the spec of the MyApp named by key to the one of its snapshot name, or of the
+// most recent one when empty, and lets the MyApp controller re-render the children. It
+// returns the name of the snapshot restored.
+func Restore(ctx context.Context, c client.Client, key client.ObjectKey, name string) (string, error) {
+	cm := &corev1.ConfigMap{}
+	if name == "" {
+		snapshots, err := Snapshots(ctx, c, key)
+		if err != nil {
+			return "", err
+		}
+		if len(snapshots) == 0 {
+			return "", fmt.Errorf("MyApp %s has no snapshots", key.Name)
+		}
+		cm = &snapshots[0]
+	} else if err := c.Get(ctx, client.ObjectKey{Namespace: key.Namespace, Name: name}, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return name, fmt.Errorf("snapshot %s not found", name)
+		}
+		return name, err
+	}
+	if cm.Labels[SnapshotLabel] != key.Name {
+		return cm.Name, fmt.Errorf("ConfigMap %s is not a snapshot of MyApp %s", cm.Name, key.Name)
+	}
+
+	saved := &api.MyApp{}
+	if err := json.Unmarshal([]byte(cm.Data[appKey]), saved); err != nil {
+		return cm.Name, fmt.Errorf("decoding snapshot %s: %w", cm.Name, err)
+	}
+	return cm.Name, restoreApp(ctx, c, saved)
+}
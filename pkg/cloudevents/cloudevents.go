@@ -0,0 +1,129 @@
+// Package cloudevents publishes CloudEvents to an HTTP sink using the binary content mode.
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	specVersion = "1.0"
+
+	// queueSize bounds the number of events buffered while the sink is slow or unavailable.
+	queueSize = 256
+)
+
+var publishedEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "myapp_cloudevents_total",
+	Help: "Number of CloudEvents handed to the sink, by event type and result",
+}, []string{"type", "result"})
+
+func init() {
+	metrics.Registry.MustRegister(publishedEvents)
+}
+
+// Event is a CloudEvent with a JSON payload.
+type Event struct {
+	ID      string
+	Type    string
+	Source  string
+	Subject string
+	Time    time.Time
+	Data    interface{}
+}
+
+// Publisher delivers events to a sink asynchronously. It implements manager.Runnable;
+// events published before Start are buffered.
+type Publisher struct {
+	sink   string
+	client *http.Client
+	queue  chan Event
+	log    logr.Logger
+}
+
+func NewPublisher(sink string, log logr.Logger) *Publisher {
+	return &Publisher{
+		sink:   sink,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan Event, queueSize),
+		log:    log,
+	}
+}
+
+// Publish enqueues e without blocking. Events are dropped when the queue is full
+// so a broken sink never stalls reconciliation.
+func (p *Publisher) Publish(e Event) {
+	if e.ID == "" {
+		e.ID = string(uuid.NewUUID())
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	select {
+	case p.queue <- e:
+	default:
+		publishedEvents.WithLabelValues(e.Type, "dropped").Inc()
+		p.log.Info("cloudevents queue full, dropping event", "type", e.Type, "subject", e.Subject)
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Events are only published
+// by the reconciler, which runs on the leader.
+func (p *Publisher) NeedLeaderElection() bool {
+	return true
+}
+
+func (p *Publisher) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-p.queue:
+			if err := p.send(ctx, e); err != nil {
+				publishedEvents.WithLabelValues(e.Type, "error").Inc()
+				p.log.Error(err, "unable to deliver cloudevent", "type", e.Type, "subject", e.Subject)
+				continue
+			}
+			publishedEvents.WithLabelValues(e.Type, "success").Inc()
+		}
+	}
+}
+
+func (p *Publisher) send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.sink, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("ce-specversion", specVersion)
+	req.Header.Set("ce-id", e.ID)
+	req.Header.Set("ce-type", e.Type)
+	req.Header.Set("ce-source", e.Source)
+	req.Header.Set("ce-time", e.Time.UTC().Format(time.RFC3339Nano))
+	if e.Subject != "" {
+		req.Header.Set("ce-subject", e.Subject)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sink responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// adaptiveQPSMin is the floor the QPS is lowered to under API server pressure.
+	adaptiveQPSMin = 1
+	// adaptiveQPSRecoveryInterval is how often the QPS is raised back while unthrottled.
+	adaptiveQPSRecoveryInterval = 30 * time.Second
+)
+
+var clientQPS = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "myapp_client_qps",
+	Help: "Effective QPS of the operator's API server clients",
+})
+
+func init() {
+	metrics.Registry.MustRegister(clientQPS)
+}
+
+// adaptiveRateLimiter is the flowcontrol.RateLimiter of every client built from the
+// operator's rest.Config. Its QPS is halved each time the API server throttles a request,
+// with a 429 or a Retry-After, and raised back by a tenth of the configured QPS every
+// recovery interval without throttling. It implements manager.Runnable to do the latter.
+type adaptiveRateLimiter struct {
+	limiter *rate.Limiter
+	max     float64
+	log     logr.Logger
+
+	mu            sync.Mutex
+	qps           float64
+	lastThrottled time.Time
+}
+
+// newAdaptiveRateLimiter installs an adaptiveRateLimiter on config, starting at its QPS.
+func newAdaptiveRateLimiter(config *rest.Config, log logr.Logger) *adaptiveRateLimiter {
+	l := &adaptiveRateLimiter{
+		limiter: rate.NewLimiter(rate.Limit(config.QPS), config.Burst),
+		max:     float64(config.QPS),
+		qps:     float64(config.QPS),
+		log:     log,
+	}
+	clientQPS.Set(l.qps)
+	config.RateLimiter = l
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return throttleObserver{next: rt, limiter: l}
+	})
+	return l
+}
+
+func (l *adaptiveRateLimiter) TryAccept() bool { return l.limiter.Allow() }
+
+func (l *adaptiveRateLimiter) Accept() { _ = l.limiter.Wait(context.Background()) }
+
+func (l *adaptiveRateLimiter) Wait(ctx context.Context) error { return l.limiter.Wait(ctx) }
+
+func (l *adaptiveRateLimiter) Stop() {}
+
+func (l *adaptiveRateLimiter) QPS() float32 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return float32(l.qps)
+}
+
+// throttled lowers the QPS after the API server throttled a request.
+func (l *adaptiveRateLimiter) throttled() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastThrottled = time.Now()
+	if l.qps <= adaptiveQPSMin {
+		return
+	}
+	l.set(max(l.qps/2, adaptiveQPSMin))
+	l.log.Info("API server is throttling, lowered client QPS", "qps", l.qps)
+}
+
+// recover raises the QPS back towards the configured one unless throttled recently.
+func (l *adaptiveRateLimiter) recover(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.qps >= l.max || now.Sub(l.lastThrottled) < adaptiveQPSRecoveryInterval {
+		return
+	}
+	l.set(min(l.qps+l.max/10, l.max))
+	l.log.V(1).Info("raised client QPS", "qps", l.qps)
+}
+
+func (l *adaptiveRateLimiter) set(qps float64) {
+	l.qps = qps
+	l.limiter.SetLimit(rate.Limit(qps))
+	clientQPS.Set(qps)
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every replica talks to the
+// API server.
+func (l *adaptiveRateLimiter) NeedLeaderElection() bool {
+	return false
+}
+
+func (l *adaptiveRateLimiter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(adaptiveQPSRecoveryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			l.recover(now)
+		}
+	}
+}
+
+// throttleObserver reports the responses throttled by the API server to the limiter.
+type throttleObserver struct {
+	next    http.RoundTripper
+	limiter *adaptiveRateLimiter
+}
+
+func (t throttleObserver) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "") {
+		t.limiter.throttled()
+	}
+	return resp, err
+}
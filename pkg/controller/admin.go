@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/admin"
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// appSummary is the admin API's view of a MyApp.
+type appSummary struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Phase     string `json:"phase,omitempty"`
+	// Shard reports whether this replica reconciles the MyApp.
+	Shard bool `json:"shard"`
+}
+
+// registerAdminEndpoints adds the controller's endpoints to the admin server. They read
+// from the cache, so they're served without a round trip to the API server.
+func (c *Controller) registerAdminEndpoints(server *admin.Server) {
+	server.Handle("/apps", admin.JSON(func(r *http.Request) (interface{}, error) {
+		apps := &api.MyAppList{}
+		var opts []client.ListOption
+		if ns := r.URL.Query().Get("namespace"); ns != "" {
+			opts = append(opts, client.InNamespace(ns))
+		}
+		if err := c.manager.GetCache().List(r.Context(), apps, opts...); err != nil {
+			return nil, err
+		}
+		summaries := make([]appSummary, 0, len(apps.Items))
+		for _, app := range apps.Items {
+			summaries = append(summaries, appSummary{
+				Namespace: app.Namespace,
+				Name:      app.Name,
+				Phase:     app.Status.Phase,
+				Shard:     c.shard.owns(client.ObjectKeyFromObject(&app)),
+			})
+		}
+		return summaries, nil
+	}))
+	// The recent reconciles of a MyApp, oldest first. A MyApp is forgotten once deleted.
+	server.Handle("/debug/reconciles", admin.JSON(func(r *http.Request) (interface{}, error) {
+		key := types.NamespacedName{Namespace: r.URL.Query().Get("namespace"), Name: r.URL.Query().Get("name")}
+		if key.Namespace == "" || key.Name == "" {
+			return nil, fmt.Errorf("namespace and name are required")
+		}
+		return c.history.get(key), nil
+	}))
+	// The children the posted MyApp, YAML or JSON, renders to against the cache. Nothing is applied.
+	server.Handle("/render", admin.Post(func(r *http.Request) (interface{}, error) {
+		objects, err := decodeManifests(r.Body, c.manager.GetScheme())
+		if err != nil {
+			return nil, err
+		}
+		if len(objects) != 1 {
+			return nil, fmt.Errorf("expected a single MyApp, got %d objects", len(objects))
+		}
+		app, ok := objects[0].(*api.MyApp)
+		if !ok {
+			return nil, fmt.Errorf("expected a MyApp, got a %s", objects[0].GetObjectKind().GroupVersionKind().Kind)
+		}
+		return c.render(r.Context(), app)
+	}))
+}
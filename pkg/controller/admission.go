@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// admissionDeniedRetryInterval is how often children denied by admission are applied again.
+// A denial is terminal until the policy or the MyApp changes, the latter requeues it at once.
+const admissionDeniedRetryInterval = 5 * time.Minute
+
+// admissionDenials returns the errors in err, which may be an aggregate, of children denied
+// by a validating admission webhook, e.g. of Gatekeeper or Kyverno, or by a
+// ValidatingAdmissionPolicy.
+func admissionDenials(err error) []error {
+	if agg, ok := err.(kerrors.Aggregate); ok {
+		var denials []error
+		for _, err := range agg.Errors() {
+			denials = append(denials, admissionDenials(err)...)
+		}
+		return denials
+	}
+	if deniedByAdmission(err) {
+		return []error{err}
+	}
+	return nil
+}
+
+// deniedByAdmission reports whether err is the denial of an admission policy. The API server
+// returns them with the code the policy chose, so they are recognized by their message.
+func deniedByAdmission(err error) bool {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return false
+	}
+	message := status.Status().Message
+	return strings.Contains(message, "admission webhook") && strings.Contains(message, "denied the request") ||
+		strings.Contains(message, "ValidatingAdmissionPolicy")
+}
+
+// admissionDeniedCondition reports the denials verbatim.
+func admissionDeniedCondition(app *api.MyApp, denials []error) metav1.Condition {
+	messages := make([]string, 0, len(denials))
+	for _, err := range denials {
+		messages = append(messages, err.Error())
+	}
+	return metav1.Condition{
+		Type:               api.ConditionChildAdmissionDenied,
+		Status:             metav1.ConditionTrue,
+		Reason:             "AdmissionDenied",
+		Message:            strings.Join(messages, "; "),
+		ObservedGeneration: app.Generation,
+	}
+}
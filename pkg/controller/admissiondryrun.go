@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// admissionDryRunInterval is how long the result of a dry run holds for an unchanged pod
+// template. Policies change without events the controller watches.
+const admissionDryRunInterval = 10 * time.Minute
+
+// admissionDryRun dry-runs the creation of a pod of every MyApp through the cluster's
+// admission chain, so denials of policy engines like Gatekeeper or Kyverno, which would only
+// show on the ReplicaSet, are reported on the MyApp. A nil *admissionDryRun runs nothing.
+type admissionDryRun struct {
+	client client.Client
+
+	mu      sync.Mutex
+	results map[types.NamespacedName]dryRunResult
+}
+
+type dryRunResult struct {
+	// hash is the hash of the pod template that was dry-run.
+	hash   string
+	time   time.Time
+	denied *metav1.Condition
+}
+
+// newAdmissionDryRun returns nil when disabled.
+func newAdmissionDryRun(enabled bool, c client.Client) *admissionDryRun {
+	if !enabled {
+		return nil
+	}
+	return &admissionDryRun{client: c, results: map[types.NamespacedName]dryRunResult{}}
+}
+
+// check creates a pod of template in the MyApp's namespace with server-side dry run. It
+// returns a PolicyViolation condition holding the denial verbatim, nil when the pod is
+// admitted. Results are reused until the template changes or admissionDryRunInterval passed.
+func (d *admissionDryRun) check(ctx context.Context, myApp *api.MyApp, template *corev1.PodTemplateSpec) (*metav1.Condition, error) {
+	if d == nil {
+		return nil, nil
+	}
+	key := client.ObjectKeyFromObject(myApp)
+	hash, err := templateHash(template)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	d.mu.Lock()
+	result, ok := d.results[key]
+	d.mu.Unlock()
+	if ok && result.hash == hash && now.Sub(result.time) < admissionDryRunInterval {
+		return result.denied, nil
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: *template.ObjectMeta.DeepCopy(),
+		Spec:       *template.Spec.DeepCopy(),
+	}
+	pod.Namespace, pod.Name, pod.GenerateName = myApp.Namespace, "", myApp.Name+"-"
+	result = dryRunResult{hash: hash, time: now}
+	err = d.client.Create(ctx, pod, client.DryRunAll)
+	switch {
+	case err == nil:
+	case apierrors.IsForbidden(err) || apierrors.IsInvalid(err) || apierrors.IsBadRequest(err):
+		result.denied = &metav1.Condition{
+			Type:               api.ConditionPolicyViolation,
+			Status:             metav1.ConditionTrue,
+			Reason:             "AdmissionDenied",
+			Message:            "a pod of the MyApp was denied in a dry run: " + err.Error(),
+			ObservedGeneration: myApp.Generation,
+		}
+	default:
+		return nil, err
+	}
+	d.mu.Lock()
+	d.results[key] = result
+	d.mu.Unlock()
+	return result.denied, nil
+}
+
+// forget drops the result of a deleted MyApp.
+func (d *admissionDryRun) forget(key types.NamespacedName) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.results, key)
+}
@@ -0,0 +1,299 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// imageArchitecturesTTL is how long the architectures of an image are cached. Tags may
+	// be pushed again.
+	imageArchitecturesTTL = time.Hour
+	// imageArchitecturesRetry is how long a failed lookup is cached.
+	imageArchitecturesRetry = 5 * time.Minute
+	// imageLookupTimeout bounds the registry requests of a single lookup.
+	imageLookupTimeout = 10 * time.Second
+)
+
+// manifestMediaTypes are the manifest and manifest list types the registry may return.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// imageArchitectures is the outcome of a lookup of an image in its registry.
+type imageArchitectures struct {
+	architectures []string
+	err           error
+	time          time.Time
+}
+
+// imageInspector looks up the architectures an image is built for in its registry, with
+// the distribution API and anonymous pulls. A nil *imageInspector doesn't look images up.
+type imageInspector struct {
+	client *http.Client
+
+	mu     sync.Mutex
+	images map[string]imageArchitectures
+}
+
+func newImageInspector() *imageInspector {
+	return &imageInspector{client: &http.Client{Timeout: imageLookupTimeout}, images: map[string]imageArchitectures{}}
+}
+
+// architectures returns the architectures of image, looking it up again once the cached
+// result expired.
+func (i *imageInspector) architectures(ctx context.Context, image string, now time.Time) ([]string, error) {
+	i.mu.Lock()
+	cached, ok := i.images[image]
+	i.mu.Unlock()
+	if ok && (cached.err == nil && now.Sub(cached.time) < imageArchitecturesTTL || cached.err != nil && now.Sub(cached.time) < imageArchitecturesRetry) {
+		return cached.architectures, cached.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, imageLookupTimeout)
+	defer cancel()
+	architectures, err := i.lookup(ctx, parseImage(image))
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for name, result := range i.images {
+		if now.Sub(result.time) >= imageArchitecturesTTL {
+			delete(i.images, name)
+		}
+	}
+	i.images[image] = imageArchitectures{architectures: architectures, err: err, time: now}
+	return architectures, err
+}
+
+// imageRef is an image reference split into the parts of its registry URLs.
+type imageRef struct {
+	registry, repository, reference string
+}
+
+// parseImage splits image the way the container runtime resolves it: images without a
+// registry are pulled from Docker Hub, and images without a tag or digest are :latest.
+func parseImage(image string) imageRef {
+	ref := imageRef{registry: "registry-1.docker.io", reference: "latest"}
+	if name, digest, ok := strings.Cut(image, "@"); ok {
+		image, ref.reference = name, digest
+	} else if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image, ref.reference = image[:i], image[i+1:]
+	}
+	if host, path, ok := strings.Cut(image, "/"); ok && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		ref.registry, image = host, path
+		if host == "docker.io" || host == "index.docker.io" {
+			ref.registry = "registry-1.docker.io"
+		}
+	}
+	if ref.registry == "registry-1.docker.io" && !strings.Contains(image, "/") {
+		image = "library/" + image
+	}
+	ref.repository = image
+	return ref
+}
+
+// manifest holds the fields of manifests and manifest lists the architectures are read from.
+type manifest struct {
+	Manifests []struct {
+		Platform *struct {
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+	Config *struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+}
+
+// lookup returns the architectures of the platforms of ref's manifest list, or the one of
+// the image's config when ref is a single manifest.
+func (i *imageInspector) lookup(ctx context.Context, ref imageRef) ([]string, error) {
+	m := &manifest{}
+	if err := i.get(ctx, ref, "manifests/"+ref.reference, strings.Join(manifestMediaTypes, ","), m); err != nil {
+		return nil, err
+	}
+	var architectures []string
+	for _, entry := range m.Manifests {
+		// Attestations are listed with the unknown platform.
+		if entry.Platform != nil && entry.Platform.Architecture != "unknown" && !slices.Contains(architectures, entry.Platform.Architecture) {
+			architectures = append(architectures, entry.Platform.Architecture)
+		}
+	}
+	if len(m.Manifests) == 0 && m.Config != nil {
+		config := &struct {
+			Architecture string `json:"architecture"`
+		}{}
+		if err := i.get(ctx, ref, "blobs/"+m.Config.Digest, "", config); err != nil {
+			return nil, err
+		}
+		architectures = append(architectures, config.Architecture)
+	}
+	sort.Strings(architectures)
+	return architectures, nil
+}
+
+// get decodes a registry resource of ref's repository into v. It authenticates with an
+// anonymous token when the registry asks for one.
+func (i *imageInspector) get(ctx context.Context, ref imageRef, path, accept string, v any) error {
+	u := fmt.Sprintf("https://%s/v2/%s/%s", ref.registry, ref.repository, path)
+	resp, err := i.do(ctx, u, accept, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		token, err := i.token(ctx, resp.Header.Get("WWW-Authenticate"), ref.repository)
+		if err != nil {
+			return err
+		}
+		if resp, err = i.do(ctx, u, accept, token); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (i *imageInspector) do(ctx context.Context, u, accept, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return i.client.Do(req)
+}
+
+// token requests an anonymous pull token from the realm of a Bearer challenge.
+func (i *imageInspector) token(ctx context.Context, challenge, repository string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("registry requires %q authentication, only anonymous pulls are supported", scheme)
+	}
+	values := url.Values{"scope": {"repository:" + repository + ":pull"}}
+	var realm string
+	for _, param := range strings.Split(params, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		value = strings.Trim(value, `"`)
+		switch key {
+		case "realm":
+			realm = value
+		case "service":
+			values.Set("service", value)
+		}
+	}
+	if realm == "" {
+		return "", fmt.Errorf("registry challenge %q has no realm", challenge)
+	}
+	resp, err := i.do(ctx, realm+"?"+values.Encode(), "", "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("requesting a pull token from %s: %s", realm, resp.Status)
+	}
+	body := &struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+		return "", err
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// checkArchitectures verifies the MyApp's image is built for the architectures in
+// Spec.Architectures. The unsupported ones are dropped from myApp's spec, in memory only,
+// so its pods aren't scheduled on nodes they can't run on. It returns nil when the MyApp
+// doesn't request architectures.
+func (c *Controller) checkArchitectures(ctx context.Context, myApp *api.MyApp) *metav1.Condition {
+	if len(myApp.Spec.Architectures) == 0 {
+		return nil
+	}
+	cond := &metav1.Condition{
+		Type:               api.ConditionArchitecturesSupported,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ImageSupportsArchitectures",
+		ObservedGeneration: myApp.Generation,
+	}
+	if c.images == nil {
+		cond.Status, cond.Reason = metav1.ConditionUnknown, "VerificationDisabled"
+		return cond
+	}
+	available, err := c.images.architectures(ctx, myApp.Spec.Image, time.Now())
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Info("unable to look up the architectures of the image", "image", myApp.Spec.Image, "reason", err.Error())
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionUnknown, "VerificationFailed", err.Error()
+		return cond
+	}
+	var supported []api.Architecture
+	var unsupported []string
+	for _, arch := range myApp.Spec.Architectures {
+		if slices.Contains(available, string(arch)) {
+			supported = append(supported, arch)
+		} else {
+			unsupported = append(unsupported, string(arch))
+		}
+	}
+	if len(unsupported) == 0 {
+		return cond
+	}
+	cond.Status, cond.Reason = metav1.ConditionFalse, "UnsupportedArchitecture"
+	cond.Message = fmt.Sprintf("image %s is not built for %s, only for %s", myApp.Spec.Image,
+		strings.Join(unsupported, ", "), strings.Join(available, ", "))
+	// When the image supports none of them the pods stay on the requested ones rather than
+	// being scheduled anywhere.
+	if len(supported) > 0 {
+		myApp.Spec.Architectures = supported
+	}
+	return cond
+}
+
+// configureArchitectures schedules the pods on nodes of the MyApp's architectures.
+func configureArchitectures(myApp *api.MyApp, template *corev1.PodTemplateSpec) {
+	if len(myApp.Spec.Architectures) == 0 {
+		return
+	}
+	values := make([]string, 0, len(myApp.Spec.Architectures))
+	for _, arch := range myApp.Spec.Architectures {
+		values = append(values, string(arch))
+	}
+	template.Spec.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{
+						Key:      corev1.LabelArchStable,
+						Operator: corev1.NodeSelectorOpIn,
+						Values:   values,
+					}},
+				}},
+			},
+		},
+	}
+}
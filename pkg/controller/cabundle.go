@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// caBundleLabel marks the copies of the CA bundle in the namespaces of MyApps.
+	caBundleLabel = "myapp.example.com/ca-bundle"
+	// caBundleHashAnnotation on the pod template rolls the pods when the bundle changes.
+	caBundleHashAnnotation = "myapp.example.com/ca-bundle-hash"
+	caBundleVolume         = "ca-bundle"
+	// caBundlePath is where the bundle is mounted, in the ca.crt file. SSL_CERT_FILE points
+	// OpenSSL and Go at it.
+	caBundlePath = "/etc/ca-bundle"
+	caBundleKey  = "ca.crt"
+)
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+
+// caBundle distributes the trusted CA bundle of a ConfigMap to the pods of every MyApp, through
+// a copy in the MyApp's namespace. A nil *caBundle distributes nothing.
+type caBundle struct {
+	key client.ObjectKey
+	// cache watches only the source ConfigMap.
+	cache cache.Cache
+	// reader reads the source ConfigMap, from cache unless rendering offline.
+	reader client.Reader
+}
+
+// newCABundle returns nil when ref, "namespace/name", is empty. The cache it watches the
+// ConfigMap with must be added to the manager.
+func newCABundle(ref string, config *rest.Config) (*caBundle, error) {
+	if ref == "" {
+		return nil, nil
+	}
+	key, err := parseCABundleRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	c, err := cache.New(config, cache.Options{
+		DefaultNamespaces: map[string]cache.Config{key.Namespace: {}},
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.ConfigMap{}: {Field: fields.OneTermEqualSelector("metadata.name", key.Name)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &caBundle{key: key, cache: c, reader: c}, nil
+}
+
+func parseCABundleRef(ref string) (client.ObjectKey, error) {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || name == "" {
+		return client.ObjectKey{}, fmt.Errorf("invalid CA bundle ConfigMap %q, expected namespace/name", ref)
+	}
+	return client.ObjectKey{Namespace: namespace, Name: name}, nil
+}
+
+// source requeues every MyApp when the bundle changes.
+func (b *caBundle) source(c *Controller) source.Source {
+	var obj client.Object = &corev1.ConfigMap{}
+	return source.Kind(b.cache, obj, handler.EnqueueRequestsFromMapFunc(c.allApps))
+}
+
+// allApps returns every MyApp of this shard.
+func (c *Controller) allApps(ctx context.Context, _ client.Object) []reconcile.Request {
+	apps := &api.MyAppList{}
+	if err := c.client.List(ctx, apps); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to list MyApps")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(apps.Items))
+	for _, app := range apps.Items {
+		key := client.ObjectKeyFromObject(&app)
+		if c.shard.owns(key) {
+			requests = append(requests, reconcile.Request{NamespacedName: key})
+		}
+	}
+	return requests
+}
+
+func caBundleName(myApp *api.MyApp) string {
+	return myApp.Name + "-ca-bundle"
+}
+
+// injectCABundle copies the bundle into the MyApp's namespace and mounts it in every
+// container of template, unless the MyApp opts out.
+func (c *Controller) injectCABundle(ctx context.Context, myApp *api.MyApp, template *corev1.PodTemplateSpec, changes *childChanges) error {
+	if c.caBundle == nil || myApp.Spec.DisableCABundle {
+		return nil
+	}
+	source := &corev1.ConfigMap{}
+	if err := c.caBundle.reader.Get(ctx, c.caBundle.key, source); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The ConfigMap watch requeues every MyApp once it is created.
+			return fmt.Errorf("CA bundle ConfigMap %s not found", c.caBundle.key)
+		}
+		return err
+	}
+	if _, ok := source.Data[caBundleKey]; !ok {
+		return fmt.Errorf("CA bundle ConfigMap %s has no %s key", c.caBundle.key, caBundleKey)
+	}
+	bundle := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: myApp.Namespace,
+			Name:      caBundleName(myApp),
+			Labels:    map[string]string{caBundleLabel: "true", generatedConfigMapLabel: "true"},
+		},
+		Data: map[string]string{caBundleKey: source.Data[caBundleKey]},
+	}
+	if _, _, err := c.ensureChild(ctx, myApp, bundle, changes); err != nil {
+		return err
+	}
+
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name: caBundleVolume,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: bundle.Name}},
+		},
+	})
+	for i := range template.Spec.Containers {
+		container := &template.Spec.Containers[i]
+		container.Env = append(container.Env, corev1.EnvVar{Name: "SSL_CERT_FILE", Value: caBundlePath + "/" + caBundleKey})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      caBundleVolume,
+			MountPath: caBundlePath,
+			ReadOnly:  true,
+		})
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[caBundleHashAnnotation] = bundleHash(bundle.Data)
+	return nil
+}
+
+func bundleHash(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s\x00%s\x00", key, data[key])
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/steeling/controller-runtime-exercise/pkg/features"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// generatedConfigMapLabel marks the ConfigMaps generated for MyApps, e.g. the copies of the CA
+// bundle. Only the ConfigMaps carrying it are cached, not every ConfigMap of the cluster.
+const generatedConfigMapLabel = "myapp.example.com/generated"
+
+var cacheMissVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "myapp_cache_miss_verifications_total",
+	Help: "Number of children the cache reported missing that were checked with the API server, by result. stale means the child existed",
+}, []string{"result"})
+
+func init() {
+	metrics.Registry.MustRegister(cacheMissVerifications)
+}
+
+// cacheOptions returns the options of the manager's cache. Objects in excluded namespaces
+// aren't even watched; the field selector is set for all namespaces rather than as the
+// default, which would also apply to cluster scoped objects whose lists the API server
+// rejects it for.
+func cacheOptions(namespaces *namespaceFilter) cache.Options {
+	var opts cache.Options
+	if selector := namespaces.fieldSelector(); selector != nil {
+		opts.DefaultNamespaces = map[string]cache.Config{cache.AllNamespaces: {FieldSelector: selector}}
+	}
+	restrictConfigMapCache(&opts)
+	return opts
+}
+
+// restrictConfigMapCache restricts the ConfigMaps the manager caches to the generated ones.
+func restrictConfigMapCache(opts *cache.Options) {
+	generated, err := labels.NewRequirement(generatedConfigMapLabel, selection.Exists, nil)
+	if err != nil {
+		panic(err)
+	}
+	if opts.ByObject == nil {
+		opts.ByObject = map[client.Object]cache.ByObject{}
+	}
+	opts.ByObject[&corev1.ConfigMap{}] = cache.ByObject{Label: labels.NewSelector().Add(*generated)}
+}
+
+// getChild reads a child from the cache. With the VerifyCacheMiss feature, a NotFound is
+// confirmed with the API server so a cache that hasn't caught up doesn't cause a duplicate create.
+func (c *Controller) getChild(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	err := c.client.Get(ctx, key, obj)
+	if !apierrors.IsNotFound(err) || !c.features.Enabled(features.VerifyCacheMiss) {
+		return err
+	}
+	err = c.manager.GetAPIReader().Get(ctx, key, obj)
+	switch {
+	case err == nil:
+		cacheMissVerifications.WithLabelValues("stale").Inc()
+	case apierrors.IsNotFound(err):
+		cacheMissVerifications.WithLabelValues("confirmed").Inc()
+	}
+	return err
+}
@@ -0,0 +1,489 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	"golang.org/x/sync/errgroup"
+	appv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const defaultTargetCPUUtilization = 80
+
+// specHashAnnotation holds a hash of the rendered spec of a child. A child whose hash
+// differs from the rendered one is out of date, without comparing its fields.
+const specHashAnnotation = "myapp.example.com/spec-hash"
+
+var childApplyFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "myapp_child_apply_failures_total",
+	Help: "Number of times creating or updating a child failed, by kind and reason. The reason is the API status reason, e.g. Forbidden or Invalid, AdmissionDenied for denials of admission policies, or Unknown",
+}, []string{"kind", "reason"})
+
+func init() {
+	metrics.Registry.MustRegister(childApplyFailures)
+}
+
+// applyFailureReason classifies an error applying a child for childApplyFailures.
+func applyFailureReason(err error) string {
+	if deniedByAdmission(err) {
+		return "AdmissionDenied"
+	}
+	if reason := apierrors.ReasonForError(err); reason != metav1.StatusReasonUnknown {
+		return string(reason)
+	}
+	return "Unknown"
+}
+
+// childrenState is what reconcileChildren observed.
+type childrenState struct {
+	// deployment is the live Deployment. It is nil while it is held back until the MyApp's
+	// ExternalSecrets have materialized.
+	deployment *appv1.Deployment
+	// deploymentCreated is set when the Deployment was created by this reconcile.
+	deploymentCreated bool
+	// changes records the children created, updated or pruned by this reconcile.
+	changes childChanges
+	// conditions describe the Service and route, if the MyApp has them.
+	conditions []metav1.Condition
+	// recommendations are the VerticalPodAutoscaler's, if the MyApp has one.
+	recommendations []api.ContainerRecommendation
+	// rotationPending is set when a restart for rotated Secrets is held back.
+	rotationPending bool
+	// rolloutQueued is set when the Deployment's rollout waits for a slot.
+	rolloutQueued *metav1.Condition
+	// quotaExceeded is set when the Deployment's pods would exceed the namespace's quotas.
+	quotaExceeded *metav1.Condition
+	// limitRangeAdjusted is set when the Deployment's resources were adjusted to the
+	// namespace's LimitRanges, or violate them.
+	limitRangeAdjusted *metav1.Condition
+	// policyViolation is set when the pods would be rejected by the namespace's pod security
+	// level or the cluster's admission.
+	policyViolation *metav1.Condition
+	// lastRun is the most recent run of a Job or CronJob workload.
+	lastRun *api.JobRunStatus
+	// lastRunTrigger is the run annotation acted on.
+	lastRunTrigger string
+	// tasks are the most recent runs of the MyApp's tasks.
+	tasks []api.TaskStatus
+	// taskTrigger is the run-task annotation acted on.
+	taskTrigger string
+}
+
+// childChanges records the kinds of the children a reconcile created, updated or pruned.
+type childChanges struct {
+	mu      sync.Mutex
+	created []string
+	updated []string
+	deleted []string
+	// resources is the inventory of the children applied or observed.
+	resources []api.ResourceStatus
+	// conflicts are the children another field manager keeps reverting.
+	conflicts []childConflict
+	// mismatches are the children whose live selector differs from the rendered one.
+	mismatches []selectorMismatch
+}
+
+func (c *childChanges) conflict(conflict childConflict) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conflicts = append(c.conflicts, conflict)
+}
+
+func (c *childChanges) mismatch(mismatch selectorMismatch) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mismatches = append(c.mismatches, mismatch)
+}
+
+func (c *childChanges) record(action childAction, kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch action {
+	case childCreated:
+		c.created = append(c.created, kind)
+	case childUpdated:
+		c.updated = append(c.updated, kind)
+	case childDeleted:
+		c.deleted = append(c.deleted, kind)
+	}
+}
+
+func (c *childChanges) any() bool {
+	return len(c.created) > 0 || len(c.updated) > 0 || len(c.deleted) > 0
+}
+
+type childAction int
+
+const (
+	childUnchanged childAction = iota
+	childCreated
+	childUpdated
+	childDeleted
+)
+
+// reconcileChildren renders every child of myApp and creates or updates them concurrently,
+// and prunes the children that are no longer desired.
+// The Deployment isn't created or updated while secretsPending. Errors of all children are
+// aggregated so one failing child doesn't hold back the others.
+func (c *Controller) reconcileChildren(ctx context.Context, myApp *api.MyApp, secrets []corev1.Secret, secretsPending bool) (*childrenState, error) {
+	var (
+		g     errgroup.Group
+		mu    sync.Mutex
+		state = &childrenState{}
+		errs  []error
+	)
+	// run runs fn concurrently, recording its error under what.
+	run := func(what string, fn func() error) {
+		g.Go(func() error {
+			if err := fn(); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", what, err))
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	ensure := func(obj client.Object) func() error {
+		return func() error {
+			_, _, err := c.ensureChild(ctx, myApp, obj, &state.changes)
+			return err
+		}
+	}
+
+	if batchWorkload(myApp) {
+		state.lastRunTrigger = myApp.Status.LastRunTrigger
+		run(strings.ToLower(myApp.Spec.WorkloadType), func() error {
+			if secretsPending {
+				// Runs are held back like rollouts.
+				var err error
+				state.lastRun, err = c.lastRun(ctx, myApp)
+				return err
+			}
+			deployment, err := c.renderDeployment(ctx, myApp, secrets, &state.changes)
+			if err != nil {
+				return err
+			}
+			if state.policyViolation, err = c.checkPodPolicies(ctx, myApp, &deployment.Spec.Template); err != nil {
+				return err
+			}
+			state.lastRun, state.lastRunTrigger, err = c.reconcileBatch(ctx, myApp, deployment.Spec.Template, &state.changes)
+			return err
+		})
+	} else {
+		run("deployment", func() error {
+			if secretsPending {
+				// Pods aren't rolled out until the ExternalSecrets they consume have materialized.
+				// The ExternalSecret watch requeues the MyApp once they have.
+				deployment := &appv1.Deployment{}
+				err := c.getChild(ctx, client.ObjectKeyFromObject(myApp), deployment)
+				if err == nil {
+					state.deployment = deployment
+					state.changes.observe(deployment, appv1.SchemeGroupVersion.WithKind("Deployment"))
+				}
+				return client.IgnoreNotFound(err)
+			}
+			deployment, err := c.renderDeployment(ctx, myApp, secrets, &state.changes)
+			if err != nil {
+				return err
+			}
+			if state.limitRangeAdjusted, err = c.fitLimitRanges(ctx, myApp, deployment); err != nil {
+				return err
+			}
+			if state.policyViolation, err = c.checkPodPolicies(ctx, myApp, &deployment.Spec.Template); err != nil {
+				return err
+			}
+			// The Deployment is applied anyway, so the pods that fit are created.
+			if state.quotaExceeded, err = c.checkQuota(ctx, myApp, deployment); err != nil {
+				return err
+			}
+			pending, err := c.rotateSecrets(ctx, myApp, deployment, secrets)
+			if err != nil {
+				return err
+			}
+			state.rotationPending = pending
+			if state.rolloutQueued, err = c.throttleRollout(ctx, myApp, deployment); err != nil || state.rolloutQueued != nil {
+				// The live Deployment is observed until the rollout may start.
+				if err == nil {
+					state.deployment = &appv1.Deployment{}
+					err = c.getChild(ctx, client.ObjectKeyFromObject(myApp), state.deployment)
+					state.changes.observe(state.deployment, appv1.SchemeGroupVersion.WithKind("Deployment"))
+				}
+				return err
+			}
+			live, action, err := c.ensureChild(ctx, myApp, deployment, &state.changes)
+			if err != nil {
+				return err
+			}
+			state.deployment, state.deploymentCreated = live.(*appv1.Deployment), action == childCreated
+			if myApp.Spec.RecreateOnImmutableChange {
+				return c.cleanupSuperseded(ctx, myApp, state.deployment)
+			}
+			return nil
+		})
+		run("pod disruption budget", ensure(createPodDisruptionBudget(myApp, c.maxUnavailable(myApp))))
+		if myApp.Spec.Autoscaling != nil {
+			run("horizontal pod autoscaler", ensure(createHorizontalPodAutoscaler(myApp)))
+		}
+		if myApp.Spec.Autoscaling != nil && myApp.Spec.Autoscaling.Vertical != nil {
+			run("vertical pod autoscaler", func() error {
+				recommendations, err := c.ensureVerticalPodAutoscaler(ctx, myApp, &state.changes)
+				state.recommendations = recommendations
+				return err
+			})
+		}
+	}
+	state.taskTrigger = myApp.Status.LastTaskTrigger
+	if len(myApp.Spec.Tasks) > 0 {
+		run("tasks", func() error {
+			var err error
+			// Tasks wait for the ExternalSecrets like the workload.
+			state.tasks, state.taskTrigger, err = c.runTasks(ctx, myApp, secrets, secretsPending)
+			return err
+		})
+	}
+	if myApp.Spec.NetworkPolicy != nil {
+		run("network policy", ensure(createNetworkPolicy(myApp)))
+	}
+	run("service mesh objects", func() error {
+		return c.applyMeshObjects(ctx, myApp, &state.changes)
+	})
+
+	var serviceCond, routeCond *metav1.Condition
+	if serviceSpec(myApp) != nil {
+		run("service", func() error {
+			cond, err := c.ensureService(ctx, myApp, &state.changes)
+			serviceCond = &cond
+			return err
+		})
+	}
+	if myApp.Spec.Ingress != nil {
+		run("route", func() error {
+			cond, err := c.ensureRoute(ctx, myApp, &state.changes)
+			routeCond = &cond
+			return err
+		})
+	}
+
+	// Optional children the spec no longer asks for are pruned.
+	for _, obj := range c.staleChildren(myApp) {
+		obj := obj
+		gvk, err := apiutil.GVKForObject(obj, c.manager.GetScheme())
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+			continue
+		}
+		run("pruning "+gvk.Kind, func() error {
+			return c.pruneChild(ctx, myApp, obj, &state.changes)
+		})
+	}
+
+	_ = g.Wait()
+	for _, cond := range []*metav1.Condition{serviceCond, routeCond, state.rolloutQueued, state.quotaExceeded, state.limitRangeAdjusted, state.policyViolation} {
+		if cond != nil {
+			state.conditions = append(state.conditions, *cond)
+		}
+	}
+	return state, kerrors.NewAggregate(errs)
+}
+
+// renderDeployment renders the Deployment of myApp, consuming secrets, with the operator's
+// additions to its pods. The pods of Job and CronJob workloads are rendered from its template.
+func (c *Controller) renderDeployment(ctx context.Context, myApp *api.MyApp, secrets []corev1.Secret, changes *childChanges) (*appv1.Deployment, error) {
+	deployment := createDeployment(myApp)
+	c.configureTier(myApp, &deployment.Spec.Template)
+	injectSecrets(&deployment.Spec.Template, secrets)
+	if err := injectEgressProxy(&deployment.Spec.Template, c.egressProxies, myApp.Spec.EgressProxy); err != nil {
+		return nil, err
+	}
+	if err := c.injectCABundle(ctx, myApp, &deployment.Spec.Template, changes); err != nil {
+		return nil, err
+	}
+	if err := c.configureLogging(ctx, myApp, &deployment.Spec.Template, changes); err != nil {
+		return nil, err
+	}
+	if err := configureProfiling(myApp, &deployment.Spec.Template, c.profiling); err != nil {
+		return nil, err
+	}
+	if err := c.configureTimezone(ctx, myApp, &deployment.Spec.Template, changes); err != nil {
+		return nil, err
+	}
+	return deployment, nil
+}
+
+// ensureChild applies obj, owned by myApp, with server-side apply unless the live child has
+// obj's spec hash and kept the fields rendered in obj. Only the fields the controller renders are owned by it, so fields
+// other controllers manage, e.g. the replicas an HPA sets or injected sidecar annotations,
+// are left alone, as are the ignored differences. Children another actor keeps reverting are
+// re-applied with a backoff, and children whose update changes an immutable field are
+// recreated when the MyApp opts in. It returns the live child.
+func (c *Controller) ensureChild(ctx context.Context, myApp *api.MyApp, obj client.Object, changes *childChanges) (client.Object, childAction, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.manager.GetScheme())
+	if err != nil {
+		return nil, childUnchanged, err
+	}
+	if err := removeIgnored(obj, c.ignoredPointers(myApp, gvk.Kind)); err != nil {
+		return nil, childUnchanged, err
+	}
+	hash, err := specHash(obj)
+	if err != nil {
+		return nil, childUnchanged, err
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[specHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+	if err := ctrl.SetControllerReference(myApp, obj, c.manager.GetScheme()); err != nil {
+		return nil, childUnchanged, err
+	}
+
+	live := obj.DeepCopyObject().(client.Object)
+	err = c.getChild(ctx, client.ObjectKeyFromObject(obj), live)
+	if client.IgnoreNotFound(err) != nil {
+		return nil, childUnchanged, err
+	}
+	action := childCreated
+	if err == nil {
+		// The hash spares comparing children whose rendering changed. Children rendered the
+		// same are compared, as other actors can change them without touching the hash.
+		if live.GetAnnotations()[specHashAnnotation] == hash {
+			drift, err := drifted(obj, live)
+			if err != nil {
+				return nil, childUnchanged, err
+			}
+			if !drift {
+				changes.observe(live, gvk)
+				return live, childUnchanged, nil
+			}
+		}
+		action = childUpdated
+		if mismatch := selectorChange(gvk.Kind, obj, live); mismatch != nil {
+			if myApp.Spec.RecreateOnImmutableChange {
+				return nil, childUnchanged, c.recreateChild(ctx, myApp, live, gvk.Kind, mismatch)
+			}
+			// Applying would fail, the child is left as it is and the mismatch reported.
+			changes.mismatch(*mismatch)
+			changes.observe(live, gvk)
+			return live, childUnchanged, nil
+		}
+		conflict, apply := c.fights.reverted(client.ObjectKeyFromObject(myApp), gvk.Kind, live, hash, time.Now())
+		if conflict != nil {
+			changes.conflict(*conflict)
+		}
+		if !apply {
+			changes.observe(live, gvk)
+			return live, childUnchanged, nil
+		}
+	}
+
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	if err := c.client.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+		childApplyFailures.WithLabelValues(gvk.Kind, applyFailureReason(err)).Inc()
+		if action == childUpdated && myApp.Spec.RecreateOnImmutableChange && immutableFieldChange(err) {
+			err = c.recreateChild(ctx, myApp, live, gvk.Kind, err)
+		}
+		return nil, childUnchanged, err
+	}
+	c.fights.applied(client.ObjectKeyFromObject(myApp), gvk.Kind, obj.GetName(), hash)
+	changes.record(action, gvk.Kind)
+	changes.observe(obj, gvk)
+	return obj, action, nil
+}
+
+// specHash hashes the rendered child, before the owner reference and hash are set.
+func specHash(obj client.Object) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+func createHorizontalPodAutoscaler(myApp *api.MyApp) *autoscalingv2.HorizontalPodAutoscaler {
+	spec := myApp.Spec.Autoscaling
+	target := int32(defaultTargetCPUUtilization)
+	if spec.TargetCPUUtilizationPercentage != nil {
+		target = *spec.TargetCPUUtilizationPercentage
+	}
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: myApp.Namespace,
+			Name:      myApp.Name,
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       myApp.Name,
+			},
+			MinReplicas: spec.MinReplicas,
+			MaxReplicas: spec.MaxReplicas,
+			Metrics: []autoscalingv2.MetricSpec{
+				{
+					Type: autoscalingv2.ResourceMetricSourceType,
+					Resource: &autoscalingv2.ResourceMetricSource{
+						Name: corev1.ResourceCPU,
+						Target: autoscalingv2.MetricTarget{
+							Type:               autoscalingv2.UtilizationMetricType,
+							AverageUtilization: &target,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// createNetworkPolicy allows ingress to the MyApp's pods from its own namespace and the
+// allowed namespaces, on the Service's target port when the MyApp has a Service.
+func createNetworkPolicy(myApp *api.MyApp) *networkingv1.NetworkPolicy {
+	peers := []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}
+	for _, ns := range myApp.Spec.NetworkPolicy.AllowedNamespaces {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{corev1.LabelMetadataName: ns},
+			},
+		})
+	}
+	rule := networkingv1.NetworkPolicyIngressRule{From: peers}
+	if spec := serviceSpec(myApp); spec != nil {
+		_, target := servicePorts(spec)
+		port := intstr.FromInt32(target)
+		protocol := corev1.ProtocolTCP
+		rule.Ports = []networkingv1.NetworkPolicyPort{{Protocol: &protocol, Port: &port}}
+	}
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: myApp.Namespace,
+			Name:      myApp.Name,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: labelsForMyApp(myApp.Name)},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{rule},
+		},
+	}
+}
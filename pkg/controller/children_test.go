@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// TestEnsureChildCorrectsDrift runs against the API server and etcd of envtest, installed
+// with `setup-envtest use -p path` into the directory KUBEBUILDER_ASSETS points to.
+func TestEnsureChildCorrectsDrift(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is unset")
+	}
+	env := &envtest.Environment{}
+	cfg, err := env.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Stop()
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager, err := ctrl.NewManager(cfg, ctrl.Options{Scheme: scheme, Metrics: metricsserver.Options{BindAddress: "0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Controller{client: cl, manager: manager, fights: newFightTracker()}
+
+	ctx := context.Background()
+	// Owner references aren't checked without the garbage collector, the MyApp needn't exist.
+	myApp := &api.MyApp{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "6b1c1a4e-63d2-4b1b-9d65-2d8f5c0d1e5a"},
+		Spec:       api.MyAppSpec{Image: "web:1.2", Replicas: int32Ptr(2)},
+	}
+	ensure := func() (*appv1.Deployment, childAction) {
+		t.Helper()
+		obj, action, err := c.ensureChild(ctx, myApp, createDeployment(myApp), &childChanges{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return obj.(*appv1.Deployment), action
+	}
+
+	if _, action := ensure(); action != childCreated {
+		t.Fatalf("first ensureChild() action = %v, want created", action)
+	}
+	if _, action := ensure(); action != childUnchanged {
+		t.Fatalf("ensureChild() of an unchanged child action = %v, want unchanged", action)
+	}
+
+	// kubectl set image changes the container but not the spec hash annotation.
+	live := &appv1.Deployment{}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(myApp), live); err != nil {
+		t.Fatal(err)
+	}
+	live.Spec.Template.Spec.Containers[0].Image = "web:1.1"
+	if err := cl.Update(ctx, live, client.FieldOwner("kubectl-set")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, action := ensure(); action != childUpdated {
+		t.Fatalf("ensureChild() of a drifted child action = %v, want updated", action)
+	}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(myApp), live); err != nil {
+		t.Fatal(err)
+	}
+	if image := live.Spec.Template.Spec.Containers[0].Image; image != "web:1.2" {
+		t.Errorf("image after correcting the drift = %s, want web:1.2", image)
+	}
+	if _, action := ensure(); action != childUnchanged {
+		t.Errorf("ensureChild() after correcting the drift action = %v, want unchanged", action)
+	}
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	clientRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "myapp_client_requests_total",
+		Help: "Number of requests issued by the MyApp controller's client, by verb, kind and result. Reads are mostly served by the cache",
+	}, []string{"verb", "kind", "result"})
+	clientRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "myapp_client_request_duration_seconds",
+		Help:    "Latency of the requests issued by the MyApp controller's client, by verb and kind",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"verb", "kind"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(clientRequests, clientRequestDuration)
+}
+
+// instrumentedClient records the count, result and latency of every request issued
+// through a client.
+type instrumentedClient struct {
+	client.Client
+}
+
+func (c *instrumentedClient) observe(verb string, obj runtime.Object, start time.Time, err error) {
+	kind := "unknown"
+	if gvk, gvkErr := c.GroupVersionKindFor(obj); gvkErr == nil {
+		kind = strings.TrimSuffix(gvk.Kind, "List")
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	clientRequests.WithLabelValues(verb, kind, result).Inc()
+	clientRequestDuration.WithLabelValues(verb, kind).Observe(time.Since(start).Seconds())
+}
+
+func (c *instrumentedClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	start := time.Now()
+	err := c.Client.Get(ctx, key, obj, opts...)
+	c.observe("get", obj, start, err)
+	return err
+}
+
+func (c *instrumentedClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	start := time.Now()
+	err := c.Client.List(ctx, list, opts...)
+	c.observe("list", list, start, err)
+	return err
+}
+
+func (c *instrumentedClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	start := time.Now()
+	err := c.Client.Create(ctx, obj, opts...)
+	c.observe("create", obj, start, err)
+	return err
+}
+
+func (c *instrumentedClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	start := time.Now()
+	err := c.Client.Update(ctx, obj, opts...)
+	c.observe("update", obj, start, err)
+	return err
+}
+
+func (c *instrumentedClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	start := time.Now()
+	err := c.Client.Patch(ctx, obj, patch, opts...)
+	c.observe("patch", obj, start, err)
+	return err
+}
+
+func (c *instrumentedClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	start := time.Now()
+	err := c.Client.Delete(ctx, obj, opts...)
+	c.observe("delete", obj, start, err)
+	return err
+}
+
+func (c *instrumentedClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	start := time.Now()
+	err := c.Client.DeleteAllOf(ctx, obj, opts...)
+	c.observe("deletecollection", obj, start, err)
+	return err
+}
+
+func (c *instrumentedClient) Status() client.SubResourceWriter {
+	return &instrumentedStatusWriter{SubResourceWriter: c.Client.Status(), client: c}
+}
+
+type instrumentedStatusWriter struct {
+	client.SubResourceWriter
+	client *instrumentedClient
+}
+
+func (w *instrumentedStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	start := time.Now()
+	err := w.SubResourceWriter.Update(ctx, obj, opts...)
+	w.client.observe("update_status", obj, start, err)
+	return err
+}
+
+func (w *instrumentedStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	start := time.Now()
+	err := w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+	w.client.observe("patch_status", obj, start, err)
+	return err
+}
@@ -2,24 +2,47 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	appv1 "k8s.io/api/apps/v1"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/steeling/controller-runtime-exercise/pkg/admin"
 	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	"github.com/steeling/controller-runtime-exercise/pkg/audit"
+	"github.com/steeling/controller-runtime-exercise/pkg/cloudevents"
+	"github.com/steeling/controller-runtime-exercise/pkg/features"
+	"github.com/steeling/controller-runtime-exercise/pkg/monitoring"
+	"github.com/steeling/controller-runtime-exercise/pkg/multicluster"
+	"github.com/steeling/controller-runtime-exercise/pkg/notify"
+	"github.com/steeling/controller-runtime-exercise/pkg/preflight"
+	"github.com/steeling/controller-runtime-exercise/pkg/webhook"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	policyv1 "k8s.io/api/policy/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
-	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	ctrlwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 // Define custom metrics
@@ -36,71 +59,771 @@ var (
 		Help:    "Duration of reconcile loop for MyApp",
 		Buckets: prometheus.DefBuckets,
 	}, []string{"result"})
+	fleetApps = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "myapp_fleet_apps",
+		Help: "Number of MyApps managed by this controller, by health",
+	}, []string{"health"})
 )
 
 const (
+	leaderElectionID = "example-leader-election-id"
+
 	reconcilationError   = "error"
 	reconcilationSuccess = "success"
 	reconcilationSkipped = "skipped"
 )
 
+// Options configures the controller.
+type Options struct {
+	// Namespace is the namespace the operator runs in.
+	Namespace string
+
+	// AuditResources additionally records every mutation in a MyAppAudit object per namespace.
+	AuditResources bool
+	// CloudEventsSink is the HTTP endpoint lifecycle CloudEvents are posted to. Disabled when empty.
+	CloudEventsSink string
+	// NotificationsSecret is the "namespace/name" of the Secret holding the notification
+	// routes. Notifications are disabled when empty.
+	NotificationsSecret string
+	// GrafanaDashboard publishes a Grafana dashboard for the controller's metrics as a ConfigMap in Namespace.
+	GrafanaDashboard bool
+	// PrometheusRules publishes alerts for the operator as a PrometheusRule in Namespace,
+	// when the prometheus-operator CRDs are installed.
+	PrometheusRules bool
+	// OTLPMetricsEndpoint additionally exports the controller's metrics to this OTLP/HTTP
+	// endpoint every OTLPMetricsInterval. Disabled when empty.
+	OTLPMetricsEndpoint string
+	OTLPMetricsInterval time.Duration
+	// PushgatewayURL pushes the controller's metrics to this Prometheus Pushgateway every
+	// PushgatewayInterval and on shutdown. Disabled when empty.
+	PushgatewayURL      string
+	PushgatewayInterval time.Duration
+	// ServiceProfilesFile is a YAML file of additional Service load balancer profiles,
+	// mapping a profile name to the annotations it expands into.
+	ServiceProfilesFile string
+	// SizeProfilesFile is a YAML file mapping the sizes small, medium and large to the
+	// resources, replicas and PodDisruptionBudget maxUnavailable of the MyApps of that size.
+	// Sizes it defines replace the built-in ones.
+	SizeProfilesFile string
+	// TierProfilesFile is a YAML file mapping the tiers dev, standard and critical to the
+	// PodDisruptionBudget maxUnavailable, priority class, anti-affinity and reconcile priority
+	// of the MyApps of that tier, replacing the built-in tiers.
+	TierProfilesFile string
+	// MaxConcurrentRollouts caps the MyApps whose Deployments roll out at once. The others
+	// are queued with the RolloutQueued condition. Unlimited when 0.
+	MaxConcurrentRollouts int
+	// RolloutWaves rolls changes from outside the MyApps' specs, e.g. to a MyAppTemplate,
+	// out by the myapp.example.com/rollout-wave annotation of the MyApps, in ascending
+	// order, letting each wave soak for WaveSoakTime. The waves halt while more than
+	// WaveMaxDegraded MyApps of lower waves are degraded.
+	RolloutWaves    bool
+	WaveSoakTime    time.Duration
+	WaveMaxDegraded int
+	// DrainMaxSurge pre-scales MyApps by up to this many replicas while their pods are on
+	// cordoned Nodes, so drains complete faster. Disabled when 0.
+	DrainMaxSurge int
+	// ZoneFailureThreshold is the fraction of unready Nodes of a single availability zone
+	// considered a zone outage, during which MyApps of the high criticality tier are scaled
+	// up. Disabled when 0.
+	ZoneFailureThreshold float64
+	// MaxConcurrentSecretRotations caps the MyApps restarting their pods for rotated Secrets
+	// at once. Unlimited when 0.
+	MaxConcurrentSecretRotations int
+	// AdmissionDryRun dry-runs the creation of a pod of every MyApp through the cluster's
+	// admission webhooks and policy engines, and reports denials on the MyApp.
+	AdmissionDryRun bool
+	// DebugImage is the image of the ephemeral containers the debug annotation adds.
+	DebugImage string
+	// FluentBitImage is the image of the sidecars tailing the log files of MyApps logging to a file.
+	FluentBitImage string
+	// CABundleConfigMap is the "namespace/name" of a ConfigMap holding a trusted CA bundle
+	// under the ca.crt key. It is copied into the namespace of every MyApp and mounted in
+	// its pods, which are rolled when it changes. Disabled when empty.
+	CABundleConfigMap string
+	// EgressProxyProfilesFile is a YAML file mapping egress proxy profile names to the proxies,
+	// and the ConfigMaps of their CA bundles, the pods of MyApps selecting them are configured with.
+	EgressProxyProfilesFile string
+	// ProfilingConfigFile is a YAML file configuring the continuous profiler, Pyroscope or
+	// Parca, the pods of MyApps enabling profiling are set up for.
+	ProfilingConfigFile string
+	// CPUHourlyPrice and MemoryHourlyPrice are the prices of a CPU and of a GiB of memory
+	// per hour. The estimated monthly cost of the requests of MyApps is reported on their
+	// status when either is set.
+	CPUHourlyPrice    float64
+	MemoryHourlyPrice float64
+	// RightSizingPrometheusURL is the Prometheus the usage of MyApps is queried from, every
+	// RightSizingInterval, to recommend their requests. Disabled when empty.
+	RightSizingPrometheusURL string
+	RightSizingInterval      time.Duration
+	// VerifyImageArchitectures looks up the images of MyApps requesting architectures in
+	// their registries, to verify they are built for them.
+	VerifyImageArchitectures bool
+	// DefaultGateway is the "namespace/name[/section]" of the Gateway HTTPRoutes attach to
+	// when a MyApp in GatewayAPI mode doesn't name one.
+	DefaultGateway string
+	// Shards splits the MyApps across this many replicas, each reconciling only its own
+	// shard. Leader election is disabled when sharding. Disabled when 0 or 1.
+	Shards int
+	// ShardIndex is the shard this replica reconciles. When negative it is taken from the
+	// ordinal of the StatefulSet pod the operator runs in.
+	ShardIndex int
+	// AdminBindAddress is the address the read-only admin API is served on. Disabled when empty.
+	AdminBindAddress string
+	// PriorityQueue reconciles MyApps whose spec changed before resyncs and requeues.
+	PriorityQueue bool
+	// DebounceWindow delays reconciles until a MyApp and its children saw no events for this
+	// long, collapsing bursts of edits into one reconcile. Disabled when 0.
+	DebounceWindow time.Duration
+	// MaxConcurrentReconciles is the number of MyApps reconciled in parallel. Defaults to 1.
+	MaxConcurrentReconciles int
+	// NamespaceConcurrency caps the concurrent reconciles per namespace. Unlimited when 0.
+	NamespaceConcurrency int
+	// NamespaceQPS caps the writes per second issued for the MyApps of a namespace. Unlimited when 0.
+	NamespaceQPS float64
+	// FeatureGates enables or disables optional behavior.
+	FeatureGates features.Gates
+	// AllowHostNamespaces permits MyApps in namespaces labeled with
+	// api.AllowHostNamespacesLabel to run in the host's network and PID namespaces.
+	AllowHostNamespaces bool
+	// ImpersonateTenants applies the children of MyApps impersonating the ServiceAccount named
+	// by the myapp.example.com/tenant-service-account annotation of their namespace.
+	ImpersonateTenants bool
+	// NamespaceSelector is a label selector of the namespaces whose MyApps are reconciled.
+	// Every namespace is reconciled when empty.
+	NamespaceSelector string
+	// ExcludeNamespaces is a comma separated list of namespaces that are never reconciled,
+	// nor cached.
+	ExcludeNamespaces string
+	// WatchLabelSelector is a label selector of the MyApps the controller manages. Every
+	// MyApp is managed when empty.
+	WatchLabelSelector string
+	// Controllers is a comma separated list of the controllers to run. "*" stands for the
+	// controllers enabled by default and "-name" disables one. Defaults to "*".
+	Controllers string
+	// IgnoreDifferences is a comma separated list of Kind:/json/pointer fields of children
+	// that are left to other managers for every MyApp, in addition to Spec.IgnoreDifferences.
+	IgnoreDifferences string
+	// WebhookPort is the port the MyApp validating webhook is served on, by every replica.
+	// Disabled when 0.
+	WebhookPort int
+	// WebhookCertDir holds the tls.crt and tls.key the webhook is served with.
+	WebhookCertDir string
+	// HealthTimeout fails the liveness check when MyApps stayed queued without a successful
+	// reconcile for this long. Disabled when 0.
+	HealthTimeout time.Duration
+	// WatchdogWindow is how long the workqueue must grow without a reconcile finishing for
+	// the watchdog to report it stuck and dump the goroutine stacks. Disabled when 0.
+	WatchdogWindow time.Duration
+	// WatchdogFailHealthz also fails the liveness check while the watchdog reports the
+	// workqueue stuck.
+	WatchdogFailHealthz bool
+	// KubeAPIQPS and KubeAPIBurst rate limit the requests to the API server.
+	KubeAPIQPS   float64
+	KubeAPIBurst int
+	// AdaptiveQPS lowers the QPS while the API server throttles requests, raising it back
+	// to KubeAPIQPS gradually.
+	AdaptiveQPS bool
+	// InstallCRDs applies the CRDs embedded in the binary at startup, so the operator can be
+	// installed without applying them separately.
+	InstallCRDs bool
+	// MigrateStoredVersions rewrites the objects of the operator's CRDs stored in a version
+	// other than the storage version, and then drops the other versions from the CRDs'
+	// status.storedVersions, so they can be removed in a later upgrade.
+	MigrateStoredVersions bool
+	// NamespaceSummaries publishes the number of MyApps, ready MyApps and replicas of every
+	// namespace in its myapp-summary ConfigMap. Not supported when sharding.
+	NamespaceSummaries bool
+	// MinReplicas and MaxReplicas bound the replicas of every MyApp, including the range
+	// it autoscales in. MaxReplicas is unbounded when 0.
+	MinReplicas int
+	MaxReplicas int
+	// LogReconcilesPerMinute is the number of reconciles per MyApp and minute that are
+	// logged, the messages of the others are summarized. Unlimited when 0.
+	LogReconcilesPerMinute int
+	// StandbyReady makes replicas that aren't the leader report Ready. When false, only
+	// the leader passes the readiness check.
+	StandbyReady bool
+}
+
 type Controller struct {
-	client  client.Client
-	manager ctrl.Manager
+	client            client.Client
+	manager           ctrl.Manager
+	runtimeController controller.Controller
+	// controllerOptions and forOptions configure the MyApp controller's queue.
+	controllerOptions controller.Options
+	forOptions        []ctrlbuilder.ForOption
+	// health backs the liveness check of the MyApp controller.
+	health *controllerHealth
+	// history backs the admin API's reconcile timelines, nil without an admin server.
+	history *reconcileHistory
+	// logSampler limits the logs of MyApps in hot loops, nil when disabled.
+	logSampler *logSampler
+	lifecycle  *lifecycleTracker
+	fights     *fightTracker
+	// summaries publishes the per-namespace summaries, nil when disabled.
+	summaries       *namespaceSummaries
+	events          *cloudevents.Publisher
+	notifier        *notify.Notifier
+	esWatch         externalSecretWatch
+	serviceProfiles map[string]map[string]string
+	sizes           map[string]sizeProfile
+	tiers           map[string]tierProfile
+	egressProxies   map[string]egressProxyProfile
+	// profiling configures the continuous profiler, nil when there is none.
+	profiling *profilingConfig
+	// caBundle distributes the trusted CA bundle, nil when there is none.
+	caBundle  *caBundle
+	rotations *rotationLimiter
+	rollouts  *rolloutCoordinator
+	waves     *waveTracker
+	// drainMaxSurge is the most replicas a MyApp is pre-scaled by for drains.
+	drainMaxSurge int
+	zones         *zoneMonitor
+	// costs estimates the cost of MyApps, nil when the operator has no prices.
+	costs *costModel
+	// rightSizer recommends requests from the usage of MyApps, nil when disabled.
+	rightSizer     *rightSizer
+	recorder       record.EventRecorder
+	debugImage     string
+	fluentBitImage string
+	// dryRuns dry-runs the pods of MyApps through admission, nil when disabled.
+	dryRuns *admissionDryRun
+	// images looks up the architectures of images, nil when not verifying them.
+	images         *imageInspector
+	defaultGateway *api.GatewayRef
+	// gatewayAPI records whether the Gateway API CRDs were installed at startup.
+	gatewayAPI bool
+	// vpa records whether the VerticalPodAutoscaler CRD was installed at startup.
+	vpa bool
+	// clusters resolves Spec.Targets. It is nil when the operator namespace is unknown.
+	clusters *multicluster.Registry
+	// shard is the slice of MyApps this replica reconciles, nil when not sharding.
+	shard *shard
+	// limits keeps a single namespace from starving the others.
+	limits   *namespaceLimits
+	features features.Gates
+	// namespaces filters the namespaces reconciled, nil when every namespace is.
+	namespaces *namespaceFilter
+	// selector filters the MyApps managed, nil when every MyApp is.
+	selector *appSelector
+	// impersonating records whether children are applied as the tenant ServiceAccounts.
+	impersonating       bool
+	allowHostNamespaces bool
+	// ignoreDifferences apply to the children of every MyApp.
+	ignoreDifferences []api.IgnoreDifference
+	replicas          replicaBounds
 }
 
 func init() {
-	metrics.Registry.MustRegister(myAppReconcileCounter, reconcileDuration)
+	metrics.Registry.MustRegister(myAppReconcileCounter, reconcileDuration, fleetApps)
 }
 
-func New(ctx context.Context) (*Controller, error) {
-	log.SetLogger(zap.New(zap.UseDevMode(true)))
+// ConfigError is returned by New when the Options or the kubeconfig are invalid, as opposed
+// to failures to set up against the cluster.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string { return e.Err.Error() }
+
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+func New(ctx context.Context, opts Options) (*Controller, error) {
 	log := log.FromContext(ctx)
 	log.Info("creating a new controller")
-	manager, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+
+	shard, err := newShard(opts.Shards, opts.ShardIndex)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	if shard != nil {
+		log.Info("sharding enabled", "shard", shard.index, "shards", shard.count)
+	}
+
+	namespaces, err := newNamespaceFilter(opts.NamespaceSelector, opts.ExcludeNamespaces)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	selector, err := newAppSelector(opts.WatchLabelSelector)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+
+	if opts.MinReplicas < 0 || opts.MaxReplicas < 0 || (opts.MaxReplicas > 0 && opts.MinReplicas > opts.MaxReplicas) {
+		return nil, &ConfigError{fmt.Errorf("invalid replica bounds %d-%d", opts.MinReplicas, opts.MaxReplicas)}
+	}
+
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	config.QPS, config.Burst = float32(opts.KubeAPIQPS), opts.KubeAPIBurst
+	var adaptiveQPS *adaptiveRateLimiter
+	if opts.AdaptiveQPS {
+		adaptiveQPS = newAdaptiveRateLimiter(config, ctrl.Log.WithName("adaptive-qps"))
+	}
+
+	var webhookServer ctrlwebhook.Server
+	if opts.WebhookPort != 0 {
+		webhookServer = ctrlwebhook.NewServer(ctrlwebhook.Options{
+			Port:    opts.WebhookPort,
+			CertDir: opts.WebhookCertDir,
+		})
+	}
+
+	bundle, err := newCABundle(opts.CABundleConfigMap, config)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	cacheOpts := cacheOptions(namespaces)
+
+	manager, err := ctrl.NewManager(config, ctrl.Options{
 		Metrics: metricsserver.Options{
 			BindAddress: ":8080",
 		},
+		Cache:                  cacheOpts,
 		HealthProbeBindAddress: ":8081",
-		LeaderElection:         true,
-		LeaderElectionID:       "example-leader-election-id",
+		WebhookServer:          webhookServer,
+		// Shards are disjoint, so every sharded replica reconciles concurrently.
+		LeaderElection:   shard == nil,
+		LeaderElectionID: leaderElectionID,
+		// Defaults to the namespace of the in-cluster service account when empty.
+		LeaderElectionNamespace: opts.Namespace,
+		// Hand over to a standby replica right away on shutdown.
+		LeaderElectionReleaseOnCancel: true,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	if err := manager.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+	health := &controllerHealth{timeout: opts.HealthTimeout}
+	if err := manager.AddHealthzCheck("myapp-controller", health.check); err != nil {
 		log.Error(err, "unable to set up health check")
 		return nil, err
 	}
 
-	if err := manager.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+	if adaptiveQPS != nil {
+		if err := manager.Add(adaptiveQPS); err != nil {
+			log.Error(err, "unable to set up adaptive QPS")
+			return nil, err
+		}
+	}
+
+	if opts.WatchdogWindow > 0 {
+		watchdog := &watchdog{health: health, window: opts.WatchdogWindow, log: ctrl.Log.WithName("watchdog")}
+		if err := manager.Add(watchdog); err != nil {
+			log.Error(err, "unable to set up watchdog")
+			return nil, err
+		}
+		if opts.WatchdogFailHealthz {
+			if err := manager.AddHealthzCheck("watchdog", watchdog.check); err != nil {
+				log.Error(err, "unable to set up watchdog health check")
+				return nil, err
+			}
+		}
+	}
+
+	if err := manager.AddReadyzCheck("informers", cacheSyncedCheck(manager.GetCache())); err != nil {
 		log.Error(err, "unable to set up ready check")
 		return nil, err
 	}
 
+	if shard == nil && !opts.StandbyReady {
+		if err := manager.AddReadyzCheck("leader", leaderReadyCheck(manager.Elected())); err != nil {
+			log.Error(err, "unable to set up leader ready check")
+			return nil, err
+		}
+	}
+
+	if bundle != nil {
+		if err := manager.Add(bundle.cache); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := api.AddToScheme(manager.GetScheme()); err != nil {
 		log.Error(err, "Unable to add the custom resource scheme")
 		return nil, err
 	}
 
+	if opts.InstallCRDs || opts.MigrateStoredVersions {
+		if err := apiextensionsv1.AddToScheme(manager.GetScheme()); err != nil {
+			return nil, err
+		}
+	}
+	if opts.InstallCRDs {
+		if err := installCRDs(ctx, manager.GetClient(), manager.GetAPIReader(), ctrl.Log.WithName("crds")); err != nil {
+			log.Error(err, "unable to install the CRDs")
+			return nil, err
+		}
+	}
+	if opts.MigrateStoredVersions {
+		if err := manager.Add(&storageMigrator{
+			client: manager.GetClient(),
+			reader: manager.GetAPIReader(),
+			log:    ctrl.Log.WithName("migration"),
+		}); err != nil {
+			log.Error(err, "unable to set up stored version migration")
+			return nil, err
+		}
+	}
+
+	// Every mutation is logged; persisting them to MyAppAudit objects is opt-in.
+	sinks := []audit.Sink{audit.LogSink{Log: ctrl.Log.WithName("audit")}}
+	if opts.AuditResources {
+		sinks = append(sinks, &audit.ResourceSink{
+			Client: manager.GetClient(),
+			Log:    ctrl.Log.WithName("audit"),
+		})
+	}
+
+	serviceProfiles, err := loadServiceProfiles(opts.ServiceProfilesFile)
+	if err != nil {
+		log.Error(err, "unable to load service profiles")
+		return nil, &ConfigError{err}
+	}
+
+	sizes, err := loadSizeProfiles(opts.SizeProfilesFile)
+	if err != nil {
+		log.Error(err, "unable to load size profiles")
+		return nil, &ConfigError{err}
+	}
+	tiers, err := loadTierProfiles(opts.TierProfilesFile)
+	if err != nil {
+		log.Error(err, "unable to load tier profiles")
+		return nil, &ConfigError{err}
+	}
+	egressProxies, err := loadEgressProxyProfiles(opts.EgressProxyProfilesFile)
+	if err != nil {
+		log.Error(err, "unable to load egress proxy profiles")
+		return nil, &ConfigError{err}
+	}
+	profiling, err := loadProfilingConfig(opts.ProfilingConfigFile)
+	if err != nil {
+		log.Error(err, "unable to load profiling config")
+		return nil, &ConfigError{err}
+	}
+
+	var images *imageInspector
+	if opts.VerifyImageArchitectures {
+		images = newImageInspector()
+	}
+	sizer, err := newRightSizer(opts.RightSizingPrometheusURL, opts.RightSizingInterval)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+
+	defaultGateway, err := parseGatewayRef(opts.DefaultGateway)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+
+	ignoreDifferences, err := parseIgnoreDifferences(opts.IgnoreDifferences)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+
+	enabled, err := enabledControllers(opts.Controllers)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+
+	var priority *priorityQueue
+	var forOpts []ctrlbuilder.ForOption
+	if opts.PriorityQueue {
+		priority = newPriorityQueue()
+		forOpts = append(forOpts, ctrlbuilder.WithPredicates(priority.predicate(reconcilePriority(tiers))))
+	}
+	controllerOpts := controller.Options{
+		MaxConcurrentReconciles: opts.MaxConcurrentReconciles,
+		NewQueue:                newQueueFunc(priority, opts.DebounceWindow, health),
+	}
+
+	limits := newNamespaceLimits(opts.NamespaceConcurrency, opts.NamespaceQPS)
+	// Mutations are audited as issued, whichever identity they are issued with.
+	baseClient := manager.GetClient()
+	if opts.ImpersonateTenants {
+		baseClient = newTenantClient(manager)
+	}
+	var apiClient client.Client = audit.NewClient(&instrumentedClient{Client: &debugClient{Client: baseClient}}, sinks...)
+	if opts.NamespaceQPS > 0 {
+		apiClient = &limitedClient{Client: apiClient, limits: limits}
+	}
+
 	controller := &Controller{
-		client:  manager.GetClient(),
-		manager: manager,
+		client:              apiClient,
+		manager:             manager,
+		lifecycle:           newLifecycleTracker(),
+		fights:              newFightTracker(),
+		serviceProfiles:     serviceProfiles,
+		sizes:               sizes,
+		tiers:               tiers,
+		egressProxies:       egressProxies,
+		profiling:           profiling,
+		caBundle:            bundle,
+		rotations:           newRotationLimiter(opts.MaxConcurrentSecretRotations),
+		rollouts:            newRolloutCoordinator(opts.MaxConcurrentRollouts),
+		waves:               newWaveTracker(opts.RolloutWaves, opts.WaveSoakTime, opts.WaveMaxDegraded),
+		drainMaxSurge:       opts.DrainMaxSurge,
+		zones:               newZoneMonitor(opts.ZoneFailureThreshold),
+		costs:               newCostModel(opts.CPUHourlyPrice, opts.MemoryHourlyPrice),
+		rightSizer:          sizer,
+		images:              images,
+		recorder:            manager.GetEventRecorderFor(fieldOwner),
+		debugImage:          opts.DebugImage,
+		dryRuns:             newAdmissionDryRun(opts.AdmissionDryRun, manager.GetClient()),
+		fluentBitImage:      opts.FluentBitImage,
+		defaultGateway:      defaultGateway,
+		shard:               shard,
+		limits:              limits,
+		features:            opts.FeatureGates,
+		ignoreDifferences:   ignoreDifferences,
+		namespaces:          namespaces,
+		selector:            selector,
+		impersonating:       opts.ImpersonateTenants,
+		allowHostNamespaces: opts.AllowHostNamespaces,
+		controllerOptions:   controllerOpts,
+		forOptions:          forOpts,
+		health:              health,
+		logSampler:          newLogSampler(opts.LogReconcilesPerMinute),
+		replicas:            replicaBounds{min: int32(opts.MinReplicas), max: int32(opts.MaxReplicas)},
+	}
+	if namespaces != nil {
+		namespaces.reader = manager.GetClient()
 	}
 
-	err = ctrl.
-		NewControllerManagedBy(manager). // Create the Controller
-		For(&api.MyApp{}).               // MyApp is the Application API
-		Owns(&appv1.Deployment{}).       // MyApp owns Deployments created by it
-		Complete(controller)
+	controller.gatewayAPI, err = controller.kindInstalled(httpRouteGVK)
 	if err != nil {
-		log.Error(err, "unable to create controller")
+		log.Error(err, "unable to detect the Gateway API CRDs")
 		return nil, err
 	}
+	log.Info("gateway API detection", "installed", controller.gatewayAPI)
+	controller.vpa, err = controller.kindInstalled(vpaGVK)
+	if err != nil {
+		log.Error(err, "unable to detect the VerticalPodAutoscaler CRD")
+		return nil, err
+	}
+	log.Info("VerticalPodAutoscaler detection", "installed", controller.vpa)
+
+	// Target clusters are registered through kubeconfig Secrets in the operator namespace.
+	if opts.Namespace != "" {
+		controller.clusters = multicluster.NewRegistry(manager.GetAPIReader(), opts.Namespace, manager.GetScheme())
+	}
+
+	// Only the leader runs the reconciler and the runnables that write to the cluster or
+	// deliver notifications. The metrics server, health probes and admin API are served by
+	// every replica so a standby can be inspected and scraped.
+	var server *admin.Server
+	if opts.AdminBindAddress != "" {
+		server = admin.NewServer(opts.AdminBindAddress, ctrl.Log.WithName("admin"))
+		controller.history = newReconcileHistory()
+		controller.registerAdminEndpoints(server)
+		if err := manager.Add(server); err != nil {
+			log.Error(err, "unable to set up admin server")
+			return nil, err
+		}
+	}
+
+	// Every replica follows the leader election Lease to report who the leader is.
+	if shard == nil && opts.Namespace != "" {
+		observer := &leaderObserver{
+			reader:  manager.GetAPIReader(),
+			lease:   types.NamespacedName{Namespace: opts.Namespace, Name: leaderElectionID},
+			elected: manager.Elected(),
+			log:     ctrl.Log.WithName("leader"),
+		}
+		if server != nil {
+			observer.registerAdminEndpoints(server)
+		}
+		if err := manager.Add(observer); err != nil {
+			log.Error(err, "unable to set up leader observer")
+			return nil, err
+		}
+	}
+
+	if opts.NotificationsSecret != "" {
+		ns, name, ok := strings.Cut(opts.NotificationsSecret, "/")
+		if !ok || ns == "" || name == "" {
+			return nil, &ConfigError{fmt.Errorf("notifications secret %q must be of the form namespace/name", opts.NotificationsSecret)}
+		}
+		controller.notifier = notify.NewNotifier(manager.GetAPIReader(), types.NamespacedName{Namespace: ns, Name: name}, ctrl.Log.WithName("notify"))
+		if err := manager.Add(controller.notifier); err != nil {
+			log.Error(err, "unable to set up notifier")
+			return nil, err
+		}
+	}
+
+	if opts.GrafanaDashboard {
+		if opts.Namespace == "" {
+			return nil, &ConfigError{fmt.Errorf("the operator namespace is required to publish the grafana dashboard")}
+		}
+		if err := manager.Add(&monitoring.DashboardPublisher{
+			Client:    manager.GetClient(),
+			Namespace: opts.Namespace,
+			Log:       ctrl.Log.WithName("monitoring"),
+		}); err != nil {
+			log.Error(err, "unable to set up grafana dashboard publisher")
+			return nil, err
+		}
+	}
+
+	if opts.PrometheusRules {
+		if opts.Namespace == "" {
+			return nil, &ConfigError{fmt.Errorf("the operator namespace is required to publish prometheus rules")}
+		}
+		if err := manager.Add(&monitoring.RulePublisher{
+			Client:           manager.GetClient(),
+			Namespace:        opts.Namespace,
+			LeaderElectionID: leaderElectionID,
+			Log:              ctrl.Log.WithName("monitoring"),
+		}); err != nil {
+			log.Error(err, "unable to set up prometheus rule publisher")
+			return nil, err
+		}
+	}
+
+	if opts.OTLPMetricsEndpoint != "" {
+		if err := manager.Add(&monitoring.OTLPExporter{
+			Endpoint: opts.OTLPMetricsEndpoint,
+			Interval: opts.OTLPMetricsInterval,
+			Gatherer: metrics.Registry,
+			Log:      ctrl.Log.WithName("monitoring"),
+		}); err != nil {
+			log.Error(err, "unable to set up OTLP metrics exporter")
+			return nil, err
+		}
+	}
+
+	if opts.PushgatewayURL != "" {
+		if err := manager.Add(&monitoring.PushgatewayPusher{
+			URL:      opts.PushgatewayURL,
+			Interval: opts.PushgatewayInterval,
+			Gatherer: metrics.Registry,
+			Log:      ctrl.Log.WithName("monitoring"),
+		}); err != nil {
+			log.Error(err, "unable to set up pushgateway pusher")
+			return nil, err
+		}
+	}
+
+	if opts.NamespaceSummaries {
+		if shard != nil {
+			return nil, &ConfigError{fmt.Errorf("namespace summaries can't be published when sharding, every shard only knows its own MyApps")}
+		}
+		controller.summaries = newNamespaceSummaries(manager.GetClient(), ctrl.Log.WithName("summaries"))
+		if err := manager.Add(controller.summaries); err != nil {
+			log.Error(err, "unable to set up namespace summaries")
+			return nil, err
+		}
+	}
+
+	if opts.CloudEventsSink != "" {
+		controller.events = cloudevents.NewPublisher(opts.CloudEventsSink, ctrl.Log.WithName("cloudevents"))
+		if err := manager.Add(controller.events); err != nil {
+			log.Error(err, "unable to set up cloudevents publisher")
+			return nil, err
+		}
+	}
+
+	var checks []preflight.Check
+	for _, setup := range setups {
+		if enabled[setup.name] && setup.preflight != nil {
+			checks = append(checks, setup.preflight(controller)...)
+		}
+	}
+	if err := preflight.Run(ctx, ctrl.Log.WithName("preflight"), checks); err != nil {
+		return nil, err
+	}
+
+	for _, setup := range setups {
+		if !enabled[setup.name] {
+			continue
+		}
+		if err := setup.setup(ctx, controller); err != nil {
+			log.Error(err, "unable to create controller", "controller", setup.name)
+			return nil, err
+		}
+		log.Info("controller enabled", "controller", setup.name)
+	}
+	if opts.WebhookPort != 0 {
+		if err := webhook.SetupWithManager(manager, &webhook.Validator{
+			MinReplicas:         int32(opts.MinReplicas),
+			MaxReplicas:         int32(opts.MaxReplicas),
+			Reader:              manager.GetClient(),
+			AllowHostNamespaces: opts.AllowHostNamespaces,
+		}); err != nil {
+			log.Error(err, "unable to create MyApp webhook")
+			return nil, err
+		}
+	}
 	return controller, nil
 }
 
+// SetupWithManager registers the MyApp controller with manager.
+func (c *Controller) SetupWithManager(ctx context.Context, manager ctrl.Manager) error {
+	log := log.FromContext(ctx)
+
+	if err := manager.GetFieldIndexer().IndexField(ctx, &api.MyApp{}, externalSecretIndex, indexExternalSecrets); err != nil {
+		log.Error(err, "unable to index MyApps by ExternalSecret")
+		return err
+	}
+	if err := manager.GetFieldIndexer().IndexField(ctx, &api.MyApp{}, templateIndex, indexTemplate); err != nil {
+		log.Error(err, "unable to index MyApps by MyAppTemplate")
+		return err
+	}
+
+	builder := ctrl.
+		NewControllerManagedBy(manager).    // Create the Controller
+		WithOptions(c.controllerOptions).   // with a priority or debouncing queue, if enabled
+		For(&api.MyApp{}, c.forOptions...). // MyApp is the Application API
+		Owns(&appv1.Deployment{}).          // MyApp owns Deployments created by it
+		Owns(&corev1.Service{}).            // and the Services exposing them
+		Owns(&networkingv1.Ingress{}).      // and the Ingresses routing to them
+		Owns(&policyv1.PodDisruptionBudget{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Owns(&batchv1.Job{}).
+		Owns(&batchv1.CronJob{}).
+		Owns(&corev1.ConfigMap{}). // and the generated ConfigMaps, e.g. of the fluent-bit sidecars
+		Watches(&api.MyAppTemplate{}, handler.EnqueueRequestsFromMapFunc(c.appsForTemplate)).
+		Watches(&api.MaintenanceWindow{}, handler.EnqueueRequestsFromMapFunc(c.appsForMaintenanceWindow)).
+		Watches(&corev1.LimitRange{}, handler.EnqueueRequestsFromMapFunc(c.appsForLimitRange)).
+		WithEventFilter(c.shard.predicate()).
+		WithEventFilter(c.namespaces.predicate()).
+		WithEventFilter(c.selector.predicate())
+	// MyApps are picked up or dropped as their namespace's labels change, and their pods
+	// checked against its pod security level again.
+	builder = builder.Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(c.appsInNamespace),
+		ctrlbuilder.WithPredicates(namespaceLabelsChanged()))
+	if c.gatewayAPI {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(httpRouteGVK)
+		builder = builder.Owns(route) // or the HTTPRoutes in GatewayAPI mode
+	}
+	if c.vpa {
+		vpa := &unstructured.Unstructured{}
+		vpa.SetGroupVersionKind(vpaGVK)
+		builder = builder.Owns(vpa)
+	}
+	if c.drainMaxSurge > 0 {
+		// MyApps are pre-scaled while Nodes hosting their pods are drained.
+		builder = builder.Watches(&corev1.Node{}, handler.EnqueueRequestsFromMapFunc(c.appsOnNode),
+			ctrlbuilder.WithPredicates(nodeCordonChanged()))
+	}
+	if c.zones != nil {
+		// High criticality MyApps respond to zone outages.
+		builder = builder.Watches(&corev1.Node{}, handler.EnqueueRequestsFromMapFunc(c.appsForZoneChange),
+			ctrlbuilder.WithPredicates(nodeReadinessChanged()))
+	}
+	if c.caBundle != nil {
+		// Every MyApp is requeued when the CA bundle changes.
+		builder = builder.WatchesRawSource(c.caBundle.source(c))
+	}
+	var err error
+	c.runtimeController, err = builder.Build(c.health.reconciler(c.history.reconciler(c.logSampler.reconciler(c))))
+	return err
+}
+
 func (c *Controller) Start(ctx context.Context) error {
 	return c.manager.Start(ctx)
 }
@@ -113,73 +836,418 @@ func (c *Controller) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 	// Increment the custom metric counter
 	myAppReconcileCounter.WithLabelValues(req.Namespace, req.Name).Inc()
 
+	if !c.limits.acquire(req.Namespace) {
+		log.V(1).Info("namespace at its concurrency limit, retrying later")
+		reconcileDuration.WithLabelValues(reconcilationSkipped).Observe(time.Since(start).Seconds())
+		return ctrl.Result{RequeueAfter: namespaceRetryDelay}, nil
+	}
+	defer c.limits.release(req.Namespace)
+
+	if allowed, err := c.namespaces.allowed(ctx, req.Namespace); err != nil {
+		log.Error(err, "unable to read the MyApp's namespace")
+		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	} else if !allowed {
+		log.V(1).Info("namespace not selected, skipping")
+		reconcileDuration.WithLabelValues(reconcilationSkipped).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, nil
+	}
+
 	// Get the MyApp object for which the reconciliation is triggered
 	myApp := &api.MyApp{}
 	if err := c.client.Get(ctx, req.NamespacedName, myApp); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The MyApp is gone, its children are garbage collected through owner references.
+			c.lifecycle.forget(req.NamespacedName)
+			c.history.forget(req.NamespacedName)
+			c.logSampler.forget(req.NamespacedName)
+			c.fights.forget(req.NamespacedName)
+			c.summaries.forget(req.NamespacedName)
+			c.costs.forget(req.NamespacedName)
+			c.dryRuns.forget(req.NamespacedName)
+			c.rightSizer.forget(req.NamespacedName)
+			c.rotations.release(req.NamespacedName)
+			c.rollouts.release(req.NamespacedName)
+			c.waves.forget(req.NamespacedName)
+			c.publishLifecycle(req.NamespacedName, nil, []string{lifecycleDeleted})
+			reconcileDuration.WithLabelValues(reconcilationSkipped).Observe(time.Since(start).Seconds())
+			return ctrl.Result{}, nil
+		}
 		// Error handling
 		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
 		return ctrl.Result{}, err
 	}
 
-	// Check if the deployment already exists
-	deployment := &appv1.Deployment{}
-	dk := client.ObjectKey{
-		Namespace: req.Namespace,
-		Name:      myApp.Name,
+	if !myApp.DeletionTimestamp.IsZero() {
+		if err := c.finalizeTargets(ctx, myApp); err != nil {
+			log.Error(err, "unable to remove the MyApp from its target clusters")
+			reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+			return ctrl.Result{}, err
+		}
+		reconcileDuration.WithLabelValues(reconcilationSkipped).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, nil
+	}
+	// Events of children still map to MyApps that aren't selected. Deselected MyApps
+	// carrying the finalizer are still finalized above.
+	if !c.selector.matches(myApp) {
+		log.V(1).Info("MyApp not selected by the watch label selector, skipping")
+		reconcileDuration.WithLabelValues(reconcilationSkipped).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, nil
 	}
-	err := c.client.Get(ctx, dk, deployment)
 
-	if err != nil && client.IgnoreNotFound(err) == nil {
-		// Create a new deployment
-		dp := createDeployment(myApp)
+	// Expired MyApps are deleted, or hibernated. The reconcile is requeued for the expiration
+	// otherwise.
+	expires := expiration(myApp)
+	expired := expires != nil && !expires.After(time.Now())
+	if expired && myApp.Spec.ExpirationPolicy != api.ExpirationPolicyHibernate {
+		log.Info("MyApp expired, deleting it", "expirationTime", expires)
+		err := client.IgnoreNotFound(c.client.Delete(ctx, myApp))
+		outcome := reconcilationSuccess
+		if err != nil {
+			log.Error(err, "unable to delete the expired MyApp")
+			outcome = reconcilationError
+		}
+		reconcileDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	}
 
-		if err := ctrl.SetControllerReference(myApp, dp, c.manager.GetScheme()); err != nil {
-			// Error handling
+	if len(myApp.Spec.Targets) > 0 && controllerutil.AddFinalizer(myApp, targetsFinalizer) {
+		if err := c.client.Update(ctx, myApp); err != nil {
+			log.Error(err, "unable to add the targets finalizer")
 			reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
 			return ctrl.Result{}, err
 		}
+	}
 
-		err := c.client.Create(ctx, dp)
+	if err := c.applyTemplate(ctx, myApp); err != nil {
+		log.Error(err, "unable to apply the MyApp's template")
+		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	}
+	c.applySize(&myApp.Spec)
+	c.replicas.apply(&myApp.Spec)
+	rightSizing := c.rightSize(ctx, myApp)
+	drainCond, err := c.drainSurge(ctx, myApp)
+	if err != nil {
+		log.Error(err, "unable to check the MyApp's pods on cordoned Nodes")
+		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	}
+	zoneCond, err := c.zoneFailureResponse(ctx, myApp)
+	if err != nil {
+		log.Error(err, "unable to check availability zones")
+		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	}
+	if expired {
+		hibernate(&myApp.Spec)
+	}
+	archCond := c.checkArchitectures(ctx, myApp)
+	overhead, err := c.runtimeClassOverhead(ctx, myApp)
+	if err != nil {
+		log.Error(err, "unable to read the MyApp's RuntimeClass")
+		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	}
+	hostCond, err := c.checkHostNamespaces(ctx, myApp)
+	if err != nil {
+		log.Error(err, "unable to check the MyApp's use of the host's namespaces")
+		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	}
+
+	secrets, secretsCond, err := c.resolveExternalSecrets(ctx, myApp)
+	if err != nil {
+		log.Error(err, "unable to resolve external secrets")
+		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	}
+	// Target states are carried over until they are observed again.
+	observed := observedState{targets: myApp.Status.Targets, rightSizing: rightSizing, expiration: expires, overhead: overhead}
+	var ttlRefresh time.Duration
+	if expires != nil {
+		observed.expiresIn, ttlRefresh = remainingTTL(expires.Time, time.Now())
+	}
+	if expired {
+		observed.conditions = append(observed.conditions, hibernatedCondition(myApp, expires))
+	}
+	if secretsCond != nil {
+		observed.conditions = append(observed.conditions, *secretsCond)
+	}
+	if archCond != nil {
+		observed.conditions = append(observed.conditions, *archCond)
+	}
+	if drainCond != nil {
+		observed.conditions = append(observed.conditions, *drainCond)
+	}
+	if zoneCond != nil {
+		observed.conditions = append(observed.conditions, *zoneCond)
+	}
+	// Pods may not use the host's namespaces. The children are left as they are until the
+	// MyApp or the namespace's labels change, which requeues it.
+	if hostCond != nil {
+		log.Info("MyApp may not use the host's namespaces", "reason", hostCond.Message)
+		if current := meta.FindStatusCondition(myApp.Status.Conditions, api.ConditionPolicyViolation); current == nil || current.Message != hostCond.Message {
+			c.recorder.Eventf(myApp, corev1.EventTypeWarning, "HostNamespacesDenied", "%s", hostCond.Message)
+		}
+		observed.conditions = append(observed.conditions, *hostCond)
+		observed.held = true
+		children, err := c.observeChildren(ctx, myApp)
+		if err == nil {
+			err = c.updateStatus(ctx, myApp, children.deployment, observed)
+		}
 		if err != nil {
-			log.Error(err, "unable to create deployment")
+			log.Error(err, "unable to update status")
+			reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
 			return ctrl.Result{}, err
 		}
+		var result ctrl.Result
+		if expires != nil && !expired {
+			requeueAfter(&result, time.Until(expires.Time))
+			requeueAfter(&result, ttlRefresh)
+		}
+		reconcileDuration.WithLabelValues(reconcilationSkipped).Observe(time.Since(start).Seconds())
+		return result, nil
+	}
 
-		reconcileDuration.WithLabelValues(reconcilationSuccess).Observe(time.Since(start).Seconds())
-		return ctrl.Result{Requeue: true}, nil
+	secretsPending := secretsCond != nil && secretsCond.Status != metav1.ConditionTrue
+	if secretsPending {
+		log.Info("waiting for external secrets", "reason", secretsCond.Message)
+	}
+	// During a maintenance window the children are left as they are, their state is still observed.
+	freeze, nextFreeze, err := c.activeFreeze(ctx, myApp.Namespace, time.Now())
+	if err != nil {
+		log.Error(err, "unable to check maintenance windows")
+		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	}
+	var children *childrenState
+	if freeze != nil {
+		log.Info("changes frozen by maintenance window", "window", freeze.window, "until", freeze.until)
+		observed.conditions = append(observed.conditions, changeFrozenCondition(myApp, freeze))
+		observed.held = true
+		children, err = c.observeChildren(ctx, myApp)
+	} else {
+		children, err = c.reconcileChildren(ctx, myApp, secrets, secretsPending)
+	}
+	// Children the tenant may not mutate, or admission denies, are reported on the status
+	// instead of failing the reconcile, which would retry them right away.
+	denied := forbidden(err)
+	rejected := admissionDenials(err)
+	if err != nil && (!c.impersonating || denied == nil) && len(rejected) == 0 {
+		log.Error(err, "unable to reconcile children")
+		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	}
+	if len(rejected) > 0 {
+		cond := admissionDeniedCondition(myApp, rejected)
+		log.Info("children denied by admission", "reason", cond.Message)
+		if current := meta.FindStatusCondition(myApp.Status.Conditions, api.ConditionChildAdmissionDenied); current == nil || current.Message != cond.Message {
+			c.recorder.Eventf(myApp, corev1.EventTypeWarning, "ChildAdmissionDenied", "%s", cond.Message)
+		}
+		observed.conditions = append(observed.conditions, cond)
+	}
+	observed.conditions = append(observed.conditions, children.conditions...)
+	observed.recommendations = children.recommendations
+	observed.lastRun, observed.lastRunTrigger = children.lastRun, children.lastRunTrigger
+	observed.tasks, observed.taskTrigger = children.tasks, children.taskTrigger
+	if c.impersonating {
+		if denied != nil {
+			log.Info("tenant is not allowed to apply children", "reason", denied.Error())
+		}
+		observed.conditions = append(observed.conditions, forbiddenCondition(myApp, denied))
+	}
+	deployment := children.deployment
+	if freeze == nil {
+		observed.resources = children.changes.inventory()
+		observed.conditions = append(observed.conditions, conflictingManagerCondition(myApp, children.changes.conflicts))
+		observed.conditions = append(observed.conditions, selectorMismatchCondition(myApp, children.changes.mismatches))
+		for _, mismatch := range children.changes.mismatches {
+			log.Info("selector of a child changed, leaving it as it is", "kind", mismatch.kind, "name", mismatch.name,
+				"live", mismatch.live, "desired", mismatch.desired)
+		}
+		for _, conflict := range children.changes.conflicts {
+			log.Info("another field manager keeps reverting a child, backing off", "kind", conflict.kind,
+				"name", conflict.name, "manager", conflict.manager, "reverts", conflict.reverts, "retry", conflict.retry)
+		}
 	}
 
-	// Check if PDB already exists
-	pdb := &policyv1.PodDisruptionBudget{}
-	pdbKey := client.ObjectKey{
-		Namespace: req.Namespace,
-		Name:      myApp.Name,
+	if children.changes.any() {
+		log.Info("applied children", "created", children.changes.created, "updated", children.changes.updated, "deleted", children.changes.deleted)
 	}
 
-	err = c.client.Get(ctx, pdbKey, pdb)
-	if err != nil {
-		// Create a new PDB
-		pdb := createPodDisruptionBudget(myApp)
+	// The watches on the children trigger the next reconcile, so nothing is requeued
+	// after creating them.
+	switch {
+	case children.deploymentCreated:
+		c.publishLifecycle(req.NamespacedName, myApp, c.lifecycle.observe(myApp, true, healthUnknown))
+		c.summaries.observe(myApp, deployment, healthUnknown)
+	case deployment != nil:
+		health, reason, message := deploymentHealth(deployment)
+		transitions := c.lifecycle.observe(myApp, false, health)
+		c.publishLifecycle(req.NamespacedName, myApp, transitions)
+		c.notifyDegraded(myApp, transitions, reason, message)
+		c.summaries.observe(myApp, deployment, health)
+	default:
+		c.summaries.observe(myApp, nil, healthUnknown)
+	}
 
-		if err := ctrl.SetControllerReference(myApp, pdb, c.manager.GetScheme()); err != nil {
-			// Error handling
-			reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
-			return ctrl.Result{}, err
+	// DNS records don't produce watch events, so pending records are polled.
+	var result ctrl.Result
+	if c.impersonating && denied != nil {
+		requeueAfter(&result, forbiddenRecheckInterval)
+	}
+	if len(rejected) > 0 {
+		requeueAfter(&result, admissionDeniedRetryInterval)
+	}
+	if expires != nil && !expired {
+		requeueAfter(&result, time.Until(expires.Time))
+		// The time left on the status is refreshed as well.
+		requeueAfter(&result, ttlRefresh)
+	}
+	// Freed rollout slots don't produce events either.
+	if children.rolloutQueued != nil {
+		requeueAfter(&result, rolloutQueuedRetryInterval)
+	}
+	// Nor does quota usage.
+	if children.quotaExceeded != nil {
+		requeueAfter(&result, quotaRecheckInterval)
+	}
+	// Secrets aren't watched either, and held back restarts are retried.
+	if children.rotationPending {
+		requeueAfter(&result, secretRotationRetryInterval)
+	} else if myApp.Spec.SecretRotation != nil {
+		requeueAfter(&result, secretRotationRecheckInterval)
+	}
+	// Usage doesn't produce events either.
+	if c.rightSizer != nil {
+		requeueAfter(&result, c.rightSizer.interval)
+	}
+	// Children backed off from are re-applied once the backoff expires.
+	for _, conflict := range children.changes.conflicts {
+		requeueAfter(&result, conflict.retry)
+	}
+	// Changes resume, or are frozen, without a MaintenanceWindow event.
+	if freeze != nil {
+		requeueAfter(&result, time.Until(freeze.until))
+	} else if !nextFreeze.IsZero() {
+		requeueAfter(&result, time.Until(nextFreeze))
+	}
+	// Pods aren't watched either, so the ones warming up are polled.
+	warming, err := c.openWarmupGates(ctx, myApp)
+	if err != nil {
+		log.Error(err, "unable to open warmup gates")
+		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	}
+	if warming {
+		requeueAfter(&result, warmupGateRetryInterval)
+	}
+	dnsCond, err := c.dnsCondition(ctx, myApp)
+	if err != nil {
+		log.Error(err, "unable to check DNS records")
+		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	}
+	if dnsCond != nil {
+		observed.conditions = append(observed.conditions, *dnsCond)
+		if dnsCond.Status != metav1.ConditionTrue {
+			requeueAfter(&result, dnsRecheckInterval)
 		}
+	}
 
-		err := c.client.Create(ctx, pdb)
+	// Remote clusters aren't watched either, so their state is polled. Applying to them is
+	// deferred during a maintenance window as well.
+	if freeze == nil {
+		targets, targetsCond, err := c.reconcileTargets(ctx, myApp)
 		if err != nil {
-			log.Error(err, "unable to create PDB")
+			log.Error(err, "unable to reconcile target clusters")
 			reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
 			return ctrl.Result{}, err
 		}
-		reconcileDuration.WithLabelValues(reconcilationSuccess).Observe(time.Since(start).Seconds())
-		return ctrl.Result{Requeue: true}, nil
+		observed.targets = targets
+		if targetsCond != nil {
+			observed.conditions = append(observed.conditions, *targetsCond)
+			requeueAfter(&result, targetRecheckInterval)
+		}
+	}
+
+	// Pods are debugged during maintenance windows too, nothing the MyApp runs is changed.
+	observed.debug, observed.debugTrigger, err = c.debugPod(ctx, myApp)
+	if err != nil {
+		log.Error(err, "unable to debug pod")
+		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	}
+
+	if err := c.updateStatus(ctx, myApp, deployment, observed); err != nil {
+		log.Error(err, "unable to update status")
+		reconcileDuration.WithLabelValues(reconcilationError).Observe(time.Since(start).Seconds())
+		return ctrl.Result{}, err
+	}
+
+	// A reconcile that found every child up to date is reported as skipped.
+	outcome := reconcilationSuccess
+	if !children.changes.any() {
+		outcome = reconcilationSkipped
+	}
+	reconcileDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+	return result, nil
+}
+
+// requeueAfter requeues at the latest after d.
+func requeueAfter(result *ctrl.Result, d time.Duration) {
+	if d <= 0 {
+		d = time.Second
+	}
+	if result.RequeueAfter == 0 || d < result.RequeueAfter {
+		result.RequeueAfter = d
+	}
+}
+
+// publishLifecycle emits a CloudEvent for each transition, if a sink is configured.
+func (c *Controller) publishLifecycle(key client.ObjectKey, app *api.MyApp, transitions []string) {
+	if c.events == nil {
+		return
+	}
+	for _, t := range transitions {
+		c.events.Publish(lifecycleEvent(key, t, app))
+	}
+}
+
+// notifyDegraded sends a notification when app has just become degraded, if notifications are configured.
+func (c *Controller) notifyDegraded(app *api.MyApp, transitions []string, reason, message string) {
+	if c.notifier == nil {
+		return
+	}
+	for _, t := range transitions {
+		if t == lifecycleDegraded {
+			c.notifier.Notify(notify.Notification{
+				Namespace: app.Namespace,
+				Name:      app.Name,
+				Reason:    reason,
+				Message:   message,
+			})
+		}
 	}
+}
 
-	// Deployment already exists, do nothing
-	reconcileDuration.WithLabelValues(reconcilationSkipped).Observe(time.Since(start).Seconds())
-	return ctrl.Result{}, nil
+// ensureService creates or updates the Service for myApp. Specs that can't be
+// rendered are reported through the returned condition rather than as an error.
+func (c *Controller) ensureService(ctx context.Context, myApp *api.MyApp, changes *childChanges) (metav1.Condition, error) {
+	cond := metav1.Condition{
+		Type:               api.ConditionServiceConfigured,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ServiceCreated",
+		ObservedGeneration: myApp.Generation,
+	}
+	svc, err := createService(myApp, c.serviceProfiles)
+	if err != nil {
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionFalse, "InvalidServiceSpec", err.Error()
+		return cond, nil
+	}
+	_, _, err = c.ensureChild(ctx, myApp, svc, changes)
+	return cond, err
 }
 
 // labelsForMyApp returns the labels for selecting the resources
@@ -189,6 +1257,11 @@ func labelsForMyApp(name string) map[string]string {
 }
 
 func createDeployment(myApp *api.MyApp) *appv1.Deployment {
+	replicas := myApp.Spec.Replicas
+	if myApp.Spec.Autoscaling != nil {
+		// Replicas are left to the HorizontalPodAutoscaler, so applying the Deployment doesn't revert its scaling.
+		replicas = nil
+	}
 	deployment := &appv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: myApp.Namespace,
@@ -196,7 +1269,7 @@ func createDeployment(myApp *api.MyApp) *appv1.Deployment {
 		},
 		Spec: appv1.DeploymentSpec{
 			// Set the desired number of replicas
-			Replicas: myApp.Spec.Replicas,
+			Replicas: replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labelsForMyApp(myApp.Name),
 			},
@@ -208,44 +1281,79 @@ func createDeployment(myApp *api.MyApp) *appv1.Deployment {
 					},
 				},
 				Spec: corev1.PodSpec{
+					RuntimeClassName: runtimeClassName(myApp),
 					Containers: []corev1.Container{
 						{
-							Name:  myApp.Name,
-							Image: myApp.Spec.Image,
-							Args:  myApp.Spec.Args,
-							Resources: corev1.ResourceRequirements{
-								Requests: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse("100m"),
-									corev1.ResourceMemory: resource.MustParse("128Mi"),
-								},
-								Limits: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse("200m"),
-									corev1.ResourceMemory: resource.MustParse("256Mi"),
-								},
-							},
+							Name:            myApp.Name,
+							Image:           myApp.Spec.Image,
+							Args:            myApp.Spec.Args,
+							Env:             append([]corev1.EnvVar(nil), myApp.Spec.Env...),
+							Resources:       containerResources(myApp),
+							LivenessProbe:   myApp.Spec.LivenessProbe,
+							ReadinessProbe:  myApp.Spec.ReadinessProbe,
+							SecurityContext: myApp.Spec.SecurityContext,
 						},
 					},
 				},
 			},
 		},
 	}
+	injectMesh(myApp, &deployment.Spec.Template)
+	exposePort(myApp, &deployment.Spec.Template)
+	configureShutdown(myApp, deployment)
+	configureOS(myApp, &deployment.Spec.Template)
+	configureArchitectures(myApp, &deployment.Spec.Template)
+	configureHostNamespaces(myApp, &deployment.Spec.Template)
+	configureWarmupGate(myApp, &deployment.Spec.Template)
+	configureWarmup(myApp, deployment)
 	return deployment
 }
 
-func createPodDisruptionBudget(myApp *api.MyApp) *policyv1.PodDisruptionBudget {
+// containerResources returns the resources of the MyApp's container, with defaults when
+// neither the MyApp nor its template set them.
+func containerResources(myApp *api.MyApp) corev1.ResourceRequirements {
+	if myApp.Spec.Resources != nil {
+		return *myApp.Spec.Resources
+	}
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("128Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("200m"),
+			corev1.ResourceMemory: resource.MustParse("256Mi"),
+		},
+	}
+}
+
+func createPodDisruptionBudget(myApp *api.MyApp, maxUnavailable intstr.IntOrString) *policyv1.PodDisruptionBudget {
 	pdb := &policyv1.PodDisruptionBudget{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: myApp.Namespace,
 			Name:      myApp.Name,
 		},
 		Spec: policyv1.PodDisruptionBudgetSpec{
-			MaxUnavailable: &intstr.IntOrString{
-				IntVal: 1,
-			},
+			MaxUnavailable: &maxUnavailable,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labelsForMyApp(myApp.Name),
 			},
 		},
 	}
+	if singleReplica(&myApp.Spec) {
+		// The budget never allows evicting the only pod while it isn't ready, which leaves its
+		// node undrainable. Unready pods don't serve traffic, so they may be evicted anyway.
+		policy := policyv1.AlwaysAllow
+		pdb.Spec.UnhealthyPodEvictionPolicy = &policy
+	}
 	return pdb
 }
+
+// singleReplica reports whether the MyApp may run a single pod, so every voluntary
+// disruption makes it unavailable. An unset Spec.Replicas defaults to 1.
+func singleReplica(spec *api.MyAppSpec) bool {
+	if spec.Autoscaling != nil {
+		return spec.Autoscaling.MinReplicas == nil || *spec.Autoscaling.MinReplicas <= 1
+	}
+	return spec.Replicas == nil || *spec.Replicas <= 1
+}
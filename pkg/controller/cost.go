@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// hoursPerMonth is the average number of hours in a month.
+const hoursPerMonth = 730
+
+var fleetCost = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "myapp_fleet_estimated_monthly_cost",
+	Help: "Estimated monthly cost of the resource requests of the MyApps managed by this controller",
+})
+
+func init() {
+	metrics.Registry.MustRegister(fleetCost)
+}
+
+// costModel estimates the monthly cost of MyApps from the hourly prices of their resource
+// requests, and sums them up for the fleet. A nil *costModel estimates nothing.
+type costModel struct {
+	// cpuHourly is the price of a CPU, memoryHourly the price of a GiB of memory, per hour.
+	cpuHourly, memoryHourly float64
+
+	mu   sync.Mutex
+	apps map[types.NamespacedName]float64
+}
+
+// newCostModel returns nil when neither resource has a price.
+func newCostModel(cpuHourly, memoryHourly float64) *costModel {
+	if cpuHourly <= 0 && memoryHourly <= 0 {
+		return nil
+	}
+	return &costModel{cpuHourly: cpuHourly, memoryHourly: memoryHourly, apps: map[types.NamespacedName]float64{}}
+}
+
+// estimate returns the monthly cost of replicas pods of app, formatted for its status, and
+// records it in the fleet's cost. The requests of the live Deployment's pods are priced, or
+// the rendered ones while it doesn't exist, plus the pod overhead of its RuntimeClass.
+func (m *costModel) estimate(key types.NamespacedName, app *api.MyApp, deployment *appv1.Deployment, overhead corev1.ResourceList, replicas int32) string {
+	if m == nil {
+		return ""
+	}
+	requests := []corev1.ResourceList{overhead}
+	if deployment != nil {
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			requests = append(requests, container.Resources.Requests)
+		}
+	} else {
+		requests = append(requests, containerResources(app).Requests)
+	}
+	var hourly float64
+	for _, requested := range requests {
+		if cpu, ok := requested[corev1.ResourceCPU]; ok {
+			hourly += cpu.AsApproximateFloat64() * m.cpuHourly
+		}
+		if memory, ok := requested[corev1.ResourceMemory]; ok {
+			hourly += memory.AsApproximateFloat64() / (1 << 30) * m.memoryHourly
+		}
+	}
+	monthly := hourly * float64(replicas) * hoursPerMonth
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fleetCost.Add(monthly - m.apps[key])
+	m.apps[key] = monthly
+	return strconv.FormatFloat(monthly, 'f', 2, 64)
+}
+
+// forget removes a deleted MyApp from the fleet's cost.
+func (m *costModel) forget(key types.NamespacedName) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fleetCost.Sub(m.apps[key])
+	delete(m.apps, key)
+}
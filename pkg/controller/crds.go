@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/steeling/controller-runtime-exercise/configs/crd"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// crdEstablishTimeout bounds how long an installed CRD may take to be served.
+const crdEstablishTimeout = 30 * time.Second
+
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;create;patch
+
+// installCRDs applies the embedded CRDs with server-side apply and waits until they are
+// served. The CRDs are read with reader, as the cache isn't started yet. A CRD whose new revision stops serving a version objects are still stored in is
+// not applied: the objects must be migrated to the storage version first, or they can no
+// longer be read.
+func installCRDs(ctx context.Context, c client.Client, reader client.Reader, log logr.Logger) error {
+	crds, err := embeddedCRDs()
+	if err != nil {
+		return err
+	}
+	for _, obj := range crds {
+		live := &apiextensionsv1.CustomResourceDefinition{}
+		err := reader.Get(ctx, client.ObjectKey{Name: obj.Name}, live)
+		switch {
+		case apierrors.IsNotFound(err):
+			log.Info("installing CRD", "name", obj.Name)
+		case err != nil:
+			return fmt.Errorf("reading CRD %s: %w", obj.Name, err)
+		default:
+			if err := checkStoredVersions(live, obj); err != nil {
+				return err
+			}
+			log.Info("updating CRD", "name", obj.Name, "storageVersion", storageVersion(obj))
+		}
+		obj.TypeMeta.APIVersion, obj.TypeMeta.Kind = apiextensionsv1.SchemeGroupVersion.String(), "CustomResourceDefinition"
+		if err := c.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+			return fmt.Errorf("applying CRD %s: %w", obj.Name, err)
+		}
+	}
+	for _, obj := range crds {
+		if err := waitEstablished(ctx, reader, obj.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func embeddedCRDs() ([]*apiextensionsv1.CustomResourceDefinition, error) {
+	files, err := fs.Glob(crd.FS, "*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	crds := make([]*apiextensionsv1.CustomResourceDefinition, 0, len(files))
+	for _, file := range files {
+		data, err := crd.FS.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		obj := &apiextensionsv1.CustomResourceDefinition{}
+		if err := yaml.UnmarshalStrict(data, obj); err != nil {
+			return nil, fmt.Errorf("decoding embedded CRD %s: %w", file, err)
+		}
+		crds = append(crds, obj)
+	}
+	return crds, nil
+}
+
+// checkStoredVersions fails when updated no longer serves a version live's objects are
+// stored in.
+func checkStoredVersions(live, updated *apiextensionsv1.CustomResourceDefinition) error {
+	versions := map[string]bool{}
+	for _, v := range updated.Spec.Versions {
+		versions[v.Name] = true
+	}
+	for _, stored := range live.Status.StoredVersions {
+		if !versions[stored] {
+			return fmt.Errorf("CRD %s: objects are still stored as %s, which the new revision removes; migrate them to %s and remove %s from status.storedVersions first",
+				live.Name, stored, storageVersion(updated), stored)
+		}
+	}
+	return nil
+}
+
+func storageVersion(crd *apiextensionsv1.CustomResourceDefinition) string {
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			return v.Name
+		}
+	}
+	return ""
+}
+
+func waitEstablished(ctx context.Context, reader client.Reader, name string) error {
+	err := wait.PollUntilContextTimeout(ctx, time.Second, crdEstablishTimeout, true, func(ctx context.Context) (bool, error) {
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := reader.Get(ctx, client.ObjectKey{Name: name}, crd); err != nil {
+			return false, err
+		}
+		for _, cond := range crd.Status.Conditions {
+			if cond.Type == apiextensionsv1.Established && cond.Status == apiextensionsv1.ConditionTrue {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for CRD %s to be established: %w", name, err)
+	}
+	return nil
+}
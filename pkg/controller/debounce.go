@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// debounceMaxWaitFactor bounds how long a continuously changing object is held back,
+// as a multiple of the debounce window.
+const debounceMaxWaitFactor = 5
+
+// debounceQueue delays the items event handlers add until no further event arrived for
+// window, so a burst of edits, e.g. from a GitOps sync, results in a single reconcile.
+// Requeues requested by the reconciler go through AddAfter and AddRateLimited and are not delayed.
+type debounceQueue struct {
+	workqueue.RateLimitingInterface
+	window time.Duration
+
+	mu      sync.Mutex
+	pending map[interface{}]*debounced
+}
+
+type debounced struct {
+	timer *time.Timer
+	first time.Time
+}
+
+func newDebounceQueue(queue workqueue.RateLimitingInterface, window time.Duration) *debounceQueue {
+	return &debounceQueue{
+		RateLimitingInterface: queue,
+		window:                window,
+		pending:               map[interface{}]*debounced{},
+	}
+}
+
+// Add adds item once window has passed without another Add of it, and at the latest
+// debounceMaxWaitFactor windows after the first one.
+func (q *debounceQueue) Add(item interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if p, ok := q.pending[item]; ok {
+		if time.Since(p.first)+q.window <= debounceMaxWaitFactor*q.window {
+			p.timer.Reset(q.window)
+		}
+		return
+	}
+	q.pending[item] = &debounced{
+		first: time.Now(),
+		timer: time.AfterFunc(q.window, func() {
+			q.mu.Lock()
+			delete(q.pending, item)
+			q.mu.Unlock()
+			q.RateLimitingInterface.Add(item)
+		}),
+	}
+}
+
+func (q *debounceQueue) ShutDown() {
+	q.stopTimers()
+	q.RateLimitingInterface.ShutDown()
+}
+
+func (q *debounceQueue) ShutDownWithDrain() {
+	q.stopTimers()
+	q.RateLimitingInterface.ShutDownWithDrain()
+}
+
+func (q *debounceQueue) stopTimers() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for item, p := range q.pending {
+		p.timer.Stop()
+		delete(q.pending, item)
+	}
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups="",resources=pods/ephemeralcontainers,verbs=update;patch
+
+// debugCopyDeadline is how long the copy of a debugged pod runs, in seconds, so forgotten
+// copies don't keep their resources.
+const debugCopyDeadline = 4 * 60 * 60
+
+// debugPod starts the debugging session the debug annotation of myApp asks for, if it
+// changed since it was acted on. It returns the last session and the annotation acted on.
+func (c *Controller) debugPod(ctx context.Context, myApp *api.MyApp) (*api.DebugStatus, string, error) {
+	trigger := myApp.Annotations[api.DebugAnnotation]
+	if trigger == "" || trigger == myApp.Status.LastDebugTrigger {
+		return myApp.Status.Debug, myApp.Status.LastDebugTrigger, nil
+	}
+	request, _, _ := strings.Cut(trigger, "@")
+	mode, podName, _ := strings.Cut(request, "/")
+	status := &api.DebugStatus{Mode: mode, Time: metav1.Now()}
+	if mode != api.DebugEphemeral && mode != api.DebugCopy {
+		status.Message = fmt.Sprintf("unknown debug mode %q, must be %s or %s", mode, api.DebugEphemeral, api.DebugCopy)
+		return status, trigger, nil
+	}
+	pod, err := c.debuggedPod(ctx, myApp, podName)
+	if err != nil || pod == nil {
+		if err == nil {
+			status.Message = "the MyApp has no running pod"
+			if podName != "" {
+				status.Message = fmt.Sprintf("pod %s isn't a running pod of the MyApp", podName)
+			}
+		}
+		return status, trigger, err
+	}
+
+	sum := sha256.Sum256([]byte(trigger))
+	suffix := hex.EncodeToString(sum[:3])
+	if mode == api.DebugEphemeral {
+		status.Pod, status.Container = pod.Name, "debugger-"+suffix
+		err = c.addDebugContainer(ctx, myApp, pod, status.Container)
+	} else {
+		status.Pod, status.Container = pod.Name+"-debug-"+suffix, myApp.Name
+		err = c.copyDebugPod(ctx, myApp, pod, status.Pod)
+	}
+	if err != nil {
+		return nil, myApp.Status.LastDebugTrigger, err
+	}
+	ctrl.LoggerFrom(ctx).Info("debugging pod", "mode", mode, "pod", status.Pod, "container", status.Container)
+	c.recorder.Eventf(myApp, corev1.EventTypeNormal, "Debugging", "Attach with kubectl attach -it -n %s %s -c %s", myApp.Namespace, status.Pod, status.Container)
+	return status, trigger, nil
+}
+
+// debuggedPod returns the running pod of myApp named name, or the first running one when
+// name is empty. Only the MyApp's own pods are debugged. It returns nil if there is none.
+// The pods are read directly so the operator doesn't have to cache every pod.
+func (c *Controller) debuggedPod(ctx context.Context, myApp *api.MyApp, name string) (*corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	if err := c.manager.GetAPIReader().List(ctx, pods, client.InNamespace(myApp.Namespace), client.MatchingLabels(labelsForMyApp(myApp.Name))); err != nil {
+		return nil, err
+	}
+	sort.Slice(pods.Items, func(i, j int) bool { return pods.Items[i].Name < pods.Items[j].Name })
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil && (name == "" || pod.Name == name) {
+			return pod, nil
+		}
+	}
+	return nil, nil
+}
+
+// addDebugContainer adds an ephemeral container named name to pod, sharing the process
+// namespace of the MyApp's container, as kubectl debug does.
+func (c *Controller) addDebugContainer(ctx context.Context, myApp *api.MyApp, pod *corev1.Pod, name string) error {
+	for _, container := range pod.Spec.EphemeralContainers {
+		if container.Name == name {
+			return nil
+		}
+	}
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:                     name,
+			Image:                    c.debugImage,
+			Stdin:                    true,
+			TTY:                      true,
+			TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+		},
+		TargetContainerName: myApp.Name,
+	})
+	return c.client.SubResource("ephemeralcontainers").Update(ctx, pod)
+}
+
+// copyDebugPod creates a copy of pod named name whose MyApp container sleeps instead of
+// running the app, so its filesystem and environment can be inspected without traffic or
+// probes. The copy isn't selected by the MyApp's Service or Deployment and is deleted with
+// the MyApp.
+func (c *Controller) copyDebugPod(ctx context.Context, myApp *api.MyApp, pod *corev1.Pod, name string) error {
+	deadline := int64(debugCopyDeadline)
+	copied := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pod.Namespace,
+			Name:      name,
+			Labels:    map[string]string{"myapp.example.com/debug-copy-of": myApp.Name},
+		},
+		Spec: *pod.Spec.DeepCopy(),
+	}
+	copied.Spec.NodeName = ""
+	copied.Spec.RestartPolicy = corev1.RestartPolicyNever
+	copied.Spec.ActiveDeadlineSeconds = &deadline
+	copied.Spec.EphemeralContainers = nil
+	copied.Spec.ReadinessGates = nil
+	for i := range copied.Spec.Containers {
+		container := &copied.Spec.Containers[i]
+		if container.Name != myApp.Name {
+			continue
+		}
+		container.Command, container.Args = []string{"sleep", "infinity"}, nil
+		container.LivenessProbe, container.ReadinessProbe, container.StartupProbe = nil, nil, nil
+		container.Lifecycle = nil
+		container.Stdin, container.TTY = true, true
+	}
+	if err := ctrl.SetControllerReference(myApp, copied, c.manager.GetScheme()); err != nil {
+		return err
+	}
+	if err := c.client.Create(ctx, copied); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
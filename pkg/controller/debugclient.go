@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// debugLogLevel is the verbosity mutations are logged in full at.
+const debugLogLevel = 5
+
+const redacted = "<redacted>"
+
+// debugClient logs the body and response code of every mutation at debugLogLevel, to
+// troubleshoot unexpected server-side apply or patch results. Secret values are redacted
+// and managed fields left out.
+type debugClient struct {
+	client.Client
+}
+
+func debugEnabled(ctx context.Context) bool {
+	return log.FromContext(ctx).V(debugLogLevel).Enabled()
+}
+
+// log logs a mutation of obj whose request carried body, or failed to be encoded with bodyErr.
+func (c *debugClient) log(ctx context.Context, verb string, obj client.Object, body []byte, bodyErr, err error) {
+	kind := "unknown"
+	if gvk, gvkErr := c.GroupVersionKindFor(obj); gvkErr == nil {
+		kind = gvk.Kind
+	}
+	if bodyErr != nil {
+		body = []byte(bodyErr.Error())
+	} else {
+		body = sanitizeBody(kind, body)
+	}
+	log.FromContext(ctx).V(debugLogLevel).Info("API request", "verb", verb, "kind", kind,
+		"namespace", obj.GetNamespace(), "name", obj.GetName(), "code", responseCode(verb, err), "body", string(body))
+}
+
+// responseCode returns the HTTP status code the API server answered a request with.
+func responseCode(verb string, err error) int32 {
+	if err == nil {
+		if verb == "create" {
+			return http.StatusCreated
+		}
+		return http.StatusOK
+	}
+	if status, ok := err.(apierrors.APIStatus); ok {
+		return status.Status().Code
+	}
+	// The request didn't get an answer.
+	return 0
+}
+
+// sanitizeBody strips managed fields from an object or patch body and redacts the values
+// of Secrets. Bodies that aren't JSON are returned as they are.
+func sanitizeBody(kind string, data []byte) []byte {
+	var doc interface{}
+	if len(data) == 0 || json.Unmarshal(data, &doc) != nil {
+		return data
+	}
+	switch doc := doc.(type) {
+	case map[string]interface{}:
+		if metadata, ok := doc["metadata"].(map[string]interface{}); ok {
+			delete(metadata, "managedFields")
+		}
+		if kind == "Secret" {
+			redactValues(doc, "data")
+			redactValues(doc, "stringData")
+		}
+	case []interface{}:
+		// A JSON patch, its operations on the values of a Secret are redacted.
+		for _, op := range doc {
+			if op, ok := op.(map[string]interface{}); ok && kind == "Secret" {
+				if path, _ := op["path"].(string); strings.HasPrefix(path, "/data") || strings.HasPrefix(path, "/stringData") {
+					if _, ok := op["value"]; ok {
+						op["value"] = redacted
+					}
+				}
+			}
+		}
+	}
+	sanitized, err := json.Marshal(doc)
+	if err != nil {
+		return data
+	}
+	return sanitized
+}
+
+func redactValues(doc map[string]interface{}, field string) {
+	values, ok := doc[field].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key := range values {
+		values[key] = redacted
+	}
+}
+
+func (c *debugClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if !debugEnabled(ctx) {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	body, bodyErr := json.Marshal(obj)
+	err := c.Client.Create(ctx, obj, opts...)
+	c.log(ctx, "create", obj, body, bodyErr, err)
+	return err
+}
+
+func (c *debugClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if !debugEnabled(ctx) {
+		return c.Client.Update(ctx, obj, opts...)
+	}
+	body, bodyErr := json.Marshal(obj)
+	err := c.Client.Update(ctx, obj, opts...)
+	c.log(ctx, "update", obj, body, bodyErr, err)
+	return err
+}
+
+func (c *debugClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if !debugEnabled(ctx) {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	// The patch is computed from obj as it is before the request.
+	body, bodyErr := patch.Data(obj)
+	err := c.Client.Patch(ctx, obj, patch, opts...)
+	c.log(ctx, "patch", obj, body, bodyErr, err)
+	return err
+}
+
+func (c *debugClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	err := c.Client.Delete(ctx, obj, opts...)
+	if debugEnabled(ctx) {
+		c.log(ctx, "delete", obj, nil, nil, err)
+	}
+	return err
+}
+
+func (c *debugClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	err := c.Client.DeleteAllOf(ctx, obj, opts...)
+	if debugEnabled(ctx) {
+		c.log(ctx, "deletecollection", obj, nil, nil, err)
+	}
+	return err
+}
+
+func (c *debugClient) Status() client.SubResourceWriter {
+	return &debugStatusWriter{SubResourceWriter: c.Client.Status(), client: c}
+}
+
+type debugStatusWriter struct {
+	client.SubResourceWriter
+	client *debugClient
+}
+
+func (w *debugStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	if !debugEnabled(ctx) {
+		return w.SubResourceWriter.Update(ctx, obj, opts...)
+	}
+	body, bodyErr := json.Marshal(obj)
+	err := w.SubResourceWriter.Update(ctx, obj, opts...)
+	w.client.log(ctx, "update_status", obj, body, bodyErr, err)
+	return err
+}
+
+func (w *debugStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	if !debugEnabled(ctx) {
+		return w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+	}
+	body, bodyErr := patch.Data(obj)
+	err := w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+	w.client.log(ctx, "patch_status", obj, body, bodyErr, err)
+	return err
+}
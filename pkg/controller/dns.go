@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// dnsRecheckInterval is how often pending records are checked; DNS changes produce no watch events.
+	dnsRecheckInterval = 30 * time.Second
+	dnsLookupTimeout   = 2 * time.Second
+)
+
+var lookupHost = net.DefaultResolver.LookupHost
+
+// dnsCondition reports whether the hostnames external-dns publishes for myApp resolve to
+// the load balancers of the generated Service and Ingress, or of the Gateway in GatewayAPI
+// mode. It returns nil when myApp has no hostnames.
+func (c *Controller) dnsCondition(ctx context.Context, myApp *api.MyApp) (*metav1.Condition, error) {
+	type record struct {
+		hostname string
+		lb       []string
+	}
+	var records []record
+
+	if spec := myApp.Spec.Service; spec != nil && spec.Hostname != "" {
+		svc := &corev1.Service{}
+		if err := c.client.Get(ctx, client.ObjectKeyFromObject(myApp), svc); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		records = append(records, record{hostname: spec.Hostname, lb: serviceLoadBalancer(svc.Status.LoadBalancer.Ingress)})
+	}
+	if spec := myApp.Spec.Ingress; spec != nil && spec.Host != "" {
+		if gatewayMode(myApp) {
+			lb, err := c.gatewayAddresses(ctx, myApp)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record{hostname: spec.Host, lb: lb})
+		} else {
+			ing := &networkingv1.Ingress{}
+			if err := c.client.Get(ctx, client.ObjectKeyFromObject(myApp), ing); client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+			records = append(records, record{hostname: spec.Host, lb: ingressLoadBalancer(ing.Status.LoadBalancer.Ingress)})
+		}
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var pending []string
+	for _, r := range records {
+		if len(r.lb) == 0 {
+			pending = append(pending, fmt.Sprintf("%s: waiting for a load balancer address", r.hostname))
+			continue
+		}
+		if ok, msg := resolvesTo(ctx, r.hostname, r.lb); !ok {
+			pending = append(pending, fmt.Sprintf("%s: %s", r.hostname, msg))
+		}
+	}
+
+	cond := &metav1.Condition{
+		Type:               api.ConditionDNSReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "RecordsResolved",
+		Message:            "All hostnames resolve to their load balancer",
+		ObservedGeneration: myApp.Generation,
+	}
+	if len(pending) > 0 {
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionFalse, "RecordsPending", strings.Join(pending, "; ")
+	}
+	return cond, nil
+}
+
+// resolvesTo reports whether hostname resolves to one of the load balancer's addresses.
+// Load balancers that are published as hostnames are resolved as well.
+func resolvesTo(ctx context.Context, hostname string, lb []string) (bool, string) {
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+
+	addrs, err := lookupHost(ctx, hostname)
+	if err != nil {
+		return false, "record not resolvable yet"
+	}
+	want := map[string]bool{}
+	for _, target := range lb {
+		if net.ParseIP(target) != nil {
+			want[target] = true
+			continue
+		}
+		resolved, err := lookupHost(ctx, target)
+		if err != nil {
+			continue
+		}
+		for _, a := range resolved {
+			want[a] = true
+		}
+	}
+	for _, a := range addrs {
+		if want[a] {
+			return true, ""
+		}
+	}
+	return false, fmt.Sprintf("resolves to %s, not the load balancer", strings.Join(addrs, ","))
+}
+
+func serviceLoadBalancer(ingress []corev1.LoadBalancerIngress) []string {
+	var out []string
+	for _, i := range ingress {
+		if i.IP != "" {
+			out = append(out, i.IP)
+		}
+		if i.Hostname != "" {
+			out = append(out, i.Hostname)
+		}
+	}
+	return out
+}
+
+func ingressLoadBalancer(ingress []networkingv1.IngressLoadBalancerIngress) []string {
+	var out []string
+	for _, i := range ingress {
+		if i.IP != "" {
+			out = append(out, i.IP)
+		}
+		if i.Hostname != "" {
+			out = append(out, i.Hostname)
+		}
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// drifted reports whether live lost any of the labels, annotations or fields rendered in obj,
+// e.g. to a `kubectl set image`. What live has in addition, defaulted by the API server or
+// set by other managers, doesn't count. Neither do owner references, status and the object
+// meta the API server maintains.
+func drifted(obj, live client.Object) (bool, error) {
+	want, err := comparedFields(obj)
+	if err != nil {
+		return false, err
+	}
+	got, err := comparedFields(live)
+	if err != nil {
+		return false, err
+	}
+	return !containsFields(got, want), nil
+}
+
+// comparedFields returns the fields of obj drifted compares, without copying them.
+func comparedFields(obj client.Object) (map[string]interface{}, error) {
+	var content map[string]interface{}
+	if u, ok := obj.(runtime.Unstructured); ok {
+		content = u.UnstructuredContent()
+	} else {
+		var err error
+		if content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj); err != nil {
+			return nil, err
+		}
+	}
+	fields := map[string]interface{}{}
+	for key, value := range content {
+		switch key {
+		case "apiVersion", "kind", "metadata", "status":
+		default:
+			fields[key] = value
+		}
+	}
+	metadata, _ := content["metadata"].(map[string]interface{})
+	fields["metadata"] = map[string]interface{}{"labels": metadata["labels"], "annotations": metadata["annotations"]}
+	return fields, nil
+}
+
+// containsFields reports whether got has every field set in want, with the same value. Lists
+// must have the same length, their items are compared by index.
+func containsFields(got, want interface{}) bool {
+	switch want := want.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		got, ok := got.(map[string]interface{})
+		if !ok && len(want) > 0 {
+			return false
+		}
+		for key, value := range want {
+			if !containsFields(got[key], value) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		got, _ := got.([]interface{})
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range want {
+			if !containsFields(got[i], want[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	// Unstructured children built by the controller may hold other number types than the
+	// int64 and float64 of decoded ones.
+	if w, ok := number(want); ok {
+		g, ok := number(got)
+		return ok && w == g
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestDrifted(t *testing.T) {
+	maxSurge := intstr.FromString("25%")
+	rendered := func() *appv1.Deployment {
+		d := createDeployment(&api.MyApp{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+			Spec:       api.MyAppSpec{Image: "web:1.2", Replicas: int32Ptr(2)},
+		})
+		d.Annotations = map[string]string{specHashAnnotation: "h1"}
+		return d
+	}
+	tests := []struct {
+		name   string
+		modify func(live *appv1.Deployment)
+		want   bool
+	}{
+		{name: "unchanged", modify: func(*appv1.Deployment) {}},
+		{
+			name: "defaulted by the API server",
+			modify: func(live *appv1.Deployment) {
+				live.ResourceVersion, live.UID, live.Generation = "42", "uid", 3
+				live.Spec.RevisionHistoryLimit = int32Ptr(10)
+				live.Spec.Strategy = appv1.DeploymentStrategy{Type: appv1.RollingUpdateDeploymentStrategyType, RollingUpdate: &appv1.RollingUpdateDeployment{MaxSurge: &maxSurge}}
+				live.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullIfNotPresent
+				live.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyAlways
+				live.Status.Replicas = 2
+			},
+		},
+		{
+			name: "labeled by another manager",
+			modify: func(live *appv1.Deployment) {
+				live.Labels = map[string]string{"team": "payments"}
+				live.Annotations["deployment.kubernetes.io/revision"] = "3"
+			},
+		},
+		{
+			name:   "image set",
+			modify: func(live *appv1.Deployment) { live.Spec.Template.Spec.Containers[0].Image = "web:1.1" },
+			want:   true,
+		},
+		{
+			name:   "scaled",
+			modify: func(live *appv1.Deployment) { live.Spec.Replicas = int32Ptr(5) },
+			want:   true,
+		},
+		{
+			name:   "annotation removed",
+			modify: func(live *appv1.Deployment) { live.Annotations = nil },
+			want:   true,
+		},
+		{
+			name: "container added",
+			modify: func(live *appv1.Deployment) {
+				live.Spec.Template.Spec.Containers = append(live.Spec.Template.Spec.Containers, corev1.Container{Name: "debug", Image: "busybox"})
+			},
+			want: true,
+		},
+		{
+			name: "resources lowered",
+			modify: func(live *appv1.Deployment) {
+				delete(live.Spec.Template.Spec.Containers[0].Resources.Limits, corev1.ResourceMemory)
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := rendered()
+			tt.modify(live)
+			got, err := drifted(rendered(), live)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("drifted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainsFields(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want interface{}
+		contains  bool
+	}{
+		{name: "nothing wanted", got: map[string]interface{}{"a": "x"}, want: nil, contains: true},
+		{name: "empty map wanted of nothing", got: nil, want: map[string]interface{}{}, contains: true},
+		{name: "subset", got: map[string]interface{}{"a": "x", "b": "y"}, want: map[string]interface{}{"a": "x"}, contains: true},
+		{name: "missing", got: map[string]interface{}{"b": "y"}, want: map[string]interface{}{"a": "x"}},
+		{name: "different", got: map[string]interface{}{"a": "y"}, want: map[string]interface{}{"a": "x"}},
+		{name: "not a map", got: "x", want: map[string]interface{}{"a": "x"}},
+		{name: "numbers of other types", got: int64(3), want: int32(3), contains: true},
+		{name: "different numbers", got: int64(3), want: 4, contains: false},
+		{name: "number and string", got: "3", want: int64(3)},
+		{name: "lists", got: []interface{}{"a", map[string]interface{}{"b": "y", "c": "z"}}, want: []interface{}{"a", map[string]interface{}{"b": "y"}}, contains: true},
+		{name: "longer list", got: []interface{}{"a", "b"}, want: []interface{}{"a"}},
+		{name: "reordered list", got: []interface{}{"b", "a"}, want: []interface{}{"a", "b"}},
+		{name: "booleans", got: false, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containsFields(tt.got, tt.want); got != tt.contains {
+				t.Errorf("containsFields(%v, %v) = %v, want %v", tt.got, tt.want, got, tt.contains)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	egressProxyCAVolume = "egress-proxy-ca"
+	// egressProxyCAPath is where the proxy's CA bundle is mounted, in the ca.crt file.
+	egressProxyCAPath = "/etc/egress-proxy"
+	// clusterNoProxy are always reached directly, so cluster traffic doesn't go through the proxy.
+	clusterNoProxy = "localhost,127.0.0.1,.svc,.cluster.local"
+)
+
+// egressProxyProfile is the proxy the pods of the MyApps selecting it reach the outside through.
+type egressProxyProfile struct {
+	HTTPProxy  string `json:"httpProxy,omitempty"`
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	// NoProxy are the additional hosts and domains reached directly.
+	NoProxy string `json:"noProxy,omitempty"`
+	// CAConfigMap is a ConfigMap, in the MyApp's namespace, holding the CA bundle of a proxy
+	// intercepting TLS under the ca.crt key.
+	CAConfigMap string `json:"caConfigMap,omitempty"`
+}
+
+// loadEgressProxyProfiles reads file, a YAML map of profile name to egress proxy. There are
+// no profiles when file is empty.
+func loadEgressProxyProfiles(file string) (map[string]egressProxyProfile, error) {
+	profiles := map[string]egressProxyProfile{}
+	if file == "" {
+		return profiles, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, &profiles); err != nil {
+		return nil, fmt.Errorf("parsing egress proxy profiles %s: %w", file, err)
+	}
+	return profiles, nil
+}
+
+// injectEgressProxy sets the proxy environment variables of the egress proxy profile name in
+// every container of template, in both cases as tools read either, and mounts its CA bundle.
+func injectEgressProxy(template *corev1.PodTemplateSpec, profiles map[string]egressProxyProfile, name string) error {
+	if name == "" {
+		return nil
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown egress proxy profile %q", name)
+	}
+	noProxy := clusterNoProxy
+	if profile.NoProxy != "" {
+		noProxy += "," + profile.NoProxy
+	}
+	var env []corev1.EnvVar
+	for _, v := range []struct{ name, value string }{
+		{"HTTP_PROXY", profile.HTTPProxy},
+		{"HTTPS_PROXY", profile.HTTPSProxy},
+		{"NO_PROXY", noProxy},
+	} {
+		if v.value != "" {
+			env = append(env, corev1.EnvVar{Name: v.name, Value: v.value}, corev1.EnvVar{Name: strings.ToLower(v.name), Value: v.value})
+		}
+	}
+	if profile.CAConfigMap != "" {
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: egressProxyCAVolume,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: profile.CAConfigMap}},
+			},
+		})
+	}
+	for i := range template.Spec.Containers {
+		container := &template.Spec.Containers[i]
+		container.Env = append(container.Env, env...)
+		if profile.CAConfigMap != "" {
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+				Name:      egressProxyCAVolume,
+				MountPath: egressProxyCAPath,
+				ReadOnly:  true,
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// expiration returns when app expires, the earlier of its TTL and Spec.ExpiresAt, or nil
+// when it doesn't.
+func expiration(app *api.MyApp) *metav1.Time {
+	var expires *metav1.Time
+	if app.Spec.TTLSecondsAfterCreation != nil {
+		t := metav1.NewTime(app.CreationTimestamp.Add(time.Duration(*app.Spec.TTLSecondsAfterCreation) * time.Second))
+		expires = &t
+	}
+	if at := app.Spec.ExpiresAt; at != nil && (expires == nil || at.Before(expires)) {
+		expires = at.DeepCopy()
+	}
+	return expires
+}
+
+// remainingTTL returns the time left from now until expires, rounded down to days from two
+// days, to hours from two hours and to minutes below, and how long until it changes.
+func remainingTTL(expires, now time.Time) (string, time.Duration) {
+	left := expires.Sub(now)
+	switch {
+	case left <= 0:
+		return "expired", 0
+	case left < time.Minute:
+		return "<1m", left
+	}
+	unit, suffix := time.Minute, "m"
+	switch {
+	case left >= 48*time.Hour:
+		unit, suffix = 24*time.Hour, "d"
+	case left >= 2*time.Hour:
+		unit, suffix = time.Hour, "h"
+	}
+	n := left / unit
+	return fmt.Sprintf("%d%s", n, suffix), left - n*unit + time.Second
+}
+
+// hibernate scales spec down to no pods. spec is modified in memory only and must not be
+// written back.
+func hibernate(spec *api.MyAppSpec) {
+	replicas := int32(0)
+	spec.Replicas = &replicas
+	spec.Autoscaling = nil
+}
+
+// hibernatedCondition reports that the MyApp was scaled down because it expired.
+func hibernatedCondition(app *api.MyApp, expires *metav1.Time) metav1.Condition {
+	return metav1.Condition{
+		Type:               api.ConditionExpired,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Hibernated",
+		Message:            "The MyApp expired at " + expires.UTC().Format(time.RFC3339) + " and was scaled down to no pods",
+		ObservedGeneration: app.Generation,
+	}
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRemainingTTL(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		left        time.Duration
+		want        string
+		wantRefresh time.Duration
+	}{
+		{left: -time.Hour, want: "expired"},
+		{left: 0, want: "expired"},
+		{left: 30 * time.Second, want: "<1m", wantRefresh: 30 * time.Second},
+		{left: 90 * time.Second, want: "1m", wantRefresh: 31 * time.Second},
+		{left: 119 * time.Minute, want: "119m", wantRefresh: time.Second},
+		{left: 2 * time.Hour, want: "2h", wantRefresh: time.Second},
+		{left: 5*time.Hour + 20*time.Minute, want: "5h", wantRefresh: 20*time.Minute + time.Second},
+		{left: 47 * time.Hour, want: "47h", wantRefresh: time.Second},
+		{left: 72*time.Hour + time.Hour, want: "3d", wantRefresh: time.Hour + time.Second},
+	}
+	for _, tt := range tests {
+		got, refresh := remainingTTL(now.Add(tt.left), now)
+		if got != tt.want || refresh != tt.wantRefresh {
+			t.Errorf("remainingTTL(now+%s) = %q, %s, want %q, %s", tt.left, got, refresh, tt.want, tt.wantRefresh)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// externalSecretIndex indexes MyApps by the ExternalSecrets they reference.
+const externalSecretIndex = "spec.externalSecrets.name"
+
+var externalSecretGVK = schema.GroupVersionKind{Group: "external-secrets.io", Version: "v1beta1", Kind: "ExternalSecret"}
+
+func indexExternalSecrets(obj client.Object) []string {
+	app := obj.(*api.MyApp)
+	names := make([]string, 0, len(app.Spec.ExternalSecrets))
+	for _, ref := range app.Spec.ExternalSecrets {
+		names = append(names, ref.Name)
+	}
+	return names
+}
+
+// +kubebuilder:rbac:groups=external-secrets.io,resources=externalsecrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list
+
+// externalSecretWatch starts watching ExternalSecrets the first time a MyApp references
+// one, so the operator works on clusters without the External Secrets Operator installed.
+type externalSecretWatch struct {
+	mu      sync.Mutex
+	started bool
+}
+
+func (w *externalSecretWatch) ensure(c *Controller) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started {
+		return nil
+	}
+	es := &unstructured.Unstructured{}
+	es.SetGroupVersionKind(externalSecretGVK)
+	var obj client.Object = es
+	if err := c.runtimeController.Watch(source.Kind(c.manager.GetCache(), obj, handler.EnqueueRequestsFromMapFunc(c.appsForExternalSecret))); err != nil {
+		return err
+	}
+	w.started = true
+	return nil
+}
+
+// appsForExternalSecret maps an ExternalSecret to the MyApps referencing it.
+func (c *Controller) appsForExternalSecret(ctx context.Context, es client.Object) []reconcile.Request {
+	apps := &api.MyAppList{}
+	if err := c.client.List(ctx, apps, client.InNamespace(es.GetNamespace()), client.MatchingFields{externalSecretIndex: es.GetName()}); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to list MyApps for ExternalSecret", "name", es.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(apps.Items))
+	for _, app := range apps.Items {
+		key := client.ObjectKeyFromObject(&app)
+		if c.shard.owns(key) {
+			requests = append(requests, reconcile.Request{NamespacedName: key})
+		}
+	}
+	return requests
+}
+
+// resolveExternalSecrets returns the target Secrets of the ExternalSecrets app references and
+// a condition describing whether all of them have materialized. The condition is nil when app
+// references no ExternalSecrets.
+func (c *Controller) resolveExternalSecrets(ctx context.Context, app *api.MyApp) ([]corev1.Secret, *metav1.Condition, error) {
+	if len(app.Spec.ExternalSecrets) == 0 {
+		return nil, nil, nil
+	}
+	cond := &metav1.Condition{
+		Type:               api.ConditionExternalSecretsReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: app.Generation,
+	}
+
+	installed, err := c.kindInstalled(externalSecretGVK)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !installed {
+		cond.Reason, cond.Message = "CRDNotInstalled", "The External Secrets Operator CRDs are not installed"
+		return nil, cond, nil
+	}
+	if err := c.esWatch.ensure(c); err != nil {
+		return nil, nil, fmt.Errorf("watching ExternalSecrets: %w", err)
+	}
+
+	var targets []corev1.Secret
+	var pending []string
+	for _, ref := range app.Spec.ExternalSecrets {
+		es := &unstructured.Unstructured{}
+		es.SetGroupVersionKind(externalSecretGVK)
+		err := c.client.Get(ctx, client.ObjectKey{Namespace: app.Namespace, Name: ref.Name}, es)
+		if apierrors.IsNotFound(err) {
+			pending = append(pending, fmt.Sprintf("ExternalSecret %s not found", ref.Name))
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		target, _, _ := unstructured.NestedString(es.Object, "spec", "target", "name")
+		if target == "" {
+			target = ref.Name
+		}
+		// The Secret is read directly so the operator doesn't have to cache every Secret in the cluster.
+		secret := corev1.Secret{}
+		if err := c.manager.GetAPIReader().Get(ctx, client.ObjectKey{Namespace: app.Namespace, Name: target}, &secret); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, nil, err
+			}
+			pending = append(pending, fmt.Sprintf("Secret %s of ExternalSecret %s has not materialized", target, ref.Name))
+			continue
+		}
+		targets = append(targets, secret)
+	}
+
+	if len(pending) > 0 {
+		cond.Reason, cond.Message = "SecretsPending", strings.Join(pending, "; ")
+		return nil, cond, nil
+	}
+	cond.Status, cond.Reason, cond.Message = metav1.ConditionTrue, "SecretsSynced", "All ExternalSecrets have materialized"
+	return targets, cond, nil
+}
+
+// injectSecrets exposes the keys of each Secret as environment variables of the app container.
+func injectSecrets(template *corev1.PodTemplateSpec, secrets []corev1.Secret) {
+	for i := range template.Spec.Containers {
+		for _, secret := range secrets {
+			template.Spec.Containers[i].EnvFrom = append(template.Spec.Containers[i].EnvFrom, corev1.EnvFromSource{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: secret.Name}},
+			})
+		}
+	}
+}
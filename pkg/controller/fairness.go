@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// namespaceRetryDelay is how long a reconcile turned away by the concurrency cap waits before it is retried.
+const namespaceRetryDelay = time.Second
+
+var namespaceThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "myapp_namespace_throttled_total",
+	Help: "Number of reconciles and mutations delayed by the per-namespace limits, by namespace and limit",
+}, []string{"namespace", "limit"})
+
+func init() {
+	metrics.Registry.MustRegister(namespaceThrottled)
+}
+
+// namespaceLimits caps the concurrent reconciles and the mutation rate of each namespace, so
+// a tenant flooding MyApp updates can't starve the others. A zero limit is unlimited.
+type namespaceLimits struct {
+	concurrency int
+	qps         float64
+
+	mu       sync.Mutex
+	active   map[string]int
+	limiters map[string]*rate.Limiter
+}
+
+func newNamespaceLimits(concurrency int, qps float64) *namespaceLimits {
+	return &namespaceLimits{
+		concurrency: concurrency,
+		qps:         qps,
+		active:      map[string]int{},
+		limiters:    map[string]*rate.Limiter{},
+	}
+}
+
+// acquire claims a reconcile slot in namespace. It returns false when the namespace is at its
+// concurrency cap; otherwise release must be called once the reconcile is done.
+func (l *namespaceLimits) acquire(namespace string) bool {
+	if l.concurrency <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[namespace] >= l.concurrency {
+		namespaceThrottled.WithLabelValues(namespace, "concurrency").Inc()
+		return false
+	}
+	l.active[namespace]++
+	return true
+}
+
+func (l *namespaceLimits) release(namespace string) {
+	if l.concurrency <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[namespace]--; l.active[namespace] <= 0 {
+		delete(l.active, namespace)
+	}
+}
+
+// wait blocks until namespace may issue another mutation.
+func (l *namespaceLimits) wait(ctx context.Context, namespace string) error {
+	if l.qps <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	limiter, ok := l.limiters[namespace]
+	if !ok {
+		// Allow short bursts, e.g. creating all children of a new MyApp at once.
+		limiter = rate.NewLimiter(rate.Limit(l.qps), int(l.qps)+1)
+		l.limiters[namespace] = limiter
+	}
+	l.mu.Unlock()
+
+	if limiter.Allow() {
+		return nil
+	}
+	namespaceThrottled.WithLabelValues(namespace, "qps").Inc()
+	return limiter.Wait(ctx)
+}
+
+// limitedClient applies the mutation rate limit of namespaceLimits to a client.
+type limitedClient struct {
+	client.Client
+	limits *namespaceLimits
+}
+
+func (c *limitedClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.limits.wait(ctx, obj.GetNamespace()); err != nil {
+		return err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *limitedClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := c.limits.wait(ctx, obj.GetNamespace()); err != nil {
+		return err
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *limitedClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := c.limits.wait(ctx, obj.GetNamespace()); err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *limitedClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := c.limits.wait(ctx, obj.GetNamespace()); err != nil {
+		return err
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *limitedClient) Status() client.SubResourceWriter {
+	return &limitedStatusWriter{SubResourceWriter: c.Client.Status(), limits: c.limits}
+}
+
+type limitedStatusWriter struct {
+	client.SubResourceWriter
+	limits *namespaceLimits
+}
+
+func (w *limitedStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	if err := w.limits.wait(ctx, obj.GetNamespace()); err != nil {
+		return err
+	}
+	return w.SubResourceWriter.Update(ctx, obj, opts...)
+}
+
+func (w *limitedStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	if err := w.limits.wait(ctx, obj.GetNamespace()); err != nil {
+		return err
+	}
+	return w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+}
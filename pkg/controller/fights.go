@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// fightThreshold is the number of times a child must be reverted within fightWindow
+	// before the controller backs off from re-applying it.
+	fightThreshold = 3
+	fightWindow    = 10 * time.Minute
+	// fightBackoff is how long re-applying a fought over child is deferred at first. It
+	// doubles with every further revert, up to fightMaxBackoff.
+	fightBackoff    = 30 * time.Second
+	fightMaxBackoff = 10 * time.Minute
+)
+
+// fightTracker detects another actor reverting the children the controller applies: a child
+// that lost fields of the rendering the controller applied last, unchanged since, was changed
+// behind its back, whether or not its spec hash annotation was. Children reverted repeatedly
+// are re-applied with an increasing backoff instead of on every event.
+type fightTracker struct {
+	mu sync.Mutex
+	// apps maps every MyApp to the state of its children.
+	apps map[types.NamespacedName]map[childRef]*fightState
+}
+
+type childRef struct {
+	kind string
+	name string
+}
+
+type fightState struct {
+	// hash is the spec hash the child was last applied with.
+	hash       string
+	reverts    int
+	lastRevert time.Time
+	// nextApply is when the child is re-applied again, zero while not backing off.
+	nextApply time.Time
+}
+
+// childConflict is a child the controller backs off from re-applying.
+type childConflict struct {
+	kind, name string
+	// manager is the field manager that changed the child last.
+	manager string
+	reverts int
+	// nextApply is when the child is re-applied, retry how long until then.
+	nextApply time.Time
+	retry     time.Duration
+}
+
+func newFightTracker() *fightTracker {
+	return &fightTracker{apps: map[types.NamespacedName]map[childRef]*fightState{}}
+}
+
+// reverted is called before re-applying live, which differs from the controller's rendering
+// hashed as hash. It reports a conflict when live keeps being reverted, and whether it should
+// be re-applied now.
+func (t *fightTracker) reverted(app types.NamespacedName, kind string, live client.Object, hash string, now time.Time) (*childConflict, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.apps[app][childRef{kind, live.GetName()}]
+	if state == nil || state.hash != hash {
+		// The rendering changed, the child is out of date rather than reverted.
+		return nil, true
+	}
+	conflict := func() *childConflict {
+		return &childConflict{kind: kind, name: live.GetName(), manager: lastManager(live), reverts: state.reverts,
+			nextApply: state.nextApply, retry: state.nextApply.Sub(now)}
+	}
+	if now.Before(state.nextApply) {
+		return conflict(), false
+	}
+	if now.Sub(state.lastRevert) > fightWindow {
+		state.reverts = 0
+	}
+	state.reverts++
+	state.lastRevert = now
+	if state.reverts < fightThreshold {
+		state.nextApply = time.Time{}
+		return nil, true
+	}
+	backoff := fightBackoff << (state.reverts - fightThreshold)
+	if backoff > fightMaxBackoff || backoff <= 0 {
+		backoff = fightMaxBackoff
+	}
+	state.nextApply = now.Add(backoff)
+	return conflict(), true
+}
+
+// applied records that the child named name was applied with hash.
+func (t *fightTracker) applied(app types.NamespacedName, kind, name, hash string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	children := t.apps[app]
+	if children == nil {
+		children = map[childRef]*fightState{}
+		t.apps[app] = children
+	}
+	ref := childRef{kind, name}
+	if state := children[ref]; state != nil && state.hash == hash {
+		return
+	}
+	children[ref] = &fightState{hash: hash}
+}
+
+// forget drops the state of the children of a deleted MyApp.
+func (t *fightTracker) forget(app types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.apps, app)
+}
+
+// lastManager returns the field manager other than the controller that changed obj last.
+func lastManager(obj client.Object) string {
+	var manager string
+	var last *metav1.Time
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == fieldOwner || entry.Subresource != "" {
+			continue
+		}
+		if last == nil || (entry.Time != nil && last.Before(entry.Time)) {
+			manager, last = entry.Manager, entry.Time
+		}
+	}
+	if manager == "" {
+		return "unknown"
+	}
+	return manager
+}
+
+// conflictingManagerCondition reports the children another field manager keeps reverting. The
+// message names when they are re-applied rather than a countdown, so it doesn't change, and
+// the status isn't written, on every reconcile while backing off.
+func conflictingManagerCondition(app *api.MyApp, conflicts []childConflict) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               api.ConditionConflictingManager,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonAsExpected,
+		ObservedGeneration: app.Generation,
+	}
+	if len(conflicts) == 0 {
+		return cond
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].kind != conflicts[j].kind {
+			return conflicts[i].kind < conflicts[j].kind
+		}
+		return conflicts[i].name < conflicts[j].name
+	})
+	messages := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		messages = append(messages, fmt.Sprintf("%s %s reverted %d times by %s, re-applying at %s",
+			c.kind, c.name, c.reverts, c.manager, c.nextApply.UTC().Format(time.RFC3339)))
+	}
+	cond.Status, cond.Reason, cond.Message = metav1.ConditionTrue, "FieldsReverted", strings.Join(messages, "; ")
+	return cond
+}
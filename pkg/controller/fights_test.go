@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestFightTracker(t *testing.T) {
+	app := types.NamespacedName{Namespace: "ns", Name: "web"}
+	t0 := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	live := &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "ns",
+		Name:      "web",
+		ManagedFields: []metav1.ManagedFieldsEntry{
+			{Manager: fieldOwner, Time: &metav1.Time{Time: t0.Add(time.Minute)}},
+			{Manager: "kubectl-set", Time: &metav1.Time{Time: t0}},
+		},
+	}}
+
+	tracker := newFightTracker()
+	if conflict, apply := tracker.reverted(app, "Deployment", live, "h1", t0); conflict != nil || !apply {
+		t.Fatalf("reverted() of a child never applied = %v, %v, want no conflict and apply", conflict, apply)
+	}
+	tracker.applied(app, "Deployment", "web", "h1")
+
+	steps := []struct {
+		name      string
+		at        time.Duration
+		hash      string
+		wantRetry time.Duration // 0 when no conflict is reported
+		wantApply bool
+	}{
+		{name: "first revert", at: 0, hash: "h1", wantApply: true},
+		{name: "second revert", at: time.Second, hash: "h1", wantApply: true},
+		{name: "threshold reached", at: 2 * time.Second, hash: "h1", wantRetry: fightBackoff, wantApply: true},
+		{name: "backing off", at: 12 * time.Second, hash: "h1", wantRetry: 20 * time.Second},
+		{name: "backoff doubled", at: 33 * time.Second, hash: "h1", wantRetry: 2 * fightBackoff, wantApply: true},
+		{name: "rendering changed", at: 34 * time.Second, hash: "h2", wantApply: true},
+		{name: "window elapsed", at: 33*time.Second + fightWindow + time.Second, hash: "h1", wantApply: true},
+	}
+	for _, s := range steps {
+		conflict, apply := tracker.reverted(app, "Deployment", live, s.hash, t0.Add(s.at))
+		if apply != s.wantApply {
+			t.Errorf("%s: apply = %v, want %v", s.name, apply, s.wantApply)
+		}
+		switch {
+		case s.wantRetry == 0 && conflict != nil:
+			t.Errorf("%s: unexpected conflict %+v", s.name, *conflict)
+		case s.wantRetry != 0 && conflict == nil:
+			t.Errorf("%s: no conflict, want one retrying in %s", s.name, s.wantRetry)
+		case conflict != nil && (conflict.retry != s.wantRetry || conflict.manager != "kubectl-set"):
+			t.Errorf("%s: conflict %+v, want one by kubectl-set retrying in %s", s.name, *conflict, s.wantRetry)
+		}
+	}
+
+	tracker.forget(app)
+	if conflict, apply := tracker.reverted(app, "Deployment", live, "h1", t0); conflict != nil || !apply {
+		t.Errorf("reverted() of a forgotten child = %v, %v, want no conflict and apply", conflict, apply)
+	}
+}
+
+func TestFightBackoffLimit(t *testing.T) {
+	app := types.NamespacedName{Namespace: "ns", Name: "web"}
+	live := &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"}}
+	tracker := newFightTracker()
+	tracker.applied(app, "Deployment", "web", "h1")
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var conflict *childConflict
+	for i := 0; i < 100; i++ {
+		conflict, _ = tracker.reverted(app, "Deployment", live, "h1", now)
+		if conflict != nil {
+			now = now.Add(conflict.retry)
+		}
+	}
+	if conflict == nil || conflict.retry != fightMaxBackoff {
+		t.Errorf("conflict after 100 reverts = %+v, want one retrying in %s", conflict, fightMaxBackoff)
+	}
+	if conflict != nil && conflict.manager != "unknown" {
+		t.Errorf("manager = %q, want unknown", conflict.manager)
+	}
+}
+
+func TestConflictingManagerConditionDuringBackoff(t *testing.T) {
+	app := &api.MyApp{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web", Generation: 4}}
+	key := types.NamespacedName{Namespace: "ns", Name: "web"}
+	live := &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"}}
+	tracker := newFightTracker()
+	tracker.applied(key, "Deployment", "web", "h1")
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < fightThreshold; i++ {
+		tracker.reverted(key, "Deployment", live, "h1", now)
+	}
+
+	// Two reconciles during the same backoff, e.g. queued by other events of the MyApp.
+	var conditions []metav1.Condition
+	for _, at := range []time.Duration{time.Second, 17 * time.Second} {
+		conflict, apply := tracker.reverted(key, "Deployment", live, "h1", now.Add(at))
+		if conflict == nil || apply {
+			t.Fatalf("reverted() %s into the backoff = %v, %v, want a conflict and no apply", at, conflict, apply)
+		}
+		conditions = append(conditions, conflictingManagerCondition(app, []childConflict{*conflict}))
+	}
+	if conditions[0] != conditions[1] {
+		t.Errorf("the condition changed during the backoff, from %+v to %+v", conditions[0], conditions[1])
+	}
+	want := "Deployment web reverted 3 times by unknown, re-applying at 2024-06-01T12:00:30Z"
+	if conditions[0].Status != metav1.ConditionTrue || conditions[0].Message != want {
+		t.Errorf("condition = %+v, want True with message %q", conditions[0], want)
+	}
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	httpRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+	gatewayGVK   = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "Gateway"}
+)
+
+func gatewayMode(myApp *api.MyApp) bool {
+	return myApp.Spec.Networking != nil && myApp.Spec.Networking.Mode == api.NetworkingModeGatewayAPI
+}
+
+// parseGatewayRef parses a "namespace/name[/section]" gateway reference.
+func parseGatewayRef(ref string) (*api.GatewayRef, error) {
+	if ref == "" {
+		return nil, nil
+	}
+	parts := strings.Split(ref, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("gateway %q must be of the form namespace/name[/section]", ref)
+	}
+	gw := &api.GatewayRef{Namespace: parts[0], Name: parts[1]}
+	if len(parts) == 3 {
+		gw.SectionName = parts[2]
+	}
+	return gw, nil
+}
+
+// gatewayFor returns the Gateway myApp's HTTPRoute attaches to, if any.
+func (c *Controller) gatewayFor(myApp *api.MyApp) *api.GatewayRef {
+	gw := c.defaultGateway
+	if myApp.Spec.Networking != nil && myApp.Spec.Networking.Gateway != nil {
+		gw = myApp.Spec.Networking.Gateway
+	}
+	if gw == nil {
+		return nil
+	}
+	out := *gw
+	if out.Namespace == "" {
+		out.Namespace = myApp.Namespace
+	}
+	return &out
+}
+
+func createHTTPRoute(myApp *api.MyApp, gw *api.GatewayRef) *unstructured.Unstructured {
+	spec := myApp.Spec.Ingress
+	path := spec.Path
+	if path == "" {
+		path = "/"
+	}
+	port, _ := servicePorts(serviceSpec(myApp))
+
+	parent := map[string]interface{}{
+		"name":      gw.Name,
+		"namespace": gw.Namespace,
+	}
+	if gw.SectionName != "" {
+		parent["sectionName"] = gw.SectionName
+	}
+
+	route := newUnstructured(httpRouteGVK, myApp.Namespace, myApp.Name)
+	route.Object["spec"] = map[string]interface{}{
+		"parentRefs": []interface{}{parent},
+		"hostnames":  []interface{}{spec.Host},
+		"rules": []interface{}{
+			map[string]interface{}{
+				"matches": []interface{}{
+					map[string]interface{}{
+						"path": map[string]interface{}{"type": "PathPrefix", "value": path},
+					},
+				},
+				"backendRefs": []interface{}{
+					map[string]interface{}{"name": myApp.Name, "port": int64(port)},
+				},
+			},
+		},
+	}
+	return route
+}
+
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch
+
+// ensureRoute realizes Spec.Ingress as an Ingress or, in GatewayAPI mode, an HTTPRoute.
+// Configurations that can't be realized are reported through the returned condition.
+func (c *Controller) ensureRoute(ctx context.Context, myApp *api.MyApp, changes *childChanges) (metav1.Condition, error) {
+	cond := metav1.Condition{
+		Type:               api.ConditionRouteConfigured,
+		Status:             metav1.ConditionTrue,
+		Reason:             "IngressCreated",
+		ObservedGeneration: myApp.Generation,
+	}
+	if !gatewayMode(myApp) {
+		return cond, c.ensureIngress(ctx, myApp, changes)
+	}
+
+	if !c.gatewayAPI {
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionFalse, "GatewayAPINotInstalled", "The Gateway API CRDs were not installed when the operator started"
+		return cond, nil
+	}
+	gw := c.gatewayFor(myApp)
+	if gw == nil {
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionFalse, "NoGateway", "spec.networking.gateway is not set and the operator has no default gateway"
+		return cond, nil
+	}
+
+	route := createHTTPRoute(myApp, gw)
+	if err := ctrl.SetControllerReference(myApp, route, c.manager.GetScheme()); err != nil {
+		return cond, err
+	}
+	if err := c.client.Patch(ctx, route, client.Apply, client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+		childApplyFailures.WithLabelValues(httpRouteGVK.Kind, applyFailureReason(err)).Inc()
+		return cond, fmt.Errorf("applying HTTPRoute: %w", err)
+	}
+	changes.observe(route, httpRouteGVK)
+	cond.Reason, cond.Message = "HTTPRouteApplied", fmt.Sprintf("Attached to gateway %s/%s", gw.Namespace, gw.Name)
+	return cond, nil
+}
+
+// gatewayAddresses returns the addresses of the Gateway myApp's HTTPRoute attaches to.
+func (c *Controller) gatewayAddresses(ctx context.Context, myApp *api.MyApp) ([]string, error) {
+	gw := c.gatewayFor(myApp)
+	if gw == nil || !c.gatewayAPI {
+		return nil, nil
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gatewayGVK)
+	if err := c.client.Get(ctx, client.ObjectKey{Namespace: gw.Namespace, Name: gw.Name}, obj); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	addresses, _, _ := unstructured.NestedSlice(obj.Object, "status", "addresses")
+	var out []string
+	for _, a := range addresses {
+		if m, ok := a.(map[string]interface{}); ok {
+			if v, ok := m["value"].(string); ok && v != "" {
+				out = append(out, v)
+			}
+		}
+	}
+	return out, nil
+}
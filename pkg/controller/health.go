@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// cacheSyncTimeout bounds how long the readiness check waits on the informers.
+const cacheSyncTimeout = time.Second
+
+// controllerHealth tracks the progress of the MyApp controller for its liveness check. A
+// controller that stopped reconciling while MyApps are queued is wedged and is restarted.
+type controllerHealth struct {
+	// timeout is how long MyApps may stay queued without a successful reconcile. The check
+	// always passes when 0.
+	timeout time.Duration
+
+	mu          sync.Mutex
+	queue       workqueue.RateLimitingInterface
+	lastSuccess time.Time
+	lastDone    time.Time
+	// processed counts the finished reconciles.
+	processed uint64
+}
+
+// track records the controller's workqueue, which is only built once the controller starts.
+func (h *controllerHealth) track(queue workqueue.RateLimitingInterface) workqueue.RateLimitingInterface {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.queue = queue
+	// The first MyApps are given the timeout to be reconciled.
+	h.lastSuccess = time.Now()
+	return queue
+}
+
+// reconciler records the outcome of every reconcile of r.
+func (h *controllerHealth) reconciler(r reconcile.Reconciler) reconcile.Reconciler {
+	return reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+		result, err := r.Reconcile(ctx, req)
+		now := time.Now()
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.lastDone = now
+		h.processed++
+		if err == nil {
+			h.lastSuccess = now
+		}
+		return result, err
+	})
+}
+
+// progress returns the depth of the workqueue and the number of finished reconciles. The
+// depth is 0 until the controller starts.
+func (h *controllerHealth) progress() (depth int, processed uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.queue != nil {
+		depth = h.queue.Len()
+	}
+	return depth, h.processed
+}
+
+// check is a liveness check failing when MyApps are queued and none was reconciled
+// successfully within the timeout. It passes on replicas that don't run the controller.
+func (h *controllerHealth) check(*http.Request) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.timeout <= 0 || h.queue == nil || h.queue.Len() == 0 {
+		return nil
+	}
+	if since := time.Since(h.lastSuccess); since > h.timeout {
+		last := "never"
+		if !h.lastDone.IsZero() {
+			last = time.Since(h.lastDone).Round(time.Second).String() + " ago"
+		}
+		return fmt.Errorf("%d MyApps queued, no successful reconcile for %s, last reconcile finished %s",
+			h.queue.Len(), since.Round(time.Second), last)
+	}
+	return nil
+}
+
+// cacheSyncedCheck is a readiness check failing until the informers of c synced.
+func cacheSyncedCheck(c cache.Cache) func(*http.Request) error {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), cacheSyncTimeout)
+		defer cancel()
+		if !c.WaitForCacheSync(ctx) {
+			return errors.New("informers not synced")
+		}
+		return nil
+	}
+}
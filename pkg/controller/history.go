@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// historySize is the number of reconciles remembered per MyApp.
+const historySize = 20
+
+// Reconcile outcomes recorded in the history.
+const (
+	outcomeSuccess = "success"
+	outcomeRequeue = "requeue"
+	outcomeError   = "error"
+)
+
+// reconcileRecord is a finished reconcile of a MyApp.
+type reconcileRecord struct {
+	Time     time.Time `json:"time"`
+	Duration string    `json:"duration"`
+	Outcome  string    `json:"outcome"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// reconcileHistory keeps the last historySize reconciles of every MyApp, for the admin API.
+// A nil *reconcileHistory records nothing.
+type reconcileHistory struct {
+	mu sync.Mutex
+	// records holds a ring buffer per MyApp; next is where its following record is written.
+	records map[types.NamespacedName]*historyRing
+}
+
+type historyRing struct {
+	records []reconcileRecord
+	next    int
+}
+
+func newReconcileHistory() *reconcileHistory {
+	return &reconcileHistory{records: map[types.NamespacedName]*historyRing{}}
+}
+
+// reconciler records every reconcile of r.
+func (h *reconcileHistory) reconciler(r reconcile.Reconciler) reconcile.Reconciler {
+	if h == nil {
+		return r
+	}
+	return reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+		start := time.Now()
+		result, err := r.Reconcile(ctx, req)
+		record := reconcileRecord{Time: start, Duration: time.Since(start).String(), Outcome: outcomeSuccess}
+		switch {
+		case err != nil:
+			record.Outcome, record.Error = outcomeError, err.Error()
+		case result.Requeue || result.RequeueAfter > 0:
+			record.Outcome = outcomeRequeue
+		}
+		h.record(req.NamespacedName, record)
+		return result, err
+	})
+}
+
+func (h *reconcileHistory) record(key types.NamespacedName, record reconcileRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ring, ok := h.records[key]
+	if !ok {
+		ring = &historyRing{}
+		h.records[key] = ring
+	}
+	if len(ring.records) < historySize {
+		ring.records = append(ring.records, record)
+		return
+	}
+	ring.records[ring.next] = record
+	ring.next = (ring.next + 1) % historySize
+}
+
+// get returns the reconciles of a MyApp, oldest first.
+func (h *reconcileHistory) get(key types.NamespacedName) []reconcileRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ring, ok := h.records[key]
+	if !ok {
+		return []reconcileRecord{}
+	}
+	records := make([]reconcileRecord, 0, len(ring.records))
+	records = append(records, ring.records[ring.next:]...)
+	return append(records, ring.records[:ring.next]...)
+}
+
+// forget drops the history of a deleted MyApp.
+func (h *reconcileHistory) forget(key types.NamespacedName) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.records, key)
+}
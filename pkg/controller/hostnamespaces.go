@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// checkHostNamespaces returns a PolicyViolation condition when the MyApp requests the host's
+// network or PID namespace but the operator doesn't allow them, or its namespace isn't
+// labeled with api.AllowHostNamespacesLabel, nil otherwise. The webhook denies such MyApps,
+// this catches the ones admitted while it was unavailable.
+func (c *Controller) checkHostNamespaces(ctx context.Context, myApp *api.MyApp) (*metav1.Condition, error) {
+	if !myApp.Spec.HostNetwork && !myApp.Spec.HostPID {
+		return nil, nil
+	}
+	cond := &metav1.Condition{
+		Type:               api.ConditionPolicyViolation,
+		Status:             metav1.ConditionTrue,
+		Reason:             "HostNamespaces",
+		ObservedGeneration: myApp.Generation,
+	}
+	if !c.allowHostNamespaces {
+		cond.Message = "hostNetwork and hostPID are disabled by the operator"
+		return cond, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := c.client.Get(ctx, client.ObjectKey{Name: myApp.Namespace}, ns); err != nil {
+		return nil, err
+	}
+	if ns.Labels[api.AllowHostNamespacesLabel] != "true" {
+		cond.Message = fmt.Sprintf("hostNetwork and hostPID require the %s=true label on namespace %s", api.AllowHostNamespacesLabel, ns.Name)
+		return cond, nil
+	}
+	return nil, nil
+}
+
+// configureHostNamespaces runs the pods in the host's namespaces the MyApp requests. Pods on
+// the host's network keep resolving cluster names.
+func configureHostNamespaces(myApp *api.MyApp, template *corev1.PodTemplateSpec) {
+	template.Spec.HostNetwork = myApp.Spec.HostNetwork
+	template.Spec.HostPID = myApp.Spec.HostPID
+	if myApp.Spec.HostNetwork {
+		template.Spec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+	}
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// parseIgnoreDifferences parses a comma separated list of Kind:/json/pointer pairs.
+func parseIgnoreDifferences(list string) ([]api.IgnoreDifference, error) {
+	var ignores []api.IgnoreDifference
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kind, pointer, ok := strings.Cut(entry, ":")
+		if !ok || kind == "" || !strings.HasPrefix(pointer, "/") {
+			return nil, fmt.Errorf("ignored difference %q must be of the form Kind:/json/pointer", entry)
+		}
+		ignores = append(ignores, api.IgnoreDifference{Kind: kind, JSONPointers: []string{pointer}})
+	}
+	return ignores, nil
+}
+
+// ignoredPointers returns the JSON pointers of the fields of myApp's children of kind that
+// are left to other managers.
+func (c *Controller) ignoredPointers(myApp *api.MyApp, kind string) []string {
+	var pointers []string
+	for _, ignores := range [][]api.IgnoreDifference{c.ignoreDifferences, myApp.Spec.IgnoreDifferences} {
+		for _, ignore := range ignores {
+			if ignore.Kind == kind {
+				pointers = append(pointers, ignore.JSONPointers...)
+			}
+		}
+	}
+	return pointers
+}
+
+// removeIgnored drops the fields at pointers from the rendered obj, so they are neither
+// hashed nor applied and stay with whichever manager sets them.
+func removeIgnored(obj client.Object, pointers []string) error {
+	if len(pointers) == 0 {
+		return nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	for _, pointer := range pointers {
+		if err := removePointer(content, pointer); err != nil {
+			return err
+		}
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(content, obj)
+}
+
+// removePointer removes the value at the RFC 6901 pointer from content. Pointers to values
+// that don't exist are ignored.
+func removePointer(content map[string]interface{}, pointer string) error {
+	if !strings.HasPrefix(pointer, "/") {
+		return fmt.Errorf("JSON pointer %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	var parent interface{} = content
+	for i, token := range tokens {
+		last := i == len(tokens)-1
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if last {
+				delete(node, token)
+				return nil
+			}
+			parent = node[token]
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil
+			}
+			if last {
+				// Removing elements would shift the ones the controller renders after it.
+				return fmt.Errorf("JSON pointer %q must not point to a list element", pointer)
+			}
+			parent = node[index]
+		default:
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// tenantServiceAccountAnnotation on a namespace names the ServiceAccount, in that namespace,
+// the children of its MyApps are mutated as when impersonating tenants.
+const tenantServiceAccountAnnotation = "myapp.example.com/tenant-service-account"
+
+// forbiddenRecheckInterval is how often a MyApp whose mutations were forbidden is retried.
+// RBAC changes don't produce events the controller watches.
+const forbiddenRecheckInterval = time.Minute
+
+// +kubebuilder:rbac:groups="",resources=serviceaccounts;groups,verbs=impersonate
+
+// tenantClient mutates namespaced objects impersonating the tenant ServiceAccount of their
+// namespace, so the operator can't exceed the tenant's own permissions. Reads, MyApps
+// themselves and status writes use the operator's identity.
+type tenantClient struct {
+	client.Client
+	manager ctrl.Manager
+
+	mu      sync.Mutex
+	clients map[string]client.Client
+}
+
+func newTenantClient(manager ctrl.Manager) *tenantClient {
+	return &tenantClient{
+		Client:  manager.GetClient(),
+		manager: manager,
+		clients: map[string]client.Client{},
+	}
+}
+
+// clientFor returns the client mutating obj.
+func (t *tenantClient) clientFor(ctx context.Context, obj client.Object) (client.Client, error) {
+	if _, ok := obj.(*api.MyApp); ok || obj.GetNamespace() == "" {
+		return t.Client, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := t.Client.Get(ctx, client.ObjectKey{Name: obj.GetNamespace()}, ns); err != nil {
+		return nil, err
+	}
+	sa := ns.Annotations[tenantServiceAccountAnnotation]
+	if sa == "" {
+		gvk, err := apiutil.GVKForObject(obj, t.Scheme())
+		if err != nil {
+			return nil, err
+		}
+		return nil, apierrors.NewForbidden(schema.GroupResource{Group: gvk.Group, Resource: gvk.Kind}, obj.GetName(),
+			fmt.Errorf("namespace %s has no %s annotation", ns.Name, tenantServiceAccountAnnotation))
+	}
+	user := fmt.Sprintf("system:serviceaccount:%s:%s", ns.Name, sa)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.clients[user]; ok {
+		return c, nil
+	}
+	config := rest.CopyConfig(t.manager.GetConfig())
+	// The groups are the ones the ServiceAccount authenticates with, so bindings to them apply too.
+	config.Impersonate = rest.ImpersonationConfig{
+		UserName: user,
+		Groups:   []string{"system:serviceaccounts", "system:serviceaccounts:" + ns.Name, "system:authenticated"},
+	}
+	c, err := client.New(config, client.Options{
+		Scheme: t.manager.GetScheme(),
+		Mapper: t.manager.GetRESTMapper(),
+		Cache:  &client.CacheOptions{Reader: t.manager.GetCache()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.clients[user] = c
+	return c, nil
+}
+
+func (t *tenantClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c, err := t.clientFor(ctx, obj)
+	if err != nil {
+		return err
+	}
+	return c.Create(ctx, obj, opts...)
+}
+
+func (t *tenantClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c, err := t.clientFor(ctx, obj)
+	if err != nil {
+		return err
+	}
+	return c.Update(ctx, obj, opts...)
+}
+
+func (t *tenantClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c, err := t.clientFor(ctx, obj)
+	if err != nil {
+		return err
+	}
+	return c.Patch(ctx, obj, patch, opts...)
+}
+
+func (t *tenantClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c, err := t.clientFor(ctx, obj)
+	if err != nil {
+		return err
+	}
+	return c.Delete(ctx, obj, opts...)
+}
+
+// forbidden returns the first Forbidden error in err, which may be an aggregate. Denials of
+// admission policies aren't RBAC's and are skipped.
+func forbidden(err error) error {
+	if agg, ok := err.(kerrors.Aggregate); ok {
+		for _, err := range agg.Errors() {
+			if f := forbidden(err); f != nil {
+				return f
+			}
+		}
+		return nil
+	}
+	if apierrors.IsForbidden(err) && !deniedByAdmission(err) {
+		return err
+	}
+	return nil
+}
+
+// forbiddenCondition reports whether the tenant's permissions kept the MyApp's children from being applied.
+func forbiddenCondition(app *api.MyApp, err error) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               api.ConditionForbidden,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonAsExpected,
+		ObservedGeneration: app.Generation,
+	}
+	if err != nil {
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionTrue, "ImpersonationForbidden", err.Error()
+	}
+	return cond
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ImportDeployment synthesizes a MyApp of the same name as deployment running its pods: the
+// replicas, and the image, args, env, resources, probes and security context of container, or
+// of the first container when empty. It also returns the notes of what the MyApp doesn't
+// capture, which the Deployment loses once the MyApp's controller applies it.
+func ImportDeployment(deployment *appv1.Deployment, container string) (*api.MyApp, []string, error) {
+	pod := &deployment.Spec.Template.Spec
+	if len(pod.Containers) == 0 {
+		return nil, nil, fmt.Errorf("Deployment %s has no containers", deployment.Name)
+	}
+	var notes []string
+	imported := &pod.Containers[0]
+	if container != "" {
+		imported = nil
+		for i := range pod.Containers {
+			if pod.Containers[i].Name == container {
+				imported = &pod.Containers[i]
+			}
+		}
+		if imported == nil {
+			return nil, nil, fmt.Errorf("Deployment %s has no container %s", deployment.Name, container)
+		}
+	}
+	for _, c := range pod.Containers {
+		if c.Name != imported.Name {
+			notes = append(notes, fmt.Sprintf("container %s is not imported, only %s is", c.Name, imported.Name))
+		}
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	app := &api.MyApp{
+		TypeMeta: metav1.TypeMeta{APIVersion: api.GroupVersion.String(), Kind: "MyApp"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: deployment.Namespace,
+			Name:      deployment.Name,
+		},
+		Spec: api.MyAppSpec{
+			Replicas:        &replicas,
+			Image:           imported.Image,
+			Args:            append([]string(nil), imported.Args...),
+			LivenessProbe:   imported.LivenessProbe.DeepCopy(),
+			ReadinessProbe:  imported.ReadinessProbe.DeepCopy(),
+			SecurityContext: imported.SecurityContext.DeepCopy(),
+			HostNetwork:     pod.HostNetwork,
+			HostPID:         pod.HostPID,
+		},
+	}
+	for i := range imported.Env {
+		app.Spec.Env = append(app.Spec.Env, *imported.Env[i].DeepCopy())
+	}
+	if len(imported.Resources.Requests) > 0 || len(imported.Resources.Limits) > 0 {
+		app.Spec.Resources = imported.Resources.DeepCopy()
+	} else {
+		notes = append(notes, "the container sets no resources, the MyApp's defaults apply")
+	}
+	if pod.RuntimeClassName != nil {
+		app.Spec.RuntimeClassName = *pod.RuntimeClassName
+	}
+
+	// MyApps select their pods by the app label. Selectors are immutable, so the Deployment is
+	// recreated, orphaning its pods until the new ones are available.
+	if !equality.Semantic.DeepEqual(deployment.Spec.Selector, &metav1.LabelSelector{MatchLabels: labelsForMyApp(deployment.Name)}) {
+		app.Spec.RecreateOnImmutableChange = true
+		notes = append(notes, fmt.Sprintf("the selector differs from the MyApp's %v, the Deployment is recreated and Services selecting its old pod labels must be updated", labelsForMyApp(deployment.Name)))
+	}
+
+	skipped := []struct {
+		field string
+		set   bool
+		// hint is the MyApp's alternative, if any.
+		hint string
+	}{
+		{"command", len(imported.Command) > 0, ""},
+		{"envFrom", len(imported.EnvFrom) > 0, ""},
+		{"ports", len(imported.Ports) > 0, "spec.service"},
+		{"startupProbe", imported.StartupProbe != nil, ""},
+		{"lifecycle", imported.Lifecycle != nil, "spec.gracefulShutdown"},
+		{"volumeMounts", len(imported.VolumeMounts) > 0, ""},
+		{"initContainers", len(pod.InitContainers) > 0, ""},
+		{"volumes", len(pod.Volumes) > 0, ""},
+		{"serviceAccountName", pod.ServiceAccountName != "", ""},
+		{"nodeSelector", len(pod.NodeSelector) > 0, ""},
+		{"affinity", pod.Affinity != nil, ""},
+		{"tolerations", len(pod.Tolerations) > 0, ""},
+		{"topologySpreadConstraints", len(pod.TopologySpreadConstraints) > 0, ""},
+		{"imagePullSecrets", len(pod.ImagePullSecrets) > 0, ""},
+		{"the pod template's annotations", len(deployment.Spec.Template.Annotations) > 0, ""},
+		{"the pod's securityContext", pod.SecurityContext != nil && !equality.Semantic.DeepEqual(pod.SecurityContext, &corev1.PodSecurityContext{}), ""},
+		{"terminationGracePeriodSeconds", pod.TerminationGracePeriodSeconds != nil && *pod.TerminationGracePeriodSeconds != corev1.DefaultTerminationGracePeriodSeconds, "spec.gracefulShutdown"},
+	}
+	for _, s := range skipped {
+		switch {
+		case !s.set:
+		case s.hint != "":
+			notes = append(notes, fmt.Sprintf("%s not imported, see %s", s.field, s.hint))
+		default:
+			notes = append(notes, s.field+" not imported")
+		}
+	}
+	return app, notes, nil
+}
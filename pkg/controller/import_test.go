@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func importedDeployment(containers ...corev1.Container) *appv1.Deployment {
+	return &appv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+		Spec: appv1.DeploymentSpec{
+			Replicas: int32Ptr(3),
+			Selector: &metav1.LabelSelector{MatchLabels: labelsForMyApp("web")},
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: containers}},
+		},
+	}
+}
+
+func TestImportDeployment(t *testing.T) {
+	resources := corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")}}
+	web := corev1.Container{Name: "web", Image: "web:1.2", Args: []string{"--port=8080"}, Resources: resources}
+	sidecar := corev1.Container{Name: "proxy", Image: "proxy:3"}
+
+	tests := []struct {
+		name       string
+		deployment *appv1.Deployment
+		container  string
+		wantImage  string
+		wantNotes  []string
+		// wantRecreate is whether the MyApp recreates the Deployment to change its selector.
+		wantRecreate bool
+		wantErr      bool
+	}{
+		{
+			name:       "single container",
+			deployment: importedDeployment(web),
+			wantImage:  "web:1.2",
+		},
+		{
+			name:       "first container",
+			deployment: importedDeployment(web, sidecar),
+			wantImage:  "web:1.2",
+			wantNotes:  []string{"container proxy is not imported, only web is"},
+		},
+		{
+			name:       "named container",
+			deployment: importedDeployment(web, sidecar),
+			container:  "proxy",
+			wantImage:  "proxy:3",
+			wantNotes: []string{
+				"container web is not imported, only proxy is",
+				"the container sets no resources, the MyApp's defaults apply",
+			},
+		},
+		{
+			name:       "missing container",
+			deployment: importedDeployment(web),
+			container:  "proxy",
+			wantErr:    true,
+		},
+		{
+			name:       "no containers",
+			deployment: importedDeployment(),
+			wantErr:    true,
+		},
+		{
+			name: "other selector",
+			deployment: func() *appv1.Deployment {
+				d := importedDeployment(web)
+				d.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app.kubernetes.io/name": "web"}}
+				return d
+			}(),
+			wantImage:    "web:1.2",
+			wantNotes:    []string{"the selector differs from the MyApp's map[app:web], the Deployment is recreated and Services selecting its old pod labels must be updated"},
+			wantRecreate: true,
+		},
+		{
+			name: "skipped fields",
+			deployment: func() *appv1.Deployment {
+				c := web
+				c.Command = []string{"/web"}
+				c.Ports = []corev1.ContainerPort{{ContainerPort: 8080}}
+				d := importedDeployment(c)
+				d.Spec.Template.Spec.ServiceAccountName = "web"
+				return d
+			}(),
+			wantImage: "web:1.2",
+			wantNotes: []string{"command not imported", "ports not imported, see spec.service", "serviceAccountName not imported"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, notes, err := ImportDeployment(tt.deployment, tt.container)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ImportDeployment() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if app.Namespace != "ns" || app.Name != "web" {
+				t.Errorf("imported MyApp %s/%s, want ns/web", app.Namespace, app.Name)
+			}
+			if app.Spec.Image != tt.wantImage {
+				t.Errorf("image = %q, want %q", app.Spec.Image, tt.wantImage)
+			}
+			if *app.Spec.Replicas != 3 {
+				t.Errorf("replicas = %d, want 3", *app.Spec.Replicas)
+			}
+			if app.Spec.RecreateOnImmutableChange != tt.wantRecreate {
+				t.Errorf("recreateOnImmutableChange = %v, want %v", app.Spec.RecreateOnImmutableChange, tt.wantRecreate)
+			}
+			if !reflect.DeepEqual(notes, tt.wantNotes) {
+				t.Errorf("notes = %q, want %q", notes, tt.wantNotes)
+			}
+		})
+	}
+}
+
+func TestImportDeploymentCopies(t *testing.T) {
+	deployment := importedDeployment(corev1.Container{Name: "web", Image: "web:1.2", Args: []string{"--port=8080"}})
+	app, _, err := ImportDeployment(deployment, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Spec.Args[0] = "--port=9090"
+	if got := deployment.Spec.Template.Spec.Containers[0].Args[0]; got != "--port=8080" {
+		t.Errorf("modifying the MyApp changed the Deployment's args to %s", got)
+	}
+}
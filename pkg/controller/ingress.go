@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func createIngress(myApp *api.MyApp) *networkingv1.Ingress {
+	spec := myApp.Spec.Ingress
+	path := spec.Path
+	if path == "" {
+		path = "/"
+	}
+	port, _ := servicePorts(serviceSpec(myApp))
+	pathType := networkingv1.PathTypePrefix
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: myApp.Namespace,
+			Name:      myApp.Name,
+			Annotations: map[string]string{
+				externalDNSHostnameAnnotation: spec.Host,
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: spec.Host,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     path,
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: myApp.Name,
+											Port: networkingv1.ServiceBackendPort{Number: port},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if spec.ClassName != "" {
+		className := spec.ClassName
+		ingress.Spec.IngressClassName = &className
+	}
+	if spec.TLSSecretName != "" {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{{Hosts: []string{spec.Host}, SecretName: spec.TLSSecretName}}
+	}
+	return ingress
+}
+
+// ensureIngress creates or updates the Ingress for myApp.
+func (c *Controller) ensureIngress(ctx context.Context, myApp *api.MyApp, changes *childChanges) error {
+	_, _, err := c.ensureChild(ctx, myApp, createIngress(myApp), changes)
+	return err
+}
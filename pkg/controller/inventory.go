@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"sort"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// observe adds the live child obj to the inventory reported in Status.Resources.
+func (c *childChanges) observe(obj client.Object, gvk schema.GroupVersionKind) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resources = append(c.resources, api.ResourceStatus{
+		APIVersion: gvk.GroupVersion().String(),
+		Kind:       gvk.Kind,
+		Name:       obj.GetName(),
+		UID:        obj.GetUID(),
+		Ready:      childReady(obj),
+	})
+}
+
+// inventory returns the observed children, sorted so the status only changes with them.
+func (c *childChanges) inventory() []api.ResourceStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resources := append([]api.ResourceStatus{}, c.resources...)
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Kind != resources[j].Kind {
+			return resources[i].Kind < resources[j].Kind
+		}
+		return resources[i].Name < resources[j].Name
+	})
+	return resources
+}
+
+// childReady reports whether a child reached the state it was applied for. Kinds without
+// a notion of readiness are ready once they exist.
+func childReady(obj client.Object) bool {
+	switch o := obj.(type) {
+	case *appv1.Deployment:
+		progressing, _, _ := deploymentProgress(o)
+		health, _, _ := deploymentHealth(o)
+		return health == healthAvailable && !progressing
+	case *corev1.Service:
+		if o.Spec.Type == corev1.ServiceTypeLoadBalancer {
+			return len(o.Status.LoadBalancer.Ingress) > 0
+		}
+		return true
+	case *networkingv1.Ingress:
+		return len(o.Status.LoadBalancer.Ingress) > 0
+	case *policyv1.PodDisruptionBudget:
+		return o.Status.ObservedGeneration >= o.Generation
+	case *autoscalingv2.HorizontalPodAutoscaler:
+		for _, cond := range o.Status.Conditions {
+			if cond.Type == autoscalingv2.ScalingActive {
+				return cond.Status == corev1.ConditionTrue
+			}
+		}
+		return false
+	}
+	return true
+}
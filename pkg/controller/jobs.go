@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Condition reasons of Job and CronJob workloads.
+const (
+	reasonScheduled    = "Scheduled"
+	reasonRunning      = "Running"
+	reasonRunSucceeded = "RunSucceeded"
+	reasonRunFailed    = "RunFailed"
+)
+
+// batchWorkload reports whether myApp runs as a Job or CronJob.
+func batchWorkload(myApp *api.MyApp) bool {
+	return myApp.Spec.WorkloadType == api.WorkloadJob || myApp.Spec.WorkloadType == api.WorkloadCronJob
+}
+
+// jobSpec runs template to completion with the MyApp's backoff limit.
+func jobSpec(myApp *api.MyApp, template corev1.PodTemplateSpec) batchv1.JobSpec {
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	spec := batchv1.JobSpec{Template: template}
+	if myApp.Spec.Job != nil {
+		spec.BackoffLimit = myApp.Spec.Job.BackoffLimit
+	}
+	return spec
+}
+
+// reconcileBatch creates the Job, or applies the CronJob, of a Job or CronJob workload
+// running template, and triggers a run when the run annotation changed. It returns the
+// most recent run and the run annotation acted on.
+func (c *Controller) reconcileBatch(ctx context.Context, myApp *api.MyApp, template corev1.PodTemplateSpec, changes *childChanges) (*api.JobRunStatus, string, error) {
+	if myApp.Spec.WorkloadType == api.WorkloadCronJob {
+		return c.reconcileCronJob(ctx, myApp, template, changes)
+	}
+	return c.reconcileJob(ctx, myApp, template, changes)
+}
+
+// runTriggered reports whether the run annotation of myApp changed since it was acted on.
+func runTriggered(myApp *api.MyApp) bool {
+	trigger := myApp.Annotations[api.RunAnnotation]
+	return trigger != "" && trigger != myApp.Status.LastRunTrigger
+}
+
+// reconcileJob creates the Job of a Job workload. Its pod template is immutable, so it
+// isn't updated: a run uses the spec at the time it was created. A finished Job is deleted
+// when a run is triggered, and created again once it's gone.
+func (c *Controller) reconcileJob(ctx context.Context, myApp *api.MyApp, template corev1.PodTemplateSpec, changes *childChanges) (*api.JobRunStatus, string, error) {
+	gvk := batchv1.SchemeGroupVersion.WithKind("Job")
+	handled := myApp.Status.LastRunTrigger
+	live := &batchv1.Job{}
+	err := c.getChild(ctx, client.ObjectKeyFromObject(myApp), live)
+	if apierrors.IsNotFound(err) {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: myApp.Namespace,
+				Name:      myApp.Name,
+				Labels:    labelsForMyApp(myApp.Name),
+			},
+			Spec: jobSpec(myApp, template),
+		}
+		if err := ctrl.SetControllerReference(myApp, job, c.manager.GetScheme()); err != nil {
+			return nil, handled, err
+		}
+		if err := c.client.Create(ctx, job); err != nil {
+			childApplyFailures.WithLabelValues(gvk.Kind, applyFailureReason(err)).Inc()
+			return nil, handled, err
+		}
+		changes.record(childCreated, gvk.Kind)
+		changes.observe(job, gvk)
+		// Creating the Job is the run a pending trigger asked for.
+		if trigger := myApp.Annotations[api.RunAnnotation]; trigger != "" {
+			handled = trigger
+		}
+		return jobRun(job), handled, nil
+	}
+	if err != nil {
+		return nil, handled, err
+	}
+	changes.observe(live, gvk)
+	run := jobRun(live)
+	if runTriggered(myApp) && run.Result != api.RunRunning && live.DeletionTimestamp == nil && metav1.IsControlledBy(live, myApp) {
+		// The Job watch requeues the MyApp once the Job is gone.
+		uid := live.UID
+		if err := c.client.Delete(ctx, live, client.Preconditions{UID: &uid}, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return run, handled, err
+		}
+		changes.record(childDeleted, gvk.Kind)
+	}
+	return run, handled, nil
+}
+
+// reconcileCronJob applies the CronJob of a CronJob workload. A triggered run is a Job
+// created from its job template and controlled by it, like kubectl create job --from does,
+// so the CronJob's history limits apply to it.
+func (c *Controller) reconcileCronJob(ctx context.Context, myApp *api.MyApp, template corev1.PodTemplateSpec, changes *childChanges) (*api.JobRunStatus, string, error) {
+	handled := myApp.Status.LastRunTrigger
+	spec := myApp.Spec.Job
+	if spec == nil {
+		spec = &api.JobSpec{}
+	}
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: myApp.Namespace,
+			Name:      myApp.Name,
+			Labels:    labelsForMyApp(myApp.Name),
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   spec.Schedule,
+			ConcurrencyPolicy:          batchv1.ConcurrencyPolicy(spec.ConcurrencyPolicy),
+			SuccessfulJobsHistoryLimit: spec.SuccessfulJobsHistoryLimit,
+			FailedJobsHistoryLimit:     spec.FailedJobsHistoryLimit,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labelsForMyApp(myApp.Name)},
+				Spec:       jobSpec(myApp, template),
+			},
+		},
+	}
+	live, _, err := c.ensureChild(ctx, myApp, cronJob, changes)
+	if err != nil {
+		return nil, handled, err
+	}
+	cronJob = live.(*batchv1.CronJob)
+
+	if runTriggered(myApp) {
+		trigger := myApp.Annotations[api.RunAnnotation]
+		sum := sha256.Sum256([]byte(trigger))
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   myApp.Namespace,
+				Name:        fmt.Sprintf("%s-run-%s", myApp.Name, hex.EncodeToString(sum[:4])),
+				Labels:      labelsForMyApp(myApp.Name),
+				Annotations: map[string]string{"cronjob.kubernetes.io/instantiate": "manual"},
+			},
+			Spec: *cronJob.Spec.JobTemplate.Spec.DeepCopy(),
+		}
+		if err := ctrl.SetControllerReference(cronJob, job, c.manager.GetScheme()); err != nil {
+			return nil, handled, err
+		}
+		// The name is derived from the trigger, so a run isn't started twice when the status
+		// couldn't be written.
+		if err := c.client.Create(ctx, job); err != nil && !apierrors.IsAlreadyExists(err) {
+			childApplyFailures.WithLabelValues("Job", applyFailureReason(err)).Inc()
+			return nil, handled, err
+		}
+		handled = trigger
+	}
+	run, err := c.lastRun(ctx, myApp)
+	return run, handled, err
+}
+
+// lastRun returns the most recent run of myApp, nil if it never ran.
+func (c *Controller) lastRun(ctx context.Context, myApp *api.MyApp) (*api.JobRunStatus, error) {
+	jobs := &batchv1.JobList{}
+	if err := c.client.List(ctx, jobs, client.InNamespace(myApp.Namespace), client.MatchingLabels(labelsForMyApp(myApp.Name))); err != nil {
+		return nil, err
+	}
+	var last *batchv1.Job
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		owner := metav1.GetControllerOf(job)
+		// Other workloads use the app label too, and tasks aren't runs of the workload.
+		if job.Labels[taskLabel] != "" || owner == nil || owner.Name != myApp.Name || owner.Kind != "CronJob" && owner.Kind != "MyApp" {
+			continue
+		}
+		if last == nil || last.CreationTimestamp.Before(&job.CreationTimestamp) {
+			last = job
+		}
+	}
+	if last == nil {
+		return nil, nil
+	}
+	return jobRun(last), nil
+}
+
+// jobRun returns the state of the run of job.
+func jobRun(job *batchv1.Job) *api.JobRunStatus {
+	run := &api.JobRunStatus{
+		JobName:        job.Name,
+		Result:         api.RunRunning,
+		StartTime:      job.Status.StartTime,
+		CompletionTime: job.Status.CompletionTime,
+	}
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			run.Result = api.RunSucceeded
+		case batchv1.JobFailed:
+			run.Result, run.Message = api.RunFailed, cond.Message
+			run.CompletionTime = cond.LastTransitionTime.DeepCopy()
+		}
+	}
+	return run
+}
+
+// jobProgress derives the progress and health of a Job or CronJob workload from its most
+// recent run, like deploymentProgress and deploymentHealth do for Deployments. A CronJob
+// waiting for its next run is healthy.
+func jobProgress(myApp *api.MyApp, run *api.JobRunStatus) (progressing bool, reason, message string, health appHealth, healthReason, healthMessage string) {
+	cron := myApp.Spec.WorkloadType == api.WorkloadCronJob
+	switch {
+	case run == nil && cron:
+		return false, reasonScheduled, "Waiting for the first scheduled run", healthAvailable, "", ""
+	case run == nil:
+		return true, reasonCreating, "Waiting for the job to be created", healthUnknown, "", ""
+	case run.Result == api.RunRunning && cron:
+		return false, reasonScheduled, fmt.Sprintf("Job %s is running", run.JobName), healthAvailable, "", ""
+	case run.Result == api.RunRunning:
+		return true, reasonRunning, fmt.Sprintf("Job %s is running", run.JobName), healthUnknown, "", ""
+	case run.Result == api.RunFailed:
+		message := fmt.Sprintf("Job %s failed: %s", run.JobName, run.Message)
+		return false, reasonRunFailed, message, healthDegraded, reasonRunFailed, message
+	}
+	return false, reasonRunSucceeded, fmt.Sprintf("Job %s succeeded", run.JobName), healthAvailable, "", ""
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/steeling/controller-runtime-exercise/pkg/admin"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// leaderPollInterval is how often the leader election Lease is read.
+const leaderPollInterval = 5 * time.Second
+
+var leaderInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "myapp_leader_info",
+	Help: "Identity of the current leader as seen by this replica, always 1",
+}, []string{"identity"})
+
+func init() {
+	metrics.Registry.MustRegister(leaderInfo)
+}
+
+// leaderObserver follows the holder of the leader election Lease so every replica can
+// report who the leader is. It implements manager.Runnable and runs on every replica.
+type leaderObserver struct {
+	reader  client.Reader
+	lease   types.NamespacedName
+	elected <-chan struct{}
+	log     logr.Logger
+
+	mu       sync.Mutex
+	identity string
+	since    time.Time
+	isLeader bool
+}
+
+// leaderState is served by the /leader admin endpoint.
+type leaderState struct {
+	Identity string    `json:"identity"`
+	Since    time.Time `json:"since,omitempty"`
+	// IsLeader reports whether the replica serving the request is the leader.
+	IsLeader bool `json:"isLeader"`
+}
+
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;patch;delete
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (o *leaderObserver) NeedLeaderElection() bool {
+	return false
+}
+
+func (o *leaderObserver) Start(ctx context.Context) error {
+	started := time.Now()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-o.elected:
+			o.mu.Lock()
+			o.isLeader = true
+			o.mu.Unlock()
+			o.log.Info("became leader", "waited", time.Since(started).Round(time.Second).String())
+		}
+	}()
+
+	ticker := time.NewTicker(leaderPollInterval)
+	defer ticker.Stop()
+	for {
+		o.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *leaderObserver) poll(ctx context.Context) {
+	lease := &coordinationv1.Lease{}
+	if err := o.reader.Get(ctx, o.lease, lease); err != nil {
+		if !errors.Is(err, context.Canceled) {
+			o.log.V(1).Info("unable to read leader election lease", "error", err.Error())
+		}
+		return
+	}
+	identity := ""
+	if lease.Spec.HolderIdentity != nil {
+		identity = *lease.Spec.HolderIdentity
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if identity == o.identity {
+		return
+	}
+	if o.identity != "" {
+		leaderInfo.DeleteLabelValues(o.identity)
+		o.log.Info("leader changed", "previous", o.identity, "leader", identity, "held", time.Since(o.since).Round(time.Second).String())
+	} else {
+		o.log.Info("observed leader", "leader", identity)
+	}
+	o.identity, o.since = identity, time.Now()
+	if identity != "" {
+		leaderInfo.WithLabelValues(identity).Set(1)
+	}
+}
+
+func (o *leaderObserver) state() leaderState {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return leaderState{Identity: o.identity, Since: o.since, IsLeader: o.isLeader}
+}
+
+func (o *leaderObserver) registerAdminEndpoints(server *admin.Server) {
+	server.Handle("/leader", admin.JSON(func(*http.Request) (interface{}, error) {
+		return o.state(), nil
+	}))
+}
+
+// leaderReadyCheck is a readiness check that fails until this replica is elected.
+func leaderReadyCheck(elected <-chan struct{}) func(*http.Request) error {
+	return func(*http.Request) error {
+		select {
+		case <-elected:
+			return nil
+		default:
+			return errors.New("not the leader")
+		}
+	}
+}
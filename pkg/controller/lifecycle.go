@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	"github.com/steeling/controller-runtime-exercise/pkg/cloudevents"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Lifecycle transitions of a MyApp.
+const (
+	lifecycleCreated   = "created"
+	lifecycleUpdated   = "updated"
+	lifecycleAvailable = "available"
+	lifecycleDegraded  = "degraded"
+	lifecycleDeleted   = "deleted"
+
+	eventTypePrefix = "com.example.myapp."
+)
+
+// appHealth is the health of a MyApp as derived from its Deployment.
+type appHealth string
+
+const (
+	healthUnknown   appHealth = ""
+	healthAvailable appHealth = lifecycleAvailable
+	healthDegraded  appHealth = lifecycleDegraded
+)
+
+func (h appHealth) label() string {
+	if h == healthUnknown {
+		return "unknown"
+	}
+	return string(h)
+}
+
+// lifecycleTracker remembers the last observed state of each MyApp so that
+// transitions are reported once rather than on every reconcile.
+type lifecycleTracker struct {
+	mu   sync.Mutex
+	apps map[types.NamespacedName]trackedApp
+}
+
+type trackedApp struct {
+	generation int64
+	health     appHealth
+}
+
+func newLifecycleTracker() *lifecycleTracker {
+	return &lifecycleTracker{apps: map[types.NamespacedName]trackedApp{}}
+}
+
+// observe records the current state of app and returns the transitions since the
+// previous observation. The first observation of an app only reports a transition
+// when created is set, so restarting the controller doesn't replay history.
+func (t *lifecycleTracker) observe(app *api.MyApp, created bool, health appHealth) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := types.NamespacedName{Namespace: app.Namespace, Name: app.Name}
+	prev, seen := t.apps[key]
+	t.apps[key] = trackedApp{generation: app.Generation, health: health}
+	if seen {
+		fleetApps.WithLabelValues(prev.health.label()).Dec()
+	}
+	fleetApps.WithLabelValues(health.label()).Inc()
+
+	var transitions []string
+	if created {
+		transitions = append(transitions, lifecycleCreated)
+	} else if seen && prev.generation != app.Generation {
+		transitions = append(transitions, lifecycleUpdated)
+	}
+	if health != healthUnknown && (created || (seen && prev.health != health)) {
+		transitions = append(transitions, string(health))
+	}
+	return transitions
+}
+
+func (t *lifecycleTracker) forget(key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if prev, ok := t.apps[key]; ok {
+		fleetApps.WithLabelValues(prev.health.label()).Dec()
+		delete(t.apps, key)
+	}
+}
+
+// deploymentHealth maps the Deployment's conditions to the health of the app,
+// along with a reason and message explaining a degraded state.
+func deploymentHealth(d *appv1.Deployment) (appHealth, string, string) {
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appv1.DeploymentProgressing && cond.Status == corev1.ConditionFalse {
+			return healthDegraded, reasonRolloutFailed, cond.Message
+		}
+	}
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appv1.DeploymentAvailable {
+			if cond.Status == corev1.ConditionTrue {
+				return healthAvailable, "", ""
+			}
+			return healthDegraded, reasonUnavailable, cond.Message
+		}
+	}
+	return healthUnknown, "", ""
+}
+
+// lifecycleData is the payload of lifecycle CloudEvents.
+type lifecycleData struct {
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	UID        string `json:"uid,omitempty"`
+	Generation int64  `json:"generation,omitempty"`
+	Image      string `json:"image,omitempty"`
+}
+
+func lifecycleEvent(key types.NamespacedName, transition string, app *api.MyApp) cloudevents.Event {
+	data := lifecycleData{Namespace: key.Namespace, Name: key.Name}
+	if app != nil {
+		data.UID = string(app.UID)
+		data.Generation = app.Generation
+		data.Image = app.Spec.Image
+	}
+	return cloudevents.Event{
+		Type:    eventTypePrefix + transition,
+		Source:  fmt.Sprintf("/apis/%s/namespaces/%s/myapps/%s", api.GroupVersion, key.Namespace, key.Name),
+		Subject: key.String(),
+		Data:    data,
+	}
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// +kubebuilder:rbac:groups="",resources=limitranges,verbs=get;list;watch
+
+// fitLimitRanges adjusts the requests and limits of the containers of the rendered
+// deployment to the min, max and maxLimitRequestRatio of the LimitRanges of the MyApp's
+// namespace, so its pods aren't rejected by the LimitRanger when the ReplicaSet creates
+// them. The values the LimitRanger would default are taken into account. It returns a
+// LimitRangeAdjusted condition listing the adjustments, with reason Violation when some
+// constraints can't be met, nil when the resources fit.
+func (c *Controller) fitLimitRanges(ctx context.Context, myApp *api.MyApp, deployment *appv1.Deployment) (*metav1.Condition, error) {
+	ranges := &corev1.LimitRangeList{}
+	if err := c.client.List(ctx, ranges, client.InNamespace(myApp.Namespace)); err != nil {
+		return nil, err
+	}
+	sort.Slice(ranges.Items, func(i, j int) bool { return ranges.Items[i].Name < ranges.Items[j].Name })
+	var adjusted, violations []string
+	spec := &deployment.Spec.Template.Spec
+	for _, lr := range ranges.Items {
+		for _, item := range lr.Spec.Limits {
+			switch item.Type {
+			case corev1.LimitTypeContainer:
+				for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+					for i := range containers {
+						a, v := fitContainer(&containers[i], lr.Name, item)
+						adjusted, violations = append(adjusted, a...), append(violations, v...)
+					}
+				}
+			case corev1.LimitTypePod:
+				// The containers' shares of a pod constraint are ambiguous, it is only reported.
+				violations = append(violations, podViolations(spec, lr.Name, item)...)
+			}
+		}
+	}
+	if len(adjusted) == 0 && len(violations) == 0 {
+		return nil, nil
+	}
+	cond := &metav1.Condition{
+		Type:               api.ConditionLimitRangeAdjusted,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Adjusted",
+		Message:            "resources adjusted to the namespace's LimitRanges: " + strings.Join(adjusted, "; "),
+		ObservedGeneration: myApp.Generation,
+	}
+	if len(violations) > 0 {
+		cond.Reason = "Violation"
+		cond.Message = "pods would be rejected by the namespace's LimitRanges: " + strings.Join(violations, "; ")
+		if len(adjusted) > 0 {
+			cond.Message += "; adjusted: " + strings.Join(adjusted, "; ")
+		}
+	}
+	return cond, nil
+}
+
+// appsForLimitRange re-renders the MyApps of the namespace of a LimitRange when it changes.
+func (c *Controller) appsForLimitRange(ctx context.Context, lr client.Object) []reconcile.Request {
+	return c.appsInNamespace(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: lr.GetNamespace()}})
+}
+
+// fitContainer adjusts the resources of container to a Container item of the LimitRange
+// named lr. It returns the adjustments and the constraints that can't be met.
+func fitContainer(container *corev1.Container, lr string, item corev1.LimitRangeItem) (adjusted, violations []string) {
+	names := map[corev1.ResourceName]bool{}
+	for _, list := range []corev1.ResourceList{item.Min, item.Max, item.MaxLimitRequestRatio} {
+		for name := range list {
+			names[name] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, string(name))
+	}
+	sort.Strings(sorted)
+
+	for _, n := range sorted {
+		name := corev1.ResourceName(n)
+		// The values the pod is admitted with: the LimitRanger defaults unset limits, and
+		// unset requests to the limit.
+		limit, hadLimit := container.Resources.Limits[name]
+		if !hadLimit {
+			limit, hadLimit = item.Default[name]
+		}
+		request, hadRequest := container.Resources.Requests[name]
+		if !hadRequest {
+			if request, hadRequest = item.DefaultRequest[name]; !hadRequest && hadLimit {
+				request, hadRequest = limit, true
+			}
+		}
+		newRequest, hasRequest := request.DeepCopy(), hadRequest
+		newLimit, hasLimit := limit.DeepCopy(), hadLimit
+
+		if min, ok := item.Min[name]; ok {
+			if !hasRequest || newRequest.Cmp(min) < 0 {
+				newRequest, hasRequest = min.DeepCopy(), true
+			}
+			if hasLimit && newLimit.Cmp(min) < 0 {
+				newLimit = min.DeepCopy()
+			}
+		}
+		max, hasMax := item.Max[name]
+		if hasMax {
+			// A maximum requires a limit.
+			if !hasLimit || newLimit.Cmp(max) > 0 {
+				newLimit, hasLimit = max.DeepCopy(), true
+			}
+			if hasRequest && newRequest.Cmp(max) > 0 {
+				newRequest = max.DeepCopy()
+			}
+		}
+		if hasRequest && hasLimit && newRequest.Cmp(newLimit) > 0 {
+			newLimit = newRequest.DeepCopy()
+		}
+		if ratio, ok := item.MaxLimitRequestRatio[name]; ok && hasRequest && hasLimit && newRequest.MilliValue() > 0 {
+			if float64(newLimit.MilliValue())/float64(newRequest.MilliValue()) > ratio.AsApproximateFloat64() {
+				// The request is raised, rounded up, to the limit divided by the ratio.
+				milli := int64(math.Ceil(float64(newLimit.MilliValue()) / ratio.AsApproximateFloat64()))
+				newRequest = *resource.NewMilliQuantity(milli, newLimit.Format)
+			}
+		}
+		if hasMax && newLimit.Cmp(max) > 0 || hasRequest && hasLimit && newRequest.Cmp(newLimit) > 0 {
+			violations = append(violations, fmt.Sprintf("%s: container %s: the %s min, max and maxLimitRequestRatio can't all be met", lr, container.Name, name))
+			continue
+		}
+
+		if hasRequest && (!hadRequest || !request.Equal(newRequest)) {
+			if container.Resources.Requests == nil {
+				container.Resources.Requests = corev1.ResourceList{}
+			}
+			container.Resources.Requests[name] = newRequest
+			adjusted = append(adjusted, fmt.Sprintf("container %s: %s request %s to %s (%s)", container.Name, name, describe(request, hadRequest), newRequest.String(), lr))
+		}
+		if hasLimit && (!hadLimit || !limit.Equal(newLimit)) {
+			if container.Resources.Limits == nil {
+				container.Resources.Limits = corev1.ResourceList{}
+			}
+			container.Resources.Limits[name] = newLimit
+			adjusted = append(adjusted, fmt.Sprintf("container %s: %s limit %s to %s (%s)", container.Name, name, describe(limit, hadLimit), newLimit.String(), lr))
+		}
+	}
+	return adjusted, violations
+}
+
+func describe(q resource.Quantity, set bool) string {
+	if !set {
+		return "unset"
+	}
+	return "from " + q.String()
+}
+
+func describeValue(q resource.Quantity, set bool) string {
+	if !set {
+		return "unset"
+	}
+	return q.String()
+}
+
+// podViolations returns the Pod constraints of the LimitRange named lr the pods of spec don't meet.
+func podViolations(spec *corev1.PodSpec, lr string, item corev1.LimitRangeItem) []string {
+	requests, limits := podResources(spec)
+	var violations []string
+	for _, check := range []struct {
+		what   string
+		values corev1.ResourceList
+		bound  corev1.ResourceList
+		above  bool
+	}{
+		{"request", requests, item.Min, false},
+		{"limit", limits, item.Max, true},
+	} {
+		for name, bound := range check.bound {
+			value, ok := check.values[name]
+			if !check.above && ok && value.Cmp(bound) < 0 || check.above && (!ok || value.Cmp(bound) > 0) {
+				violations = append(violations, fmt.Sprintf("%s: the pod's %s %s is %s, bound %s", lr, name, check.what, describeValue(value, ok), bound.String()))
+			}
+		}
+	}
+	sort.Strings(violations)
+	return violations
+}
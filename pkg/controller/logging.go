@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// logParserAnnotation on the pod template tells fluent-bit's Kubernetes filter to parse
+	// the containers' lines as JSON.
+	logParserAnnotation = "fluentbit.io/parser"
+	// logConfigHashAnnotation on the pod template rolls the pods when the sidecar's
+	// configuration changes.
+	logConfigHashAnnotation = "myapp.example.com/fluent-bit-config-hash"
+	logVolume               = "app-logs"
+	logConfigVolume         = "fluent-bit-config"
+	// logDir is where the MyApp's container writes its logs with the file output, LOG_FILE
+	// names the file.
+	logDir             = "/var/log/app"
+	logFile            = logDir + "/app.log"
+	logConfigDir       = "/fluent-bit/etc/myapp"
+	logConfigKey       = "fluent-bit.conf"
+	fluentBitContainer = "fluent-bit"
+	defaultLogLevelEnv = "LOG_LEVEL"
+)
+
+func fluentBitConfigName(myApp *api.MyApp) string {
+	return myApp.Name + "-fluent-bit"
+}
+
+// configureLogging sets the logging environment variables of Spec.Logging in the containers
+// of template. With the file output, it adds a fluent-bit sidecar tailing the log file to its
+// stdout, configured by a ConfigMap in the MyApp's namespace.
+func (c *Controller) configureLogging(ctx context.Context, myApp *api.MyApp, template *corev1.PodTemplateSpec, changes *childChanges) error {
+	logging := myApp.Spec.Logging
+	if logging == nil {
+		return nil
+	}
+	format := logging.Format
+	if format == "" {
+		format = api.LogFormatJSON
+	}
+	levelEnv := logging.LevelEnv
+	if levelEnv == "" {
+		levelEnv = defaultLogLevelEnv
+	}
+	env := []corev1.EnvVar{{Name: "LOG_FORMAT", Value: format}}
+	if logging.Level != "" {
+		env = append(env, corev1.EnvVar{Name: levelEnv, Value: logging.Level})
+	}
+	toFile := logging.Output == api.LogOutputFile
+	if toFile {
+		env = append(env, corev1.EnvVar{Name: "LOG_FILE", Value: logFile})
+	}
+	for i := range template.Spec.Containers {
+		container := &template.Spec.Containers[i]
+		container.Env = append(container.Env, env...)
+		if toFile {
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: logVolume, MountPath: logDir})
+		}
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	// The sidecar prints JSON lines whatever the format of the file.
+	if format == api.LogFormatJSON || toFile {
+		template.Annotations[logParserAnnotation] = "json"
+	}
+	if !toFile {
+		return nil
+	}
+
+	config := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: myApp.Namespace,
+			Name:      fluentBitConfigName(myApp),
+			Labels:    map[string]string{generatedConfigMapLabel: "true"},
+		},
+		Data: map[string]string{logConfigKey: fluentBitConfig(format)},
+	}
+	if _, _, err := c.ensureChild(ctx, myApp, config, changes); err != nil {
+		return err
+	}
+	template.Annotations[logConfigHashAnnotation] = bundleHash(config.Data)
+	template.Spec.Volumes = append(template.Spec.Volumes,
+		corev1.Volume{Name: logVolume, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		corev1.Volume{Name: logConfigVolume, VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: config.Name}},
+		}},
+	)
+	// A sidecar init container runs alongside the MyApp's containers and doesn't keep Jobs
+	// from completing. Requires Kubernetes 1.29.
+	always := corev1.ContainerRestartPolicyAlways
+	template.Spec.InitContainers = append(template.Spec.InitContainers, corev1.Container{
+		Name:          fluentBitContainer,
+		Image:         c.fluentBitImage,
+		Args:          []string{"-c", logConfigDir + "/" + logConfigKey},
+		RestartPolicy: &always,
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("32Mi"),
+			},
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: logVolume, MountPath: logDir, ReadOnly: true},
+			{Name: logConfigVolume, MountPath: logConfigDir, ReadOnly: true},
+		},
+	})
+	return nil
+}
+
+// fluentBitConfig tails the log file to stdout as JSON lines, parsing JSON logs so their
+// fields aren't nested in a string.
+func fluentBitConfig(format string) string {
+	parser := ""
+	if format == api.LogFormatJSON {
+		parser = "    Parser           json\n"
+	}
+	return fmt.Sprintf(`[SERVICE]
+    Flush            1
+    Log_Level        warn
+    Parsers_File     /fluent-bit/etc/parsers.conf
+
+[INPUT]
+    Name             tail
+    Path             %s
+    Read_from_Head   true
+    Refresh_Interval 5
+%s
+[OUTPUT]
+    Name             stdout
+    Match            *
+    Format           json_lines
+`, logFile, parser)
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// logSampleWindow is the period the per-MyApp log budget applies to.
+const logSampleWindow = time.Minute
+
+var hotReconciles = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "myapp_reconcile_hot_loops_total",
+	Help: "Number of minutes a MyApp was reconciled more often than its log budget allows, typically because another controller keeps reverting its children",
+}, []string{"namespace", "name"})
+
+func init() {
+	metrics.Registry.MustRegister(hotReconciles)
+}
+
+// logSampler limits the number of reconciles per MyApp and minute whose logs are written,
+// so a MyApp in a hot loop doesn't flood the logs. The messages of the reconciles over the
+// budget are counted and summarized once the window is over. A nil *logSampler logs
+// everything.
+type logSampler struct {
+	// budget is the number of reconciles per MyApp and window that are logged.
+	budget int
+
+	mu     sync.Mutex
+	states map[types.NamespacedName]*sampleState
+}
+
+type sampleState struct {
+	windowStart time.Time
+	reconciles  int
+	// suppressed counts the messages dropped in the window. It is shared with the sinks
+	// of the window's reconciles, which may still be logging.
+	suppressed *suppressedCount
+}
+
+type suppressedCount struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *suppressedCount) inc() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+}
+
+func (c *suppressedCount) get() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+// newLogSampler returns nil when budget is 0.
+func newLogSampler(budget int) *logSampler {
+	if budget <= 0 {
+		return nil
+	}
+	return &logSampler{budget: budget, states: map[types.NamespacedName]*sampleState{}}
+}
+
+// reconciler discards the logs of the reconciles of r that exceed the budget.
+func (s *logSampler) reconciler(r reconcile.Reconciler) reconcile.Reconciler {
+	if s == nil {
+		return r
+	}
+	return reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+		if suppressed := s.sample(ctx, req.NamespacedName, time.Now()); suppressed != nil {
+			logger := log.FromContext(ctx)
+			ctx = log.IntoContext(ctx, logr.New(&countingSink{LogSink: logger.GetSink(), count: suppressed}))
+		}
+		return r.Reconcile(ctx, req)
+	})
+}
+
+// sample counts a reconcile of key. It returns the counter of suppressed messages when the
+// reconcile exceeds the budget, nil when it is logged.
+func (s *logSampler) sample(ctx context.Context, key types.NamespacedName, now time.Time) *suppressedCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[key]
+	if !ok || now.Sub(state.windowStart) >= logSampleWindow {
+		if ok && state.reconciles > s.budget {
+			log.FromContext(ctx).Info("suppressed similar messages", "suppressed", state.suppressed.get(),
+				"reconciles", state.reconciles, "window", logSampleWindow)
+		}
+		state = &sampleState{windowStart: now, suppressed: &suppressedCount{}}
+		s.states[key] = state
+	}
+	state.reconciles++
+	if state.reconciles <= s.budget {
+		return nil
+	}
+	if state.reconciles == s.budget+1 {
+		hotReconciles.WithLabelValues(key.Namespace, key.Name).Inc()
+		log.FromContext(ctx).Info("MyApp is reconciled too often, suppressing its logs for the rest of the window",
+			"budget", s.budget, "window", logSampleWindow)
+	}
+	return state.suppressed
+}
+
+// forget drops the state of a deleted MyApp.
+func (s *logSampler) forget(key types.NamespacedName) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, key)
+	hotReconciles.DeleteLabelValues(key.Namespace, key.Name)
+}
+
+// countingSink drops the messages it would write and counts them.
+type countingSink struct {
+	logr.LogSink
+	count *suppressedCount
+}
+
+func (s *countingSink) Info(int, string, ...interface{}) {
+	s.count.inc()
+}
+
+func (s *countingSink) Error(error, string, ...interface{}) {
+	s.count.inc()
+}
+
+func (s *countingSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &countingSink{LogSink: s.LogSink.WithValues(keysAndValues...), count: s.count}
+}
+
+func (s *countingSink) WithName(name string) logr.LogSink {
+	return &countingSink{LogSink: s.LogSink.WithName(name), count: s.count}
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// changeFreeze is an active MaintenanceWindow.
+type changeFreeze struct {
+	window string
+	until  time.Time
+}
+
+// activeFreeze returns the MaintenanceWindow freezing changes in namespace at now, if any,
+// and otherwise when the next window selecting namespace starts. next is zero when none is scheduled.
+func (c *Controller) activeFreeze(ctx context.Context, namespace string, now time.Time) (*changeFreeze, time.Time, error) {
+	windows := &api.MaintenanceWindowList{}
+	if err := c.client.List(ctx, windows); err != nil {
+		return nil, time.Time{}, err
+	}
+	var (
+		freeze *changeFreeze
+		next   time.Time
+		ns     *corev1.Namespace
+	)
+	for _, w := range windows.Items {
+		if w.Spec.NamespaceSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(w.Spec.NamespaceSelector)
+			if err != nil {
+				ctrl.LoggerFrom(ctx).Error(err, "ignoring MaintenanceWindow with an invalid namespace selector", "window", w.Name)
+				continue
+			}
+			if ns == nil {
+				ns = &corev1.Namespace{}
+				if err := c.client.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+					return nil, time.Time{}, err
+				}
+			}
+			if !selector.Matches(labels.Set(ns.Labels)) {
+				continue
+			}
+		}
+		for _, r := range w.Spec.Ranges {
+			switch {
+			case !now.Before(r.Start.Time) && now.Before(r.End.Time):
+				if freeze == nil || r.End.After(freeze.until) {
+					freeze = &changeFreeze{window: w.Name, until: r.End.Time}
+				}
+			case r.Start.After(now):
+				if next.IsZero() || r.Start.Time.Before(next) {
+					next = r.Start.Time
+				}
+			}
+		}
+	}
+	return freeze, next, nil
+}
+
+// observeChildren reads the MyApp's Deployment without applying any child.
+func (c *Controller) observeChildren(ctx context.Context, myApp *api.MyApp) (*childrenState, error) {
+	state := &childrenState{lastRunTrigger: myApp.Status.LastRunTrigger, taskTrigger: myApp.Status.LastTaskTrigger}
+	var err error
+	// Triggered runs and tasks are deferred too.
+	if state.tasks, err = c.taskStatuses(ctx, myApp); err != nil {
+		return nil, err
+	}
+	if batchWorkload(myApp) {
+		state.lastRun, err = c.lastRun(ctx, myApp)
+		return state, err
+	}
+	deployment := &appv1.Deployment{}
+	err = c.getChild(ctx, client.ObjectKeyFromObject(myApp), deployment)
+	if err == nil {
+		state.deployment = deployment
+	}
+	return state, client.IgnoreNotFound(err)
+}
+
+func changeFrozenCondition(app *api.MyApp, freeze *changeFreeze) metav1.Condition {
+	return metav1.Condition{
+		Type:               api.ConditionChangeFrozen,
+		Status:             metav1.ConditionTrue,
+		Reason:             "MaintenanceWindow",
+		Message:            "Changes are deferred by MaintenanceWindow " + freeze.window + " until " + freeze.until.UTC().Format(time.RFC3339),
+		ObservedGeneration: app.Generation,
+	}
+}
+
+// appsForMaintenanceWindow requeues every MyApp when a MaintenanceWindow changes, to freeze
+// or resume them.
+func (c *Controller) appsForMaintenanceWindow(ctx context.Context, _ client.Object) []reconcile.Request {
+	apps := &api.MyAppList{}
+	if err := c.client.List(ctx, apps); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to list MyApps for MaintenanceWindow")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(apps.Items))
+	for _, app := range apps.Items {
+		key := client.ObjectKeyFromObject(&app)
+		if c.shard.owns(key) {
+			requests = append(requests, reconcile.Request{NamespacedName: key})
+		}
+	}
+	return requests
+}
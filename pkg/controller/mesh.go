@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// fieldOwner is the server-side apply field manager used for generated objects.
+	fieldOwner = "my-app-controller"
+
+	istioInjectLabel        = "sidecar.istio.io/inject"
+	linkerdInjectAnnotation = "linkerd.io/inject"
+
+	defaultMTLSMode = "STRICT"
+)
+
+var (
+	peerAuthenticationGVK = schema.GroupVersionKind{Group: "security.istio.io", Version: "v1beta1", Kind: "PeerAuthentication"}
+	destinationRuleGVK    = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1beta1", Kind: "DestinationRule"}
+)
+
+// injectMesh adds the sidecar injection label or annotation for the app's mesh to the pod template.
+func injectMesh(app *api.MyApp, template *corev1.PodTemplateSpec) {
+	mesh := app.Spec.ServiceMesh
+	if mesh == nil {
+		return
+	}
+	switch mesh.Provider {
+	case api.MeshIstio:
+		if template.Labels == nil {
+			template.Labels = map[string]string{}
+		}
+		template.Labels[istioInjectLabel] = "true"
+	case api.MeshLinkerd:
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[linkerdInjectAnnotation] = "enabled"
+	}
+}
+
+// meshObjects renders the Istio policy objects for app. Linkerd needs none.
+func meshObjects(app *api.MyApp) []*unstructured.Unstructured {
+	mesh := app.Spec.ServiceMesh
+	if mesh == nil || mesh.Provider != api.MeshIstio {
+		return nil
+	}
+	mode := mesh.MTLSMode
+	if mode == "" {
+		mode = defaultMTLSMode
+	}
+
+	peerAuth := newUnstructured(peerAuthenticationGVK, app.Namespace, app.Name)
+	peerAuth.Object["spec"] = map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchLabels": toInterfaceMap(labelsForMyApp(app.Name)),
+		},
+		"mtls": map[string]interface{}{"mode": mode},
+	}
+
+	trafficPolicy := map[string]interface{}{
+		"tls": map[string]interface{}{"mode": "ISTIO_MUTUAL"},
+	}
+	if warmup := app.Spec.Warmup; warmup != nil && warmup.SlowStartSeconds > 0 {
+		// Slow start requires the ROUND_ROBIN or LEAST_REQUEST load balancer, the latter is Istio's default.
+		trafficPolicy["loadBalancer"] = map[string]interface{}{
+			"simple":             "LEAST_REQUEST",
+			"warmupDurationSecs": fmt.Sprintf("%ds", warmup.SlowStartSeconds),
+		}
+	}
+	destRule := newUnstructured(destinationRuleGVK, app.Namespace, app.Name)
+	destRule.Object["spec"] = map[string]interface{}{
+		"host":          fmt.Sprintf("%s.%s.svc.cluster.local", app.Name, app.Namespace),
+		"trafficPolicy": trafficPolicy,
+	}
+	return []*unstructured.Unstructured{peerAuth, destRule}
+}
+
+// +kubebuilder:rbac:groups=security.istio.io,resources=peerauthentications,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.istio.io,resources=destinationrules,verbs=get;list;watch;create;update;patch;delete
+
+// applyMeshObjects applies the Istio objects for app, skipping kinds whose CRDs aren't installed.
+func (c *Controller) applyMeshObjects(ctx context.Context, app *api.MyApp, changes *childChanges) error {
+	for _, obj := range meshObjects(app) {
+		installed, err := c.kindInstalled(obj.GroupVersionKind())
+		if err != nil {
+			return err
+		}
+		if !installed {
+			log := ctrl.LoggerFrom(ctx)
+			log.V(1).Info("mesh CRD not installed, skipping", "kind", obj.GetKind())
+			continue
+		}
+		if err := ctrl.SetControllerReference(app, obj, c.manager.GetScheme()); err != nil {
+			return err
+		}
+		if err := c.client.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+			childApplyFailures.WithLabelValues(obj.GetKind(), applyFailureReason(err)).Inc()
+			return fmt.Errorf("applying %s: %w", obj.GetKind(), err)
+		}
+		changes.observe(obj, obj.GroupVersionKind())
+	}
+	return nil
+}
+
+// kindInstalled reports whether the API server serves gvk.
+func (c *Controller) kindInstalled(gvk schema.GroupVersionKind) (bool, error) {
+	_, err := c.client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func newUnstructured(gvk schema.GroupVersionKind, namespace, name string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	return u
+}
+
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// migrationPageSize is the number of objects listed at a time while migrating.
+	migrationPageSize = 100
+	// migrationRetryInterval is how often a failed migration is retried.
+	migrationRetryInterval = 5 * time.Minute
+)
+
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=update
+// +kubebuilder:rbac:groups=example.com,resources=myapps;myappaudits;myappbackups;myapprestores;myapppreviews;myapptemplates;maintenancewindows,verbs=list;update
+
+// storageMigrator rewrites the objects of the operator's CRDs stored in a version other than
+// the storage version, then drops the other versions from the CRD's status.storedVersions.
+// A version still listed there can't be removed from the CRD, so without the migration the
+// next upgrade removing it would be stuck.
+type storageMigrator struct {
+	client client.Client
+	// reader reads around the cache, objects are migrated once.
+	reader client.Reader
+	log    logr.Logger
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable; the leader migrates the
+// objects once for every replica.
+func (m *storageMigrator) NeedLeaderElection() bool {
+	return true
+}
+
+func (m *storageMigrator) Start(ctx context.Context) error {
+	crds, err := embeddedCRDs()
+	if err != nil {
+		return err
+	}
+	pending := make([]string, 0, len(crds))
+	for _, crd := range crds {
+		pending = append(pending, crd.Name)
+	}
+	ticker := time.NewTicker(migrationRetryInterval)
+	defer ticker.Stop()
+	for {
+		var failed []string
+		for _, name := range pending {
+			if err := m.migrate(ctx, name); err != nil {
+				m.log.Error(err, "unable to migrate stored versions, retrying later", "crd", name)
+				failed = append(failed, name)
+			}
+		}
+		if pending = failed; len(pending) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// migrate rewrites the objects of the CRD name in its storage version.
+func (m *storageMigrator) migrate(ctx context.Context, name string) error {
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := m.reader.Get(ctx, client.ObjectKey{Name: name}, crd); err != nil {
+		// Optional CRDs, e.g. the backup ones, may not be installed.
+		return client.IgnoreNotFound(err)
+	}
+	storage := storageVersion(crd)
+	if len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == storage {
+		return nil
+	}
+	m.log.Info("migrating objects to the storage version", "crd", name, "storageVersion", storage, "storedVersions", crd.Status.StoredVersions)
+
+	gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: storage, Kind: crd.Spec.Names.ListKind}
+	migrated := 0
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk)
+	for {
+		if err := m.reader.List(ctx, list, client.Limit(migrationPageSize), client.Continue(list.GetContinue())); err != nil {
+			return fmt.Errorf("listing %s: %w", crd.Spec.Names.Plural, err)
+		}
+		for i := range list.Items {
+			// Writing the object unchanged stores it in the storage version. Objects changed
+			// or deleted since they were listed were written already, or are gone.
+			err := m.client.Update(ctx, &list.Items[i])
+			if err != nil && !apierrors.IsConflict(err) && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("rewriting %s %s: %w", crd.Spec.Names.Kind, client.ObjectKeyFromObject(&list.Items[i]), err)
+			}
+			migrated++
+		}
+		if list.GetContinue() == "" {
+			break
+		}
+	}
+
+	crd.Status.StoredVersions = []string{storage}
+	if err := m.client.Status().Update(ctx, crd); err != nil {
+		return fmt.Errorf("updating the stored versions: %w", err)
+	}
+	m.log.Info("migrated objects to the storage version", "crd", name, "storageVersion", storage, "objects", migrated)
+	return nil
+}
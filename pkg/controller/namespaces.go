@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// namespaceFilter restricts the namespaces whose MyApps are reconciled. A nil *namespaceFilter
+// allows every namespace.
+type namespaceFilter struct {
+	// selector matches the labels of allowed namespaces. nil allows every namespace.
+	selector labels.Selector
+	excluded map[string]bool
+	reader   client.Reader
+}
+
+// newNamespaceFilter parses a label selector and a comma separated list of excluded
+// namespaces. It returns nil when neither is set.
+func newNamespaceFilter(selector, exclude string) (*namespaceFilter, error) {
+	f := &namespaceFilter{excluded: map[string]bool{}}
+	if selector != "" {
+		s, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector %q: %w", selector, err)
+		}
+		f.selector = s
+	}
+	for _, ns := range strings.Split(exclude, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			f.excluded[ns] = true
+		}
+	}
+	if f.selector == nil && len(f.excluded) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// fieldSelector keeps objects in excluded namespaces out of the cache. It is nil when no
+// namespace is excluded.
+func (f *namespaceFilter) fieldSelector() fields.Selector {
+	if f == nil || len(f.excluded) == 0 {
+		return nil
+	}
+	selectors := make([]fields.Selector, 0, len(f.excluded))
+	for ns := range f.excluded {
+		selectors = append(selectors, fields.OneTermNotEqualSelector("metadata.namespace", ns))
+	}
+	return fields.AndSelectors(selectors...)
+}
+
+// allowed reports whether the MyApps in namespace are reconciled.
+func (f *namespaceFilter) allowed(ctx context.Context, namespace string) (bool, error) {
+	if f == nil {
+		return true, nil
+	}
+	if f.excluded[namespace] {
+		return false, nil
+	}
+	if f.selector == nil {
+		return true, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := f.reader.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		return false, err
+	}
+	return f.selector.Matches(labels.Set(ns.Labels)), nil
+}
+
+// predicate drops events of objects in namespaces that aren't allowed. Cluster scoped objects
+// pass, their handlers map them to MyApps. Events are let through when the namespace can't be
+// read, the reconcile checks again.
+func (f *namespaceFilter) predicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		if f == nil || obj.GetNamespace() == "" {
+			return true
+		}
+		allowed, err := f.allowed(context.Background(), obj.GetNamespace())
+		return allowed || err != nil
+	})
+}
+
+// namespaceLabelsChanged passes Namespace updates that change its labels.
+func namespaceLabelsChanged() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return !labels.Equals(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels())
+		},
+	}
+}
+
+// appsInNamespace requeues the MyApps of a namespace whose labels changed, so they are picked
+// up once the namespace matches the selector, and follow its pod security level.
+func (c *Controller) appsInNamespace(ctx context.Context, ns client.Object) []reconcile.Request {
+	apps := &api.MyAppList{}
+	if err := c.client.List(ctx, apps, client.InNamespace(ns.GetName())); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to list MyApps in namespace", "namespace", ns.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(apps.Items))
+	for _, app := range apps.Items {
+		key := client.ObjectKeyFromObject(&app)
+		if c.shard.owns(key) {
+			requests = append(requests, reconcile.Request{NamespacedName: key})
+		}
+	}
+	return requests
+}
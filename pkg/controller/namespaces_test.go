@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func TestCacheOptions(t *testing.T) {
+	filter, err := newNamespaceFilter("", "tenant-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := cacheOptions(filter)
+	if opts.DefaultFieldSelector != nil {
+		t.Errorf("DefaultFieldSelector = %s, want none, it applies to cluster scoped objects", opts.DefaultFieldSelector)
+	}
+	all, ok := opts.DefaultNamespaces[cache.AllNamespaces]
+	if !ok || all.FieldSelector == nil || all.FieldSelector.String() != "metadata.namespace!=tenant-b" {
+		t.Errorf("DefaultNamespaces = %v, want all namespaces but tenant-b", opts.DefaultNamespaces)
+	}
+	for obj := range opts.ByObject {
+		if _, ok := obj.(*corev1.ConfigMap); !ok || len(opts.ByObject) != 1 {
+			t.Errorf("ByObject = %v, want the ConfigMap restriction only", opts.ByObject)
+		}
+	}
+
+	if opts := cacheOptions(nil); opts.DefaultNamespaces != nil {
+		t.Errorf("DefaultNamespaces without a filter = %v, want none", opts.DefaultNamespaces)
+	}
+}
+
+// TestCacheExcludedNamespaces runs against the API server and etcd of envtest, installed
+// with `setup-envtest use -p path` into the directory KUBEBUILDER_ASSETS points to.
+func TestCacheExcludedNamespaces(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is unset")
+	}
+	env := &envtest.Environment{}
+	cfg, err := env.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Stop()
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, ns := range []string{"tenant-a", "tenant-b"} {
+		if err := cl.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}); err != nil {
+			t.Fatal(err)
+		}
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "web-ca-bundle", Labels: map[string]string{generatedConfigMapLabel: "true"}}}
+		if err := cl.Create(ctx, cm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter, err := newNamespaceFilter("", "tenant-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := cacheOptions(filter)
+	opts.Scheme = scheme
+	c, err := cache.New(cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Namespaces and Nodes are cluster scoped, ConfigMaps namespaced.
+	for _, obj := range []client.Object{&corev1.Namespace{}, &corev1.Node{}, &corev1.ConfigMap{}} {
+		if _, err := c.GetInformer(ctx, obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go func() {
+		if err := c.Start(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	if !c.WaitForCacheSync(ctx) {
+		t.Fatal("the cache didn't sync")
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	if err := c.List(ctx, namespaces); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, ns := range namespaces.Items {
+		found = found || ns.Name == "tenant-b"
+	}
+	if !found {
+		t.Error("the excluded tenant-b Namespace isn't cached, cluster scoped objects are cached whatever their name")
+	}
+
+	configMaps := &corev1.ConfigMapList{}
+	if err := c.List(ctx, configMaps); err != nil {
+		t.Fatal(err)
+	}
+	if len(configMaps.Items) != 1 || configMaps.Items[0].Namespace != "tenant-a" {
+		t.Errorf("cached %d ConfigMaps, want the one in tenant-a only", len(configMaps.Items))
+	}
+}
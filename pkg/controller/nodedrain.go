@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+
+// nodeCordonChanged passes Node updates that cordon or uncordon it.
+func nodeCordonChanged() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.ObjectOld.(*corev1.Node).Spec.Unschedulable != e.ObjectNew.(*corev1.Node).Spec.Unschedulable
+		},
+	}
+}
+
+// appsOnNode requeues the MyApps with pods on a cordoned or uncordoned Node. The pods are
+// read directly so the operator doesn't have to cache every pod in the cluster.
+func (c *Controller) appsOnNode(ctx context.Context, node client.Object) []reconcile.Request {
+	pods := &corev1.PodList{}
+	if err := c.manager.GetAPIReader().List(ctx, pods, client.MatchingFieldsSelector{
+		Selector: fields.OneTermEqualSelector("spec.nodeName", node.GetName()),
+	}); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to list the pods of Node", "name", node.GetName())
+		return nil
+	}
+	seen := map[types.NamespacedName]bool{}
+	var requests []reconcile.Request
+	for _, pod := range pods.Items {
+		key := types.NamespacedName{Namespace: pod.Namespace, Name: pod.Labels["app"]}
+		if key.Name == "" || seen[key] || !c.shard.owns(key) {
+			continue
+		}
+		seen[key] = true
+		// Other workloads use the app label too.
+		if err := c.client.Get(ctx, key, &api.MyApp{}); err != nil {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: key})
+	}
+	return requests
+}
+
+// drainSurge pre-scales the MyApp by its pods on cordoned Nodes, up to the operator's
+// maximum surge, so the drains evicting them aren't held up by its PodDisruptionBudget.
+// Replicas are restored once the pods moved. myApp's spec is modified in memory only
+// and must not be written back. It returns the NodeDrain condition, nil when the MyApp
+// isn't pre-scaled.
+func (c *Controller) drainSurge(ctx context.Context, myApp *api.MyApp) (*metav1.Condition, error) {
+	if c.drainMaxSurge <= 0 {
+		return nil, nil
+	}
+	nodes := &corev1.NodeList{}
+	if err := c.client.List(ctx, nodes); err != nil {
+		return nil, err
+	}
+	cordoned := map[string]bool{}
+	for _, node := range nodes.Items {
+		if node.Spec.Unschedulable {
+			cordoned[node.Name] = true
+		}
+	}
+	if len(cordoned) == 0 {
+		return nil, nil
+	}
+	pods := &corev1.PodList{}
+	if err := c.manager.GetAPIReader().List(ctx, pods, client.InNamespace(myApp.Namespace), client.MatchingLabels(labelsForMyApp(myApp.Name))); err != nil {
+		return nil, err
+	}
+	var draining int32
+	for _, pod := range pods.Items {
+		if cordoned[pod.Spec.NodeName] && pod.DeletionTimestamp.IsZero() {
+			draining++
+		}
+	}
+	if draining == 0 {
+		return nil, nil
+	}
+	surge := min(draining, int32(c.drainMaxSurge))
+	if myApp.Spec.Autoscaling != nil {
+		autoscaling := &api.AutoscalingSpec{}
+		myApp.Spec.Autoscaling.DeepCopyInto(autoscaling)
+		minReplicas := min(*autoscaling.MinReplicas+surge, autoscaling.MaxReplicas)
+		autoscaling.MinReplicas = &minReplicas
+		myApp.Spec.Autoscaling = autoscaling
+	} else {
+		replicas := c.replicas.clamp(*myApp.Spec.Replicas + surge)
+		myApp.Spec.Replicas = &replicas
+	}
+	return &metav1.Condition{
+		Type:               api.ConditionNodeDrain,
+		Status:             metav1.ConditionTrue,
+		Reason:             "PreScaled",
+		Message:            fmt.Sprintf("Scaled up by %d replicas while %d pods are on cordoned Nodes", surge, draining),
+		ObservedGeneration: myApp.Generation,
+	}, nil
+}
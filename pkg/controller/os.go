@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// windowsTaint is the taint Windows nodes commonly carry, so Linux pods aren't scheduled on them.
+	windowsTaint = "os"
+	// windowsNonRootUser is the built-in unprivileged user of Windows containers.
+	windowsNonRootUser = "ContainerUser"
+)
+
+// configureOS schedules the pods on nodes of the MyApp's OS. For Windows, the Linux-only
+// fields of the container's security context, e.g. inherited from a MyAppTemplate, are
+// dropped, as the API server rejects them, and runAsNonRoot runs the container as the
+// unprivileged ContainerUser.
+func configureOS(myApp *api.MyApp, template *corev1.PodTemplateSpec) {
+	if myApp.Spec.OS == "" {
+		return
+	}
+	os := corev1.OSName(myApp.Spec.OS)
+	template.Spec.OS = &corev1.PodOS{Name: os}
+	if template.Spec.NodeSelector == nil {
+		template.Spec.NodeSelector = map[string]string{}
+	}
+	template.Spec.NodeSelector[corev1.LabelOSStable] = string(os)
+	if os != corev1.Windows {
+		return
+	}
+	template.Spec.Tolerations = append(template.Spec.Tolerations, corev1.Toleration{
+		Key:      windowsTaint,
+		Operator: corev1.TolerationOpEqual,
+		Value:    string(corev1.Windows),
+		Effect:   corev1.TaintEffectNoSchedule,
+	})
+	for i := range template.Spec.Containers {
+		if sc := template.Spec.Containers[i].SecurityContext; sc != nil {
+			template.Spec.Containers[i].SecurityContext = windowsSecurityContext(sc)
+		}
+	}
+}
+
+// windowsSecurityContext returns sc without its Linux-only fields.
+func windowsSecurityContext(sc *corev1.SecurityContext) *corev1.SecurityContext {
+	out := &corev1.SecurityContext{
+		WindowsOptions: sc.WindowsOptions.DeepCopy(),
+		RunAsNonRoot:   sc.RunAsNonRoot,
+	}
+	if sc.RunAsNonRoot != nil && *sc.RunAsNonRoot && (out.WindowsOptions == nil || out.WindowsOptions.RunAsUserName == nil) {
+		if out.WindowsOptions == nil {
+			out.WindowsOptions = &corev1.WindowsSecurityContextOptions{}
+		}
+		user := windowsNonRootUser
+		out.WindowsOptions.RunAsUserName = &user
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	psaapi "k8s.io/pod-security-admission/api"
+	"k8s.io/pod-security-admission/policy"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// podSecurityEvaluator evaluates pods with the checks of the PodSecurity admission plugin.
+var podSecurityEvaluator = func() policy.Evaluator {
+	evaluator, err := policy.NewEvaluator(policy.DefaultChecks())
+	if err != nil {
+		panic(err)
+	}
+	return evaluator
+}()
+
+// checkPodPolicies returns a PolicyViolation condition when pods of template would be
+// rejected. The denial of an admission dry run, which covers PodSecurity admission too,
+// takes precedence over the PodSecurity evaluation.
+func (c *Controller) checkPodPolicies(ctx context.Context, myApp *api.MyApp, template *corev1.PodTemplateSpec) (*metav1.Condition, error) {
+	denied, err := c.dryRuns.check(ctx, myApp, template)
+	if err != nil || denied != nil {
+		return denied, err
+	}
+	return c.checkPodSecurity(ctx, myApp, template)
+}
+
+// checkPodSecurity evaluates the rendered pod template against the level the MyApp's
+// namespace enforces with its pod-security.kubernetes.io labels, as PodSecurity admission
+// will when the pods are created. It returns a PolicyViolation condition naming the fields
+// that would be rejected, nil when the pods are allowed. Namespaces without the labels are
+// assumed privileged, the default of the admission plugin.
+func (c *Controller) checkPodSecurity(ctx context.Context, myApp *api.MyApp, template *corev1.PodTemplateSpec) (*metav1.Condition, error) {
+	ns := &corev1.Namespace{}
+	if err := c.client.Get(ctx, client.ObjectKey{Name: myApp.Namespace}, ns); err != nil {
+		return nil, err
+	}
+	defaults := psaapi.Policy{
+		Enforce: psaapi.LevelVersion{Level: psaapi.LevelPrivileged, Version: psaapi.LatestVersion()},
+	}
+	// Invalid labels fall back to restricted, as in the admission plugin.
+	p, _ := psaapi.PolicyToEvaluate(ns.Labels, defaults)
+	if p.Enforce.Level == psaapi.LevelPrivileged {
+		return nil, nil
+	}
+	result := policy.AggregateCheckResults(podSecurityEvaluator.EvaluatePod(p.Enforce, &template.ObjectMeta, &template.Spec))
+	if result.Allowed {
+		return nil, nil
+	}
+	return &metav1.Condition{
+		Type:               api.ConditionPolicyViolation,
+		Status:             metav1.ConditionTrue,
+		Reason:             "PodSecurity",
+		Message:            fmt.Sprintf("pods would be rejected by the %q pod security level of namespace %s: %s", p.Enforce.String(), ns.Name, result.ForbiddenDetail()),
+		ObservedGeneration: myApp.Generation,
+	}, nil
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Continuous profilers of profilingConfig.Provider.
+const (
+	profilerPyroscope = "pyroscope"
+	profilerParca     = "parca"
+)
+
+// profilingConfig is how the pods of MyApps enabling continuous profiling are set up for the
+// operator's profiler.
+type profilingConfig struct {
+	// Provider is pyroscope, whose agents are told where to push to and whose scrapers pull
+	// the pods annotated for it, or parca, whose scrapers pull the pods annotated for it.
+	Provider string `json:"provider"`
+	// ServerAddress is the profiling server the Pyroscope SDKs push profiles to.
+	ServerAddress string `json:"serverAddress,omitempty"`
+	// Annotations are added to the pods, over the provider's.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Env is added to the MyApp's containers and the sidecar.
+	Env map[string]string `json:"env,omitempty"`
+	// Sidecar is an agent container running alongside the MyApp's, for runtimes profiled out
+	// of process.
+	Sidecar *corev1.Container `json:"sidecar,omitempty"`
+}
+
+// loadProfilingConfig reads file, a YAML profilingConfig. Profiling isn't configured when
+// file is empty.
+func loadProfilingConfig(file string) (*profilingConfig, error) {
+	if file == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	config := &profilingConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("parsing profiling config %s: %w", file, err)
+	}
+	if config.Provider != profilerPyroscope && config.Provider != profilerParca {
+		return nil, fmt.Errorf("profiling config %s: unknown provider %q, want pyroscope or parca", file, config.Provider)
+	}
+	if config.Sidecar != nil && config.Sidecar.Name == "" {
+		return nil, fmt.Errorf("profiling config %s: the sidecar has no name", file)
+	}
+	return config, nil
+}
+
+// configureProfiling sets template up for the operator's profiler when myApp enables
+// continuous profiling.
+func configureProfiling(myApp *api.MyApp, template *corev1.PodTemplateSpec, config *profilingConfig) error {
+	if myApp.Spec.Profiling == nil || !myApp.Spec.Profiling.Enabled {
+		return nil
+	}
+	if config == nil {
+		return fmt.Errorf("continuous profiling is not configured by the operator")
+	}
+	annotations := map[string]string{}
+	values := map[string]string{}
+	switch config.Provider {
+	case profilerPyroscope:
+		annotations["profiles.grafana.com/cpu.scrape"] = "true"
+		annotations["profiles.grafana.com/memory.scrape"] = "true"
+		values["PYROSCOPE_APPLICATION_NAME"] = myApp.Namespace + "/" + myApp.Name
+		if config.ServerAddress != "" {
+			values["PYROSCOPE_SERVER_ADDRESS"] = config.ServerAddress
+		}
+	case profilerParca:
+		annotations["parca.dev/scrape"] = "true"
+	}
+	for key, value := range config.Annotations {
+		annotations[key] = value
+	}
+	for name, value := range config.Env {
+		values[name] = value
+	}
+
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	for key, value := range annotations {
+		template.Annotations[key] = value
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	// Sorted, so the rendered pods don't change between reconciles.
+	sort.Strings(names)
+	env := make([]corev1.EnvVar, 0, len(names))
+	for _, name := range names {
+		env = append(env, corev1.EnvVar{Name: name, Value: values[name]})
+	}
+	for i := range template.Spec.Containers {
+		template.Spec.Containers[i].Env = append(template.Spec.Containers[i].Env, env...)
+	}
+	if config.Sidecar != nil {
+		sidecar := config.Sidecar.DeepCopy()
+		sidecar.Env = append(sidecar.Env, env...)
+		// A sidecar init container doesn't keep Jobs from completing.
+		always := corev1.ContainerRestartPolicyAlways
+		sidecar.RestartPolicy = &always
+		template.Spec.InitContainers = append(template.Spec.InitContainers, *sidecar)
+	}
+	return nil
+}
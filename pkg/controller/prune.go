@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// staleChildren returns the kinds of optional children myApp's spec no longer asks for, as
+// empty objects named after myApp. Children of these kinds still owned by it are pruned.
+func (c *Controller) staleChildren(myApp *api.MyApp) []client.Object {
+	var stale []client.Object
+	switch myApp.Spec.WorkloadType {
+	case api.WorkloadJob:
+		stale = append(stale, &appv1.Deployment{}, &policyv1.PodDisruptionBudget{}, &batchv1.CronJob{})
+	case api.WorkloadCronJob:
+		stale = append(stale, &appv1.Deployment{}, &policyv1.PodDisruptionBudget{}, &batchv1.Job{})
+	default:
+		stale = append(stale, &batchv1.Job{}, &batchv1.CronJob{})
+	}
+	if serviceSpec(myApp) == nil {
+		stale = append(stale, &corev1.Service{})
+	}
+	if myApp.Spec.Ingress == nil || gatewayMode(myApp) {
+		stale = append(stale, &networkingv1.Ingress{})
+	}
+	if c.gatewayAPI && (myApp.Spec.Ingress == nil || !gatewayMode(myApp)) {
+		stale = append(stale, newUnstructured(httpRouteGVK, "", ""))
+	}
+	if myApp.Spec.Autoscaling == nil {
+		stale = append(stale, &autoscalingv2.HorizontalPodAutoscaler{})
+	}
+	if c.vpa && (myApp.Spec.Autoscaling == nil || myApp.Spec.Autoscaling.Vertical == nil) {
+		stale = append(stale, newUnstructured(vpaGVK, "", ""))
+	}
+	if myApp.Spec.NetworkPolicy == nil {
+		stale = append(stale, &networkingv1.NetworkPolicy{})
+	}
+	if len(meshObjects(myApp)) == 0 {
+		for _, gvk := range []schema.GroupVersionKind{peerAuthenticationGVK, destinationRuleGVK} {
+			if installed, err := c.kindInstalled(gvk); err == nil && installed {
+				stale = append(stale, newUnstructured(gvk, "", ""))
+			}
+		}
+	}
+	for _, obj := range stale {
+		obj.SetNamespace(myApp.Namespace)
+		obj.SetName(myApp.Name)
+	}
+	if c.caBundle != nil && myApp.Spec.DisableCABundle {
+		stale = append(stale, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: myApp.Namespace, Name: caBundleName(myApp)}})
+	}
+	if myApp.Spec.Logging == nil || myApp.Spec.Logging.Output != api.LogOutputFile {
+		stale = append(stale, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: myApp.Namespace, Name: fluentBitConfigName(myApp)}})
+	}
+	if myApp.Spec.Timezone == nil || !myApp.Spec.Timezone.MountLocaltime {
+		stale = append(stale, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: myApp.Namespace, Name: timezoneName(myApp)}})
+	}
+	return stale
+}
+
+// pruneChild deletes obj if it exists and is controlled by myApp. Objects of the same name
+// created by someone else are left alone.
+func (c *Controller) pruneChild(ctx context.Context, myApp *api.MyApp, obj client.Object, changes *childChanges) error {
+	gvk, err := apiutil.GVKForObject(obj, c.manager.GetScheme())
+	if err != nil {
+		return err
+	}
+	if err := c.getChild(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(obj, myApp) {
+		return nil
+	}
+	uid := obj.GetUID()
+	// Jobs orphan their pods by default.
+	if err := c.client.Delete(ctx, obj, client.Preconditions{UID: &uid}, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	changes.record(childDeleted, gvk.Kind)
+	return nil
+}
@@ -0,0 +1,266 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Queue priorities, as reported by the myapp_queue_depth metric.
+const (
+	priorityHigh = "high"
+	priorityLow  = "low"
+)
+
+var queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "myapp_queue_depth",
+	Help: "Number of MyApps waiting in the priority queue, by priority",
+}, []string{"priority"})
+
+func init() {
+	metrics.Registry.MustRegister(queueDepth)
+}
+
+// priorityQueue is a workqueue that hands out MyApps whose spec changed before resyncs,
+// requeues and changes to children. Like the client-go workqueue, an item is queued at
+// most once and never processed concurrently.
+//
+// Requests don't carry the event that caused them, so the MyApp predicate marks keys
+// whose generation changed with hint before they are added.
+type priorityQueue struct {
+	rateLimiter ratelimiter.RateLimiter
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	high []interface{}
+	low  []interface{}
+	// dirty holds the priority of every item that is queued or must be queued again once
+	// it is done processing.
+	dirty      map[interface{}]string
+	processing map[interface{}]bool
+	hints      map[interface{}]bool
+	// pinned items are always high priority.
+	pinned       map[interface{}]bool
+	shuttingDown bool
+}
+
+func newPriorityQueue() *priorityQueue {
+	q := &priorityQueue{
+		rateLimiter: workqueue.DefaultControllerRateLimiter(),
+		dirty:       map[interface{}]string{},
+		processing:  map[interface{}]bool{},
+		hints:       map[interface{}]bool{},
+		pinned:      map[interface{}]bool{},
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// newQueueFunc returns a controller.Options.NewQueue building the controller's workqueue:
+// priority when set, otherwise the default queue, wrapped in a debounceQueue when debounce
+// is positive. The queue is tracked by health.
+func newQueueFunc(priority *priorityQueue, debounce time.Duration, health *controllerHealth) func(string, ratelimiter.RateLimiter) workqueue.RateLimitingInterface {
+	return func(name string, rateLimiter ratelimiter.RateLimiter) workqueue.RateLimitingInterface {
+		var queue workqueue.RateLimitingInterface
+		if priority != nil {
+			priority.rateLimiter = rateLimiter
+			queue = priority
+		} else {
+			queue = workqueue.NewRateLimitingQueueWithConfig(rateLimiter, workqueue.RateLimitingQueueConfig{Name: name})
+		}
+		if debounce > 0 {
+			queue = newDebounceQueue(queue, debounce)
+		}
+		return health.track(queue)
+	}
+}
+
+// hint makes the next Add of item high priority.
+func (q *priorityQueue) hint(item interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.hints[item] = true
+}
+
+// pin makes every Add of item high priority, or none when pinned is false.
+func (q *priorityQueue) pin(item interface{}, pinned bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if pinned {
+		q.pinned[item] = true
+	} else {
+		delete(q.pinned, item)
+	}
+}
+
+// predicate hints generation bumps of MyApps and pins the MyApps whose priorityOf is high.
+// Generation bumps of MyApps whose priorityOf is low aren't hinted. It doesn't filter any
+// events.
+func (q *priorityQueue) predicate(priorityOf func(client.Object) string) predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			q.pin(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(e.Object)}, priorityOf(e.Object) == priorityHigh)
+			return true
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			item := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(e.ObjectNew)}
+			priority := priorityOf(e.ObjectNew)
+			q.pin(item, priority == priorityHigh)
+			if priority != priorityLow && e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() {
+				q.hint(item)
+			}
+			return true
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			q.pin(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(e.Object)}, false)
+			return true
+		},
+	}
+}
+
+func (q *priorityQueue) Add(item interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.shuttingDown {
+		return
+	}
+	priority := priorityLow
+	if q.hints[item] || q.pinned[item] {
+		delete(q.hints, item)
+		priority = priorityHigh
+	}
+
+	if queued, ok := q.dirty[item]; ok {
+		if queued == priorityLow && priority == priorityHigh {
+			q.dirty[item] = priorityHigh
+			if !q.processing[item] {
+				q.low = remove(q.low, item)
+				q.high = append(q.high, item)
+				q.updateDepth()
+			}
+		}
+		return
+	}
+	q.dirty[item] = priority
+	if q.processing[item] {
+		return
+	}
+	q.push(item, priority)
+	q.cond.Signal()
+}
+
+func (q *priorityQueue) push(item interface{}, priority string) {
+	if priority == priorityHigh {
+		q.high = append(q.high, item)
+	} else {
+		q.low = append(q.low, item)
+	}
+	q.updateDepth()
+}
+
+func (q *priorityQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.high) + len(q.low)
+}
+
+func (q *priorityQueue) Get() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.high) == 0 && len(q.low) == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	var item interface{}
+	switch {
+	case len(q.high) > 0:
+		item, q.high = q.high[0], q.high[1:]
+	case len(q.low) > 0:
+		item, q.low = q.low[0], q.low[1:]
+	default:
+		return nil, true
+	}
+	q.updateDepth()
+	q.processing[item] = true
+	delete(q.dirty, item)
+	return item, false
+}
+
+func (q *priorityQueue) Done(item interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.processing, item)
+	if priority, ok := q.dirty[item]; ok {
+		q.push(item, priority)
+		q.cond.Signal()
+	} else if len(q.processing) == 0 {
+		// Wake ShutDownWithDrain.
+		q.cond.Broadcast()
+	}
+}
+
+func (q *priorityQueue) ShutDown() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.shuttingDown = true
+	q.cond.Broadcast()
+}
+
+// ShutDownWithDrain shuts down the queue and waits for the items being processed to be done.
+func (q *priorityQueue) ShutDownWithDrain() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.shuttingDown = true
+	q.cond.Broadcast()
+	for len(q.processing) > 0 {
+		q.cond.Wait()
+	}
+}
+
+func (q *priorityQueue) ShuttingDown() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.shuttingDown
+}
+
+// AddAfter adds item once duration has passed.
+func (q *priorityQueue) AddAfter(item interface{}, duration time.Duration) {
+	if duration <= 0 {
+		q.Add(item)
+		return
+	}
+	time.AfterFunc(duration, func() { q.Add(item) })
+}
+
+func (q *priorityQueue) AddRateLimited(item interface{}) {
+	q.AddAfter(item, q.rateLimiter.When(item))
+}
+
+func (q *priorityQueue) Forget(item interface{}) {
+	q.rateLimiter.Forget(item)
+}
+
+func (q *priorityQueue) NumRequeues(item interface{}) int {
+	return q.rateLimiter.NumRequeues(item)
+}
+
+func (q *priorityQueue) updateDepth() {
+	queueDepth.WithLabelValues(priorityHigh).Set(float64(len(q.high)))
+	queueDepth.WithLabelValues(priorityLow).Set(float64(len(q.low)))
+}
+
+func remove(items []interface{}, item interface{}) []interface{} {
+	for i, it := range items {
+		if it == item {
+			return append(items[:i], items[i+1:]...)
+		}
+	}
+	return items
+}
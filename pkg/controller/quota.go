@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// quotaRecheckInterval is how often a MyApp exceeding its namespace's ResourceQuotas is
+// checked again. Quota usage changes with every pod of the namespace, it isn't watched.
+const quotaRecheckInterval = time.Minute
+
+// +kubebuilder:rbac:groups="",resources=resourcequotas,verbs=get;list;watch
+
+// checkQuota simulates the pods of the rendered deployment, at its desired replicas, against
+// the ResourceQuotas of the MyApp's namespace. It returns a QuotaExceeded condition listing
+// the shortfall of every exceeded quota, nil when the pods fit. The live Deployment's pods
+// are already counted in the quotas' usage and are replaced. Scoped quotas are ignored, and
+// the extra pods of a rolling update aren't counted.
+func (c *Controller) checkQuota(ctx context.Context, myApp *api.MyApp, deployment *appv1.Deployment) (*metav1.Condition, error) {
+	quotas := &corev1.ResourceQuotaList{}
+	if err := c.client.List(ctx, quotas, client.InNamespace(myApp.Namespace)); err != nil {
+		return nil, err
+	}
+	if len(quotas.Items) == 0 {
+		return nil, nil
+	}
+	live := &appv1.Deployment{}
+	err := c.getChild(ctx, client.ObjectKeyFromObject(myApp), live)
+	if client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	var current corev1.ResourceList
+	var replicas int32
+	if err == nil {
+		replicas = live.Status.Replicas
+		current = quotaUsage(&live.Spec.Template.Spec, replicas)
+	}
+	switch {
+	case deployment.Spec.Replicas != nil:
+		replicas = *deployment.Spec.Replicas
+	case replicas == 0 && myApp.Spec.Autoscaling != nil && myApp.Spec.Autoscaling.MinReplicas != nil:
+		replicas = *myApp.Spec.Autoscaling.MinReplicas
+	case replicas == 0:
+		replicas = 1
+	}
+	needed := quotaUsage(&deployment.Spec.Template.Spec, replicas)
+
+	sort.Slice(quotas.Items, func(i, j int) bool { return quotas.Items[i].Name < quotas.Items[j].Name })
+	var shortfalls []string
+	for _, quota := range quotas.Items {
+		if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+			continue
+		}
+		names := make([]string, 0, len(quota.Status.Hard))
+		for name := range quota.Status.Hard {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			want, ok := needed[corev1.ResourceName(name)]
+			if !ok {
+				continue
+			}
+			hard, used := quota.Status.Hard[corev1.ResourceName(name)], quota.Status.Used[corev1.ResourceName(name)]
+			total := used.DeepCopy()
+			total.Sub(current[corev1.ResourceName(name)])
+			total.Add(want)
+			if total.Cmp(hard) <= 0 {
+				continue
+			}
+			short := total.DeepCopy()
+			short.Sub(hard)
+			shortfalls = append(shortfalls, fmt.Sprintf("%s: %s short by %s (needs %s, %s of %s used)",
+				quota.Name, name, short.String(), want.String(), used.String(), hard.String()))
+		}
+	}
+	if len(shortfalls) == 0 {
+		return nil, nil
+	}
+	return &metav1.Condition{
+		Type:               api.ConditionQuotaExceeded,
+		Status:             metav1.ConditionTrue,
+		Reason:             "QuotaExceeded",
+		Message:            fmt.Sprintf("%d pods would exceed the namespace's ResourceQuotas: %s", replicas, strings.Join(shortfalls, "; ")),
+		ObservedGeneration: myApp.Generation,
+	}, nil
+}
+
+// quotaUsage returns the quota usage of n pods of spec, under the names ResourceQuotas
+// use: pods, requests.<resource>, limits.<resource>, and the bare cpu, memory and
+// ephemeral-storage for their requests.
+func quotaUsage(spec *corev1.PodSpec, n int32) corev1.ResourceList {
+	requests, limits := podResources(spec)
+	usage := corev1.ResourceList{corev1.ResourcePods: *resource.NewQuantity(int64(n), resource.DecimalSI)}
+	scaled := func(q resource.Quantity) resource.Quantity {
+		return *resource.NewMilliQuantity(q.MilliValue()*int64(n), q.Format)
+	}
+	for name, q := range requests {
+		usage[corev1.ResourceName("requests."+string(name))] = scaled(q)
+		switch name {
+		case corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage:
+			usage[name] = scaled(q)
+		}
+	}
+	for name, q := range limits {
+		usage[corev1.ResourceName("limits."+string(name))] = scaled(q)
+	}
+	return usage
+}
+
+// podResources returns the effective requests and limits of a pod of spec: the sum of its
+// containers and sidecars, or the largest init container's if that's more.
+func podResources(spec *corev1.PodSpec) (corev1.ResourceList, corev1.ResourceList) {
+	add := func(list, of corev1.ResourceList) {
+		for name, q := range of {
+			sum := list[name]
+			sum.Add(q)
+			list[name] = sum
+		}
+	}
+	raise := func(list, of corev1.ResourceList) {
+		for name, q := range of {
+			if q.Cmp(list[name]) > 0 {
+				list[name] = q
+			}
+		}
+	}
+	requests, limits := corev1.ResourceList{}, corev1.ResourceList{}
+	initRequests, initLimits := corev1.ResourceList{}, corev1.ResourceList{}
+	for _, container := range spec.Containers {
+		add(requests, container.Resources.Requests)
+		add(limits, container.Resources.Limits)
+	}
+	for _, container := range spec.InitContainers {
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			add(requests, container.Resources.Requests)
+			add(limits, container.Resources.Limits)
+			continue
+		}
+		raise(initRequests, container.Resources.Requests)
+		raise(initLimits, container.Resources.Limits)
+	}
+	raise(requests, initRequests)
+	raise(limits, initLimits)
+	return requests, limits
+}
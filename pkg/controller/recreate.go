@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// supersededLabel marks the ReplicaSets of a recreated Deployment with the name of its
+// MyApp. They are deleted once the replacement is rolled out, unless it adopted them.
+const supersededLabel = "myapp.example.com/superseded-by"
+
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=list;patch;delete
+
+// immutableFieldChange reports whether err rejects an update because it changes an
+// immutable field.
+func immutableFieldChange(err error) bool {
+	var status apierrors.APIStatus
+	if !apierrors.IsInvalid(err) || !errors.As(err, &status) || status.Status().Details == nil {
+		return false
+	}
+	for _, cause := range status.Status().Details.Causes {
+		if strings.Contains(cause.Message, apivalidation.FieldImmutableErrorMsg) {
+			return true
+		}
+	}
+	return false
+}
+
+// recreateChild deletes live, so it is created again by the next reconcile, which the
+// deletion triggers. The ReplicaSets of a Deployment are orphaned rather than deleted, so
+// its pods keep serving until the replacement is rolled out. Children controlled by
+// another owner are left alone.
+func (c *Controller) recreateChild(ctx context.Context, myApp *api.MyApp, live client.Object, kind string, cause error) error {
+	if owner := metav1.GetControllerOf(live); owner != nil && owner.UID != myApp.UID {
+		return cause
+	}
+	propagation := metav1.DeletePropagationBackground
+	if deployment, ok := live.(*appv1.Deployment); ok {
+		if err := c.markSuperseded(ctx, myApp, deployment); err != nil {
+			return err
+		}
+		propagation = metav1.DeletePropagationOrphan
+	}
+	uid := live.GetUID()
+	if err := c.client.Delete(ctx, live, client.Preconditions{UID: &uid}, client.PropagationPolicy(propagation)); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	ctrl.LoggerFrom(ctx).Info("recreating child to change an immutable field", "kind", kind, "name", live.GetName(), "reason", cause.Error())
+	return fmt.Errorf("recreating %s %s to change an immutable field", kind, live.GetName())
+}
+
+// markSuperseded labels the ReplicaSets controlled by deployment, so they can be cleaned up
+// once they are orphaned.
+func (c *Controller) markSuperseded(ctx context.Context, myApp *api.MyApp, deployment *appv1.Deployment) error {
+	sets := &appv1.ReplicaSetList{}
+	if err := c.manager.GetAPIReader().List(ctx, sets, client.InNamespace(deployment.Namespace)); err != nil {
+		return err
+	}
+	for i := range sets.Items {
+		rs := &sets.Items[i]
+		if owner := metav1.GetControllerOf(rs); owner == nil || owner.UID != deployment.UID {
+			continue
+		}
+		patch := fmt.Sprintf(`{"metadata":{"labels":{%q:%q}}}`, supersededLabel, myApp.Name)
+		if err := c.client.Patch(ctx, rs, client.RawPatch(types.MergePatchType, []byte(patch))); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanupSuperseded deletes the ReplicaSets orphaned by recreating the MyApp's Deployment
+// once deployment is rolled out. ReplicaSets the new Deployment adopted are left to it.
+func (c *Controller) cleanupSuperseded(ctx context.Context, myApp *api.MyApp, deployment *appv1.Deployment) error {
+	if rolling, _, _ := deploymentProgress(deployment); rolling {
+		return nil
+	}
+	sets := &appv1.ReplicaSetList{}
+	if err := c.manager.GetAPIReader().List(ctx, sets, client.InNamespace(myApp.Namespace), client.MatchingLabels{supersededLabel: myApp.Name}); err != nil {
+		return err
+	}
+	for i := range sets.Items {
+		rs := &sets.Items[i]
+		if metav1.GetControllerOf(rs) != nil {
+			continue
+		}
+		uid := rs.UID
+		if err := c.client.Delete(ctx, rs, client.Preconditions{UID: &uid}); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		ctrl.LoggerFrom(ctx).Info("deleted ReplicaSet superseded by the recreated Deployment", "name", rs.Name)
+	}
+	return nil
+}
+
+// selectorMismatch is a child whose live selector differs from the rendered one.
+type selectorMismatch struct {
+	kind, name    string
+	live, desired string
+}
+
+func (m *selectorMismatch) Error() string {
+	return fmt.Sprintf("%s %s selects %s instead of %s", m.kind, m.name, m.live, m.desired)
+}
+
+// selectorChange compares the selector of the rendered obj to the live one's. Only the
+// selectors of Deployments are immutable.
+func selectorChange(kind string, obj, live client.Object) *selectorMismatch {
+	desired, ok := obj.(*appv1.Deployment)
+	if !ok {
+		return nil
+	}
+	current := live.(*appv1.Deployment)
+	if current.Spec.Selector == nil || apiequality.Semantic.DeepEqual(desired.Spec.Selector, current.Spec.Selector) {
+		return nil
+	}
+	return &selectorMismatch{
+		kind:    kind,
+		name:    obj.GetName(),
+		live:    metav1.FormatLabelSelector(current.Spec.Selector),
+		desired: metav1.FormatLabelSelector(desired.Spec.Selector),
+	}
+}
+
+// selectorMismatchCondition reports the children left as they are because their selector changed.
+func selectorMismatchCondition(app *api.MyApp, mismatches []selectorMismatch) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               api.ConditionSelectorMismatch,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonAsExpected,
+		ObservedGeneration: app.Generation,
+	}
+	if len(mismatches) == 0 {
+		return cond
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].kind != mismatches[j].kind {
+			return mismatches[i].kind < mismatches[j].kind
+		}
+		return mismatches[i].name < mismatches[j].name
+	})
+	messages := make([]string, 0, len(mismatches))
+	for i := range mismatches {
+		messages = append(messages, mismatches[i].Error())
+	}
+	cond.Status, cond.Reason = metav1.ConditionTrue, "ImmutableSelector"
+	cond.Message = strings.Join(messages, "; ") + ". Selectors are immutable: set spec.recreateOnImmutableChange, or delete the children, to recreate them"
+	return cond
+}
@@ -0,0 +1,411 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// defaultRenderNamespace is the namespace of rendered MyApps that don't set one, as kubectl
+// would apply them.
+const defaultRenderNamespace = "default"
+
+// renderClient records the children the controller applies instead of applying them, so
+// they are rendered with the reconciler's own code path. Reads go to the embedded client;
+// other writes are dropped.
+type renderClient struct {
+	client.Client
+
+	mu      sync.Mutex
+	objects map[renderKey]client.Object
+}
+
+type renderKey struct {
+	gvk             schema.GroupVersionKind
+	namespace, name string
+}
+
+func newRenderClient(c client.Client) *renderClient {
+	return &renderClient{Client: c, objects: map[renderKey]client.Object{}}
+}
+
+func (r *renderClient) record(obj client.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme())
+	if err != nil {
+		return err
+	}
+	obj = obj.DeepCopyObject().(client.Object)
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	name := obj.GetName()
+	if name == "" {
+		name = obj.GetGenerateName()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// A child applied twice, e.g. when recreated, is rendered as last applied.
+	r.objects[renderKey{gvk, obj.GetNamespace(), name}] = obj
+	return nil
+}
+
+func (r *renderClient) Create(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+	return r.record(obj)
+}
+
+func (r *renderClient) Patch(_ context.Context, obj client.Object, patch client.Patch, _ ...client.PatchOption) error {
+	// Children are applied; other patches touch objects the controller doesn't render.
+	if patch.Type() != types.ApplyPatchType {
+		return nil
+	}
+	return r.record(obj)
+}
+
+func (r *renderClient) Update(context.Context, client.Object, ...client.UpdateOption) error {
+	return nil
+}
+
+func (r *renderClient) Delete(context.Context, client.Object, ...client.DeleteOption) error {
+	return nil
+}
+
+func (r *renderClient) DeleteAllOf(context.Context, client.Object, ...client.DeleteAllOfOption) error {
+	return nil
+}
+
+func (r *renderClient) Status() client.SubResourceWriter {
+	return renderSubResourceClient{r.Client.SubResource("status")}
+}
+
+func (r *renderClient) SubResource(subResource string) client.SubResourceClient {
+	return renderSubResourceClient{r.Client.SubResource(subResource)}
+}
+
+// rendered returns the recorded children ordered by kind, namespace and name.
+func (r *renderClient) rendered() []client.Object {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]renderKey, 0, len(r.objects))
+	for key := range r.objects {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.gvk.Kind != b.gvk.Kind {
+			return a.gvk.Kind < b.gvk.Kind
+		}
+		if a.gvk.Group != b.gvk.Group {
+			return a.gvk.Group < b.gvk.Group
+		}
+		if a.namespace != b.namespace {
+			return a.namespace < b.namespace
+		}
+		return a.name < b.name
+	})
+	objects := make([]client.Object, 0, len(keys))
+	for _, key := range keys {
+		objects = append(objects, r.objects[key])
+	}
+	return objects
+}
+
+// renderSubResourceClient drops the writes of subresources, e.g. status updates.
+type renderSubResourceClient struct {
+	client.SubResourceClient
+}
+
+func (renderSubResourceClient) Create(context.Context, client.Object, client.Object, ...client.SubResourceCreateOption) error {
+	return nil
+}
+
+func (renderSubResourceClient) Update(context.Context, client.Object, ...client.SubResourceUpdateOption) error {
+	return nil
+}
+
+func (renderSubResourceClient) Patch(context.Context, client.Object, client.Patch, ...client.SubResourcePatchOption) error {
+	return nil
+}
+
+// render returns the children of myApp the reconciler would apply against the objects c reads,
+// without applying them nor affecting the reconciler's state. The MyApp's template, size and
+// replica bounds are applied as when reconciling. Adjustments to the state of the cluster,
+// e.g. to drains, zone failures and expiration, are not, and the workload isn't held back for
+// pending ExternalSecrets.
+func (c *Controller) render(ctx context.Context, myApp *api.MyApp) ([]client.Object, error) {
+	myApp = myApp.DeepCopy()
+	if err := c.applyTemplate(ctx, myApp); err != nil {
+		return nil, err
+	}
+	c.applySize(&myApp.Spec)
+	c.replicas.apply(&myApp.Spec)
+	if cond, err := c.checkHostNamespaces(ctx, myApp); err != nil {
+		return nil, err
+	} else if cond != nil {
+		return nil, errors.New(cond.Message)
+	}
+	secrets, _, err := c.resolveExternalSecrets(ctx, myApp)
+	if err != nil {
+		return nil, err
+	}
+
+	// The trackers of rollouts, rotations and fights are left out, they'd hold back or count
+	// the rendering as a reconcile.
+	recorder := newRenderClient(c.client)
+	renderer := &Controller{
+		client:              recorder,
+		manager:             c.manager,
+		fights:              newFightTracker(),
+		serviceProfiles:     c.serviceProfiles,
+		sizes:               c.sizes,
+		tiers:               c.tiers,
+		egressProxies:       c.egressProxies,
+		profiling:           c.profiling,
+		caBundle:            c.caBundle,
+		recorder:            &record.FakeRecorder{},
+		debugImage:          c.debugImage,
+		fluentBitImage:      c.fluentBitImage,
+		defaultGateway:      c.defaultGateway,
+		gatewayAPI:          c.gatewayAPI,
+		vpa:                 c.vpa,
+		features:            c.features,
+		ignoreDifferences:   c.ignoreDifferences,
+		impersonating:       c.impersonating,
+		allowHostNamespaces: c.allowHostNamespaces,
+		replicas:            c.replicas,
+	}
+	if _, err := renderer.reconcileChildren(ctx, myApp, secrets, false); err != nil {
+		return nil, err
+	}
+	return recorder.rendered(), nil
+}
+
+// Renderer renders the children of MyApps without a manager, e.g. for CI or to export them.
+type Renderer struct {
+	controller *Controller
+}
+
+// NewRenderer returns a Renderer rendering with the rendering options of opts, against the
+// objects read with c. The optional CRDs the children use are those c's RESTMapper knows.
+func NewRenderer(opts Options, c client.Client) (*Renderer, error) {
+	if opts.MinReplicas < 0 || opts.MaxReplicas < 0 || (opts.MaxReplicas > 0 && opts.MinReplicas > opts.MaxReplicas) {
+		return nil, &ConfigError{fmt.Errorf("invalid replica bounds %d-%d", opts.MinReplicas, opts.MaxReplicas)}
+	}
+	serviceProfiles, err := loadServiceProfiles(opts.ServiceProfilesFile)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	sizes, err := loadSizeProfiles(opts.SizeProfilesFile)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	tiers, err := loadTierProfiles(opts.TierProfilesFile)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	egressProxies, err := loadEgressProxyProfiles(opts.EgressProxyProfilesFile)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	profiling, err := loadProfilingConfig(opts.ProfilingConfigFile)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	defaultGateway, err := parseGatewayRef(opts.DefaultGateway)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	ignoreDifferences, err := parseIgnoreDifferences(opts.IgnoreDifferences)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	var bundle *caBundle
+	if opts.CABundleConfigMap != "" {
+		key, err := parseCABundleRef(opts.CABundleConfigMap)
+		if err != nil {
+			return nil, &ConfigError{err}
+		}
+		bundle = &caBundle{key: key, reader: c}
+	}
+
+	controller := &Controller{
+		client:              c,
+		manager:             renderManager{client: c},
+		serviceProfiles:     serviceProfiles,
+		sizes:               sizes,
+		tiers:               tiers,
+		egressProxies:       egressProxies,
+		profiling:           profiling,
+		caBundle:            bundle,
+		debugImage:          opts.DebugImage,
+		fluentBitImage:      opts.FluentBitImage,
+		defaultGateway:      defaultGateway,
+		features:            opts.FeatureGates,
+		ignoreDifferences:   ignoreDifferences,
+		allowHostNamespaces: opts.AllowHostNamespaces,
+		replicas:            replicaBounds{min: int32(opts.MinReplicas), max: int32(opts.MaxReplicas)},
+	}
+	if controller.gatewayAPI, err = controller.kindInstalled(httpRouteGVK); err != nil {
+		return nil, err
+	}
+	if controller.vpa, err = controller.kindInstalled(vpaGVK); err != nil {
+		return nil, err
+	}
+	return &Renderer{controller: controller}, nil
+}
+
+// Render returns the children the controller would apply for myApp, ordered by kind,
+// namespace and name.
+func (r *Renderer) Render(ctx context.Context, myApp *api.MyApp) ([]client.Object, error) {
+	return r.controller.render(ctx, myApp)
+}
+
+// renderManager stands in for the manager of a Renderer. Only the methods the rendering calls
+// are implemented.
+type renderManager struct {
+	ctrl.Manager
+	client client.Client
+}
+
+func (m renderManager) GetScheme() *runtime.Scheme { return m.client.Scheme() }
+
+func (m renderManager) GetClient() client.Client { return m.client }
+
+func (m renderManager) GetAPIReader() client.Reader { return m.client }
+
+func (m renderManager) GetRESTMapper() meta.RESTMapper { return m.client.RESTMapper() }
+
+// NewScheme returns a scheme of the Kubernetes and MyApp types, for the clients of Renderers.
+func NewScheme() (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := api.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	return scheme, nil
+}
+
+// RenderManifests renders the children of every MyApp in manifests, YAML or JSON documents.
+// The other objects of manifests, e.g. the MyAppTemplates, Namespaces and LimitRanges, stand
+// in for the cluster's, as if every optional CRD the controller supports was installed. The
+// namespaces of the MyApps exist, unlabeled, unless given.
+func RenderManifests(ctx context.Context, opts Options, manifests io.Reader) ([]client.Object, error) {
+	scheme, err := NewScheme()
+	if err != nil {
+		return nil, err
+	}
+	objects, err := decodeManifests(manifests, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	var apps []*api.MyApp
+	namespaces := map[string]bool{}
+	for _, obj := range objects {
+		if ns, ok := obj.(*corev1.Namespace); ok {
+			namespaces[ns.Name] = true
+		}
+		if app, ok := obj.(*api.MyApp); ok {
+			apps = append(apps, app)
+		}
+	}
+	if len(apps) == 0 {
+		return nil, errors.New("no MyApp in the manifests")
+	}
+	for _, app := range apps {
+		if !namespaces[app.Namespace] {
+			namespaces[app.Namespace] = true
+			objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: app.Namespace}})
+		}
+	}
+
+	// The optional kinds are namespaced, the kinds of the scheme are looked up in it.
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range []schema.GroupVersionKind{httpRouteGVK, gatewayGVK, vpaGVK, peerAuthenticationGVK, destinationRuleGVK} {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).WithObjects(objects...).Build()
+	renderer, err := NewRenderer(opts, c)
+	if err != nil {
+		return nil, err
+	}
+	var rendered []client.Object
+	for _, app := range apps {
+		children, err := renderer.Render(ctx, app)
+		if err != nil {
+			return nil, fmt.Errorf("rendering MyApp %s/%s: %w", app.Namespace, app.Name, err)
+		}
+		rendered = append(rendered, children...)
+	}
+	return rendered, nil
+}
+
+// decodeManifests decodes the YAML or JSON documents of r into the types of scheme, or into
+// unstructured objects for kinds scheme doesn't know. MyApps without a namespace are put in
+// defaultRenderNamespace.
+func decodeManifests(r io.Reader, scheme *runtime.Scheme) ([]client.Object, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	var objects []client.Object
+	for {
+		u := &unstructured.Unstructured{}
+		if err := decoder.Decode(&u.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+			return nil, err
+		}
+		if len(u.Object) == 0 {
+			continue
+		}
+		gvk := u.GroupVersionKind()
+		if gvk.Kind == "" {
+			return nil, fmt.Errorf("manifest %q has no kind", u.GetName())
+		}
+		var obj client.Object = u
+		if typed, err := scheme.New(gvk); err == nil {
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, typed); err != nil {
+				return nil, fmt.Errorf("decoding %s %s: %w", gvk.Kind, u.GetName(), err)
+			}
+			obj = typed.(client.Object)
+		}
+		if app, ok := obj.(*api.MyApp); ok && app.Namespace == "" {
+			app.Namespace = defaultRenderNamespace
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// Detach removes the MyApp's controller reference and the annotations the controller tracks
+// its children with from a rendered child, so it can be applied without the operator.
+func Detach(obj client.Object) {
+	refs := obj.GetOwnerReferences()[:0]
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.Kind != "MyApp" || ref.APIVersion != api.GroupVersion.String() {
+			refs = append(refs, ref)
+		}
+	}
+	obj.SetOwnerReferences(refs)
+	annotations := obj.GetAnnotations()
+	for _, key := range []string{specHashAnnotation, templateHashAnnotation, appGenerationAnnotation} {
+		delete(annotations, key)
+	}
+	obj.SetAnnotations(annotations)
+}
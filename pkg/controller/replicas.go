@@ -0,0 +1,48 @@
+package controller
+
+import "github.com/steeling/controller-runtime-exercise/pkg/api"
+
+// defaultReplicas is the number of replicas of a MyApp that leaves Spec.Replicas unset.
+const defaultReplicas = 1
+
+// replicaBounds limits the replicas of every MyApp, including the range its
+// HorizontalPodAutoscaler scales in. The webhook rejects MyApps out of bounds; the
+// controller enforces them when the webhook isn't consulted.
+type replicaBounds struct {
+	// min and max are inclusive. max is unbounded when 0.
+	min, max int32
+}
+
+func (b replicaBounds) clamp(n int32) int32 {
+	if n < b.min {
+		n = b.min
+	}
+	if b.max > 0 && n > b.max {
+		n = b.max
+	}
+	return n
+}
+
+// apply defaults and bounds the replicas of spec. spec is modified in memory only and must
+// not be written back.
+func (b replicaBounds) apply(spec *api.MyAppSpec) {
+	replicas := int32(defaultReplicas)
+	if spec.Replicas != nil {
+		replicas = *spec.Replicas
+	}
+	replicas = b.clamp(replicas)
+	spec.Replicas = &replicas
+	if spec.Autoscaling == nil {
+		return
+	}
+	autoscaling := &api.AutoscalingSpec{}
+	spec.Autoscaling.DeepCopyInto(autoscaling)
+	min := int32(1)
+	if autoscaling.MinReplicas != nil {
+		min = *autoscaling.MinReplicas
+	}
+	min = b.clamp(min)
+	autoscaling.MinReplicas = &min
+	autoscaling.MaxReplicas = b.clamp(autoscaling.MaxReplicas)
+	spec.Autoscaling = autoscaling
+}
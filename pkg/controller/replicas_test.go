@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+)
+
+func TestReplicaBoundsApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		bounds replicaBounds
+		// replicas is Spec.Replicas and minReplicas Spec.Autoscaling.MinReplicas, unset when
+		// negative. The MyApp doesn't autoscale when maxReplicas is 0.
+		replicas, minReplicas, maxReplicas int32
+		// want is the applied Spec.Replicas, wantMin and wantMax the autoscaling range.
+		want, wantMin, wantMax int32
+	}{
+		{name: "defaulted", replicas: -1, want: defaultReplicas},
+		{name: "unbounded", replicas: 50, want: 50},
+		{name: "within bounds", bounds: replicaBounds{min: 2, max: 10}, replicas: 5, want: 5},
+		{name: "default raised to min", bounds: replicaBounds{min: 2}, replicas: -1, want: 2},
+		{name: "below min", bounds: replicaBounds{min: 2, max: 10}, replicas: 0, want: 2},
+		{name: "above max", bounds: replicaBounds{min: 2, max: 10}, replicas: 20, want: 10},
+		{
+			name:        "autoscaling clamped",
+			bounds:      replicaBounds{min: 2, max: 10},
+			replicas:    -1,
+			minReplicas: 1,
+			maxReplicas: 20,
+			want:        2,
+			wantMin:     2,
+			wantMax:     10,
+		},
+		{
+			name:        "autoscaling min defaulted",
+			bounds:      replicaBounds{max: 10},
+			replicas:    -1,
+			minReplicas: -1,
+			maxReplicas: 5,
+			want:        1,
+			wantMin:     1,
+			wantMax:     5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spec api.MyAppSpec
+			if tt.replicas >= 0 {
+				replicas := tt.replicas
+				spec.Replicas = &replicas
+			}
+			var autoscaling *api.AutoscalingSpec
+			if tt.maxReplicas > 0 {
+				autoscaling = &api.AutoscalingSpec{MaxReplicas: tt.maxReplicas}
+				if tt.minReplicas >= 0 {
+					min := tt.minReplicas
+					autoscaling.MinReplicas = &min
+				}
+				spec.Autoscaling = autoscaling
+			}
+			tt.bounds.apply(&spec)
+			if *spec.Replicas != tt.want {
+				t.Errorf("replicas = %d, want %d", *spec.Replicas, tt.want)
+			}
+			if autoscaling == nil {
+				return
+			}
+			if *spec.Autoscaling.MinReplicas != tt.wantMin || spec.Autoscaling.MaxReplicas != tt.wantMax {
+				t.Errorf("autoscaling = [%d, %d], want [%d, %d]", *spec.Autoscaling.MinReplicas, spec.Autoscaling.MaxReplicas, tt.wantMin, tt.wantMax)
+			}
+			if spec.Autoscaling == autoscaling {
+				t.Error("apply modified the MyApp's autoscaling spec in place")
+			}
+		})
+	}
+}
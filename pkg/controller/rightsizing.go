@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	promapi "github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// rightSizingWindow is the range of usage the recommendations are computed from.
+	rightSizingWindow = "7d"
+	// rightSizingHeadroom is added to the 95th percentile of the usage.
+	rightSizingHeadroom = 1.2
+	// rightSizingThreshold is how far off, relative to the requests, the usage must be for
+	// a recommendation.
+	rightSizingThreshold = 0.5
+	// rightSizingTimeout bounds the queries of a single analysis.
+	rightSizingTimeout = 10 * time.Second
+)
+
+// usageQueries are the PromQL queries of the 95th percentile usage of the MyApp's container
+// per pod, formatted with the namespace, a regular expression of the pod names and the
+// container name.
+var usageQueries = map[corev1.ResourceName]string{
+	corev1.ResourceCPU: `max(quantile_over_time(0.95, sum by (pod) (rate(container_cpu_usage_seconds_total{namespace="%s",pod=~"%s",container="%s"}[5m]))[` +
+		rightSizingWindow + `:5m]))`,
+	corev1.ResourceMemory: `max(quantile_over_time(0.95, sum by (pod) (container_memory_working_set_bytes{namespace="%s",pod=~"%s",container="%s"})[` +
+		rightSizingWindow + `:5m]))`,
+}
+
+// rightSizing is the outcome of an analysis of a MyApp's usage.
+type rightSizing struct {
+	// requests are the recommended requests of the resources that are off, nil when none are.
+	requests corev1.ResourceList
+	time     time.Time
+}
+
+// rightSizer recommends requests from the actual usage of MyApps, queried from Prometheus
+// at most every interval per MyApp. A nil *rightSizer recommends nothing.
+type rightSizer struct {
+	api      promv1.API
+	interval time.Duration
+
+	mu      sync.Mutex
+	results map[types.NamespacedName]rightSizing
+}
+
+// newRightSizer returns nil when url is empty.
+func newRightSizer(url string, interval time.Duration) (*rightSizer, error) {
+	if url == "" {
+		return nil, nil
+	}
+	client, err := promapi.NewClient(promapi.Config{Address: url})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Prometheus URL %q: %w", url, err)
+	}
+	return &rightSizer{api: promv1.NewAPI(client), interval: interval, results: map[types.NamespacedName]rightSizing{}}, nil
+}
+
+// recommend returns the right-sizing of myApp, analyzing its usage again once the previous
+// analysis is older than the interval. fresh reports whether it was analyzed now.
+func (r *rightSizer) recommend(ctx context.Context, myApp *api.MyApp, now time.Time) (result rightSizing, fresh bool, err error) {
+	if r == nil {
+		return rightSizing{}, false, nil
+	}
+	key := types.NamespacedName{Namespace: myApp.Namespace, Name: myApp.Name}
+	r.mu.Lock()
+	result, ok := r.results[key]
+	r.mu.Unlock()
+	if ok && now.Sub(result.time) < r.interval {
+		return result, false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rightSizingTimeout)
+	defer cancel()
+	requests := containerResources(myApp).Requests
+	result = rightSizing{time: now}
+	for name, query := range usageQueries {
+		usage, found, err := r.query(ctx, fmt.Sprintf(query, myApp.Namespace, regexp.QuoteMeta(myApp.Name)+"-.*", myApp.Name), now)
+		if err != nil {
+			return rightSizing{}, false, fmt.Errorf("querying %s usage: %w", name, err)
+		}
+		if !found {
+			continue
+		}
+		recommended := recommendedQuantity(name, usage*rightSizingHeadroom)
+		if requested, ok := requests[name]; ok && !off(requested, recommended) {
+			continue
+		}
+		if result.requests == nil {
+			result.requests = corev1.ResourceList{}
+		}
+		result.requests[name] = recommended
+	}
+	r.mu.Lock()
+	r.results[key] = result
+	r.mu.Unlock()
+	return result, true, nil
+}
+
+// query returns the value of a query returning a single sample, if there is one.
+func (r *rightSizer) query(ctx context.Context, query string, now time.Time) (float64, bool, error) {
+	value, _, err := r.api.Query(ctx, query, now)
+	if err != nil {
+		return 0, false, err
+	}
+	vector, ok := value.(model.Vector)
+	if !ok || len(vector) == 0 || math.IsNaN(float64(vector[0].Value)) {
+		return 0, false, nil
+	}
+	return float64(vector[0].Value), true, nil
+}
+
+// recommendedQuantity rounds value up to whole millicores, or MiB of memory.
+func recommendedQuantity(name corev1.ResourceName, value float64) resource.Quantity {
+	if name == corev1.ResourceCPU {
+		return *resource.NewMilliQuantity(int64(math.Ceil(value*1000)), resource.DecimalSI)
+	}
+	return *resource.NewQuantity(int64(math.Ceil(value/(1<<20)))<<20, resource.BinarySI)
+}
+
+// off reports whether recommended differs from requested by more than the threshold.
+func off(requested, recommended resource.Quantity) bool {
+	req := requested.AsApproximateFloat64()
+	if req == 0 {
+		return true
+	}
+	return math.Abs(recommended.AsApproximateFloat64()-req)/req > rightSizingThreshold
+}
+
+// forget drops the analysis of a deleted MyApp.
+func (r *rightSizer) forget(key types.NamespacedName) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.results, key)
+}
+
+// applyRightSizing sets the requests of spec's container to the recommended ones. Limits
+// below them are raised to them. spec is modified in memory only and must not be written back.
+func applyRightSizing(spec *api.MyAppSpec, requests corev1.ResourceList) {
+	resources := containerResources(&api.MyApp{Spec: *spec})
+	resources = *resources.DeepCopy()
+	if resources.Requests == nil {
+		resources.Requests = corev1.ResourceList{}
+	}
+	for name, quantity := range requests {
+		resources.Requests[name] = quantity
+		if limit, ok := resources.Limits[name]; ok && limit.Cmp(quantity) < 0 {
+			resources.Limits[name] = quantity
+		}
+	}
+	spec.Resources = &resources
+}
+
+// rightSize analyzes the usage of myApp and applies the recommendation when the MyApp opts
+// in. A failed analysis is logged and doesn't hold back the reconcile. It returns the
+// recommendation to report, nil when there is none.
+func (c *Controller) rightSize(ctx context.Context, myApp *api.MyApp) *api.RightSizingStatus {
+	result, fresh, err := c.rightSizer.recommend(ctx, myApp, time.Now())
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to analyze the MyApp's usage")
+		return myApp.Status.RightSizing
+	}
+	if result.requests == nil {
+		return nil
+	}
+	if fresh {
+		c.recorder.Eventf(myApp, corev1.EventTypeNormal, "RightSizingRecommended", "Recommended requests from the usage of the last %s: %s",
+			rightSizingWindow, formatResources(result.requests))
+	}
+	if myApp.Spec.AutoRightSize {
+		applyRightSizing(&myApp.Spec, result.requests)
+	}
+	return &api.RightSizingStatus{
+		Requests: result.requests,
+		Applied:  myApp.Spec.AutoRightSize,
+		Time:     metav1.NewTime(result.time),
+	}
+}
+
+// formatResources formats resources as "cpu=250m, memory=512Mi", sorted by name.
+func formatResources(resources corev1.ResourceList) string {
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		quantity := resources[corev1.ResourceName(name)]
+		names[i] = name + "=" + quantity.String()
+	}
+	return strings.Join(names, ", ")
+}
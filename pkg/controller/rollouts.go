@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// templateHashAnnotation on the Deployment is the hash of the pod template the controller
+	// rendered, so a change that starts a rollout is recognized before it is applied.
+	templateHashAnnotation = "myapp.example.com/template-hash"
+	// rolloutQueuedRetryInterval is how often a queued rollout checks for a free slot.
+	rolloutQueuedRetryInterval = 15 * time.Second
+)
+
+var (
+	rolloutsInProgress = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "myapp_rollouts_in_progress",
+		Help: "Number of MyApps rolling out, counted against the concurrent rollout limit",
+	})
+	rolloutsQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "myapp_rollouts_queued",
+		Help: "Number of MyApps waiting for a concurrent rollout slot",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(rolloutsInProgress, rolloutsQueued)
+}
+
+// rolloutCoordinator caps the MyApps rolling out at once, e.g. during a mass image bump, so
+// registries and shared backends aren't overwhelmed. The others wait in a queue, in the
+// order they asked. The limit applies per operator replica, i.e. per shard. A nil
+// *rolloutCoordinator is unlimited.
+type rolloutCoordinator struct {
+	max int
+
+	mu      sync.Mutex
+	rolling map[types.NamespacedName]bool
+	queue   []types.NamespacedName
+}
+
+// newRolloutCoordinator returns nil when max isn't positive.
+func newRolloutCoordinator(max int) *rolloutCoordinator {
+	if max <= 0 {
+		return nil
+	}
+	return &rolloutCoordinator{max: max, rolling: map[types.NamespacedName]bool{}}
+}
+
+// acquire reports whether key may start a rollout. Otherwise it is queued and its position
+// returned.
+func (r *rolloutCoordinator) acquire(key types.NamespacedName) (bool, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.publish()
+	if r.rolling[key] {
+		return true, 0
+	}
+	position := slices.Index(r.queue, key)
+	if position < 0 {
+		r.queue = append(r.queue, key)
+		position = len(r.queue) - 1
+	}
+	if position >= r.max-len(r.rolling) {
+		return false, position + 1
+	}
+	r.queue = slices.Delete(r.queue, position, position+1)
+	r.rolling[key] = true
+	return true, 0
+}
+
+// track counts a rollout that started without acquire, e.g. before the operator restarted.
+func (r *rolloutCoordinator) track(key types.NamespacedName) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.publish()
+	r.rolling[key] = true
+	r.queue = slices.DeleteFunc(r.queue, func(queued types.NamespacedName) bool { return queued == key })
+}
+
+// release frees the slot of key, or removes it from the queue.
+func (r *rolloutCoordinator) release(key types.NamespacedName) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.publish()
+	delete(r.rolling, key)
+	r.queue = slices.DeleteFunc(r.queue, func(queued types.NamespacedName) bool { return queued == key })
+}
+
+func (r *rolloutCoordinator) publish() {
+	rolloutsInProgress.Set(float64(len(r.rolling)))
+	rolloutsQueued.Set(float64(len(r.queue)))
+}
+
+func templateHash(template *corev1.PodTemplateSpec) (string, error) {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// throttleRollout annotates the rendered deployment with the hash of its pod template and
+// the MyApp's generation, and returns a RolloutQueued condition when applying it would start
+// a rollout that has to wait for its wave, or for a slot while the fleet is at its limit.
+// The Deployment is then left as it is. Creating Deployments isn't throttled.
+func (c *Controller) throttleRollout(ctx context.Context, myApp *api.MyApp, deployment *appv1.Deployment) (*metav1.Condition, error) {
+	if c.rollouts == nil && c.waves == nil {
+		return nil, nil
+	}
+	key := client.ObjectKeyFromObject(myApp)
+	hash, err := templateHash(&deployment.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+	if deployment.Annotations == nil {
+		deployment.Annotations = map[string]string{}
+	}
+	deployment.Annotations[templateHashAnnotation] = hash
+	generation := strconv.FormatInt(myApp.Generation, 10)
+	deployment.Annotations[appGenerationAnnotation] = generation
+
+	live := &appv1.Deployment{}
+	if err := c.getChild(ctx, key, live); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	now := time.Now()
+	wave := rolloutWave(myApp)
+	rolling, _, _ := deploymentProgress(live)
+	health, _, _ := deploymentHealth(live)
+	// Deployments rendered before the annotation existed are updated without waiting.
+	if current := live.Annotations[templateHashAnnotation]; current == "" || current == hash {
+		c.waves.observe(key, wave, rolling && live.Annotations[appGenerationAnnotation] == generation, health == healthDegraded, now)
+		if rolling {
+			c.rollouts.track(key)
+		} else {
+			c.rollouts.release(key)
+		}
+		return nil, nil
+	}
+
+	cond := &metav1.Condition{
+		Type:               api.ConditionRolloutQueued,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: myApp.Generation,
+	}
+	// Changes of the MyApp's own spec don't wait for the waves.
+	if live.Annotations[appGenerationAnnotation] == generation {
+		c.waves.observe(key, wave, true, health == healthDegraded, now)
+		if cond.Reason, cond.Message = c.waves.hold(wave, now); cond.Reason != "" {
+			return cond, nil
+		}
+	}
+	if c.rollouts == nil {
+		return nil, nil
+	}
+	allowed, position := c.rollouts.acquire(key)
+	if allowed {
+		return nil, nil
+	}
+	cond.Reason = "ConcurrentRolloutLimit"
+	cond.Message = fmt.Sprintf("The limit of %d concurrent rollouts is reached, position %d in the queue", c.rollouts.max, position)
+	return cond, nil
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// secretsVersionAnnotation on the pod template records the versions of the Secrets the
+	// pods were started with. Changing it restarts them.
+	secretsVersionAnnotation = "myapp.example.com/secrets-version"
+	// secretRotationRecheckInterval is how often the Secrets of opted in MyApps are checked.
+	// Secrets aren't watched, only their ExternalSecrets are.
+	secretRotationRecheckInterval = 5 * time.Minute
+	// secretRotationRetryInterval is how often a held back restart is retried.
+	secretRotationRetryInterval = 30 * time.Second
+)
+
+var secretRotationRestarts = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "myapp_secret_rotation_restarts_in_progress",
+	Help: "Number of MyApps whose pods are restarting for rotated Secrets",
+})
+
+func init() {
+	metrics.Registry.MustRegister(secretRotationRestarts)
+}
+
+// rotationLimiter caps the MyApps restarting for rotated Secrets at once across the fleet.
+// A MyApp holds its slot until its Deployment is rolled out. A nil *rotationLimiter is unlimited.
+type rotationLimiter struct {
+	max int
+
+	mu         sync.Mutex
+	restarting map[types.NamespacedName]bool
+}
+
+// newRotationLimiter returns nil when max isn't positive.
+func newRotationLimiter(max int) *rotationLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &rotationLimiter{max: max, restarting: map[types.NamespacedName]bool{}}
+}
+
+func (l *rotationLimiter) acquire(key types.NamespacedName) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.restarting[key] && len(l.restarting) >= l.max {
+		return false
+	}
+	l.restarting[key] = true
+	secretRotationRestarts.Set(float64(len(l.restarting)))
+	return true
+}
+
+func (l *rotationLimiter) release(key types.NamespacedName) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.restarting, key)
+	secretRotationRestarts.Set(float64(len(l.restarting)))
+}
+
+// secretsVersion identifies the versions of secrets.
+func secretsVersion(secrets []corev1.Secret) string {
+	versions := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		versions = append(versions, secret.Name+"="+secret.ResourceVersion)
+	}
+	slices.Sort(versions)
+	sum := sha256.Sum256([]byte(strings.Join(versions, ",")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// rotateSecrets restarts the pods of a MyApp opting in to Spec.SecretRotation once the
+// Secrets they consume rotated. The restart is held back while the Deployment is rolling
+// out, while its PodDisruptionBudget allows no disruption, and while the fleet is at its
+// limit of concurrent restarts; it reports whether it was, so the MyApp is requeued.
+// deployment is the rendered Deployment, its pod template annotated with the versions of
+// the Secrets its pods are to run with.
+func (c *Controller) rotateSecrets(ctx context.Context, myApp *api.MyApp, deployment *appv1.Deployment, secrets []corev1.Secret) (bool, error) {
+	key := client.ObjectKeyFromObject(myApp)
+	if myApp.Spec.SecretRotation == nil {
+		c.rotations.release(key)
+		return false, nil
+	}
+	if names := myApp.Spec.SecretRotation.Secrets; len(names) > 0 {
+		secrets = slices.DeleteFunc(slices.Clone(secrets), func(secret corev1.Secret) bool {
+			return !slices.Contains(names, secret.Name)
+		})
+	}
+	version := secretsVersion(secrets)
+	annotate := func(version string) {
+		if version == "" {
+			return
+		}
+		if deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = map[string]string{}
+		}
+		deployment.Spec.Template.Annotations[secretsVersionAnnotation] = version
+	}
+
+	live := &appv1.Deployment{}
+	if err := c.getChild(ctx, key, live); err != nil {
+		if apierrors.IsNotFound(err) {
+			annotate(version)
+			return false, nil
+		}
+		return false, err
+	}
+	current := live.Spec.Template.Annotations[secretsVersionAnnotation]
+	rolling, _, _ := deploymentProgress(live)
+	if current == version {
+		if !rolling {
+			c.rotations.release(key)
+		}
+		annotate(version)
+		return false, nil
+	}
+
+	// The pods keep their Secrets until the restart may start.
+	annotate(current)
+	if rolling {
+		return true, nil
+	}
+	pdb := &policyv1.PodDisruptionBudget{}
+	if err := c.getChild(ctx, key, pdb); client.IgnoreNotFound(err) != nil {
+		return false, err
+	} else if err == nil && pdb.Status.DisruptionsAllowed < 1 {
+		return true, nil
+	}
+	if !c.rotations.acquire(key) {
+		return true, nil
+	}
+	names := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		names = append(names, secret.Name)
+	}
+	ctrl.LoggerFrom(ctx).Info("secrets rotated, restarting pods", "secrets", names)
+	c.recorder.Event(myApp, corev1.EventTypeNormal, "SecretsRotated", fmt.Sprintf("Restarting pods for rotated Secrets %s", strings.Join(names, ", ")))
+	annotate(version)
+	return false, nil
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups=node.k8s.io,resources=runtimeclasses,verbs=get;list;watch
+
+// runtimeClassOverhead returns the resources the sandbox of the MyApp's RuntimeClass adds
+// to each pod, nil when the MyApp has no RuntimeClass or it declares no overhead.
+func (c *Controller) runtimeClassOverhead(ctx context.Context, myApp *api.MyApp) (corev1.ResourceList, error) {
+	if myApp.Spec.RuntimeClassName == "" {
+		return nil, nil
+	}
+	rc := &nodev1.RuntimeClass{}
+	if err := c.client.Get(ctx, client.ObjectKey{Name: myApp.Spec.RuntimeClassName}, rc); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The pods would be rejected by the RuntimeClass admission plugin.
+			return nil, fmt.Errorf("RuntimeClass %s not found", myApp.Spec.RuntimeClassName)
+		}
+		return nil, err
+	}
+	if rc.Overhead == nil {
+		return nil, nil
+	}
+	return rc.Overhead.PodFixed, nil
+}
+
+func runtimeClassName(myApp *api.MyApp) *string {
+	if myApp.Spec.RuntimeClassName == "" {
+		return nil
+	}
+	return &myApp.Spec.RuntimeClassName
+}
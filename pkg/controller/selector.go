@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// appSelector restricts the MyApps the controller manages by their labels, so the operator
+// can be rolled out across an existing fleet gradually. A nil *appSelector selects every MyApp.
+type appSelector struct {
+	selector labels.Selector
+}
+
+// newAppSelector parses a label selector. It returns nil when selector is empty.
+func newAppSelector(selector string) (*appSelector, error) {
+	if selector == "" {
+		return nil, nil
+	}
+	s, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid watch label selector %q: %w", selector, err)
+	}
+	return &appSelector{selector: s}, nil
+}
+
+func (s *appSelector) matches(app *api.MyApp) bool {
+	return s == nil || s.selector.Matches(labels.Set(app.Labels))
+}
+
+// predicate drops events of MyApps that aren't selected. Events of other objects pass, the
+// reconcile checks the labels of the MyApp they map to.
+func (s *appSelector) predicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		app, ok := obj.(*api.MyApp)
+		return !ok || s.matches(app)
+	})
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	defaultServicePort = 80
+
+	// externalDNSHostnameAnnotation asks external-dns to publish a record for a Service or Ingress.
+	externalDNSHostnameAnnotation = "external-dns.alpha.kubernetes.io/hostname"
+)
+
+// builtinServiceProfiles map profile names to the cloud provider annotations they expand into.
+var builtinServiceProfiles = map[string]map[string]string{
+	api.ServiceProfileAWSNLB: {
+		"service.beta.kubernetes.io/aws-load-balancer-type":            "external",
+		"service.beta.kubernetes.io/aws-load-balancer-nlb-target-type": "ip",
+		"service.beta.kubernetes.io/aws-load-balancer-scheme":          "internet-facing",
+	},
+	api.ServiceProfileGKEInternal: {
+		"networking.gke.io/load-balancer-type": "Internal",
+	},
+	api.ServiceProfileAzureInternal: {
+		"service.beta.kubernetes.io/azure-load-balancer-internal": "true",
+	},
+}
+
+// loadServiceProfiles returns the built-in profiles merged with the profiles defined in
+// file, a YAML map of profile name to annotations. Profiles in file replace built-ins of the same name.
+func loadServiceProfiles(file string) (map[string]map[string]string, error) {
+	profiles := make(map[string]map[string]string, len(builtinServiceProfiles))
+	for name, annotations := range builtinServiceProfiles {
+		profiles[name] = annotations
+	}
+	if file == "" {
+		return profiles, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	custom := map[string]map[string]string{}
+	if err := yaml.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("parsing service profiles %s: %w", file, err)
+	}
+	for name, annotations := range custom {
+		profiles[name] = annotations
+	}
+	return profiles, nil
+}
+
+// serviceSpec returns the Service to generate for myApp, if any. An Ingress needs a
+// Service to route to, so one with defaults is generated when only Spec.Ingress is set.
+func serviceSpec(myApp *api.MyApp) *api.ServiceSpec {
+	if myApp.Spec.Service != nil {
+		return myApp.Spec.Service
+	}
+	if myApp.Spec.Ingress != nil {
+		return &api.ServiceSpec{}
+	}
+	return nil
+}
+
+func servicePorts(spec *api.ServiceSpec) (int32, int32) {
+	port := spec.Port
+	if port == 0 {
+		port = defaultServicePort
+	}
+	target := spec.TargetPort
+	if target == 0 {
+		target = port
+	}
+	return port, target
+}
+
+func createService(myApp *api.MyApp, profiles map[string]map[string]string) (*corev1.Service, error) {
+	spec := serviceSpec(myApp)
+	annotations := map[string]string{}
+	if spec.Profile != "" {
+		profile, ok := profiles[spec.Profile]
+		if !ok {
+			return nil, fmt.Errorf("unknown service profile %q", spec.Profile)
+		}
+		for k, v := range profile {
+			annotations[k] = v
+		}
+	}
+	if spec.Hostname != "" {
+		annotations[externalDNSHostnameAnnotation] = spec.Hostname
+	}
+	for k, v := range spec.Annotations {
+		annotations[k] = v
+	}
+
+	serviceType := spec.Type
+	if serviceType == "" {
+		serviceType = corev1.ServiceTypeClusterIP
+		if spec.Profile != "" {
+			serviceType = corev1.ServiceTypeLoadBalancer
+		}
+	}
+
+	port, target := servicePorts(spec)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   myApp.Namespace,
+			Name:        myApp.Name,
+			Annotations: annotations,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     serviceType,
+			Selector: labelsForMyApp(myApp.Name),
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Port:       port,
+					TargetPort: intstr.FromInt32(target),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+	return service, nil
+}
+
+// exposePort declares the Service's target port on the app container.
+func exposePort(myApp *api.MyApp, template *corev1.PodTemplateSpec) {
+	spec := serviceSpec(myApp)
+	if spec == nil {
+		return
+	}
+	_, target := servicePorts(spec)
+	for i := range template.Spec.Containers {
+		template.Spec.Containers[i].Ports = append(template.Spec.Containers[i].Ports, corev1.ContainerPort{
+			Name:          "http",
+			ContainerPort: target,
+			Protocol:      corev1.ProtocolTCP,
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	"github.com/steeling/controller-runtime-exercise/pkg/backup"
+	"github.com/steeling/controller-runtime-exercise/pkg/preflight"
+	"github.com/steeling/controller-runtime-exercise/pkg/preview"
+	"github.com/steeling/controller-runtime-exercise/pkg/rbac"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	policyv1 "k8s.io/api/policy/v1"
+)
+
+// setup registers one of the controllers the operator runs with its manager. Controllers
+// share the manager, its cache and the operator's audited client.
+type setup struct {
+	name string
+	// enabledByDefault controllers run unless disabled with "-name".
+	enabledByDefault bool
+	// preflight returns the checks the cluster must pass for the controller to run. They
+	// run before any controller is set up.
+	preflight func(c *Controller) []preflight.Check
+	setup     func(ctx context.Context, c *Controller) error
+}
+
+// setups are the controllers the operator can run, in the order they are registered.
+var setups = []setup{
+	{
+		name:             "myapp",
+		enabledByDefault: true,
+		preflight: func(c *Controller) []preflight.Check {
+			mapper := c.manager.GetRESTMapper()
+			return []preflight.Check{
+				preflight.KindServed(mapper, api.GroupVersion.WithKind("MyApp"), "the MyApp CRD isn't installed, apply configs/crd/app.yaml or run with --install-crds"),
+				preflight.KindServed(mapper, api.GroupVersion.WithKind("MyAppTemplate"), "the MyAppTemplate CRD isn't installed, apply configs/crd/template.yaml or run with --install-crds"),
+				preflight.KindServed(mapper, api.GroupVersion.WithKind("MaintenanceWindow"), "the MaintenanceWindow CRD isn't installed, apply configs/crd/maintenance.yaml or run with --install-crds"),
+				preflight.KindServed(mapper, autoscalingv2.SchemeGroupVersion.WithKind("HorizontalPodAutoscaler"), "the cluster doesn't serve autoscaling/v2, Kubernetes 1.23 or newer is required"),
+				preflight.KindServed(mapper, policyv1.SchemeGroupVersion.WithKind("PodDisruptionBudget"), "the cluster doesn't serve policy/v1, Kubernetes 1.21 or newer is required"),
+				// Missing permissions fail the startup rather than every reconcile.
+				preflight.Permissions(c.manager.GetClient(), rbac.Required),
+			}
+		},
+		setup: func(ctx context.Context, c *Controller) error {
+			return c.SetupWithManager(ctx, c.manager)
+		},
+	},
+	{
+		// The MyAppBackup and MyAppRestore CRDs are optional.
+		name: "backup",
+		preflight: func(c *Controller) []preflight.Check {
+			mapper := c.manager.GetRESTMapper()
+			return []preflight.Check{
+				preflight.KindServed(mapper, api.GroupVersion.WithKind("MyAppBackup"), "the MyAppBackup CRD isn't installed, apply configs/crd/backup.yaml or run with --install-crds"),
+				preflight.KindServed(mapper, api.GroupVersion.WithKind("MyAppRestore"), "the MyAppRestore CRD isn't installed, apply configs/crd/restore.yaml or run with --install-crds"),
+			}
+		},
+		setup: func(_ context.Context, c *Controller) error {
+			return backup.SetupWithManager(c.manager, c.client)
+		},
+	},
+	{
+		// The MyAppPreview CRD is optional.
+		name: "preview",
+		preflight: func(c *Controller) []preflight.Check {
+			return []preflight.Check{
+				preflight.KindServed(c.manager.GetRESTMapper(), api.GroupVersion.WithKind("MyAppPreview"), "the MyAppPreview CRD isn't installed, apply configs/crd/preview.yaml or run with --install-crds"),
+			}
+		},
+		setup: func(ctx context.Context, c *Controller) error {
+			return preview.SetupWithManager(ctx, c.manager, c.client)
+		},
+	},
+}
+
+// enabledControllers parses a comma separated list of controller names. "*" stands for the
+// controllers enabled by default and "-name" disables one. An empty list is "*".
+func enabledControllers(list string) (map[string]bool, error) {
+	if strings.TrimSpace(list) == "" {
+		list = "*"
+	}
+	known := map[string]bool{}
+	for _, s := range setups {
+		known[s.name] = true
+	}
+	enabled := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+		case name == "*":
+			for _, s := range setups {
+				if s.enabledByDefault {
+					enabled[s.name] = true
+				}
+			}
+		case strings.HasPrefix(name, "-") && known[name[1:]]:
+			enabled[name[1:]] = false
+		case known[name]:
+			enabled[name] = true
+		default:
+			return nil, fmt.Errorf("unknown controller %q", name)
+		}
+	}
+	return enabled, nil
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// shard identifies the slice of the fleet a replica reconciles. MyApps are assigned to
+// shards by a consistent hash of their namespace/name, so changing the shard count only
+// moves the MyApps that have to move.
+type shard struct {
+	index, count int
+}
+
+// newShard returns the shard configured by count and index. A negative index is taken from
+// the ordinal of the StatefulSet pod the operator runs in. It returns nil when sharding is disabled.
+func newShard(count, index int) (*shard, error) {
+	if count <= 1 {
+		return nil, nil
+	}
+	if index < 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		index, err = statefulSetOrdinal(hostname)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if index >= count {
+		return nil, fmt.Errorf("shard index %d is out of range for %d shards", index, count)
+	}
+	return &shard{index: index, count: count}, nil
+}
+
+// statefulSetOrdinal parses the ordinal StatefulSet pods carry as their name suffix, e.g. 2 for "my-app-controller-2".
+func statefulSetOrdinal(hostname string) (int, error) {
+	i := strings.LastIndex(hostname, "-")
+	ordinal, err := strconv.Atoi(hostname[i+1:])
+	if i < 0 || err != nil || ordinal < 0 {
+		return 0, fmt.Errorf("hostname %q has no StatefulSet ordinal, set the shard index explicitly", hostname)
+	}
+	return ordinal, nil
+}
+
+// owns reports whether the MyApp with the given key belongs to this shard.
+func (s *shard) owns(key types.NamespacedName) bool {
+	if s == nil {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key.String()))
+	return jumpHash(h.Sum64(), s.count) == s.index
+}
+
+// predicate filters events for MyApps and children of other shards. Children are keyed by
+// the MyApp controlling them, as not all of them are named after it, e.g. the Jobs of runs
+// and tasks. Events of other objects, e.g. LimitRanges, pass; their map funcs only request
+// the MyApps of this shard.
+func (s *shard) predicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		key, ok := appKey(obj)
+		return !ok || s.owns(key)
+	})
+}
+
+// appKey returns the key of the MyApp obj belongs to: its own for MyApps, its controller's
+// for children. The Jobs of runs are controlled by the CronJob, named after the MyApp. It
+// returns false for other objects.
+func appKey(obj client.Object) (types.NamespacedName, bool) {
+	if _, ok := obj.(*api.MyApp); ok {
+		return client.ObjectKeyFromObject(obj), true
+	}
+	if owner := metav1.GetControllerOf(obj); owner != nil && isAppOwner(owner) {
+		return types.NamespacedName{Namespace: obj.GetNamespace(), Name: owner.Name}, true
+	}
+	return types.NamespacedName{}, false
+}
+
+// isAppOwner reports whether owner is a MyApp, or a CronJob of one.
+func isAppOwner(owner *metav1.OwnerReference) bool {
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	if err != nil {
+		return false
+	}
+	return gv.Group == api.GroupVersion.Group && owner.Kind == "MyApp" ||
+		gv.Group == batchv1.GroupName && owner.Kind == "CronJob"
+}
+
+// jumpHash is the jump consistent hash of Lamping and Veach, https://arxiv.org/abs/1406.2294.
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestJumpHash(t *testing.T) {
+	for key := uint64(0); key < 1000; key++ {
+		if b := jumpHash(key, 1); b != 0 {
+			t.Fatalf("jumpHash(%d, 1) = %d, want 0", key, b)
+		}
+		prev := 0
+		for buckets := 2; buckets <= 16; buckets++ {
+			b := jumpHash(key, buckets)
+			if b < 0 || b >= buckets {
+				t.Fatalf("jumpHash(%d, %d) = %d, out of range", key, buckets, b)
+			}
+			// Adding a bucket only moves keys to the new bucket.
+			if b != prev && b != buckets-1 {
+				t.Fatalf("jumpHash(%d, %d) = %d, moved from %d to an old bucket", key, buckets, b, prev)
+			}
+			prev = b
+		}
+	}
+}
+
+func TestShardOwns(t *testing.T) {
+	var unsharded *shard
+	if !unsharded.owns(types.NamespacedName{Namespace: "ns", Name: "web"}) {
+		t.Error("a nil shard doesn't own every MyApp")
+	}
+	const count = 4
+	for i := 0; i < 100; i++ {
+		key := types.NamespacedName{Namespace: "ns", Name: fmt.Sprintf("app-%d", i)}
+		owners := 0
+		for index := 0; index < count; index++ {
+			if (&shard{index: index, count: count}).owns(key) {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Errorf("%s is owned by %d shards, want 1", key, owners)
+		}
+	}
+}
+
+func TestNewShard(t *testing.T) {
+	tests := []struct {
+		count, index int
+		want         *shard
+		wantErr      bool
+	}{
+		{count: 0, index: 3},
+		{count: 1, index: 0},
+		{count: 3, index: 2, want: &shard{index: 2, count: 3}},
+		{count: 3, index: 3, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := newShard(tt.count, tt.index)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newShard(%d, %d) error = %v, want error %v", tt.count, tt.index, err, tt.wantErr)
+			continue
+		}
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("newShard(%d, %d) = %v, want %v", tt.count, tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestStatefulSetOrdinal(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     int
+		wantErr  bool
+	}{
+		{hostname: "my-app-controller-2", want: 2},
+		{hostname: "controller-0", want: 0},
+		{hostname: "controller", wantErr: true},
+		{hostname: "my-app-controller-abc12", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := statefulSetOrdinal(tt.hostname)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("statefulSetOrdinal(%q) = %d, %v, want %d, error %v", tt.hostname, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func controlledBy(apiVersion, kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name, Controller: &controller}}
+}
+
+func TestAppKey(t *testing.T) {
+	myApp := api.GroupVersion.String()
+	tests := []struct {
+		name   string
+		obj    client.Object
+		want   types.NamespacedName
+		wantOK bool
+	}{
+		{
+			name:   "MyApp",
+			obj:    &api.MyApp{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"}},
+			want:   types.NamespacedName{Namespace: "ns", Name: "web"},
+			wantOK: true,
+		},
+		{
+			name:   "child named after its MyApp",
+			obj:    &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web", OwnerReferences: controlledBy(myApp, "MyApp", "web")}},
+			want:   types.NamespacedName{Namespace: "ns", Name: "web"},
+			wantOK: true,
+		},
+		{
+			name:   "ConfigMap",
+			obj:    &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-fluent-bit", OwnerReferences: controlledBy(myApp, "MyApp", "web")}},
+			want:   types.NamespacedName{Namespace: "ns", Name: "web"},
+			wantOK: true,
+		},
+		{
+			name:   "task Job",
+			obj:    &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-task-migrate", OwnerReferences: controlledBy(myApp, "MyApp", "web")}},
+			want:   types.NamespacedName{Namespace: "ns", Name: "web"},
+			wantOK: true,
+		},
+		{
+			name:   "run Job",
+			obj:    &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-28930140", OwnerReferences: controlledBy("batch/v1", "CronJob", "web")}},
+			want:   types.NamespacedName{Namespace: "ns", Name: "web"},
+			wantOK: true,
+		},
+		{
+			name: "owned but not controlled",
+			obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web", OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: myApp, Kind: "MyApp", Name: "web"},
+			}}},
+		},
+		{
+			name: "controlled by another kind",
+			obj:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-5d8f7-x2x9z", OwnerReferences: controlledBy("apps/v1", "ReplicaSet", "web-5d8f7")}},
+		},
+		{
+			name: "LimitRange",
+			obj:  &corev1.LimitRange{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "limits"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := appKey(tt.obj)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("appKey() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestShardPredicate(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ns", Name: "web"}
+	owner := &shard{count: 2}
+	other := &shard{index: 1, count: 2}
+	if !owner.owns(key) {
+		owner, other = other, owner
+	}
+	objects := []client.Object{
+		&api.MyApp{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-28930140", OwnerReferences: controlledBy("batch/v1", "CronJob", "web")}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-fluent-bit", OwnerReferences: controlledBy(api.GroupVersion.String(), "MyApp", "web")}},
+	}
+	for _, obj := range objects {
+		if !owner.predicate().Create(event.CreateEvent{Object: obj}) {
+			t.Errorf("the shard owning %s filtered %T %s", key, obj, obj.GetName())
+		}
+		if other.predicate().Create(event.CreateEvent{Object: obj}) {
+			t.Errorf("a shard not owning %s passed %T %s", key, obj, obj.GetName())
+		}
+	}
+	limitRange := &corev1.LimitRange{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "limits"}}
+	for _, s := range []*shard{owner, other} {
+		if !s.predicate().Create(event.CreateEvent{Object: limitRange}) {
+			t.Errorf("shard %d filtered a LimitRange", s.index)
+		}
+	}
+}
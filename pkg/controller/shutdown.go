@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// defaultDrainSeconds is the drain time of Spec.GracefulShutdown when unset.
+	defaultDrainSeconds = 15
+	// defaultTerminationGracePeriod is the time, in seconds, Kubernetes gives a container
+	// between SIGTERM and SIGKILL. The drain time is added to it.
+	defaultTerminationGracePeriod = 30
+)
+
+// configureShutdown applies the MyApp's graceful shutdown to its Deployment. A terminating
+// pod stays up for the drain time, ideally without receiving SIGTERM yet, while the load
+// balancers deregister it, and a new pod only counts as available once they had the same
+// time to register it.
+func configureShutdown(myApp *api.MyApp, deployment *appv1.Deployment) {
+	spec := myApp.Spec.GracefulShutdown
+	if spec == nil {
+		return
+	}
+	drain := spec.DrainSeconds
+	if drain == 0 {
+		drain = defaultDrainSeconds
+	}
+	deployment.Spec.MinReadySeconds = drain
+	grace := int64(drain) + defaultTerminationGracePeriod
+	template := &deployment.Spec.Template
+	template.Spec.TerminationGracePeriodSeconds = &grace
+	if !spec.SleepPreStop {
+		return
+	}
+	for i := range template.Spec.Containers {
+		container := &template.Spec.Containers[i]
+		if container.Lifecycle == nil {
+			container.Lifecycle = &corev1.Lifecycle{}
+		}
+		container.Lifecycle.PreStop = &corev1.LifecycleHandler{
+			Sleep: &corev1.SleepAction{Seconds: int64(drain)},
+		}
+	}
+}
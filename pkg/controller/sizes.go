@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+// sizeProfile is what a Spec.Size expands into. The fields a MyApp or its template set take
+// precedence.
+type sizeProfile struct {
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	Replicas  *int32                       `json:"replicas,omitempty"`
+	// MaxUnavailable of the MyApp's PodDisruptionBudget. Defaults to 1.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+func int32Ptr(n int32) *int32 { return &n }
+
+// builtinSizeProfiles are the sizes used when the operator doesn't configure them.
+var builtinSizeProfiles = map[string]sizeProfile{
+	api.SizeSmall: {
+		Resources: &corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+			Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m"), corev1.ResourceMemory: resource.MustParse("256Mi")},
+		},
+		Replicas: int32Ptr(1),
+	},
+	api.SizeMedium: {
+		Resources: &corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("512Mi")},
+			Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("1Gi")},
+		},
+		Replicas: int32Ptr(2),
+	},
+	api.SizeLarge: {
+		Resources: &corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("2Gi")},
+			Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4"), corev1.ResourceMemory: resource.MustParse("4Gi")},
+		},
+		Replicas:       int32Ptr(3),
+		MaxUnavailable: &intstr.IntOrString{Type: intstr.String, StrVal: "25%"},
+	},
+}
+
+// loadSizeProfiles returns the built-in sizes merged with the sizes defined in file, a YAML
+// map of size name to profile. Sizes in file replace the built-ins of the same name.
+func loadSizeProfiles(file string) (map[string]sizeProfile, error) {
+	profiles := make(map[string]sizeProfile, len(builtinSizeProfiles))
+	for name, profile := range builtinSizeProfiles {
+		profiles[name] = profile
+	}
+	if file == "" {
+		return profiles, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	custom := map[string]sizeProfile{}
+	if err := yaml.UnmarshalStrict(data, &custom); err != nil {
+		return nil, fmt.Errorf("parsing size profiles %s: %w", file, err)
+	}
+	for name, profile := range custom {
+		if _, ok := builtinSizeProfiles[name]; !ok {
+			return nil, fmt.Errorf("size profiles %s: unknown size %q, must be one of %s, %s or %s", file, name, api.SizeSmall, api.SizeMedium, api.SizeLarge)
+		}
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// applySize fills the resources and replicas spec leaves unset from its size. spec is
+// modified in memory only and must not be written back.
+func (c *Controller) applySize(spec *api.MyAppSpec) {
+	profile, ok := c.sizes[spec.Size]
+	if !ok {
+		return
+	}
+	if spec.Resources == nil && profile.Resources != nil {
+		spec.Resources = profile.Resources.DeepCopy()
+	}
+	if spec.Replicas == nil && profile.Replicas != nil {
+		replicas := *profile.Replicas
+		spec.Replicas = &replicas
+	}
+}
+
+// maxUnavailable returns the MaxUnavailable of the PodDisruptionBudget of myApp, from its
+// tier or its size.
+func (c *Controller) maxUnavailable(myApp *api.MyApp) intstr.IntOrString {
+	if profile, ok := c.tiers[effectiveTier(&myApp.Spec)]; ok && profile.MaxUnavailable != nil {
+		return *profile.MaxUnavailable
+	}
+	if profile, ok := c.sizes[myApp.Spec.Size]; ok && profile.MaxUnavailable != nil {
+		return *profile.MaxUnavailable
+	}
+	return intstr.FromInt32(1)
+}
@@ -0,0 +1,273 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var statusWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "myapp_status_writes_total",
+	Help: "Number of MyApp status updates, by result. unchanged updates are skipped without a write",
+}, []string{"result"})
+
+func init() {
+	metrics.Registry.MustRegister(statusWrites)
+}
+
+// Condition reasons set by the controller.
+const (
+	reasonCreating        = "Creating"
+	reasonRollingOut      = "RollingOut"
+	reasonRolloutComplete = "RolloutComplete"
+	reasonAvailable       = "MinimumReplicasAvailable"
+	reasonAsExpected      = "AsExpected"
+	reasonRolloutFailed   = "RolloutFailed"
+	reasonUnavailable     = "Unavailable"
+)
+
+// computeStatus derives the status of app from its Deployment, or from its most recent
+// run for Job and CronJob workloads. deployment is nil while it hasn't been created yet.
+func computeStatus(app *api.MyApp, deployment *appv1.Deployment, run *api.JobRunStatus) api.MyAppStatus {
+	status := *app.Status.DeepCopy()
+	status.Errors = nil
+	if app.Spec.Replicas != nil {
+		status.Replicas = *app.Spec.Replicas
+	}
+	if deployment != nil && deployment.Spec.Replicas != nil {
+		status.Replicas = *deployment.Spec.Replicas
+	}
+
+	progressing, progressReason, progressMessage := true, reasonCreating, "Waiting for the deployment to be created"
+	health, healthReason, healthMessage := healthUnknown, "", ""
+	switch {
+	case batchWorkload(app):
+		progressing, progressReason, progressMessage, health, healthReason, healthMessage = jobProgress(app, run)
+	case deployment != nil:
+		progressing, progressReason, progressMessage = deploymentProgress(deployment)
+		health, healthReason, healthMessage = deploymentHealth(deployment)
+	}
+
+	available := metav1.Condition{
+		Type:    api.ConditionAvailable,
+		Status:  metav1.ConditionFalse,
+		Reason:  reasonCreating,
+		Message: "The deployment has no available replicas yet",
+	}
+	if health == healthAvailable {
+		available.Status, available.Reason, available.Message = metav1.ConditionTrue, reasonAvailable, "The deployment has minimum availability"
+	} else if health == healthDegraded {
+		available.Reason, available.Message = healthReason, healthMessage
+	}
+
+	degraded := metav1.Condition{
+		Type:   api.ConditionDegraded,
+		Status: metav1.ConditionFalse,
+		Reason: reasonAsExpected,
+	}
+	if health == healthDegraded {
+		degraded.Status, degraded.Reason, degraded.Message = metav1.ConditionTrue, healthReason, healthMessage
+		status.Errors = append(status.Errors, healthMessage)
+		// A failed rollout is no longer making progress.
+		if healthReason == reasonRolloutFailed {
+			progressing, progressReason, progressMessage = false, healthReason, healthMessage
+		}
+	}
+
+	progress := metav1.Condition{
+		Type:    api.ConditionProgressing,
+		Status:  metav1.ConditionFalse,
+		Reason:  progressReason,
+		Message: progressMessage,
+	}
+	if progressing {
+		progress.Status = metav1.ConditionTrue
+	}
+
+	ready := metav1.Condition{
+		Type:    api.ConditionReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  available.Reason,
+		Message: available.Message,
+	}
+	if health == healthAvailable && !progressing {
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionTrue, reasonRolloutComplete, "The MyApp is available and fully rolled out"
+	}
+
+	reconciling := progress
+	reconciling.Type = api.ConditionReconciling
+
+	stalled := metav1.Condition{
+		Type:   api.ConditionStalled,
+		Status: metav1.ConditionFalse,
+		Reason: reasonAsExpected,
+	}
+	if health == healthDegraded && !progressing {
+		stalled.Status, stalled.Reason, stalled.Message = metav1.ConditionTrue, healthReason, healthMessage
+	}
+
+	for _, cond := range []metav1.Condition{available, progress, degraded, ready, reconciling, stalled} {
+		cond.ObservedGeneration = app.Generation
+		meta.SetStatusCondition(&status.Conditions, cond)
+	}
+
+	switch {
+	case health == healthDegraded:
+		status.Phase = api.PhaseDegraded
+	case health == healthAvailable && !progressing:
+		status.Phase = api.PhaseHealthy
+	default:
+		status.Phase = api.PhaseProgressing
+	}
+	status.Healthy = status.Phase == api.PhaseHealthy
+	status.ObservedGeneration = app.Generation
+	return status
+}
+
+// deploymentProgress reports whether the Deployment is still rolling out.
+func deploymentProgress(d *appv1.Deployment) (bool, string, string) {
+	desired := int32(1)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+	switch {
+	case d.Generation > d.Status.ObservedGeneration:
+		return true, reasonRollingOut, "Waiting for the deployment spec to be observed"
+	case d.Status.UpdatedReplicas < desired:
+		return true, reasonRollingOut, fmt.Sprintf("%d of %d replicas updated", d.Status.UpdatedReplicas, desired)
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		return true, reasonRollingOut, fmt.Sprintf("%d old replicas pending termination", d.Status.Replicas-d.Status.UpdatedReplicas)
+	case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+		return true, reasonRollingOut, fmt.Sprintf("%d of %d updated replicas available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas)
+	}
+	return false, reasonRolloutComplete, "The deployment is fully rolled out"
+}
+
+// observedState is what a reconcile observed besides the Deployment.
+type observedState struct {
+	// conditions are set on the status in addition to the ones derived from the Deployment.
+	conditions []metav1.Condition
+	// targets is the state of the MyApp in its remote clusters.
+	targets []api.TargetStatus
+	// resources is the inventory of the MyApp's children. The previous inventory is kept when nil.
+	resources []api.ResourceStatus
+	// recommendations are the VerticalPodAutoscaler's. The previous ones are kept when nil,
+	// unless the MyApp has no VerticalPodAutoscaler.
+	recommendations []api.ContainerRecommendation
+	// rightSizing is the recommendation from the MyApp's usage, nil when there is none.
+	rightSizing *api.RightSizingStatus
+	// expiration is when the MyApp expires, nil when it doesn't, and expiresIn the time left.
+	expiration *metav1.Time
+	expiresIn  string
+	// overhead is the pod overhead of the MyApp's RuntimeClass.
+	overhead corev1.ResourceList
+	// lastRun is the most recent run of a Job or CronJob workload.
+	lastRun *api.JobRunStatus
+	// lastRunTrigger is the run annotation acted on.
+	lastRunTrigger string
+	// tasks are the most recent runs of the MyApp's tasks.
+	tasks []api.TaskStatus
+	// taskTrigger is the run-task annotation acted on.
+	taskTrigger string
+	// debug is the last debugging session.
+	debug *api.DebugStatus
+	// debugTrigger is the debug annotation acted on.
+	debugTrigger string
+	// held is set when the children weren't applied, e.g. during a maintenance window.
+	held bool
+}
+
+// observedConditions are the condition types set from what a reconcile observed, besides the
+// ones computed from the Deployment. keptWhileHeld marks the ones of applying children.
+var observedConditions = []struct {
+	condType      string
+	keptWhileHeld bool
+}{
+	{api.ConditionExternalSecretsReady, false},
+	{api.ConditionServiceConfigured, true},
+	{api.ConditionDNSReady, false},
+	{api.ConditionRouteConfigured, true},
+	{api.ConditionTargetsReady, true},
+	{api.ConditionForbidden, false},
+	{api.ConditionChangeFrozen, false},
+	{api.ConditionConflictingManager, true},
+	{api.ConditionSelectorMismatch, true},
+	{api.ConditionExpired, false},
+	{api.ConditionArchitecturesSupported, false},
+	{api.ConditionRolloutQueued, false},
+	{api.ConditionNodeDrain, false},
+	{api.ConditionZoneFailure, false},
+	{api.ConditionQuotaExceeded, false},
+	{api.ConditionLimitRangeAdjusted, false},
+	{api.ConditionPolicyViolation, false},
+	{api.ConditionChildAdmissionDenied, false},
+}
+
+// updateStatus writes the computed status of app, merged with the observed state, if it changed.
+func (c *Controller) updateStatus(ctx context.Context, app *api.MyApp, deployment *appv1.Deployment, observed observedState) error {
+	status := computeStatus(app, deployment, observed.lastRun)
+	status.LastRun = observed.lastRun
+	status.LastRunTrigger = observed.lastRunTrigger
+	status.Tasks = observed.tasks
+	status.LastTaskTrigger = observed.taskTrigger
+	status.Debug, status.LastDebugTrigger = observed.debug, observed.debugTrigger
+	status.EstimatedCost = c.costs.estimate(client.ObjectKeyFromObject(app), app, deployment, observed.overhead, status.Replicas)
+	for _, cond := range observed.conditions {
+		meta.SetStatusCondition(&status.Conditions, cond)
+	}
+	status.Targets = observed.targets
+	if observed.resources != nil {
+		status.Resources = observed.resources
+	}
+	status.RightSizing = observed.rightSizing
+	status.ExpirationTime, status.ExpiresIn = observed.expiration, observed.expiresIn
+	if observed.recommendations != nil {
+		status.Recommendations = observed.recommendations
+	}
+	if app.Spec.Autoscaling == nil || app.Spec.Autoscaling.Vertical == nil {
+		status.Recommendations = nil
+	}
+	// Conditions a reconcile didn't observe are removed, e.g. once their feature is removed
+	// from the spec. The conditions of applying children are kept while they are held, until
+	// they are observed again.
+	for _, owned := range observedConditions {
+		if meta.FindStatusCondition(observed.conditions, owned.condType) == nil && !(observed.held && owned.keptWhileHeld) {
+			meta.RemoveStatusCondition(&status.Conditions, owned.condType)
+		}
+	}
+	return c.applyStatus(ctx, app, status)
+}
+
+// applyStatus writes status to app's status subresource with server-side apply, unless it
+// matches the live status. Only the status is sent, so the write can't conflict with spec
+// edits made since app was read.
+func (c *Controller) applyStatus(ctx context.Context, app *api.MyApp, status api.MyAppStatus) error {
+	if equality.Semantic.DeepEqual(status, app.Status) {
+		statusWrites.WithLabelValues("unchanged").Inc()
+		return nil
+	}
+	patch := &api.MyApp{
+		TypeMeta: metav1.TypeMeta{APIVersion: api.GroupVersion.String(), Kind: "MyApp"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: app.Namespace,
+			Name:      app.Name,
+		},
+		Status: status,
+	}
+	if err := c.client.Status().Patch(ctx, patch, client.Apply, client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+		return err
+	}
+	statusWrites.WithLabelValues("applied").Inc()
+	app.Status = patch.Status
+	app.ResourceVersion = patch.ResourceVersion
+	return nil
+}
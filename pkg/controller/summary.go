@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// summaryConfigMapName is the ConfigMap every namespace's summary is published in.
+	summaryConfigMapName = "myapp-summary"
+	// summaryFlushInterval is how often changed summaries are published.
+	summaryFlushInterval = 10 * time.Second
+)
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=create;patch;delete
+
+// namespaceSummaries maintains the number of MyApps, ready MyApps and replicas of every
+// namespace from the reconcile results, and publishes them in a ConfigMap per namespace for
+// platform dashboards. Only the namespaces that changed are published. A nil
+// *namespaceSummaries publishes nothing.
+type namespaceSummaries struct {
+	client client.Client
+	log    logr.Logger
+
+	mu    sync.Mutex
+	apps  map[string]map[string]summarizedApp
+	dirty map[string]bool
+}
+
+type summarizedApp struct {
+	ready    bool
+	replicas int32
+}
+
+func newNamespaceSummaries(c client.Client, log logr.Logger) *namespaceSummaries {
+	return &namespaceSummaries{
+		client: c,
+		log:    log,
+		apps:   map[string]map[string]summarizedApp{},
+		dirty:  map[string]bool{},
+	}
+}
+
+// observe records the state of app, whose Deployment is deployment or nil while it isn't created.
+func (s *namespaceSummaries) observe(app *api.MyApp, deployment *appv1.Deployment, health appHealth) {
+	if s == nil {
+		return
+	}
+	state := summarizedApp{ready: health == healthAvailable}
+	if deployment != nil {
+		state.replicas = deployment.Status.Replicas
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	apps := s.apps[app.Namespace]
+	if apps == nil {
+		apps = map[string]summarizedApp{}
+		s.apps[app.Namespace] = apps
+	}
+	if prev, ok := apps[app.Name]; !ok || prev != state {
+		apps[app.Name] = state
+		s.dirty[app.Namespace] = true
+	}
+}
+
+// forget drops a deleted MyApp.
+func (s *namespaceSummaries) forget(key types.NamespacedName) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.apps[key.Namespace][key.Name]; ok {
+		delete(s.apps[key.Namespace], key.Name)
+		s.dirty[key.Namespace] = true
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable; only the leader reconciles
+// MyApps, so only it knows their state.
+func (s *namespaceSummaries) NeedLeaderElection() bool {
+	return true
+}
+
+func (s *namespaceSummaries) Start(ctx context.Context) error {
+	ticker := time.NewTicker(summaryFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.flush(ctx)
+		}
+	}
+}
+
+// flush publishes the summaries of the namespaces that changed. Failed ones are retried
+// with the next flush.
+func (s *namespaceSummaries) flush(ctx context.Context) {
+	s.mu.Lock()
+	pending := make(map[string]*corev1.ConfigMap, len(s.dirty))
+	for ns := range s.dirty {
+		var cm *corev1.ConfigMap
+		if apps := s.apps[ns]; len(apps) > 0 {
+			cm = summaryConfigMap(ns, apps)
+		} else {
+			delete(s.apps, ns)
+		}
+		pending[ns] = cm
+	}
+	s.dirty = map[string]bool{}
+	s.mu.Unlock()
+
+	for ns, cm := range pending {
+		var err error
+		if cm == nil {
+			err = client.IgnoreNotFound(s.client.Delete(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: summaryConfigMapName},
+			}))
+		} else {
+			err = s.client.Patch(ctx, cm, client.Apply, client.FieldOwner(fieldOwner), client.ForceOwnership)
+		}
+		if err != nil {
+			s.log.Error(err, "unable to publish namespace summary", "namespace", ns)
+			s.mu.Lock()
+			s.dirty[ns] = true
+			s.mu.Unlock()
+		}
+	}
+}
+
+func summaryConfigMap(namespace string, apps map[string]summarizedApp) *corev1.ConfigMap {
+	var ready int
+	var replicas int32
+	for _, app := range apps {
+		if app.ready {
+			ready++
+		}
+		replicas += app.replicas
+	}
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      summaryConfigMapName,
+		},
+		Data: map[string]string{
+			"apps":      strconv.Itoa(len(apps)),
+			"readyApps": strconv.Itoa(ready),
+			"replicas":  strconv.Itoa(int(replicas)),
+		},
+	}
+}
@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// targetsFinalizer holds a MyApp with Spec.Targets until its objects are removed from
+	// the remote clusters, which owner references can't garbage collect.
+	targetsFinalizer = "myapp.example.com/targets"
+	// ownerAnnotation records the "namespace/name" of the MyApp that created a remote object.
+	ownerAnnotation = "myapp.example.com/owner"
+
+	// targetRecheckInterval is how often remote clusters are polled; they produce no watch events.
+	targetRecheckInterval = 30 * time.Second
+)
+
+// reconcileTargets creates the MyApp's Deployment and PDB in each cluster in Spec.Targets and
+// reports their state. Objects are removed from clusters that were dropped from Spec.Targets.
+// The condition is nil when the MyApp has no targets.
+func (c *Controller) reconcileTargets(ctx context.Context, myApp *api.MyApp) ([]api.TargetStatus, *metav1.Condition, error) {
+	wanted := map[string]bool{}
+	for _, t := range myApp.Spec.Targets {
+		wanted[t.Name] = true
+	}
+	for _, t := range myApp.Status.Targets {
+		if !wanted[t.Name] {
+			if err := c.removeFromTarget(ctx, myApp, t.Name); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if len(myApp.Spec.Targets) == 0 {
+		return nil, nil, nil
+	}
+
+	statuses := make([]api.TargetStatus, 0, len(myApp.Spec.Targets))
+	var pending []string
+	for _, t := range myApp.Spec.Targets {
+		status := c.applyToTarget(ctx, myApp, t.Name)
+		if !status.Ready {
+			pending = append(pending, fmt.Sprintf("%s: %s", t.Name, status.Message))
+		}
+		statuses = append(statuses, status)
+	}
+
+	cond := &metav1.Condition{
+		Type:               api.ConditionTargetsReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "TargetsAvailable",
+		Message:            "The MyApp is available in every target cluster",
+		ObservedGeneration: myApp.Generation,
+	}
+	if len(pending) > 0 {
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionFalse, "TargetsPending", strings.Join(pending, "; ")
+	}
+	return statuses, cond, nil
+}
+
+// applyToTarget creates the MyApp's objects in the named cluster if they don't exist yet.
+// Failures are reported in the returned status, so one unreachable cluster doesn't block the others.
+func (c *Controller) applyToTarget(ctx context.Context, myApp *api.MyApp, name string) api.TargetStatus {
+	status := api.TargetStatus{Name: name}
+	if c.clusters == nil {
+		status.Message = "cluster targets require the operator namespace to be set"
+		return status
+	}
+	remote, err := c.clusters.Client(ctx, name)
+	if err != nil {
+		status.Message = err.Error()
+		return status
+	}
+
+	if err := ensureNamespace(ctx, remote, myApp.Namespace); err != nil {
+		status.Message = fmt.Sprintf("unable to create namespace: %v", err)
+		return status
+	}
+	deployment := createDeployment(myApp)
+	if err := ensureRemote(ctx, remote, myApp, deployment); err != nil {
+		status.Message = fmt.Sprintf("unable to create deployment: %v", err)
+		return status
+	}
+	if err := ensureRemote(ctx, remote, myApp, createPodDisruptionBudget(myApp, c.maxUnavailable(myApp))); err != nil {
+		status.Message = fmt.Sprintf("unable to create PDB: %v", err)
+		return status
+	}
+
+	status.AvailableReplicas = deployment.Status.AvailableReplicas
+	health, _, message := deploymentHealth(deployment)
+	progressing, _, progressMessage := deploymentProgress(deployment)
+	switch {
+	case health == healthDegraded:
+		status.Message = message
+	case progressing:
+		status.Message = progressMessage
+	case health != healthAvailable:
+		status.Message = "The deployment has no available replicas yet"
+	default:
+		status.Ready = true
+	}
+	return status
+}
+
+// ensureRemote creates obj in a remote cluster if it doesn't exist, and otherwise reads it
+// back into obj. Objects that weren't created for myApp are left alone.
+func ensureRemote(ctx context.Context, remote client.Client, myApp *api.MyApp, obj client.Object) error {
+	owner := client.ObjectKeyFromObject(myApp).String()
+	err := remote.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+	if apierrors.IsNotFound(err) {
+		obj.SetLabels(labelsForMyApp(myApp.Name))
+		obj.SetAnnotations(map[string]string{ownerAnnotation: owner})
+		return remote.Create(ctx, obj)
+	}
+	if err != nil {
+		return err
+	}
+	if obj.GetAnnotations()[ownerAnnotation] != owner {
+		return fmt.Errorf("%s exists and is not managed by this MyApp", obj.GetName())
+	}
+	return nil
+}
+
+func ensureNamespace(ctx context.Context, remote client.Client, name string) error {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if err := remote.Create(ctx, ns); !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// removeFromTarget deletes the MyApp's objects from the named cluster. Clusters that are no
+// longer registered are skipped, as they can't be reached.
+func (c *Controller) removeFromTarget(ctx context.Context, myApp *api.MyApp, name string) error {
+	if c.clusters == nil {
+		return nil
+	}
+	remote, err := c.clusters.Client(ctx, name)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Info("skipping cleanup of unreachable cluster", "cluster", name, "reason", err.Error())
+		return nil
+	}
+	owner := client.ObjectKeyFromObject(myApp).String()
+	key := client.ObjectKeyFromObject(myApp)
+	for _, obj := range []client.Object{&appv1.Deployment{}, &policyv1.PodDisruptionBudget{}} {
+		if err := remote.Get(ctx, key, obj); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("cluster %s: %w", name, err)
+		}
+		if obj.GetAnnotations()[ownerAnnotation] != owner {
+			continue
+		}
+		if err := remote.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("cluster %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// finalizeTargets removes the MyApp's objects from every target cluster and releases the
+// finalizer once they are gone.
+func (c *Controller) finalizeTargets(ctx context.Context, myApp *api.MyApp) error {
+	if !controllerutil.ContainsFinalizer(myApp, targetsFinalizer) {
+		return nil
+	}
+	names := map[string]bool{}
+	for _, t := range myApp.Spec.Targets {
+		names[t.Name] = true
+	}
+	for _, t := range myApp.Status.Targets {
+		names[t.Name] = true
+	}
+	for name := range names {
+		if err := c.removeFromTarget(ctx, myApp, name); err != nil {
+			return err
+		}
+	}
+	controllerutil.RemoveFinalizer(myApp, targetsFinalizer)
+	return c.client.Update(ctx, myApp)
+}
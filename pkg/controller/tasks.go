@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// taskLabel names the task of Spec.Tasks a Job, and its pods, run.
+const taskLabel = "myapp.example.com/task"
+
+// taskJobTTL is how long the Job of a finished task is kept, in seconds. The most recent
+// run of every task stays in the status.
+const taskJobTTL = 24 * 60 * 60
+
+func findTask(spec *api.MyAppSpec, name string) *api.TaskSpec {
+	for i := range spec.Tasks {
+		if spec.Tasks[i].Name == name {
+			return &spec.Tasks[i]
+		}
+	}
+	return nil
+}
+
+// runTasks starts the task the run-task annotation of myApp asks for, if it changed since it
+// was acted on, unless held. It returns the most recent run of every task and the
+// annotation acted on.
+func (c *Controller) runTasks(ctx context.Context, myApp *api.MyApp, secrets []corev1.Secret, held bool) ([]api.TaskStatus, string, error) {
+	handled := myApp.Status.LastTaskTrigger
+	if trigger := myApp.Annotations[api.RunTaskAnnotation]; !held && trigger != "" && trigger != handled {
+		name, _, _ := strings.Cut(trigger, "@")
+		if task := findTask(&myApp.Spec, name); task == nil {
+			c.recorder.Eventf(myApp, corev1.EventTypeWarning, "UnknownTask", "Task %q of the %s annotation isn't in spec.tasks", name, api.RunTaskAnnotation)
+		} else {
+			job, err := c.startTask(ctx, myApp, task, trigger, secrets)
+			if err != nil {
+				return nil, handled, err
+			}
+			ctrl.LoggerFrom(ctx).Info("started task", "task", name, "job", job)
+			c.recorder.Eventf(myApp, corev1.EventTypeNormal, "TaskStarted", "Started task %s in Job %s", name, job)
+		}
+		handled = trigger
+	}
+	tasks, err := c.taskStatuses(ctx, myApp)
+	return tasks, handled, err
+}
+
+// startTask creates the Job running task, named after trigger so a task isn't started twice
+// when the status couldn't be written. It returns the name of the Job.
+func (c *Controller) startTask(ctx context.Context, myApp *api.MyApp, task *api.TaskSpec, trigger string, secrets []corev1.Secret) (string, error) {
+	// The CA bundle copy is applied, and recorded, by the workload.
+	deployment, err := c.renderDeployment(ctx, myApp, secrets, &childChanges{})
+	if err != nil {
+		return "", err
+	}
+	template := deployment.Spec.Template
+	// The task's pods aren't selected by the MyApp's Service, PodDisruptionBudget or
+	// Deployment, and don't serve.
+	delete(template.Labels, "app")
+	template.Labels[taskLabel] = task.Name
+	template.Spec.ReadinessGates = nil
+	if template.Spec.Affinity != nil {
+		// The tier's anti-affinity would keep the task off the Nodes the MyApp runs on.
+		template.Spec.Affinity.PodAntiAffinity = nil
+	}
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	for i := range template.Spec.Containers {
+		container := &template.Spec.Containers[i]
+		if container.Name != myApp.Name {
+			continue
+		}
+		container.Command = task.Command
+		if task.Args != nil {
+			container.Args = task.Args
+		}
+		container.Ports = nil
+		container.LivenessProbe, container.ReadinessProbe, container.StartupProbe = nil, nil, nil
+		container.Lifecycle = nil
+	}
+
+	backoffLimit := int32(0)
+	if task.BackoffLimit != nil {
+		backoffLimit = *task.BackoffLimit
+	}
+	ttl := int32(taskJobTTL)
+	labels := labelsForMyApp(myApp.Name)
+	labels[taskLabel] = task.Name
+	sum := sha256.Sum256([]byte(trigger))
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: myApp.Namespace,
+			Name:      fmt.Sprintf("%s-%s-%s", myApp.Name, task.Name, hex.EncodeToString(sum[:4])),
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			Template:                template,
+		},
+	}
+	if err := ctrl.SetControllerReference(myApp, job, c.manager.GetScheme()); err != nil {
+		return "", err
+	}
+	if err := c.client.Create(ctx, job); err != nil && !apierrors.IsAlreadyExists(err) {
+		childApplyFailures.WithLabelValues("Job", applyFailureReason(err)).Inc()
+		return "", err
+	}
+	return job.Name, nil
+}
+
+// taskStatuses returns the most recent run of the tasks of myApp, by task name.
+func (c *Controller) taskStatuses(ctx context.Context, myApp *api.MyApp) ([]api.TaskStatus, error) {
+	if len(myApp.Spec.Tasks) == 0 {
+		return nil, nil
+	}
+	jobs := &batchv1.JobList{}
+	if err := c.client.List(ctx, jobs, client.InNamespace(myApp.Namespace), client.MatchingLabels(labelsForMyApp(myApp.Name)), client.HasLabels{taskLabel}); err != nil {
+		return nil, err
+	}
+	latest := map[string]*batchv1.Job{}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		name := job.Labels[taskLabel]
+		if !metav1.IsControlledBy(job, myApp) || findTask(&myApp.Spec, name) == nil {
+			continue
+		}
+		if last, ok := latest[name]; !ok || last.CreationTimestamp.Before(&job.CreationTimestamp) {
+			latest[name] = job
+		}
+	}
+	tasks := make([]api.TaskStatus, 0, len(latest))
+	for name, job := range latest {
+		tasks = append(tasks, api.TaskStatus{Name: name, JobRunStatus: *jobRun(job)})
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+	return tasks, nil
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// templateIndex indexes MyApps by the MyAppTemplate they reference.
+const templateIndex = "spec.templateRef.name"
+
+func indexTemplate(obj client.Object) []string {
+	app := obj.(*api.MyApp)
+	if app.Spec.TemplateRef == nil {
+		return nil
+	}
+	return []string{app.Spec.TemplateRef.Name}
+}
+
+// appsForTemplate re-renders the MyApps referencing a MyAppTemplate when it changes.
+func (c *Controller) appsForTemplate(ctx context.Context, tmpl client.Object) []reconcile.Request {
+	apps := &api.MyAppList{}
+	if err := c.client.List(ctx, apps, client.MatchingFields{templateIndex: tmpl.GetName()}); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to list MyApps for MyAppTemplate", "name", tmpl.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(apps.Items))
+	for _, app := range apps.Items {
+		key := client.ObjectKeyFromObject(&app)
+		if c.shard.owns(key) {
+			requests = append(requests, reconcile.Request{NamespacedName: key})
+		}
+	}
+	return requests
+}
+
+// applyTemplate fills the fields myApp leaves unset from the MyAppTemplate it references.
+// myApp is modified in memory only and must not be written back.
+func (c *Controller) applyTemplate(ctx context.Context, myApp *api.MyApp) error {
+	if myApp.Spec.TemplateRef == nil {
+		return nil
+	}
+	tmpl := &api.MyAppTemplate{}
+	if err := c.client.Get(ctx, client.ObjectKey{Name: myApp.Spec.TemplateRef.Name}, tmpl); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The MyAppTemplate watch requeues the MyApp once it is created.
+			return fmt.Errorf("MyAppTemplate %s not found", myApp.Spec.TemplateRef.Name)
+		}
+		return err
+	}
+	mergeTemplate(&myApp.Spec, &tmpl.Spec)
+	return nil
+}
+
+func mergeTemplate(spec *api.MyAppSpec, tmpl *api.MyAppTemplateSpec) {
+	if tmpl.Resources != nil {
+		resources := tmpl.Resources.DeepCopy()
+		if spec.Resources != nil {
+			resources.Requests = mergeResources(resources.Requests, spec.Resources.Requests)
+			resources.Limits = mergeResources(resources.Limits, spec.Resources.Limits)
+			resources.Claims = append(resources.Claims, spec.Resources.Claims...)
+		}
+		spec.Resources = resources
+	}
+	if spec.LivenessProbe == nil && tmpl.LivenessProbe != nil {
+		spec.LivenessProbe = tmpl.LivenessProbe.DeepCopy()
+	}
+	if spec.ReadinessProbe == nil && tmpl.ReadinessProbe != nil {
+		spec.ReadinessProbe = tmpl.ReadinessProbe.DeepCopy()
+	}
+	if spec.SecurityContext == nil && tmpl.SecurityContext != nil {
+		spec.SecurityContext = tmpl.SecurityContext.DeepCopy()
+	}
+}
+
+// mergeResources returns base with the quantities of overrides taking precedence.
+func mergeResources(base, overrides corev1.ResourceList) corev1.ResourceList {
+	if len(overrides) == 0 {
+		return base
+	}
+	if base == nil {
+		base = corev1.ResourceList{}
+	}
+	for name, quantity := range overrides {
+		base[name] = quantity
+	}
+	return base
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// Anti-affinities of a tierProfile.
+const (
+	antiAffinityPreferred = "preferred"
+	antiAffinityRequired  = "required"
+)
+
+// tierProfile holds the defaults a Spec.Tier applies.
+type tierProfile struct {
+	// MaxUnavailable of the MyApp's PodDisruptionBudget, taking precedence over its size's.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// PriorityClassName of the MyApp's pods.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// AntiAffinity spreads the MyApp's pods over Nodes: preferred, or required, which leaves
+	// the pods beyond the number of Nodes pending. Empty doesn't spread them.
+	AntiAffinity string `json:"antiAffinity,omitempty"`
+	// ReconcilePriority high always reconciles the MyApps of the tier first, low never does,
+	// not even when their spec changed. Only with --priority-queue.
+	ReconcilePriority string `json:"reconcilePriority,omitempty"`
+}
+
+// builtinTierProfiles are the tiers used when the operator doesn't configure them. Priority
+// classes are specific to the cluster, so none is set.
+var builtinTierProfiles = map[string]tierProfile{
+	api.TierDev: {
+		MaxUnavailable:    &intstr.IntOrString{Type: intstr.String, StrVal: "50%"},
+		ReconcilePriority: priorityLow,
+	},
+	api.TierStandard: {
+		AntiAffinity: antiAffinityPreferred,
+	},
+	api.TierCritical: {
+		MaxUnavailable:    &intstr.IntOrString{Type: intstr.Int, IntVal: 1},
+		AntiAffinity:      antiAffinityRequired,
+		ReconcilePriority: priorityHigh,
+	},
+}
+
+// loadTierProfiles returns the built-in tiers merged with the tiers defined in file, a YAML
+// map of tier name to profile. Tiers in file replace the built-ins of the same name.
+func loadTierProfiles(file string) (map[string]tierProfile, error) {
+	profiles := make(map[string]tierProfile, len(builtinTierProfiles))
+	for name, profile := range builtinTierProfiles {
+		profiles[name] = profile
+	}
+	if file == "" {
+		return profiles, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	custom := map[string]tierProfile{}
+	if err := yaml.UnmarshalStrict(data, &custom); err != nil {
+		return nil, fmt.Errorf("parsing tier profiles %s: %w", file, err)
+	}
+	for name, profile := range custom {
+		if _, ok := builtinTierProfiles[name]; !ok {
+			return nil, fmt.Errorf("tier profiles %s: unknown tier %q, must be one of %s, %s or %s", file, name, api.TierDev, api.TierStandard, api.TierCritical)
+		}
+		switch profile.AntiAffinity {
+		case "", antiAffinityPreferred, antiAffinityRequired:
+		default:
+			return nil, fmt.Errorf("tier profiles %s: tier %s: unknown antiAffinity %q, must be %s or %s", file, name, profile.AntiAffinity, antiAffinityPreferred, antiAffinityRequired)
+		}
+		switch profile.ReconcilePriority {
+		case "", priorityHigh, priorityLow:
+		default:
+			return nil, fmt.Errorf("tier profiles %s: tier %s: unknown reconcilePriority %q, must be %s or %s", file, name, profile.ReconcilePriority, priorityHigh, priorityLow)
+		}
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// reconcilePriority returns the ReconcilePriority of the tier of obj, a MyApp.
+func reconcilePriority(tiers map[string]tierProfile) func(client.Object) string {
+	return func(obj client.Object) string {
+		return tiers[effectiveTier(&obj.(*api.MyApp).Spec)].ReconcilePriority
+	}
+}
+
+// configureTier sets the priority class and anti-affinity of the tier of myApp on template.
+func (c *Controller) configureTier(myApp *api.MyApp, template *corev1.PodTemplateSpec) {
+	profile, ok := c.tiers[effectiveTier(&myApp.Spec)]
+	if !ok {
+		return
+	}
+	template.Spec.PriorityClassName = profile.PriorityClassName
+	term := corev1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: labelsForMyApp(myApp.Name)},
+		TopologyKey:   corev1.LabelHostname,
+	}
+	var antiAffinity *corev1.PodAntiAffinity
+	switch profile.AntiAffinity {
+	case antiAffinityPreferred:
+		antiAffinity = &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{Weight: 100, PodAffinityTerm: term}},
+		}
+	case antiAffinityRequired:
+		antiAffinity = &corev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{term},
+		}
+	default:
+		return
+	}
+	if template.Spec.Affinity == nil {
+		template.Spec.Affinity = &corev1.Affinity{}
+	}
+	template.Spec.Affinity.PodAntiAffinity = antiAffinity
+}
+
+// highlyCritical reports whether spec responds to zone outages: its tier is critical.
+func highlyCritical(spec *api.MyAppSpec) bool {
+	return effectiveTier(spec) == api.TierCritical
+}
+
+// effectiveTier returns the tier of spec. The deprecated CriticalityTier high is migrated to
+// the critical tier when no tier is set.
+func effectiveTier(spec *api.MyAppSpec) string {
+	if spec.Tier == "" && spec.CriticalityTier == api.CriticalityTierHigh {
+		return api.TierCritical
+	}
+	return spec.Tier
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	"github.com/steeling/controller-runtime-exercise/pkg/timezone"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	localtimeVolume = "localtime"
+	localtimeKey    = "localtime"
+)
+
+func timezoneName(myApp *api.MyApp) string {
+	return myApp.Name + "-timezone"
+}
+
+// configureTimezone sets TZ in every container of template, sidecars included, and mounts
+// the time zone's file at /etc/localtime when the MyApp asks for it. The file is copied from
+// the embedded database into a ConfigMap in the MyApp's namespace. It runs after the other
+// containers were added.
+func (c *Controller) configureTimezone(ctx context.Context, myApp *api.MyApp, template *corev1.PodTemplateSpec, changes *childChanges) error {
+	tz := myApp.Spec.Timezone
+	if tz == nil {
+		return nil
+	}
+	data, err := timezone.TZif(tz.Name)
+	if err != nil {
+		return err
+	}
+	var mount *corev1.VolumeMount
+	if tz.MountLocaltime {
+		localtime := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: myApp.Namespace,
+				Name:      timezoneName(myApp),
+				Labels:    map[string]string{generatedConfigMapLabel: "true"},
+			},
+			BinaryData: map[string][]byte{localtimeKey: data},
+		}
+		if _, _, err := c.ensureChild(ctx, myApp, localtime, changes); err != nil {
+			return err
+		}
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: localtimeVolume,
+			VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{{ConfigMap: &corev1.ConfigMapProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: localtime.Name},
+					Items:                []corev1.KeyToPath{{Key: localtimeKey, Path: localtimeKey}},
+				}}},
+			}},
+		})
+		// A subPath mount isn't updated, the pods roll as TZ changes with the file.
+		mount = &corev1.VolumeMount{Name: localtimeVolume, MountPath: "/etc/localtime", SubPath: localtimeKey, ReadOnly: true}
+	}
+	for _, containers := range [][]corev1.Container{template.Spec.InitContainers, template.Spec.Containers} {
+		for i := range containers {
+			containers[i].Env = append(containers[i].Env, corev1.EnvVar{Name: "TZ", Value: tz.Name})
+			if mount != nil {
+				containers[i].VolumeMounts = append(containers[i].VolumeMounts, *mount)
+			}
+		}
+	}
+	return nil
+}
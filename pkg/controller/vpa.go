@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var vpaGVK = schema.GroupVersionKind{Group: "autoscaling.k8s.io", Version: "v1", Kind: "VerticalPodAutoscaler"}
+
+// +kubebuilder:rbac:groups=autoscaling.k8s.io,resources=verticalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+
+// createVerticalPodAutoscaler renders the VerticalPodAutoscaler of the MyApp's Deployment. In
+// Auto mode it only controls memory, as the HorizontalPodAutoscaler scales on CPU usage.
+func createVerticalPodAutoscaler(myApp *api.MyApp) *unstructured.Unstructured {
+	mode := myApp.Spec.Autoscaling.Vertical.Mode
+	if mode == "" {
+		mode = api.VerticalModeOff
+	}
+	policy := map[string]interface{}{"containerName": myApp.Name}
+	if mode == api.VerticalModeAuto {
+		policy["controlledResources"] = []interface{}{string(corev1.ResourceMemory)}
+	}
+	vpa := newUnstructured(vpaGVK, myApp.Namespace, myApp.Name)
+	vpa.Object["spec"] = map[string]interface{}{
+		"targetRef": map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"name":       myApp.Name,
+		},
+		"updatePolicy":   map[string]interface{}{"updateMode": mode},
+		"resourcePolicy": map[string]interface{}{"containerPolicies": []interface{}{policy}},
+	}
+	return vpa
+}
+
+// ensureVerticalPodAutoscaler applies the MyApp's VerticalPodAutoscaler, if its CRD was
+// installed at startup, and returns its recommendations.
+func (c *Controller) ensureVerticalPodAutoscaler(ctx context.Context, myApp *api.MyApp, changes *childChanges) ([]api.ContainerRecommendation, error) {
+	if !c.vpa {
+		ctrl.LoggerFrom(ctx).V(1).Info("VerticalPodAutoscaler CRD not installed, skipping")
+		return nil, nil
+	}
+	vpa := createVerticalPodAutoscaler(myApp)
+	if err := ctrl.SetControllerReference(myApp, vpa, c.manager.GetScheme()); err != nil {
+		return nil, err
+	}
+	if err := c.client.Patch(ctx, vpa, client.Apply, client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+		childApplyFailures.WithLabelValues(vpaGVK.Kind, applyFailureReason(err)).Inc()
+		return nil, fmt.Errorf("applying VerticalPodAutoscaler: %w", err)
+	}
+	changes.observe(vpa, vpaGVK)
+	return vpaRecommendations(vpa)
+}
+
+// vpaRecommendations returns the recommendations in the status of vpa.
+func vpaRecommendations(vpa *unstructured.Unstructured) ([]api.ContainerRecommendation, error) {
+	recommendation, found, err := unstructured.NestedMap(vpa.Object, "status", "recommendation")
+	if err != nil || !found {
+		return nil, err
+	}
+	var parsed struct {
+		ContainerRecommendations []api.ContainerRecommendation `json:"containerRecommendations"`
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(recommendation, &parsed); err != nil {
+		return nil, fmt.Errorf("parsing VerticalPodAutoscaler recommendations: %w", err)
+	}
+	return parsed.ContainerRecommendations, nil
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// warmupProbePeriod and warmupProbeFailures give a pod's startup probe five minutes after
+	// its initial delay to succeed before the container is restarted.
+	warmupProbePeriod   = 5
+	warmupProbeFailures = 60
+)
+
+// configureWarmup derives the startup probe of the MyApp's container from its readiness,
+// or liveness, probe, delayed by Spec.Warmup.InitialDelaySeconds, and raises the
+// Deployment's minReadySeconds to Spec.Warmup.SlowStartSeconds. Istio's slow start is set
+// on the DestinationRule by meshObjects. It runs after configureShutdown, which sets
+// minReadySeconds too.
+func configureWarmup(myApp *api.MyApp, deployment *appv1.Deployment) {
+	warmup := myApp.Spec.Warmup
+	if warmup == nil {
+		return
+	}
+	deployment.Spec.MinReadySeconds = max(deployment.Spec.MinReadySeconds, warmup.SlowStartSeconds)
+	if warmup.InitialDelaySeconds == 0 {
+		return
+	}
+	for i := range deployment.Spec.Template.Spec.Containers {
+		container := &deployment.Spec.Template.Spec.Containers[i]
+		probe := container.ReadinessProbe
+		if probe == nil {
+			probe = container.LivenessProbe
+		}
+		if probe == nil || container.StartupProbe != nil {
+			// Without probes the pod is ready as soon as it started, there is nothing to delay.
+			continue
+		}
+		container.StartupProbe = &corev1.Probe{
+			ProbeHandler:        *probe.ProbeHandler.DeepCopy(),
+			InitialDelaySeconds: warmup.InitialDelaySeconds,
+			TimeoutSeconds:      probe.TimeoutSeconds,
+			PeriodSeconds:       warmupProbePeriod,
+			FailureThreshold:    warmupProbeFailures,
+		}
+	}
+}
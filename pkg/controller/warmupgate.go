@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// warmupGate is the readiness gate the controller sets once a pod's warmup endpoint
+// returns 200.
+const warmupGate corev1.PodConditionType = "myapp.example.com/warm"
+
+// warmupGateRetryInterval is how often pods whose warmup gate is closed are checked. Pods
+// aren't watched.
+const warmupGateRetryInterval = 5 * time.Second
+
+// warmupProbeConcurrency is the most warmup endpoints of a MyApp checked at once.
+const warmupProbeConcurrency = 8
+
+// +kubebuilder:rbac:groups="",resources=pods/status,verbs=patch
+
+var warmupClient = &http.Client{
+	Timeout: 2 * time.Second,
+	// A redirect isn't the warmup endpoint answering.
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// configureWarmupGate adds the warmup readiness gate to template, so the MyApp's pods
+// only become ready, and receive traffic, once the controller opened it.
+func configureWarmupGate(myApp *api.MyApp, template *corev1.PodTemplateSpec) {
+	if myApp.Spec.WarmupGate == nil {
+		return
+	}
+	template.Spec.ReadinessGates = append(template.Spec.ReadinessGates, corev1.PodReadinessGate{ConditionType: warmupGate})
+}
+
+// openWarmupGates opens the warmup gate of the MyApp's pods whose containers are ready and
+// whose warmup endpoint returns 200. The pods are read directly so the operator doesn't have
+// to cache every pod. It reports whether any pod's gate is still closed.
+func (c *Controller) openWarmupGates(ctx context.Context, myApp *api.MyApp) (bool, error) {
+	if myApp.Spec.WarmupGate == nil {
+		return false, nil
+	}
+	pods := &corev1.PodList{}
+	if err := c.manager.GetAPIReader().List(ctx, pods, client.InNamespace(myApp.Namespace), client.MatchingLabels(labelsForMyApp(myApp.Name))); err != nil {
+		return false, err
+	}
+
+	var (
+		g       errgroup.Group
+		mu      sync.Mutex
+		warming bool
+	)
+	g.SetLimit(warmupProbeConcurrency)
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || !gated(pod) || podCondition(pod, warmupGate) == corev1.ConditionTrue {
+			continue
+		}
+		g.Go(func() error {
+			opened := false
+			if podCondition(pod, corev1.ContainersReady) == corev1.ConditionTrue && pod.Status.PodIP != "" {
+				opened = probeWarmup(ctx, pod.Status.PodIP, myApp.Spec.WarmupGate)
+			}
+			if !opened {
+				mu.Lock()
+				warming = true
+				mu.Unlock()
+				return nil
+			}
+			ctrl.LoggerFrom(ctx).V(1).Info("pod warmed up", "pod", pod.Name)
+			return openWarmupGate(ctx, c.client, pod)
+		})
+	}
+	err := g.Wait()
+	return warming, err
+}
+
+// gated reports whether pod has the warmup readiness gate. Pods of earlier revisions may not.
+func gated(pod *corev1.Pod) bool {
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == warmupGate {
+			return true
+		}
+	}
+	return false
+}
+
+func podCondition(pod *corev1.Pod, condType corev1.PodConditionType) corev1.ConditionStatus {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == condType {
+			return cond.Status
+		}
+	}
+	return corev1.ConditionUnknown
+}
+
+// probeWarmup reports whether the warmup endpoint of the pod at ip returns 200.
+func probeWarmup(ctx context.Context, ip string, gate *api.WarmupGateSpec) bool {
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(ip, strconv.Itoa(int(gate.Port))), gate.Path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := warmupClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// openWarmupGate sets the warmup condition of pod. The strategic merge patch merges the
+// conditions by type, so the kubelet's aren't overwritten.
+func openWarmupGate(ctx context.Context, c client.Client, pod *corev1.Pod) error {
+	patch := client.StrategicMergeFrom(pod.DeepCopy())
+	pod.Status.Conditions = append(pod.Status.Conditions, corev1.PodCondition{
+		Type:               warmupGate,
+		Status:             corev1.ConditionTrue,
+		Reason:             "WarmedUp",
+		LastTransitionTime: metav1.Now(),
+	})
+	if err := c.Status().Patch(ctx, pod, patch); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return nil
+}
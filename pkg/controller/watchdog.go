@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// watchdogSampleInterval is how often the watchdog samples the workqueue.
+const watchdogSampleInterval = 15 * time.Second
+
+var (
+	watchdogStalls = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "myapp_watchdog_stalls_total",
+		Help: "Number of times the workqueue grew without any reconcile finishing for the watchdog window",
+	})
+	watchdogStalled = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "myapp_watchdog_stalled",
+		Help: "1 while the watchdog considers the workqueue stuck",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(watchdogStalls, watchdogStalled)
+}
+
+// watchdog detects a stuck MyApp controller: its workqueue grew over window while no
+// reconcile finished. It then logs the goroutine stacks, which show what the workers are
+// blocked on. It implements manager.Runnable.
+type watchdog struct {
+	health *controllerHealth
+	window time.Duration
+	log    logr.Logger
+
+	mu      sync.Mutex
+	stalled bool
+}
+
+type watchdogSample struct {
+	at        time.Time
+	depth     int
+	processed uint64
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. The queue only fills on the
+// replicas running the controller, the others never stall.
+func (w *watchdog) NeedLeaderElection() bool {
+	return false
+}
+
+func (w *watchdog) Start(ctx context.Context) error {
+	ticker := time.NewTicker(watchdogSampleInterval)
+	defer ticker.Stop()
+	var samples []watchdogSample
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			depth, processed := w.health.progress()
+			samples = append(samples, watchdogSample{at: now, depth: depth, processed: processed})
+			// Keep the oldest sample covering the window.
+			for len(samples) > 1 && now.Sub(samples[1].at) >= w.window {
+				samples = samples[1:]
+			}
+			w.observe(samples)
+		}
+	}
+}
+
+func (w *watchdog) observe(samples []watchdogSample) {
+	first, last := samples[0], samples[len(samples)-1]
+	stalled := last.at.Sub(first.at) >= w.window &&
+		last.depth > first.depth &&
+		last.processed == first.processed
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if stalled == w.stalled {
+		return
+	}
+	w.stalled = stalled
+	if !stalled {
+		watchdogStalled.Set(0)
+		w.log.Info("workqueue is making progress again", "depth", last.depth)
+		return
+	}
+	watchdogStalls.Inc()
+	watchdogStalled.Set(1)
+	var stacks bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&stacks, 2); err != nil {
+		w.log.Error(err, "unable to dump goroutine stacks")
+	}
+	w.log.Info("workqueue is stuck", "window", w.window, "depthBefore", first.depth, "depth", last.depth, "goroutines", stacks.String())
+}
+
+// check is a liveness check failing while the workqueue is stuck.
+func (w *watchdog) check(*http.Request) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stalled {
+		return errors.New("workqueue is stuck")
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// rolloutWaveAnnotation assigns a MyApp to a rollout wave, a positive number. Changes
+	// from outside a MyApp's spec reach the waves in ascending order.
+	rolloutWaveAnnotation = "myapp.example.com/rollout-wave"
+	// appGenerationAnnotation on the Deployment is the generation of the MyApp it was
+	// rendered from. A rollout of the same generation was caused by a change outside the
+	// MyApp's spec, e.g. to its MyAppTemplate or the operator's defaults.
+	appGenerationAnnotation = "myapp.example.com/app-generation"
+)
+
+// rolloutWave returns the wave of myApp, 0 when it isn't in one.
+func rolloutWave(myApp *api.MyApp) int {
+	wave, err := strconv.Atoi(myApp.Annotations[rolloutWaveAnnotation])
+	if err != nil || wave < 0 {
+		return 0
+	}
+	return wave
+}
+
+// waveState is what the waves know of a MyApp in one.
+type waveState struct {
+	wave int
+	// pending is set while a change from outside its spec waits to be applied, or rolls out.
+	pending  bool
+	degraded bool
+	// settled is when it last finished rolling out such a change.
+	settled time.Time
+}
+
+// waveTracker rolls changes that don't come from the MyApps' own specs out wave by wave:
+// a MyApp applies them once every MyApp of a lower wave did and finished rolling out at
+// least soak ago, and none, or at most maxDegraded, of them is degraded. MyApps without a
+// wave apply them right away. The waves span the MyApps of an operator replica, i.e. of a
+// shard. A nil *waveTracker doesn't hold back changes.
+type waveTracker struct {
+	soak        time.Duration
+	maxDegraded int
+
+	mu   sync.Mutex
+	apps map[types.NamespacedName]waveState
+}
+
+// newWaveTracker returns nil when disabled.
+func newWaveTracker(enabled bool, soak time.Duration, maxDegraded int) *waveTracker {
+	if !enabled {
+		return nil
+	}
+	return &waveTracker{soak: soak, maxDegraded: maxDegraded, apps: map[types.NamespacedName]waveState{}}
+}
+
+// observe records the state of a MyApp in wave.
+func (w *waveTracker) observe(key types.NamespacedName, wave int, pending, degraded bool, now time.Time) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if wave == 0 {
+		delete(w.apps, key)
+		return
+	}
+	state := w.apps[key]
+	if state.pending && !pending {
+		state.settled = now
+	}
+	state.wave, state.pending, state.degraded = wave, pending, degraded
+	w.apps[key] = state
+}
+
+// hold returns the reason and message why a MyApp in wave may not apply a change yet. The
+// reason is empty when it may.
+func (w *waveTracker) hold(wave int, now time.Time) (string, string) {
+	if w == nil || wave == 0 {
+		return "", ""
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var pending, degraded int
+	var settled time.Time
+	for _, state := range w.apps {
+		if state.wave >= wave {
+			continue
+		}
+		if state.pending {
+			pending++
+		}
+		if state.degraded {
+			degraded++
+		}
+		if state.settled.After(settled) {
+			settled = state.settled
+		}
+	}
+	switch {
+	case degraded > w.maxDegraded:
+		return "WaveHalted", fmt.Sprintf("Halted, %d MyApps of lower waves are degraded", degraded)
+	case pending > 0:
+		return "WaitingForWave", fmt.Sprintf("Waiting for %d MyApps of lower waves to roll out", pending)
+	case now.Sub(settled) < w.soak:
+		return "WaveSoaking", "Lower waves soak until " + settled.Add(w.soak).UTC().Format(time.RFC3339)
+	}
+	return "", ""
+}
+
+func (w *waveTracker) forget(key types.NamespacedName) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.apps, key)
+}
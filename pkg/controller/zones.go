@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// zoneMonitor detects an availability zone outage: at least threshold of the Nodes of a
+// single zone are unready, while the other zones are healthy. A nil *zoneMonitor detects
+// nothing.
+type zoneMonitor struct {
+	threshold float64
+
+	mu sync.Mutex
+	// failed is the failing zone at the last Node event.
+	failed string
+}
+
+// newZoneMonitor returns nil when threshold isn't in (0, 1].
+func newZoneMonitor(threshold float64) *zoneMonitor {
+	if threshold <= 0 || threshold > 1 {
+		return nil
+	}
+	return &zoneMonitor{threshold: threshold}
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// failedZone returns the failing zone and the number of zones, or "" if no single zone fails.
+func (z *zoneMonitor) failedZone(nodes []corev1.Node) (string, int) {
+	total, unready := map[string]int{}, map[string]int{}
+	for i := range nodes {
+		zone := nodes[i].Labels[corev1.LabelTopologyZone]
+		if zone == "" {
+			continue
+		}
+		total[zone]++
+		if !nodeReady(&nodes[i]) {
+			unready[zone]++
+		}
+	}
+	var failed []string
+	for zone, n := range total {
+		if float64(unready[zone]) >= z.threshold*float64(n) {
+			failed = append(failed, zone)
+		}
+	}
+	// Unready Nodes in every zone are not a zone outage.
+	if len(failed) != 1 || len(total) < 2 {
+		return "", len(total)
+	}
+	return failed[0], len(total)
+}
+
+// nodeReadinessChanged passes Node updates that change its readiness or zone.
+func nodeReadinessChanged() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return true },
+		DeleteFunc:  func(event.DeleteEvent) bool { return true },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			old, node := e.ObjectOld.(*corev1.Node), e.ObjectNew.(*corev1.Node)
+			return nodeReady(old) != nodeReady(node) || old.Labels[corev1.LabelTopologyZone] != node.Labels[corev1.LabelTopologyZone]
+		},
+	}
+}
+
+// appsForZoneChange requeues the highly critical MyApps when a zone starts or stops failing.
+func (c *Controller) appsForZoneChange(ctx context.Context, _ client.Object) []reconcile.Request {
+	log := ctrl.LoggerFrom(ctx)
+	nodes := &corev1.NodeList{}
+	if err := c.client.List(ctx, nodes); err != nil {
+		log.Error(err, "unable to list Nodes")
+		return nil
+	}
+	failed, _ := c.zones.failedZone(nodes.Items)
+	c.zones.mu.Lock()
+	changed := failed != c.zones.failed
+	previous := c.zones.failed
+	c.zones.failed = failed
+	c.zones.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	if failed != "" {
+		log.Info("availability zone outage detected", "zone", failed)
+	} else {
+		log.Info("availability zone recovered", "zone", previous)
+	}
+
+	apps := &api.MyAppList{}
+	if err := c.client.List(ctx, apps); err != nil {
+		log.Error(err, "unable to list MyApps")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, app := range apps.Items {
+		key := client.ObjectKeyFromObject(&app)
+		if highlyCritical(&app.Spec) && c.shard.owns(key) {
+			requests = append(requests, reconcile.Request{NamespacedName: key})
+		}
+	}
+	return requests
+}
+
+// zoneFailureResponse scales a highly critical MyApp up while a zone fails, so the healthy
+// zones run as many pods as all zones did. New pods aren't scheduled on the unready Nodes,
+// which are tainted, so the pod template, and the running pods, are left alone. myApp's
+// spec is modified in memory only and must not be written back. It returns the
+// ZoneFailure condition, nil when no zone fails or the MyApp isn't highly critical.
+func (c *Controller) zoneFailureResponse(ctx context.Context, myApp *api.MyApp) (*metav1.Condition, error) {
+	if c.zones == nil || !highlyCritical(&myApp.Spec) {
+		return nil, nil
+	}
+	nodes := &corev1.NodeList{}
+	if err := c.client.List(ctx, nodes); err != nil {
+		return nil, err
+	}
+	failed, zones := c.zones.failedZone(nodes.Items)
+	if failed == "" {
+		return nil, nil
+	}
+	scale := func(n int32) int32 {
+		return (n*int32(zones) + int32(zones) - 2) / int32(zones-1)
+	}
+	var replicas int32
+	if myApp.Spec.Autoscaling != nil {
+		autoscaling := &api.AutoscalingSpec{}
+		myApp.Spec.Autoscaling.DeepCopyInto(autoscaling)
+		replicas = min(scale(*autoscaling.MinReplicas), autoscaling.MaxReplicas)
+		autoscaling.MinReplicas = &replicas
+		myApp.Spec.Autoscaling = autoscaling
+	} else {
+		replicas = c.replicas.clamp(scale(*myApp.Spec.Replicas))
+		myApp.Spec.Replicas = &replicas
+	}
+	return &metav1.Condition{
+		Type:               api.ConditionZoneFailure,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ScaledForZoneOutage",
+		Message:            fmt.Sprintf("Zone %s is failing, scaled up to %d replicas in the %d healthy zones", failed, replicas, zones-1),
+		ObservedGeneration: myApp.Generation,
+	}, nil
+}
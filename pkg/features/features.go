@@ -0,0 +1,68 @@
+// Package features defines the operator's feature gates.
+package features
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Feature string
+
+const (
+	// VerifyCacheMiss double-checks with the API server before creating a child the cache
+	// reported missing, e.g. right after startup when the cache may still be syncing.
+	VerifyCacheMiss Feature = "VerifyCacheMiss"
+)
+
+// defaults lists every known feature with its default state.
+var defaults = map[Feature]bool{
+	VerifyCacheMiss: false,
+}
+
+// Gates enables or disables features. It implements flag.Value, parsing a comma separated
+// list of Feature=bool pairs.
+type Gates map[Feature]bool
+
+// Enabled reports whether f is enabled, falling back to its default.
+func (g Gates) Enabled(f Feature) bool {
+	if enabled, ok := g[f]; ok {
+		return enabled
+	}
+	return defaults[f]
+}
+
+func (g Gates) String() string {
+	pairs := make([]string, 0, len(g))
+	for f, enabled := range g {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", f, enabled))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (g *Gates) Set(value string) error {
+	if *g == nil {
+		*g = Gates{}
+	}
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("feature gate %q must be of the form Feature=true|false", pair)
+		}
+		f := Feature(strings.TrimSpace(name))
+		if _, known := defaults[f]; !known {
+			return fmt.Errorf("unknown feature gate %q", f)
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("feature gate %s: %w", f, err)
+		}
+		(*g)[f] = enabled
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Package monitoring publishes the monitoring artifacts that ship with the operator.
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DashboardConfigMapName is the name of the ConfigMap holding the dashboard.
+	DashboardConfigMapName = "my-app-controller-dashboard"
+	// DashboardLabel is the label the grafana dashboard sidecar discovers ConfigMaps by.
+	DashboardLabel = "grafana_dashboard"
+
+	dashboardKey = "my-app-controller.json"
+
+	// FieldOwner is the server-side apply field manager for monitoring artifacts.
+	FieldOwner = "my-app-controller"
+)
+
+// panel is a single graph on the dashboard.
+type panel struct {
+	Title string
+	Expr  string
+	Unit  string
+}
+
+var dashboardPanels = []panel{
+	{Title: "Reconcile rate", Expr: `sum(rate(myapp_reconcile_total[5m]))`, Unit: "ops"},
+	{Title: "Reconcile duration p95 by result", Expr: `histogram_quantile(0.95, sum(rate(myapp_reconcile_duration_seconds_bucket[5m])) by (le, result))`, Unit: "s"},
+	{Title: "Reconcile errors", Expr: `sum(rate(controller_runtime_reconcile_errors_total{controller="myapp"}[5m]))`, Unit: "ops"},
+	{Title: "Workqueue depth", Expr: `sum(workqueue_depth{name="myapp"})`, Unit: "short"},
+	{Title: "MyApps by health", Expr: `sum(myapp_fleet_apps) by (health)`, Unit: "short"},
+	{Title: "Client requests by verb", Expr: `sum(rate(myapp_client_requests_total[5m])) by (verb)`, Unit: "reqps"},
+	{Title: "Client request errors by kind", Expr: `sum(rate(myapp_client_requests_total{result="error"}[5m])) by (kind)`, Unit: "reqps"},
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// Panels are laid out two per row.
+	"col": func(i int) int { return (i % 2) * 12 },
+	"row": func(i int) int { return (i / 2) * 8 },
+}).Parse(`{
+  "uid": "my-app-controller",
+  "title": "MyApp Controller",
+  "schemaVersion": 39,
+  "refresh": "30s",
+  "time": {"from": "now-6h", "to": "now"},
+  "templating": {
+    "list": [
+      {"name": "datasource", "type": "datasource", "query": "prometheus"}
+    ]
+  },
+  "panels": [
+{{- range $i, $p := .Panels }}
+    {{- if $i }},{{ end }}
+    {
+      "id": {{ $i }},
+      "title": {{ json $p.Title }},
+      "type": "timeseries",
+      "datasource": {"type": "prometheus", "uid": "${datasource}"},
+      "gridPos": {"h": 8, "w": 12, "x": {{ col $i }}, "y": {{ row $i }}},
+      "fieldConfig": {"defaults": {"unit": {{ json $p.Unit }}}},
+      "targets": [{"refId": "A", "expr": {{ json $p.Expr }}}]
+    }
+{{- end }}
+  ]
+}
+`))
+
+// Dashboard renders the Grafana dashboard JSON for the controller's metrics.
+func Dashboard() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := dashboardTemplate.Execute(&buf, struct{ Panels []panel }{dashboardPanels}); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("rendered dashboard is not valid JSON")
+	}
+	return buf.Bytes(), nil
+}
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;create;update;patch
+
+// DashboardPublisher applies the dashboard ConfigMap once on start. It implements manager.Runnable.
+type DashboardPublisher struct {
+	Client    client.Client
+	Namespace string
+	Log       logr.Logger
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable; only the leader writes the ConfigMap.
+func (p *DashboardPublisher) NeedLeaderElection() bool {
+	return true
+}
+
+func (p *DashboardPublisher) Start(ctx context.Context) error {
+	dashboard, err := Dashboard()
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: p.Namespace,
+			Name:      DashboardConfigMapName,
+			Labels:    map[string]string{DashboardLabel: "1"},
+		},
+		Data: map[string]string{dashboardKey: string(dashboard)},
+	}
+	// Failing to publish the dashboard must not take the operator down.
+	if err := p.Client.Patch(ctx, cm, client.Apply, client.FieldOwner(FieldOwner), client.ForceOwnership); err != nil {
+		p.Log.Error(err, "unable to publish grafana dashboard", "namespace", p.Namespace)
+		return nil
+	}
+	p.Log.Info("grafana dashboard published", "namespace", p.Namespace, "name", DashboardConfigMapName)
+	return nil
+}
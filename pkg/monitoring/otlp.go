@@ -0,0 +1,59 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	otelprometheus "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// serviceName identifies the operator in the exported resource.
+const serviceName = "my-app-controller"
+
+// OTLPExporter pushes the metrics of Gatherer to an OTLP/HTTP endpoint, typically an
+// OpenTelemetry Collector, every Interval. The metrics are still served for scraping.
+type OTLPExporter struct {
+	// Endpoint is the URL metrics are exported to, e.g. http://otel-collector:4318. The
+	// /v1/metrics path is appended when it has none.
+	Endpoint string
+	Interval time.Duration
+	Gatherer prometheus.Gatherer
+	Log      logr.Logger
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable; every replica exports its own metrics.
+func (e *OTLPExporter) NeedLeaderElection() bool {
+	return false
+}
+
+func (e *OTLPExporter) Start(ctx context.Context) error {
+	exporter, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(e.Endpoint))
+	if err != nil {
+		return fmt.Errorf("creating OTLP metrics exporter: %w", err)
+	}
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(e.Interval),
+		sdkmetric.WithProducer(otelprometheus.NewMetricProducer(otelprometheus.WithGatherer(e.Gatherer))),
+	)
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	e.Log.Info("exporting metrics over OTLP", "endpoint", e.Endpoint, "interval", e.Interval)
+
+	<-ctx.Done()
+	// Export the final values before exiting. ctx is already done.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := provider.Shutdown(shutdownCtx); err != nil {
+		e.Log.Error(err, "unable to flush OTLP metrics")
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package monitoring
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// PushgatewayPusher pushes the metrics of Gatherer to a Prometheus Pushgateway every
+// Interval and once more on shutdown, for runs that end before they are scraped, e.g. as a
+// Job in CI. Every replica pushes to its own group, keyed by its hostname.
+type PushgatewayPusher struct {
+	// URL of the Pushgateway, e.g. http://pushgateway:9091.
+	URL string
+	// Interval between pushes. Only the final push is made when 0.
+	Interval time.Duration
+	Gatherer prometheus.Gatherer
+	Log      logr.Logger
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable; every replica pushes its own metrics.
+func (p *PushgatewayPusher) NeedLeaderElection() bool {
+	return false
+}
+
+func (p *PushgatewayPusher) Start(ctx context.Context) error {
+	instance, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	pusher := push.New(p.URL, serviceName).Gatherer(p.Gatherer).Grouping("instance", instance)
+	p.Log.Info("pushing metrics to pushgateway", "url", p.URL, "interval", p.Interval)
+
+	var tick <-chan time.Time
+	if p.Interval > 0 {
+		ticker := time.NewTicker(p.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			// Push the final values before exiting. ctx is already done.
+			pushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := pusher.PushContext(pushCtx); err != nil {
+				p.Log.Error(err, "unable to push final metrics to pushgateway")
+			}
+			return nil
+		case <-tick:
+			// Replacing the group drops metrics that are gone since the last push.
+			if err := pusher.PushContext(ctx); err != nil {
+				p.Log.Error(err, "unable to push metrics to pushgateway")
+			}
+		}
+	}
+}
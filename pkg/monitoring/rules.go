@@ -0,0 +1,133 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PrometheusRuleName is the name of the PrometheusRule holding the operator alerts.
+const PrometheusRuleName = "my-app-controller"
+
+// PrometheusRuleGVK identifies the prometheus-operator PrometheusRule kind.
+var PrometheusRuleGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PrometheusRule"}
+
+type alert struct {
+	Name        string
+	Expr        string
+	For         string
+	Severity    string
+	Summary     string
+	Description string
+}
+
+func alerts(leaderElectionID string) []alert {
+	return []alert{
+		{
+			Name:        "MyAppReconcileErrorRateHigh",
+			Expr:        `sum(rate(controller_runtime_reconcile_errors_total{controller="myapp"}[5m])) / sum(rate(controller_runtime_reconcile_total{controller="myapp"}[5m])) > 0.1`,
+			For:         "15m",
+			Severity:    "warning",
+			Summary:     "More than 10% of MyApp reconciles are failing.",
+			Description: "The MyApp controller has been failing over 10% of its reconciles for 15 minutes; check the controller logs.",
+		},
+		{
+			Name:        "MyAppsStalled",
+			Expr:        `sum(myapp_fleet_apps{health="degraded"}) > 0`,
+			For:         "30m",
+			Severity:    "warning",
+			Summary:     "MyApps have been degraded for 30 minutes.",
+			Description: "{{ $value }} MyApps have not become available for 30 minutes.",
+		},
+		{
+			Name:        "MyAppControllerNoLeader",
+			Expr:        fmt.Sprintf(`max(leader_election_master_status{name=%q}) < 1 or absent(leader_election_master_status{name=%q})`, leaderElectionID, leaderElectionID),
+			For:         "5m",
+			Severity:    "critical",
+			Summary:     "No MyApp controller replica holds the leader lease.",
+			Description: "No replica has been leading for 5 minutes, MyApps are not being reconciled.",
+		},
+		{
+			Name:        "MyAppWorkqueueStuck",
+			Expr:        `max(myapp_watchdog_stalled) > 0`,
+			For:         "5m",
+			Severity:    "critical",
+			Summary:     "The MyApp controller's workqueue is stuck.",
+			Description: "MyApps are queued but no reconcile has finished; the goroutine stacks were logged by the watchdog.",
+		},
+	}
+}
+
+// PrometheusRule renders the operator alerts as an unstructured PrometheusRule.
+func PrometheusRule(namespace, leaderElectionID string) *unstructured.Unstructured {
+	var rules []interface{}
+	for _, a := range alerts(leaderElectionID) {
+		rules = append(rules, map[string]interface{}{
+			"alert": a.Name,
+			"expr":  a.Expr,
+			"for":   a.For,
+			"labels": map[string]interface{}{
+				"severity": a.Severity,
+			},
+			"annotations": map[string]interface{}{
+				"summary":     a.Summary,
+				"description": a.Description,
+			},
+		})
+	}
+
+	rule := &unstructured.Unstructured{}
+	rule.SetGroupVersionKind(PrometheusRuleGVK)
+	rule.SetNamespace(namespace)
+	rule.SetName(PrometheusRuleName)
+	rule.SetLabels(map[string]string{"app": "my-app-controller"})
+	rule.Object["spec"] = map[string]interface{}{
+		"groups": []interface{}{
+			map[string]interface{}{
+				"name":  "my-app-controller",
+				"rules": rules,
+			},
+		},
+	}
+	return rule
+}
+
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheusrules,verbs=get;create;update;patch
+
+// RulePublisher applies the PrometheusRule once on start, if the prometheus-operator
+// CRDs are installed. It implements manager.Runnable.
+type RulePublisher struct {
+	Client           client.Client
+	Namespace        string
+	LeaderElectionID string
+	Log              logr.Logger
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable; only the leader writes the PrometheusRule.
+func (p *RulePublisher) NeedLeaderElection() bool {
+	return true
+}
+
+func (p *RulePublisher) Start(ctx context.Context) error {
+	if _, err := p.Client.RESTMapper().RESTMapping(PrometheusRuleGVK.GroupKind(), PrometheusRuleGVK.Version); err != nil {
+		if meta.IsNoMatchError(err) {
+			p.Log.Info("PrometheusRule CRD not installed, skipping operator alerts")
+			return nil
+		}
+		p.Log.Error(err, "unable to discover PrometheusRule CRD")
+		return nil
+	}
+
+	rule := PrometheusRule(p.Namespace, p.LeaderElectionID)
+	if err := p.Client.Patch(ctx, rule, client.Apply, client.FieldOwner(FieldOwner), client.ForceOwnership); err != nil {
+		p.Log.Error(err, "unable to publish PrometheusRule", "namespace", p.Namespace)
+		return nil
+	}
+	p.Log.Info("PrometheusRule published", "namespace", p.Namespace, "name", PrometheusRuleName)
+	return nil
+}
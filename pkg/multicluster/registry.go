@@ -0,0 +1,124 @@
+// Package multicluster builds clients for the remote clusters MyApps can be deployed to.
+//
+// A cluster is registered by creating a Secret in the operator namespace labeled
+// myapp.example.com/cluster-target=true whose "kubeconfig" key holds a kubeconfig for it.
+// The cluster's name is the Secret's name unless the myapp.example.com/cluster-name
+// annotation is set.
+package multicluster
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// TargetLabel marks a Secret as a cluster registration.
+	TargetLabel = "myapp.example.com/cluster-target"
+	// NameAnnotation overrides the name of the registered cluster.
+	NameAnnotation = "myapp.example.com/cluster-name"
+	// KubeconfigKey is the Secret key holding the kubeconfig.
+	KubeconfigKey = "kubeconfig"
+
+	// refreshInterval is how long the list of registered clusters is reused.
+	refreshInterval = time.Minute
+	// requestTimeout bounds requests to remote clusters so an unreachable cluster doesn't
+	// stall reconciles.
+	requestTimeout = 10 * time.Second
+)
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list
+
+// Registry resolves cluster names to clients. Clients are rebuilt when their Secret changes.
+type Registry struct {
+	reader    client.Reader
+	namespace string
+	scheme    *runtime.Scheme
+
+	mu          sync.Mutex
+	refreshedAt time.Time
+	clusters    map[string]*cluster
+}
+
+type cluster struct {
+	// version is the resourceVersion of the Secret the client was built from.
+	version string
+	client  client.Client
+	// err is set when no client could be built from the Secret.
+	err error
+}
+
+// NewRegistry discovers registrations in namespace. reader should be uncached so the
+// operator doesn't need to watch every Secret in the cluster.
+func NewRegistry(reader client.Reader, namespace string, scheme *runtime.Scheme) *Registry {
+	return &Registry{
+		reader:    reader,
+		namespace: namespace,
+		scheme:    scheme,
+		clusters:  map[string]*cluster{},
+	}
+}
+
+// Client returns a client for the named cluster. It fails if the cluster isn't registered or
+// its registration is invalid.
+func (r *Registry) Client(ctx context.Context, name string) (client.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.refreshedAt) > refreshInterval {
+		if err := r.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+	c, ok := r.clusters[name]
+	if !ok {
+		return nil, fmt.Errorf("cluster %q is not registered", name)
+	}
+	return c.client, c.err
+}
+
+func (r *Registry) refresh(ctx context.Context) error {
+	secrets := &corev1.SecretList{}
+	if err := r.reader.List(ctx, secrets, client.InNamespace(r.namespace), client.MatchingLabels{TargetLabel: "true"}); err != nil {
+		return fmt.Errorf("listing cluster registrations: %w", err)
+	}
+
+	clusters := make(map[string]*cluster, len(secrets.Items))
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		name := secret.Name
+		if n := secret.Annotations[NameAnnotation]; n != "" {
+			name = n
+		}
+		if existing, ok := r.clusters[name]; ok && existing.version == secret.ResourceVersion {
+			clusters[name] = existing
+			continue
+		}
+		c, err := r.newClient(secret)
+		if err != nil {
+			err = fmt.Errorf("invalid registration for cluster %q: %w", name, err)
+		}
+		clusters[name] = &cluster{version: secret.ResourceVersion, client: c, err: err}
+	}
+	r.clusters, r.refreshedAt = clusters, time.Now()
+	return nil
+}
+
+func (r *Registry) newClient(secret *corev1.Secret) (client.Client, error) {
+	kubeconfig, ok := secret.Data[KubeconfigKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no %q key", secret.Name, KubeconfigKey)
+	}
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Timeout = requestTimeout
+	return client.New(cfg, client.Options{Scheme: r.scheme})
+}
@@ -0,0 +1,248 @@
+// Package notify posts MyApp degradation notifications to Slack, Teams, or generic webhooks.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ConfigKey is the key in the notifications Secret that holds the routing configuration.
+	ConfigKey = "config.yaml"
+
+	RouteSlack   = "slack"
+	RouteTeams   = "teams"
+	RouteWebhook = "webhook"
+
+	defaultMaxPerMinute = 5
+
+	// configTTL is how long a loaded configuration is reused before the Secret is read again.
+	configTTL = time.Minute
+	queueSize = 128
+)
+
+var sentNotifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "myapp_notifications_total",
+	Help: "Number of notifications by route and result",
+}, []string{"route", "result"})
+
+func init() {
+	metrics.Registry.MustRegister(sentNotifications)
+}
+
+// Config is the routing configuration stored in the notifications Secret, e.g.
+//
+//	routes:
+//	- name: platform
+//	  type: slack
+//	  url: https://hooks.slack.com/services/...
+//	  namespaces: ["payments"]
+//	  maxPerMinute: 2
+type Config struct {
+	Routes []Route `json:"routes"`
+}
+
+// Route delivers notifications for a set of namespaces to one endpoint.
+type Route struct {
+	Name string `json:"name"`
+	// Type is one of slack, teams or webhook.
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// Namespaces restricts the route to MyApps in these namespaces. All namespaces match when empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// MaxPerMinute caps how many notifications the route sends per minute. Defaults to 5.
+	MaxPerMinute int `json:"maxPerMinute,omitempty"`
+}
+
+func (r Route) matches(namespace string) bool {
+	if len(r.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range r.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification describes a MyApp that needs attention.
+type Notification struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+}
+
+func (n Notification) text() string {
+	return fmt.Sprintf("MyApp %s/%s: %s. %s", n.Namespace, n.Name, n.Reason, n.Message)
+}
+
+// Notifier delivers notifications asynchronously. It implements manager.Runnable.
+type Notifier struct {
+	reader client.Reader
+	secret types.NamespacedName
+	http   *http.Client
+	queue  chan Notification
+	log    logr.Logger
+
+	mu       sync.Mutex
+	config   *Config
+	loadedAt time.Time
+	limiters map[string]*rate.Limiter
+}
+
+// NewNotifier reads its configuration from secret. reader should be uncached so the
+// operator doesn't need to watch every Secret in the cluster.
+func NewNotifier(reader client.Reader, secret types.NamespacedName, log logr.Logger) *Notifier {
+	return &Notifier{
+		reader:   reader,
+		secret:   secret,
+		http:     &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan Notification, queueSize),
+		log:      log,
+		limiters: map[string]*rate.Limiter{},
+	}
+}
+
+// Notify enqueues nf without blocking; notifications are dropped when the queue is full.
+func (n *Notifier) Notify(nf Notification) {
+	if nf.Time.IsZero() {
+		nf.Time = time.Now()
+	}
+	select {
+	case n.queue <- nf:
+	default:
+		sentNotifications.WithLabelValues("", "dropped").Inc()
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Notifications are only
+// raised by the reconciler, which runs on the leader.
+func (n *Notifier) NeedLeaderElection() bool {
+	return true
+}
+
+func (n *Notifier) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case nf := <-n.queue:
+			n.deliver(ctx, nf)
+		}
+	}
+}
+
+func (n *Notifier) deliver(ctx context.Context, nf Notification) {
+	cfg, err := n.loadConfig(ctx)
+	if err != nil {
+		n.log.Error(err, "unable to load notification config", "secret", n.secret)
+		return
+	}
+	for _, route := range cfg.Routes {
+		if !route.matches(nf.Namespace) {
+			continue
+		}
+		if !n.limiter(route).Allow() {
+			sentNotifications.WithLabelValues(route.Name, "rate_limited").Inc()
+			continue
+		}
+		if err := n.send(ctx, route, nf); err != nil {
+			sentNotifications.WithLabelValues(route.Name, "error").Inc()
+			n.log.Error(err, "unable to send notification", "route", route.Name)
+			continue
+		}
+		sentNotifications.WithLabelValues(route.Name, "success").Inc()
+	}
+}
+
+func (n *Notifier) loadConfig(ctx context.Context) (*Config, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.config != nil && time.Since(n.loadedAt) < configTTL {
+		return n.config, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := n.reader.Get(ctx, n.secret, secret); err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.Unmarshal(secret.Data[ConfigKey], cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", ConfigKey, err)
+	}
+	n.config, n.loadedAt = cfg, time.Now()
+	return cfg, nil
+}
+
+// limiter returns the rate limiter for route, keeping it across config reloads.
+func (n *Notifier) limiter(route Route) *rate.Limiter {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	perMinute := route.MaxPerMinute
+	if perMinute <= 0 {
+		perMinute = defaultMaxPerMinute
+	}
+	key := route.Name + "|" + route.URL
+	l, ok := n.limiters[key]
+	if !ok || l.Burst() != perMinute {
+		l = rate.NewLimiter(rate.Every(time.Minute/time.Duration(perMinute)), perMinute)
+		n.limiters[key] = l
+	}
+	return l
+}
+
+func (n *Notifier) send(ctx context.Context, route Route, nf Notification) error {
+	var payload interface{}
+	switch route.Type {
+	case RouteSlack:
+		payload = map[string]string{"text": nf.text()}
+	case RouteTeams:
+		payload = map[string]string{
+			"@type":    "MessageCard",
+			"@context": "http://schema.org/extensions",
+			"summary":  nf.Reason,
+			"title":    fmt.Sprintf("MyApp %s/%s", nf.Namespace, nf.Name),
+			"text":     nf.text(),
+		}
+	case RouteWebhook, "":
+		payload = nf
+	default:
+		return fmt.Errorf("unknown route type %q", route.Type)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, route.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Package preflight verifies, before the manager starts, that the cluster serves the APIs
+// the operator depends on and that the operator may use them, so a broken install fails at
+// startup with a message saying how to fix it.
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/steeling/controller-runtime-exercise/pkg/rbac"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Check is a single preflight check. Run returns an error explaining how to fix the cluster
+// or the install when the check fails.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Error lists the failed checks.
+type Error struct {
+	Failures []string
+}
+
+func (e *Error) Error() string {
+	return "preflight checks failed:\n  - " + strings.Join(e.Failures, "\n  - ")
+}
+
+// Run runs every check, rather than stopping at the first failure, so all the problems are
+// reported at once. It returns an *Error when any failed.
+func Run(ctx context.Context, log logr.Logger, checks []Check) error {
+	var failures []string
+	for _, check := range checks {
+		if err := check.Run(ctx); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", check.Name, err))
+			continue
+		}
+		log.V(1).Info("preflight check passed", "check", check.Name)
+	}
+	if len(failures) > 0 {
+		return &Error{Failures: failures}
+	}
+	return nil
+}
+
+// KindServed checks the cluster serves gvk. hint tells how to make it available, e.g. which
+// CRD to install.
+func KindServed(mapper meta.RESTMapper, gvk schema.GroupVersionKind, hint string) Check {
+	return Check{
+		Name: fmt.Sprintf("%s %s", gvk.GroupVersion(), gvk.Kind),
+		Run: func(context.Context) error {
+			_, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if meta.IsNoMatchError(err) {
+				return errors.New(hint)
+			}
+			return err
+		},
+	}
+}
+
+// Permissions checks the identity of c was granted rules.
+func Permissions(c client.Client, rules []rbac.Rule) Check {
+	return Check{
+		Name: "permissions",
+		Run: func(ctx context.Context) error {
+			return rbac.Check(ctx, c, rules)
+		},
+	}
+}
@@ -0,0 +1,190 @@
+// Package preview runs short-lived copies of MyApps for MyAppPreviews.
+package preview
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	defaultTTL = 24 * time.Hour
+
+	// previewLabel marks the copies of MyApps with the name of their MyAppPreview.
+	previewLabel = "myapp.example.com/preview"
+
+	// appIndex indexes MyAppPreviews by the MyApp they copy.
+	appIndex = "spec.appName"
+)
+
+// +kubebuilder:rbac:groups=example.com,resources=myapppreviews,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=example.com,resources=myapppreviews/status,verbs=get;update;patch
+
+// Reconciler keeps the copy of the MyApp of every MyAppPreview in sync with it, and deletes
+// the preview once its TTL expires. The copy is garbage collected with it.
+type Reconciler struct {
+	Client client.Client
+	Scheme *runtime.Scheme
+}
+
+// SetupWithManager registers the MyAppPreview controller with manager. MyApps are mutated with apiClient.
+func SetupWithManager(ctx context.Context, manager ctrl.Manager, apiClient client.Client) error {
+	if err := manager.GetFieldIndexer().IndexField(ctx, &api.MyAppPreview{}, appIndex, func(obj client.Object) []string {
+		return []string{obj.(*api.MyAppPreview).Spec.AppName}
+	}); err != nil {
+		return err
+	}
+	r := &Reconciler{Client: apiClient, Scheme: manager.GetScheme()}
+	return ctrl.NewControllerManagedBy(manager).
+		For(&api.MyAppPreview{}).
+		Owns(&api.MyApp{}).
+		// Copies follow the changes of the MyApp they copy.
+		Watches(&api.MyApp{}, handler.EnqueueRequestsFromMapFunc(r.previewsForApp)).
+		Complete(r)
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	preview := &api.MyAppPreview{}
+	if err := r.Client.Get(ctx, req.NamespacedName, preview); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !preview.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	ttl := defaultTTL
+	if preview.Spec.TTL != nil {
+		ttl = preview.Spec.TTL.Duration
+	}
+	expiration := preview.CreationTimestamp.Add(ttl)
+	if remaining := time.Until(expiration); remaining <= 0 {
+		log.Info("preview expired, deleting it")
+		return ctrl.Result{}, client.IgnoreNotFound(r.Client.Delete(ctx, preview, client.PropagationPolicy(metav1.DeletePropagationBackground)))
+	}
+
+	status := api.MyAppPreviewStatus{ExpirationTime: &metav1.Time{Time: expiration}}
+	copied, err := r.copyApp(ctx, preview)
+	switch {
+	case isPermanent(err):
+		status.Error = err.Error()
+	case err != nil:
+		log.Error(err, "unable to copy MyApp")
+		return ctrl.Result{}, err
+	default:
+		status.URL = previewURL(copied)
+	}
+	if !equality.Semantic.DeepEqual(status, preview.Status) {
+		preview.Status = status
+		if err := r.Client.Status().Update(ctx, preview); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{RequeueAfter: time.Until(expiration)}, nil
+}
+
+// permanentError is reported on the preview's status instead of being retried. The watches
+// requeue the preview once it may be resolved.
+type permanentError struct{ error }
+
+func isPermanent(err error) bool {
+	_, ok := err.(permanentError)
+	return ok
+}
+
+// copyApp creates or updates the copy of the preview's MyApp.
+func (r *Reconciler) copyApp(ctx context.Context, preview *api.MyAppPreview) (*api.MyApp, error) {
+	source := &api.MyApp{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: preview.Namespace, Name: preview.Spec.AppName}, source); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, permanentError{fmt.Errorf("MyApp %s not found", preview.Spec.AppName)}
+		}
+		return nil, err
+	}
+	if preview.Name == source.Name {
+		return nil, permanentError{fmt.Errorf("the preview must not be named after the MyApp %s it copies", source.Name)}
+	}
+
+	copied := &api.MyApp{ObjectMeta: metav1.ObjectMeta{Namespace: preview.Namespace, Name: preview.Name}}
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(copied), copied); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	if !copied.CreationTimestamp.IsZero() && !metav1.IsControlledBy(copied, preview) {
+		return nil, permanentError{fmt.Errorf("MyApp %s already exists and isn't a copy of this preview", copied.Name)}
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, copied, func() error {
+		if copied.Labels == nil {
+			copied.Labels = map[string]string{}
+		}
+		copied.Labels[previewLabel] = preview.Name
+		copied.Spec = previewSpec(source, preview)
+		return controllerutil.SetControllerReference(preview, copied, r.Scheme)
+	})
+	return copied, err
+}
+
+// previewSpec is the spec of the copy of source. It runs a single pod in the local cluster
+// only, and doesn't claim the MyApp's DNS names.
+func previewSpec(source *api.MyApp, preview *api.MyAppPreview) api.MyAppSpec {
+	spec := *source.Spec.DeepCopy()
+	if preview.Spec.Image != "" {
+		spec.Image = preview.Spec.Image
+	}
+	replicas := int32(1)
+	spec.Replicas = &replicas
+	spec.Autoscaling = nil
+	spec.Targets = nil
+	if spec.Service != nil {
+		spec.Service.Hostname = ""
+	}
+	if spec.Ingress != nil {
+		spec.Ingress.Host = previewHost(source, preview)
+	}
+	return spec
+}
+
+func previewHost(source *api.MyApp, preview *api.MyAppPreview) string {
+	if preview.Spec.Host != "" {
+		return preview.Spec.Host
+	}
+	return preview.Name + "." + source.Spec.Ingress.Host
+}
+
+func previewURL(copied *api.MyApp) string {
+	ingress := copied.Spec.Ingress
+	if ingress == nil {
+		return ""
+	}
+	scheme := "http"
+	if ingress.TLSSecretName != "" {
+		scheme = "https"
+	}
+	return scheme + "://" + ingress.Host + ingress.Path
+}
+
+// previewsForApp requeues the previews copying a MyApp when it changes.
+func (r *Reconciler) previewsForApp(ctx context.Context, app client.Object) []reconcile.Request {
+	previews := &api.MyAppPreviewList{}
+	if err := r.Client.List(ctx, previews, client.InNamespace(app.GetNamespace()), client.MatchingFields{appIndex: app.GetName()}); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to list MyAppPreviews for MyApp", "name", app.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(previews.Items))
+	for _, p := range previews.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&p)})
+	}
+	return requests
+}
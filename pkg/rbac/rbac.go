@@ -0,0 +1,109 @@
+// Package rbac declares the permissions the MyApp controller needs on the resources it
+// generates, and checks the operator was granted them.
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups=example.com,resources=myapps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=example.com,resources=myapps/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=pods;events;services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses;networkpolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=example.com,resources=myapptemplates;maintenancewindows,verbs=get;list;watch
+
+// Rule is a permission on every object of a resource, cluster wide.
+type Rule struct {
+	Group    string
+	Resource string
+	// Subresource, e.g. status, is empty for the resource itself.
+	Subresource string
+	Verbs       []string
+}
+
+var readWrite = []string{"get", "list", "watch", "create", "update", "patch", "delete"}
+
+// Required are the permissions the MyApp controller can't run without, as granted by the
+// markers above. Permissions of optional features, e.g. the mesh or Gateway API children,
+// aren't required.
+var Required = []Rule{
+	{Group: "example.com", Resource: "myapps", Verbs: readWrite},
+	{Group: "example.com", Resource: "myapps", Subresource: "status", Verbs: []string{"get", "update", "patch"}},
+	{Resource: "pods", Verbs: []string{"get", "list", "watch"}},
+	{Resource: "events", Verbs: []string{"create", "patch"}},
+	{Resource: "services", Verbs: readWrite},
+	{Resource: "configmaps", Verbs: readWrite},
+	{Resource: "resourcequotas", Verbs: []string{"get", "list", "watch"}},
+	{Resource: "limitranges", Verbs: []string{"get", "list", "watch"}},
+	{Resource: "namespaces", Verbs: []string{"get", "list", "watch"}},
+	{Group: "apps", Resource: "deployments", Verbs: readWrite},
+	{Group: "networking.k8s.io", Resource: "ingresses", Verbs: readWrite},
+	{Group: "networking.k8s.io", Resource: "networkpolicies", Verbs: readWrite},
+	{Group: "autoscaling", Resource: "horizontalpodautoscalers", Verbs: readWrite},
+	{Group: "policy", Resource: "poddisruptionbudgets", Verbs: readWrite},
+	{Group: "batch", Resource: "jobs", Verbs: readWrite},
+	{Group: "batch", Resource: "cronjobs", Verbs: readWrite},
+	{Group: "example.com", Resource: "myapptemplates", Verbs: []string{"get", "list", "watch"}},
+	{Group: "example.com", Resource: "maintenancewindows", Verbs: []string{"get", "list", "watch"}},
+}
+
+// MissingPermissionsError lists the permissions the operator wasn't granted.
+type MissingPermissionsError struct {
+	Missing []string
+}
+
+func (e *MissingPermissionsError) Error() string {
+	return fmt.Sprintf("the operator's ServiceAccount is missing permissions, check the my-app-controller ClusterRole: %s", strings.Join(e.Missing, ", "))
+}
+
+// Check asks the API server, with a SelfSubjectAccessReview per verb, whether the client's
+// identity was granted rules. It returns a *MissingPermissionsError listing the permissions
+// that are denied.
+func Check(ctx context.Context, c client.Client, rules []Rule) error {
+	var missing []string
+	for _, rule := range rules {
+		for _, verb := range rule.Verbs {
+			review := &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Group:       rule.Group,
+						Resource:    rule.Resource,
+						Subresource: rule.Subresource,
+						Verb:        verb,
+					},
+				},
+			}
+			if err := c.Create(ctx, review); err != nil {
+				return fmt.Errorf("checking the operator's permissions: %w", err)
+			}
+			if !review.Status.Allowed {
+				missing = append(missing, fmt.Sprintf("%s %s", verb, rule.resource()))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingPermissionsError{Missing: missing}
+	}
+	return nil
+}
+
+// resource returns the resource in the group/resource/subresource form of RBAC rules.
+func (r Rule) resource() string {
+	resource := r.Resource
+	if r.Subresource != "" {
+		resource += "/" + r.Subresource
+	}
+	if r.Group != "" {
+		resource = r.Group + "/" + resource
+	}
+	return resource
+}
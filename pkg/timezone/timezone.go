@@ -0,0 +1,52 @@
+// Package timezone looks time zones up in the IANA time zone database embedded in the binary,
+// so MyApps are validated the same whatever the operator's image ships.
+package timezone
+
+import (
+	"archive/zip"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"time"
+)
+
+// zoneinfo is the IANA time zone database of the Go distribution, as in $GOROOT/lib/time.
+//
+//go:generate sh -c "cp \"$(go env GOROOT)/lib/time/zoneinfo.zip\" zoneinfo.zip"
+//go:embed zoneinfo.zip
+var zoneinfo []byte
+
+// TZif returns the TZif file of the time zone name, e.g. Europe/Paris, the contents of
+// /etc/localtime for it.
+func TZif(name string) ([]byte, error) {
+	r, err := zip.NewReader(bytes.NewReader(zoneinfo), int64(len(zoneinfo)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range r.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := time.LoadLocationFromTZData(name, data); err != nil {
+			return nil, fmt.Errorf("time zone %s: %w", name, err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("unknown time zone %q", name)
+}
+
+// Validate returns an error when name isn't a time zone of the database.
+func Validate(name string) error {
+	_, err := TZif(name)
+	return err
+}
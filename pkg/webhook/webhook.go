@@ -0,0 +1,258 @@
+// Package webhook serves the MyApp validating admission webhook.
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	"github.com/steeling/controller-runtime-exercise/pkg/timezone"
+	corev1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:path=/validate-example-com-v1alpha1-myapp,mutating=false,failurePolicy=ignore,sideEffects=None,groups=example.com,resources=myapps,verbs=create;update,versions=v1alpha1,name=myapps.example.com,admissionReviewVersions=v1,timeoutSeconds=5
+
+// SetupWithManager registers v as the MyApp validating webhook with manager's webhook server.
+func SetupWithManager(manager ctrl.Manager, v *Validator) error {
+	return ctrl.NewWebhookManagedBy(manager).For(&api.MyApp{}).WithValidator(v).Complete()
+}
+
+// Validator admits MyApps. It denies MyApps whose replicas are out of the operator's bounds,
+// Windows MyApps setting Linux-only security context fields, MyApps requesting a
+// RuntimeClass that doesn't exist, MyApps using the host's namespaces where they aren't
+// permitted, MyApps in unknown time zones and changes of the workload type, and returns
+// warnings for deprecated fields and for defaults that change in the next API version, so
+// users see the migration guidance in kubectl's output, and for MyApps running a single pod.
+type Validator struct {
+	// MinReplicas and MaxReplicas bound the replicas of a MyApp, including the range it
+	// autoscales in. MaxReplicas is unbounded when 0.
+	MinReplicas int32
+	MaxReplicas int32
+	// Reader reads RuntimeClasses and Namespaces. They aren't checked when nil.
+	Reader client.Reader
+	// AllowHostNamespaces permits the MyApps in namespaces labeled with
+	// api.AllowHostNamespacesLabel to set Spec.HostNetwork and Spec.HostPID.
+	AllowHostNamespaces bool
+}
+
+var _ admission.CustomValidator = &Validator{}
+
+func (v *Validator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	app, ok := obj.(*api.MyApp)
+	if !ok {
+		return nil, fmt.Errorf("expected a MyApp, got %T", obj)
+	}
+	return warnings(app), errors.Join(v.validateReplicas(app), validateOS(app), validateTimezone(app), v.validateRuntimeClass(ctx, app), v.validateHostNamespaces(ctx, app))
+}
+
+func (v *Validator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	app, ok := newObj.(*api.MyApp)
+	if !ok {
+		return nil, fmt.Errorf("expected a MyApp, got %T", newObj)
+	}
+	errs := []error{v.validateReplicas(app), validateOS(app), validateTimezone(app)}
+	// A RuntimeClass deleted, or a namespace label removed, since doesn't block unrelated
+	// updates, like removing finalizers; the controller reports them.
+	old, ok := oldObj.(*api.MyApp)
+	if !ok || old.Spec.RuntimeClassName != app.Spec.RuntimeClassName {
+		errs = append(errs, v.validateRuntimeClass(ctx, app))
+	}
+	if !ok || old.Spec.HostNetwork != app.Spec.HostNetwork || old.Spec.HostPID != app.Spec.HostPID {
+		errs = append(errs, v.validateHostNamespaces(ctx, app))
+	}
+	if ok {
+		errs = append(errs, validateWorkloadType(old, app))
+	}
+	return warnings(app), errors.Join(errs...)
+}
+
+func (v *Validator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// deprecation warns about a pattern of the spec that behaves differently in the next API version.
+type deprecation struct {
+	applies func(spec *api.MyAppSpec) bool
+	message string
+}
+
+var deprecations = []deprecation{
+	{
+		applies: func(spec *api.MyAppSpec) bool { return spec.Replicas != nil && spec.Autoscaling != nil },
+		message: "spec.replicas is ignored when spec.autoscaling is set and will be rejected in the next API version; remove spec.replicas",
+	},
+	{
+		applies: func(spec *api.MyAppSpec) bool {
+			return spec.Resources == nil && spec.TemplateRef == nil && !sized(spec)
+		},
+		message: "spec.resources is unset: the built-in default of 100m CPU and 128Mi memory requests is removed in the next API version; set spec.resources or spec.size, or reference a MyAppTemplate with spec.templateRef",
+	},
+	{
+		applies: func(spec *api.MyAppSpec) bool { return spec.CriticalityTier != "" && spec.Tier == "" },
+		message: "spec.criticalityTier is deprecated and will be removed in the next API version; set spec.tier instead; criticalityTier high is treated as tier critical, including the tier's PodDisruptionBudget, priority class and anti-affinity defaults",
+	},
+	{
+		applies: func(spec *api.MyAppSpec) bool { return spec.CriticalityTier != "" && spec.Tier != "" },
+		message: "spec.criticalityTier is deprecated and ignored as spec.tier is set; remove spec.criticalityTier",
+	},
+}
+
+// validateReplicas denies replicas out of bounds. An unset Spec.Replicas defaults to 1,
+// which the controller raises to MinReplicas.
+func (v *Validator) validateReplicas(app *api.MyApp) error {
+	check := func(field string, n int32) error {
+		if n < v.MinReplicas || (v.MaxReplicas > 0 && n > v.MaxReplicas) {
+			return fmt.Errorf("%s must be within %s, got %d", field, v.bounds(), n)
+		}
+		return nil
+	}
+	var errs []error
+	if app.Spec.Replicas != nil {
+		errs = append(errs, check("spec.replicas", *app.Spec.Replicas))
+	}
+	if as := app.Spec.Autoscaling; as != nil {
+		if as.MinReplicas != nil {
+			errs = append(errs, check("spec.autoscaling.minReplicas", *as.MinReplicas))
+		}
+		errs = append(errs, check("spec.autoscaling.maxReplicas", as.MaxReplicas))
+	}
+	return errors.Join(errs...)
+}
+
+// linuxOnlyFields returns the fields of sc Windows containers don't support.
+func linuxOnlyFields(sc *corev1.SecurityContext) []string {
+	var fields []string
+	for name, set := range map[string]bool{
+		"seLinuxOptions":           sc.SELinuxOptions != nil,
+		"seccompProfile":           sc.SeccompProfile != nil,
+		"appArmorProfile":          sc.AppArmorProfile != nil,
+		"capabilities":             sc.Capabilities != nil,
+		"readOnlyRootFilesystem":   sc.ReadOnlyRootFilesystem != nil,
+		"privileged":               sc.Privileged != nil,
+		"allowPrivilegeEscalation": sc.AllowPrivilegeEscalation != nil,
+		"procMount":                sc.ProcMount != nil,
+		"runAsUser":                sc.RunAsUser != nil,
+		"runAsGroup":               sc.RunAsGroup != nil,
+	} {
+		if set {
+			fields = append(fields, "spec.securityContext."+name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// validateOS denies Linux-only security context fields on Windows MyApps. The ones inherited
+// from a template are dropped by the controller instead.
+func validateOS(app *api.MyApp) error {
+	if app.Spec.OS != string(corev1.Windows) || app.Spec.SecurityContext == nil {
+		return nil
+	}
+	if fields := linuxOnlyFields(app.Spec.SecurityContext); len(fields) > 0 {
+		return fmt.Errorf("%s not supported on windows; use spec.securityContext.windowsOptions, or runAsNonRoot to run as ContainerUser", strings.Join(fields, ", "))
+	}
+	return nil
+}
+
+// validateTimezone denies time zones missing from the database embedded in the operator,
+// which the controller mounts them from.
+func validateTimezone(app *api.MyApp) error {
+	if app.Spec.Timezone == nil {
+		return nil
+	}
+	if err := timezone.Validate(app.Spec.Timezone.Name); err != nil {
+		return fmt.Errorf("spec.timezone.name: %w", err)
+	}
+	return nil
+}
+
+// validateWorkloadType denies changing the workload type of a MyApp, which would replace its
+// running pods at once. MyApps admitted while the webhook was unavailable have their children
+// of the old kind pruned by the controller.
+func validateWorkloadType(old, app *api.MyApp) error {
+	from, to := workloadType(&old.Spec), workloadType(&app.Spec)
+	if from == to {
+		return nil
+	}
+	return fmt.Errorf("spec.workloadType is immutable, changing it from %s to %s would delete the running %s; "+
+		"to migrate, create a MyApp of another name with workloadType %s and delete this one once it runs, "+
+		"or recreate this one with `kubectl replace --force`", from, to, from, to)
+}
+
+// workloadType returns the workload type of spec, defaulting to Deployment.
+func workloadType(spec *api.MyAppSpec) string {
+	if spec.WorkloadType == "" {
+		return api.WorkloadDeployment
+	}
+	return spec.WorkloadType
+}
+
+// validateRuntimeClass denies MyApps whose RuntimeClass doesn't exist.
+func (v *Validator) validateRuntimeClass(ctx context.Context, app *api.MyApp) error {
+	if v.Reader == nil || app.Spec.RuntimeClassName == "" {
+		return nil
+	}
+	err := v.Reader.Get(ctx, client.ObjectKey{Name: app.Spec.RuntimeClassName}, &nodev1.RuntimeClass{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("spec.runtimeClassName: RuntimeClass %s not found", app.Spec.RuntimeClassName)
+	}
+	// Other errors admit the MyApp, as the webhook's failure policy does.
+	return nil
+}
+
+// validateHostNamespaces denies MyApps using the host's network or PID namespace unless the
+// operator allows them and their namespace is labeled with api.AllowHostNamespacesLabel.
+func (v *Validator) validateHostNamespaces(ctx context.Context, app *api.MyApp) error {
+	if !app.Spec.HostNetwork && !app.Spec.HostPID {
+		return nil
+	}
+	if !v.AllowHostNamespaces {
+		return fmt.Errorf("spec.hostNetwork and spec.hostPID are disabled by the operator")
+	}
+	if v.Reader == nil {
+		return nil
+	}
+	ns := &corev1.Namespace{}
+	if err := v.Reader.Get(ctx, client.ObjectKey{Name: app.Namespace}, ns); err != nil {
+		return fmt.Errorf("reading namespace %s: %w", app.Namespace, err)
+	}
+	if ns.Labels[api.AllowHostNamespacesLabel] != "true" {
+		return fmt.Errorf("spec.hostNetwork and spec.hostPID require the %s=true label on namespace %s", api.AllowHostNamespacesLabel, ns.Name)
+	}
+	return nil
+}
+
+func (v *Validator) bounds() string {
+	if v.MaxReplicas == 0 {
+		return fmt.Sprintf("[%d, unbounded)", v.MinReplicas)
+	}
+	return fmt.Sprintf("[%d, %d]", v.MinReplicas, v.MaxReplicas)
+}
+
+func warnings(app *api.MyApp) admission.Warnings {
+	var warnings admission.Warnings
+	for _, d := range deprecations {
+		if d.applies(&app.Spec) {
+			warnings = append(warnings, d.message)
+		}
+	}
+	// The replicas of a size are configured on the operator, they aren't known here.
+	if spec := app.Spec; spec.Autoscaling == nil && (spec.Replicas == nil && !sized(&spec) || spec.Replicas != nil && *spec.Replicas == 1) {
+		warnings = append(warnings, "spec.replicas is 1 or unset: the MyApp is unavailable whenever its pod is evicted, e.g. while its node is drained, as the generated PodDisruptionBudget allows evicting it; set spec.replicas to 2 or more")
+	}
+	return warnings
+}
+
+// sized reports whether spec's size expands into a profile.
+func sized(spec *api.MyAppSpec) bool {
+	return spec.Size != "" && spec.Size != api.SizeCustom
+}
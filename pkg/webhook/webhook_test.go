@@ -0,0 +1,349 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/steeling/controller-runtime-exercise/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestDeprecationWarnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    api.MyAppSpec
+		warning string
+		want    bool
+	}{
+		{
+			name:    "replicas with autoscaling",
+			spec:    api.MyAppSpec{Replicas: int32Ptr(3), Autoscaling: &api.AutoscalingSpec{MaxReplicas: 5}},
+			warning: "spec.replicas is ignored when spec.autoscaling is set",
+			want:    true,
+		},
+		{
+			name:    "replicas without autoscaling",
+			spec:    api.MyAppSpec{Replicas: int32Ptr(3)},
+			warning: "spec.replicas is ignored when spec.autoscaling is set",
+		},
+		{
+			name:    "default resources",
+			spec:    api.MyAppSpec{},
+			warning: "spec.resources is unset",
+			want:    true,
+		},
+		{
+			name:    "resources",
+			spec:    api.MyAppSpec{Resources: &corev1.ResourceRequirements{}},
+			warning: "spec.resources is unset",
+		},
+		{
+			name:    "template",
+			spec:    api.MyAppSpec{TemplateRef: &api.TemplateRef{Name: "web"}},
+			warning: "spec.resources is unset",
+		},
+		{
+			name:    "size",
+			spec:    api.MyAppSpec{Size: "small"},
+			warning: "spec.resources is unset",
+		},
+		{
+			name:    "custom size",
+			spec:    api.MyAppSpec{Size: api.SizeCustom},
+			warning: "spec.resources is unset",
+			want:    true,
+		},
+		{
+			name:    "criticalityTier",
+			spec:    api.MyAppSpec{CriticalityTier: "high"},
+			warning: "spec.criticalityTier is deprecated and will be removed in the next API version; set spec.tier instead",
+			want:    true,
+		},
+		{
+			name:    "criticalityTier with tier",
+			spec:    api.MyAppSpec{CriticalityTier: "high", Tier: "critical"},
+			warning: "spec.criticalityTier is deprecated and ignored as spec.tier is set",
+			want:    true,
+		},
+		{
+			name:    "tier",
+			spec:    api.MyAppSpec{Tier: "critical"},
+			warning: "spec.criticalityTier",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, _ := (&Validator{}).ValidateCreate(context.Background(), newApp(tt.spec))
+			if got := hasWarning(warnings, tt.warning); got != tt.want {
+				t.Errorf("warnings %q contain %q: %v, want %v", warnings, tt.warning, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSingleReplicaWarning(t *testing.T) {
+	tests := []struct {
+		name string
+		spec api.MyAppSpec
+		want bool
+	}{
+		{name: "unset", spec: api.MyAppSpec{}, want: true},
+		{name: "single replica", spec: api.MyAppSpec{Replicas: int32Ptr(1)}, want: true},
+		{name: "replicas", spec: api.MyAppSpec{Replicas: int32Ptr(3)}},
+		{name: "autoscaling", spec: api.MyAppSpec{Autoscaling: &api.AutoscalingSpec{MaxReplicas: 5}}},
+		{name: "size", spec: api.MyAppSpec{Size: "small"}},
+		{name: "size with a single replica", spec: api.MyAppSpec{Size: "small", Replicas: int32Ptr(1)}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, _ := (&Validator{}).ValidateCreate(context.Background(), newApp(tt.spec))
+			if got := hasWarning(warnings, "spec.replicas is 1 or unset"); got != tt.want {
+				t.Errorf("warnings %q warn about a single replica: %v, want %v", warnings, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReplicas(t *testing.T) {
+	tests := []struct {
+		name string
+		v    Validator
+		spec api.MyAppSpec
+		// wantErr is a substring of the error, empty when the MyApp is admitted.
+		wantErr string
+	}{
+		{name: "within bounds", v: Validator{MinReplicas: 2, MaxReplicas: 10}, spec: api.MyAppSpec{Replicas: int32Ptr(3)}},
+		{name: "unset", v: Validator{MinReplicas: 2, MaxReplicas: 10}},
+		{name: "unbounded", v: Validator{MinReplicas: 1}, spec: api.MyAppSpec{Replicas: int32Ptr(100)}},
+		{name: "too few", v: Validator{MinReplicas: 2, MaxReplicas: 10}, spec: api.MyAppSpec{Replicas: int32Ptr(1)}, wantErr: "spec.replicas must be within [2, 10], got 1"},
+		{name: "too many", v: Validator{MinReplicas: 2, MaxReplicas: 10}, spec: api.MyAppSpec{Replicas: int32Ptr(11)}, wantErr: "spec.replicas must be within [2, 10], got 11"},
+		{name: "too few unbounded", v: Validator{MinReplicas: 2}, spec: api.MyAppSpec{Replicas: int32Ptr(1)}, wantErr: "spec.replicas must be within [2, unbounded), got 1"},
+		{
+			name:    "autoscaling out of bounds",
+			v:       Validator{MinReplicas: 2, MaxReplicas: 10},
+			spec:    api.MyAppSpec{Autoscaling: &api.AutoscalingSpec{MinReplicas: int32Ptr(1), MaxReplicas: 20}},
+			wantErr: "spec.autoscaling.minReplicas must be within [2, 10], got 1\nspec.autoscaling.maxReplicas must be within [2, 10], got 20",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.v.ValidateCreate(context.Background(), newApp(tt.spec))
+			checkErr(t, err, tt.wantErr)
+			_, err = tt.v.ValidateUpdate(context.Background(), newApp(tt.spec), newApp(tt.spec))
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateOS(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    api.MyAppSpec
+		wantErr string
+	}{
+		{name: "Linux", spec: api.MyAppSpec{SecurityContext: &corev1.SecurityContext{Privileged: boolPtr(false)}}},
+		{name: "Windows", spec: api.MyAppSpec{OS: "windows", SecurityContext: &corev1.SecurityContext{RunAsNonRoot: boolPtr(true)}}},
+		{name: "Windows without a security context", spec: api.MyAppSpec{OS: "windows"}},
+		{
+			name:    "Linux-only fields on Windows",
+			spec:    api.MyAppSpec{OS: "windows", SecurityContext: &corev1.SecurityContext{Privileged: boolPtr(false), RunAsUser: new(int64)}},
+			wantErr: "spec.securityContext.privileged, spec.securityContext.runAsUser not supported on windows",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&Validator{}).ValidateCreate(context.Background(), newApp(tt.spec))
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateRuntimeClass(t *testing.T) {
+	reader := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(
+		&nodev1.RuntimeClass{ObjectMeta: metav1.ObjectMeta{Name: "gvisor"}, Handler: "runsc"},
+	).Build()
+	v := &Validator{Reader: reader}
+	tests := []struct {
+		name string
+		// old is the MyApp updated, nil on create.
+		old     *api.MyApp
+		app     *api.MyApp
+		wantErr string
+	}{
+		{name: "unset", app: newApp(api.MyAppSpec{})},
+		{name: "existing", app: newApp(api.MyAppSpec{RuntimeClassName: "gvisor"})},
+		{name: "missing", app: newApp(api.MyAppSpec{RuntimeClassName: "kata"}), wantErr: "spec.runtimeClassName: RuntimeClass kata not found"},
+		{
+			name:    "changed to a missing one",
+			old:     newApp(api.MyAppSpec{RuntimeClassName: "gvisor"}),
+			app:     newApp(api.MyAppSpec{RuntimeClassName: "kata"}),
+			wantErr: "RuntimeClass kata not found",
+		},
+		{
+			name: "deleted since",
+			old:  newApp(api.MyAppSpec{RuntimeClassName: "kata"}),
+			app:  newApp(api.MyAppSpec{RuntimeClassName: "kata", Image: "web:1.3"}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.old == nil {
+				_, err = v.ValidateCreate(context.Background(), tt.app)
+			} else {
+				_, err = v.ValidateUpdate(context.Background(), tt.old, tt.app)
+			}
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateHostNamespaces(t *testing.T) {
+	reader := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "infra", Labels: map[string]string{api.AllowHostNamespacesLabel: "true"}}},
+	).Build()
+	inInfra := func(spec api.MyAppSpec) *api.MyApp {
+		app := newApp(spec)
+		app.Namespace = "infra"
+		return app
+	}
+	tests := []struct {
+		name    string
+		v       Validator
+		old     *api.MyApp
+		app     *api.MyApp
+		wantErr string
+	}{
+		{name: "not using them", app: newApp(api.MyAppSpec{})},
+		{name: "disabled", app: inInfra(api.MyAppSpec{HostNetwork: true}), wantErr: "spec.hostNetwork and spec.hostPID are disabled by the operator"},
+		{name: "labeled namespace", v: Validator{AllowHostNamespaces: true, Reader: reader}, app: inInfra(api.MyAppSpec{HostPID: true})},
+		{
+			name:    "unlabeled namespace",
+			v:       Validator{AllowHostNamespaces: true, Reader: reader},
+			app:     newApp(api.MyAppSpec{HostNetwork: true}),
+			wantErr: "spec.hostNetwork and spec.hostPID require the " + api.AllowHostNamespacesLabel + "=true label on namespace ns",
+		},
+		{name: "without a reader", v: Validator{AllowHostNamespaces: true}, app: newApp(api.MyAppSpec{HostNetwork: true})},
+		{
+			name: "label removed since",
+			v:    Validator{AllowHostNamespaces: true, Reader: reader},
+			old:  newApp(api.MyAppSpec{HostNetwork: true}),
+			app:  newApp(api.MyAppSpec{HostNetwork: true, Image: "web:1.3"}),
+		},
+		{
+			name:    "enabled in an unlabeled namespace",
+			v:       Validator{AllowHostNamespaces: true, Reader: reader},
+			old:     newApp(api.MyAppSpec{HostNetwork: true}),
+			app:     newApp(api.MyAppSpec{HostNetwork: true, HostPID: true}),
+			wantErr: "require the " + api.AllowHostNamespacesLabel + "=true label",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.old == nil {
+				_, err = tt.v.ValidateCreate(context.Background(), tt.app)
+			} else {
+				_, err = tt.v.ValidateUpdate(context.Background(), tt.old, tt.app)
+			}
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateTimezone(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    api.MyAppSpec
+		wantErr string
+	}{
+		{name: "unset", spec: api.MyAppSpec{}},
+		{name: "known", spec: api.MyAppSpec{Timezone: &api.TimezoneSpec{Name: "Europe/Paris"}}},
+		{name: "unknown", spec: api.MyAppSpec{Timezone: &api.TimezoneSpec{Name: "Mars/Olympus_Mons"}}, wantErr: "spec.timezone.name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&Validator{}).ValidateCreate(context.Background(), newApp(tt.spec))
+			checkErr(t, err, tt.wantErr)
+			_, err = (&Validator{}).ValidateUpdate(context.Background(), newApp(api.MyAppSpec{}), newApp(tt.spec))
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateWorkloadType(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, app *api.MyApp
+		wantErr  string
+	}{
+		{name: "unchanged", old: newApp(api.MyAppSpec{WorkloadType: api.WorkloadJob}), app: newApp(api.MyAppSpec{WorkloadType: api.WorkloadJob, Image: "web:1.3"})},
+		{name: "defaulted", old: newApp(api.MyAppSpec{}), app: newApp(api.MyAppSpec{WorkloadType: api.WorkloadDeployment})},
+		{
+			name:    "changed",
+			old:     newApp(api.MyAppSpec{}),
+			app:     newApp(api.MyAppSpec{WorkloadType: api.WorkloadCronJob}),
+			wantErr: "spec.workloadType is immutable, changing it from Deployment to CronJob",
+		},
+		{
+			name:    "unset",
+			old:     newApp(api.MyAppSpec{WorkloadType: api.WorkloadJob}),
+			app:     newApp(api.MyAppSpec{}),
+			wantErr: "changing it from Job to Deployment",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&Validator{}).ValidateUpdate(context.Background(), tt.old, tt.app)
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateOtherObjects(t *testing.T) {
+	v := &Validator{}
+	if _, err := v.ValidateCreate(context.Background(), &runtime.Unknown{}); err == nil {
+		t.Error("ValidateCreate() of an object other than a MyApp succeeded")
+	}
+	if _, err := v.ValidateUpdate(context.Background(), &api.MyApp{}, &runtime.Unknown{}); err == nil {
+		t.Error("ValidateUpdate() of an object other than a MyApp succeeded")
+	}
+}
+
+func newApp(spec api.MyAppSpec) *api.MyApp {
+	return &api.MyApp{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"}, Spec: spec}
+}
+
+func int32Ptr(n int32) *int32 { return &n }
+
+// hasWarning reports whether one of warnings contains message.
+func hasWarning(warnings admission.Warnings, message string) bool {
+	for _, w := range warnings {
+		if strings.Contains(w, message) {
+			return true
+		}
+	}
+	return false
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func checkErr(t *testing.T, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Errorf("unexpected error: %v", err)
+	case want != "" && err == nil:
+		t.Errorf("no error, want %q", want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Errorf("error %q doesn't contain %q", err, want)
+	}
+}